@@ -3,11 +3,42 @@ package ast
 import (
 	"bytes"
 	"encoding/json"
+	"reflect"
+	"strings"
+	"text/scanner"
+	"unicode"
 )
 
 type Node interface {
 	TokenLiteral() string
 	String() string
+	// Pos returns the position of the first character of the node.
+	Pos() scanner.Position
+	// End returns the position immediately after the node.
+	End() scanner.Position
+}
+
+// Kind describes the kind of a node in lower case for use in messages, e.g.
+// "for statement" for a *ForStatement.
+func Kind(node Node) string {
+	t := reflect.TypeOf(node)
+	if t == nil {
+		return "nil"
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var out strings.Builder
+	for i, r := range t.Name() {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				out.WriteByte(' ')
+			}
+			r = unicode.ToLower(r)
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
 }
 
 type Statement interface {
@@ -31,6 +62,20 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+func (p *Program) Pos() scanner.Position {
+	if len(p.Files) == 0 {
+		return scanner.Position{}
+	}
+	return p.Files[0].Pos()
+}
+
+func (p *Program) End() scanner.Position {
+	if len(p.Files) == 0 {
+		return scanner.Position{}
+	}
+	return p.Files[len(p.Files)-1].End()
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 	for _, f := range p.Files {
@@ -64,8 +109,11 @@ func (p *Program) JSONPretty() (string, error) {
 type File struct {
 	Filename    string
 	PackageName string
-	Imports     []string
-	Statements  []Statement
+	// ImportPath is the path other packages import the file's package by. It
+	// is empty for the package a program is loaded from.
+	ImportPath string
+	Imports    []*Import
+	Statements []Statement
 }
 
 func (f *File) statementNode() {}
@@ -77,13 +125,26 @@ func (f *File) TokenLiteral() string {
 	return ""
 }
 
+// Pos returns the start of the file.
+func (f *File) Pos() scanner.Position {
+	return scanner.Position{Filename: f.Filename, Offset: 0, Line: 1, Column: 1}
+}
+
+// End returns the end of the last statement in the file.
+func (f *File) End() scanner.Position {
+	if len(f.Statements) == 0 {
+		return f.Pos()
+	}
+	return endOf(f.Statements[len(f.Statements)-1])
+}
+
 func (f *File) String() string {
 	var out bytes.Buffer
 	out.WriteString("package " + f.PackageName + "\n\n")
 	if len(f.Imports) > 0 {
 		out.WriteString("import (\n")
 		for _, imp := range f.Imports {
-			out.WriteString("\t\"" + imp + "\"\n")
+			out.WriteString("\t" + imp.String() + "\n")
 		}
 		out.WriteString(")\n\n")
 	}
@@ -0,0 +1,76 @@
+package ast
+
+import (
+	"bytes"
+	"text/scanner"
+
+	"github.com/dfirebaugh/punch/token"
+)
+
+type EnumVariant struct {
+	Name  *Identifier
+	Value Expression // explicit value, nil if the value is implicit
+}
+
+func (ev *EnumVariant) TokenLiteral() string {
+	return ev.Name.TokenLiteral()
+}
+
+func (ev *EnumVariant) Pos() scanner.Position { return ev.Name.Pos() }
+
+func (ev *EnumVariant) End() scanner.Position {
+	if isNil(ev.Value) {
+		return ev.Name.End()
+	}
+	return ev.Value.End()
+}
+
+func (ev *EnumVariant) String() string {
+	if ev.Value == nil {
+		return ev.Name.String()
+	}
+	return ev.Name.String() + " = " + ev.Value.String()
+}
+
+type EnumDefinition struct {
+	Token    token.Token // the 'enum' token
+	Name     *Identifier
+	Variants []*EnumVariant
+	Rbrace   token.Token
+}
+
+func (ed *EnumDefinition) statementNode() {}
+
+func (ed *EnumDefinition) TokenLiteral() string {
+	return ed.Token.Literal
+}
+
+func (ed *EnumDefinition) Pos() scanner.Position { return ed.Token.Position }
+
+func (ed *EnumDefinition) End() scanner.Position {
+	if ed.Rbrace.Position.IsValid() {
+		return TokenEnd(ed.Rbrace)
+	}
+	if len(ed.Variants) > 0 {
+		return ed.Variants[len(ed.Variants)-1].End()
+	}
+	return ed.Name.End()
+}
+
+func (ed *EnumDefinition) String() string {
+	var out bytes.Buffer
+	out.WriteString(ed.TokenLiteral() + " ")
+	if ed.Name != nil {
+		out.WriteString(ed.Name.String())
+	}
+	out.WriteString(" {")
+	for i, variant := range ed.Variants {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		out.WriteString(" ")
+		out.WriteString(variant.String())
+	}
+	out.WriteString(" }")
+	return out.String()
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"strings"
+	"text/scanner"
 
 	"github.com/dfirebaugh/punch/token"
 )
@@ -22,6 +23,20 @@ func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i *Identifier) Pos() scanner.Position {
+	if i == nil {
+		return scanner.Position{}
+	}
+	return i.Token.Position
+}
+
+func (i *Identifier) End() scanner.Position {
+	if i == nil {
+		return scanner.Position{}
+	}
+	return TokenEnd(i.Token)
+}
+
 func (i *Identifier) String() string {
 	if i == nil {
 		return ""
@@ -44,6 +59,10 @@ func (be *BinaryExpression) TokenLiteral() string {
 	return be.Operator.Literal
 }
 
+func (be *BinaryExpression) Pos() scanner.Position { return startOf(be.Left) }
+
+func (be *BinaryExpression) End() scanner.Position { return endOf(be.Right) }
+
 func (be *BinaryExpression) String() string {
 	if be == nil {
 		return ""
@@ -66,6 +85,10 @@ func (w *WhileExpression) TokenLiteral() string {
 	return "while"
 }
 
+func (w *WhileExpression) Pos() scanner.Position { return startOf(w.Condition) }
+
+func (w *WhileExpression) End() scanner.Position { return endOf(w.Body) }
+
 func (w *WhileExpression) String() string {
 	if w == nil {
 		return ""
@@ -93,6 +116,15 @@ func (c *CallExpression) TokenLiteral() string {
 	return "call"
 }
 
+func (c *CallExpression) Pos() scanner.Position { return startOf(c.Function) }
+
+func (c *CallExpression) End() scanner.Position {
+	if len(c.Arguments) > 0 {
+		return endOf(c.Arguments[len(c.Arguments)-1])
+	}
+	return endOf(c.Function)
+}
+
 func (c *CallExpression) String() string {
 	if c == nil || c.Function == nil {
 		return ""
@@ -118,10 +150,19 @@ type PrefixExpression struct {
 func (pe *PrefixExpression) expressionNode() {}
 
 func (pe *PrefixExpression) TokenLiteral() string {
-	if pe == nil || pe.Token.Type == token.EOF {
+	if pe == nil {
 		return ""
 	}
-	return pe.TokenLiteral()
+	return pe.Operator.Literal
+}
+
+func (pe *PrefixExpression) Pos() scanner.Position { return pe.Operator.Position }
+
+func (pe *PrefixExpression) End() scanner.Position {
+	if isNil(pe.Right) {
+		return TokenEnd(pe.Operator)
+	}
+	return pe.Right.End()
 }
 
 func (pe *PrefixExpression) String() string {
@@ -145,6 +186,15 @@ func (ie *InfixExpression) expressionNode() {}
 
 func (ie *InfixExpression) TokenLiteral() string { return ie.Operator.Literal }
 
+func (ie *InfixExpression) Pos() scanner.Position { return startOf(ie.Left) }
+
+func (ie *InfixExpression) End() scanner.Position {
+	if isNil(ie.Right) {
+		return TokenEnd(ie.Operator)
+	}
+	return ie.Right.End()
+}
+
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -164,6 +214,10 @@ func (b *Boolean) expressionNode() {}
 
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
 
+func (b *Boolean) Pos() scanner.Position { return b.Token.Position }
+
+func (b *Boolean) End() scanner.Position { return TokenEnd(b.Token) }
+
 func (b *Boolean) String() string { return b.Token.Literal }
 
 type Integer struct {
@@ -180,6 +234,10 @@ func (i *Integer) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i *Integer) Pos() scanner.Position { return i.Token.Position }
+
+func (i *Integer) End() scanner.Position { return TokenEnd(i.Token) }
+
 func (i *Integer) String() string {
 	if i == nil {
 		return ""
@@ -199,6 +257,15 @@ func (ae *AssignmentExpression) TokenLiteral() string {
 	return ae.Token.Literal
 }
 
+func (ae *AssignmentExpression) Pos() scanner.Position { return startOf(ae.Left) }
+
+func (ae *AssignmentExpression) End() scanner.Position {
+	if isNil(ae.Right) {
+		return TokenEnd(ae.Token)
+	}
+	return ae.Right.End()
+}
+
 func (ae *AssignmentExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString(ae.Left.String())
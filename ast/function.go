@@ -3,6 +3,7 @@ package ast
 import (
 	"bytes"
 	"strings"
+	"text/scanner"
 
 	"github.com/dfirebaugh/punch/token"
 )
@@ -30,6 +31,15 @@ func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
 
+func (rs *ReturnStatement) Pos() scanner.Position { return rs.Token.Position }
+
+func (rs *ReturnStatement) End() scanner.Position {
+	if len(rs.ReturnValues) > 0 {
+		return endOf(rs.ReturnValues[len(rs.ReturnValues)-1])
+	}
+	return TokenEnd(rs.Token)
+}
+
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -46,23 +56,44 @@ func (rs *ReturnStatement) String() string {
 }
 
 type FunctionStatement struct {
+	Token      token.Token // the 'pub', 'fn' or return type token
 	IsExported bool
+	Receiver   *Parameter // the struct a method is attached to, nil for functions
 	Name       *Identifier
 	Parameters []*Parameter
 	Body       *BlockStatement
-	ReturnType *Identifier
+	// ReturnTypes holds the types of the values the function returns,
+	// e.g. two for `(i32, bool) add_eq(i32 a, i32 b)`
+	ReturnTypes []*Identifier
 }
 
 func (f *FunctionStatement) expressionNode() {}
 func (f *FunctionStatement) statementNode()  {}
 
 func (f *FunctionStatement) TokenLiteral() string {
-	if f.ReturnType != nil {
-		return f.ReturnType.TokenLiteral()
+	if len(f.ReturnTypes) > 0 {
+		return f.ReturnTypes[0].TokenLiteral()
 	}
 	return ""
 }
 
+func (f *FunctionStatement) Pos() scanner.Position {
+	if f.Token.Position.IsValid() {
+		return f.Token.Position
+	}
+	if len(f.ReturnTypes) > 0 {
+		return f.ReturnTypes[0].Pos()
+	}
+	return f.Name.Pos()
+}
+
+func (f *FunctionStatement) End() scanner.Position {
+	if f.Body != nil {
+		return f.Body.End()
+	}
+	return f.Name.End()
+}
+
 func (f *FunctionStatement) String() string {
 	if f == nil {
 		return ""
@@ -81,8 +112,19 @@ func (f *FunctionStatement) String() string {
 	}
 
 	var out bytes.Buffer
-	if f.ReturnType != nil {
-		out.WriteString(f.ReturnType.String() + " ")
+	switch len(f.ReturnTypes) {
+	case 0:
+	case 1:
+		out.WriteString(f.ReturnTypes[0].String() + " ")
+	default:
+		results := make([]string, len(f.ReturnTypes))
+		for i, r := range f.ReturnTypes {
+			results[i] = r.String()
+		}
+		out.WriteString("(" + strings.Join(results, ", ") + ") ")
+	}
+	if f.Receiver != nil {
+		out.WriteString("(" + string(f.Receiver.Type) + " " + f.Receiver.String() + ") ")
 	}
 	if f.Name != nil {
 		out.WriteString(f.Name.String())
@@ -112,6 +154,20 @@ func (fd *FunctionDeclaration) TokenLiteral() string {
 	return ""
 }
 
+func (fd *FunctionDeclaration) Pos() scanner.Position {
+	if fd.ReturnType != nil {
+		return fd.ReturnType.Pos()
+	}
+	return fd.Name.Pos()
+}
+
+func (fd *FunctionDeclaration) End() scanner.Position {
+	if fd.Body != nil {
+		return fd.Body.End()
+	}
+	return fd.Name.End()
+}
+
 func (fd *FunctionDeclaration) String() string {
 	var out strings.Builder
 
@@ -141,6 +197,7 @@ type FunctionCall struct {
 	Token        token.Token
 	Function     Expression
 	Arguments    []Expression
+	Rparen       token.Token
 }
 
 func (f *FunctionCall) expressionNode() {}
@@ -152,6 +209,26 @@ func (f *FunctionCall) TokenLiteral() string {
 	return "function call"
 }
 
+func (f *FunctionCall) Pos() scanner.Position {
+	if isNil(f.Function) {
+		return f.Token.Position
+	}
+	return f.Function.Pos()
+}
+
+func (f *FunctionCall) End() scanner.Position {
+	if f.Rparen.Position.IsValid() {
+		return TokenEnd(f.Rparen)
+	}
+	if len(f.Arguments) > 0 {
+		return endOf(f.Arguments[len(f.Arguments)-1])
+	}
+	if isNil(f.Function) {
+		return TokenEnd(f.Token)
+	}
+	return f.Function.End()
+}
+
 func (f *FunctionCall) String() string {
 	if f == nil {
 		return ""
@@ -0,0 +1,26 @@
+package ast
+
+import (
+	"strconv"
+	"text/scanner"
+
+	"github.com/dfirebaugh/punch/token"
+)
+
+// Import is one path in a file's import clause.
+type Import struct {
+	Token token.Token // the path's string token
+	Path  string
+}
+
+func (i *Import) TokenLiteral() string {
+	return i.Token.Literal
+}
+
+func (i *Import) Pos() scanner.Position { return i.Token.Position }
+
+func (i *Import) End() scanner.Position { return TokenEnd(i.Token) }
+
+func (i *Import) String() string {
+	return strconv.Quote(i.Path)
+}
@@ -0,0 +1,93 @@
+package ast
+
+import (
+	"bytes"
+	"strings"
+	"text/scanner"
+
+	"github.com/dfirebaugh/punch/token"
+)
+
+// InterfaceMethod is a method signature listed in an interface.
+type InterfaceMethod struct {
+	Token      token.Token // the return type or 'fn' token
+	Name       *Identifier
+	Parameters []*Parameter
+	ReturnType *Identifier
+	Rparen     token.Token
+}
+
+func (im *InterfaceMethod) TokenLiteral() string {
+	return im.Token.Literal
+}
+
+func (im *InterfaceMethod) Pos() scanner.Position { return im.Token.Position }
+
+func (im *InterfaceMethod) End() scanner.Position {
+	if im.Rparen.Position.IsValid() {
+		return TokenEnd(im.Rparen)
+	}
+	return im.Name.End()
+}
+
+func (im *InterfaceMethod) String() string {
+	params := make([]string, len(im.Parameters))
+	for i, p := range im.Parameters {
+		params[i] = string(p.Type) + " " + p.String()
+	}
+
+	var out bytes.Buffer
+	if im.ReturnType != nil {
+		out.WriteString(im.ReturnType.String() + " ")
+	} else {
+		out.WriteString("fn ")
+	}
+	out.WriteString(im.Name.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(")")
+	return out.String()
+}
+
+type InterfaceDefinition struct {
+	Token   token.Token // the 'interface' token
+	Name    *Identifier
+	Methods []*InterfaceMethod
+	Rbrace  token.Token
+}
+
+func (id *InterfaceDefinition) statementNode() {}
+
+func (id *InterfaceDefinition) TokenLiteral() string {
+	return id.Token.Literal
+}
+
+func (id *InterfaceDefinition) Pos() scanner.Position { return id.Token.Position }
+
+func (id *InterfaceDefinition) End() scanner.Position {
+	if id.Rbrace.Position.IsValid() {
+		return TokenEnd(id.Rbrace)
+	}
+	if len(id.Methods) > 0 {
+		return id.Methods[len(id.Methods)-1].End()
+	}
+	return id.Name.End()
+}
+
+func (id *InterfaceDefinition) String() string {
+	var out bytes.Buffer
+	out.WriteString(id.TokenLiteral() + " ")
+	if id.Name != nil {
+		out.WriteString(id.Name.String())
+	}
+	out.WriteString(" {")
+	for _, method := range id.Methods {
+		out.WriteString("\n  ")
+		out.WriteString(method.String())
+	}
+	if len(id.Methods) > 0 {
+		out.WriteString("\n")
+	}
+	out.WriteString("}")
+	return out.String()
+}
@@ -0,0 +1,134 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// MarshalJSON encodes the program with the source span of every node so that
+// tools can map nodes back to the text they came from.
+func (p *Program) MarshalJSON() ([]byte, error) {
+	return json.Marshal(encodeNode(reflect.ValueOf(p)))
+}
+
+// MarshalJSON encodes the file with the source span of every node.
+func (f *File) MarshalJSON() ([]byte, error) {
+	return json.Marshal(encodeNode(reflect.ValueOf(f)))
+}
+
+// jsonObject is a JSON object that keeps its keys in the order they were
+// added, so nodes encode with the same field order as their struct.
+type jsonObject []jsonField
+
+type jsonField struct {
+	Key   string
+	Value interface{}
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteString("{")
+	for i, field := range o {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		key, err := json.Marshal(field.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.Value)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(key)
+		out.WriteString(":")
+		out.Write(value)
+	}
+	out.WriteString("}")
+	return out.Bytes(), nil
+}
+
+var nodeType = reflect.TypeOf((*Node)(nil)).Elem()
+
+// encodeNode walks the AST and converts it to values that encoding/json can
+// marshal. Structs from this package are encoded field by field, with Pos and
+// End added for every node.
+func encodeNode(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct && isASTType(v.Elem().Type()) {
+			return encodeStruct(v)
+		}
+		return encodeNode(v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		values := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			values[i] = encodeNode(v.Index(i))
+		}
+		return values
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		keys := make([]string, 0, v.Len())
+		values := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := fmt.Sprint(iter.Key().Interface())
+			keys = append(keys, key)
+			values[key] = encodeNode(iter.Value())
+		}
+		sort.Strings(keys)
+		obj := make(jsonObject, 0, len(keys))
+		for _, key := range keys {
+			obj = append(obj, jsonField{Key: key, Value: values[key]})
+		}
+		return obj
+	case reflect.Struct:
+		if isASTType(v.Type()) {
+			ptr := reflect.New(v.Type())
+			ptr.Elem().Set(v)
+			return encodeStruct(ptr)
+		}
+		return v.Interface()
+	case reflect.Invalid:
+		return nil
+	default:
+		return v.Interface()
+	}
+}
+
+// encodeStruct encodes a pointer to a struct from this package.
+func encodeStruct(ptr reflect.Value) jsonObject {
+	v := ptr.Elem()
+	t := v.Type()
+	obj := make(jsonObject, 0, t.NumField()+2)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		obj = append(obj, jsonField{Key: field.Name, Value: encodeNode(v.Field(i))})
+	}
+	if ptr.Type().Implements(nodeType) {
+		node := ptr.Interface().(Node)
+		obj = append(obj,
+			jsonField{Key: "Pos", Value: node.Pos()},
+			jsonField{Key: "End", Value: node.End()},
+		)
+	}
+	return obj
+}
+
+func isASTType(t reflect.Type) bool {
+	return t.PkgPath() == nodeType.PkgPath()
+}
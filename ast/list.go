@@ -3,6 +3,7 @@ package ast
 import (
 	"bytes"
 	"strings"
+	"text/scanner"
 
 	"github.com/dfirebaugh/punch/token"
 )
@@ -20,6 +21,15 @@ func (ld *ListDeclaration) TokenLiteral() string {
 	return ld.Token.Literal
 }
 
+func (ld *ListDeclaration) Pos() scanner.Position { return ld.Token.Position }
+
+func (ld *ListDeclaration) End() scanner.Position {
+	if ld.Value != nil {
+		return ld.Value.End()
+	}
+	return ld.Name.End()
+}
+
 func (ld *ListDeclaration) String() string {
 	var out bytes.Buffer
 	out.WriteString(ld.TokenLiteral() + " ")
@@ -33,6 +43,7 @@ func (ld *ListDeclaration) String() string {
 type ListLiteral struct {
 	Token    token.Token // The '[' token
 	Elements []Expression
+	Rbrace   token.Token // The closing '}' token
 }
 
 func (ll *ListLiteral) expressionNode() {}
@@ -41,6 +52,18 @@ func (ll *ListLiteral) TokenLiteral() string {
 	return ll.Token.Literal
 }
 
+func (ll *ListLiteral) Pos() scanner.Position { return ll.Token.Position }
+
+func (ll *ListLiteral) End() scanner.Position {
+	if ll.Rbrace.Position.IsValid() {
+		return TokenEnd(ll.Rbrace)
+	}
+	if len(ll.Elements) > 0 {
+		return endOf(ll.Elements[len(ll.Elements)-1])
+	}
+	return TokenEnd(ll.Token)
+}
+
 func (ll *ListLiteral) String() string {
 	var out bytes.Buffer
 	elements := []string{}
@@ -58,6 +81,7 @@ type ListOperation struct {
 	Operator string
 	List     Expression
 	Element  Expression // Used for operations like append
+	Rparen   token.Token
 }
 
 func (lo *ListOperation) expressionNode() {}
@@ -66,6 +90,21 @@ func (lo *ListOperation) TokenLiteral() string {
 	return lo.Token.Literal
 }
 
+func (lo *ListOperation) Pos() scanner.Position { return lo.Token.Position }
+
+func (lo *ListOperation) End() scanner.Position {
+	if lo.Rparen.Position.IsValid() {
+		return TokenEnd(lo.Rparen)
+	}
+	if !isNil(lo.Element) {
+		return lo.Element.End()
+	}
+	if !isNil(lo.List) {
+		return lo.List.End()
+	}
+	return TokenEnd(lo.Token)
+}
+
 func (lo *ListOperation) String() string {
 	var out bytes.Buffer
 	out.WriteString(lo.Operator)
@@ -80,9 +119,10 @@ func (lo *ListOperation) String() string {
 }
 
 type IndexExpression struct {
-	Token token.Token // The '[' token
-	Left  Expression  // The expression being indexed
-	Index Expression  // The index expression
+	Token    token.Token // The '[' token
+	Left     Expression  // The expression being indexed
+	Index    Expression  // The index expression
+	Rbracket token.Token // The ']' token
 }
 
 func (ie *IndexExpression) expressionNode() {}
@@ -91,6 +131,15 @@ func (ie *IndexExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+func (ie *IndexExpression) Pos() scanner.Position { return startOf(ie.Left) }
+
+func (ie *IndexExpression) End() scanner.Position {
+	if ie.Rbracket.Position.IsValid() {
+		return TokenEnd(ie.Rbracket)
+	}
+	return endOf(ie.Index)
+}
+
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -100,3 +149,69 @@ func (ie *IndexExpression) String() string {
 	out.WriteString("])")
 	return out.String()
 }
+
+// IndexAssignment stores a value in an element of a list or under a key of
+// a map, e.g. xs[0] = 1 or m["a"] = 1.
+type IndexAssignment struct {
+	Token token.Token // The '=' token
+	Left  *IndexExpression
+	Right Expression
+}
+
+func (ia *IndexAssignment) expressionNode() {}
+
+func (ia *IndexAssignment) TokenLiteral() string {
+	return ia.Token.Literal
+}
+
+func (ia *IndexAssignment) Pos() scanner.Position { return ia.Left.Pos() }
+
+func (ia *IndexAssignment) End() scanner.Position {
+	if isNil(ia.Right) {
+		return TokenEnd(ia.Token)
+	}
+	return ia.Right.End()
+}
+
+func (ia *IndexAssignment) String() string {
+	var out bytes.Buffer
+	out.WriteString(ia.Left.String())
+	out.WriteString(" = ")
+	out.WriteString(ia.Right.String())
+	return out.String()
+}
+
+// SliceExpression is s[low:high]. Either bound may be left out.
+type SliceExpression struct {
+	Token    token.Token // The '[' token
+	Left     Expression  // The expression being sliced
+	Low      Expression  // The first index, nil for the start
+	High     Expression  // The index after the last, nil for the end
+	Rbracket token.Token // The ']' token
+}
+
+func (se *SliceExpression) expressionNode() {}
+
+func (se *SliceExpression) TokenLiteral() string {
+	return se.Token.Literal
+}
+
+func (se *SliceExpression) Pos() scanner.Position { return startOf(se.Left) }
+
+func (se *SliceExpression) End() scanner.Position { return TokenEnd(se.Rbracket) }
+
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Low != nil {
+		out.WriteString(se.Low.String())
+	}
+	out.WriteString(":")
+	if se.High != nil {
+		out.WriteString(se.High.String())
+	}
+	out.WriteString("])")
+	return out.String()
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"strconv"
 	"strings"
+	"text/scanner"
 
 	"github.com/dfirebaugh/punch/token"
 )
@@ -17,6 +18,10 @@ func (il *IntegerLiteral) expressionNode() {}
 
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 
+func (il *IntegerLiteral) Pos() scanner.Position { return il.Token.Position }
+
+func (il *IntegerLiteral) End() scanner.Position { return TokenEnd(il.Token) }
+
 func (il *IntegerLiteral) String() string {
 	if il != nil {
 		return strconv.FormatInt(il.Value, 10)
@@ -33,9 +38,13 @@ func (il *FloatLiteral) expressionNode() {}
 
 func (il *FloatLiteral) TokenLiteral() string { return il.Token.Literal }
 
+func (il *FloatLiteral) Pos() scanner.Position { return il.Token.Position }
+
+func (il *FloatLiteral) End() scanner.Position { return TokenEnd(il.Token) }
+
 func (il *FloatLiteral) String() string {
 	if il != nil {
-		return strconv.FormatFloat(il.Value, 10, 64, 64)
+		return strconv.FormatFloat(il.Value, 'g', -1, 64)
 	}
 	return ""
 }
@@ -49,6 +58,10 @@ func (sl *StringLiteral) expressionNode() {}
 
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
 
+func (sl *StringLiteral) Pos() scanner.Position { return sl.Token.Position }
+
+func (sl *StringLiteral) End() scanner.Position { return TokenEnd(sl.Token) }
+
 func (sl *StringLiteral) String() string {
 	if sl != nil {
 		return sl.Value
@@ -67,6 +80,10 @@ func (bl *BooleanLiteral) TokenLiteral() string {
 	return bl.Token.Literal
 }
 
+func (bl *BooleanLiteral) Pos() scanner.Position { return bl.Token.Position }
+
+func (bl *BooleanLiteral) End() scanner.Position { return TokenEnd(bl.Token) }
+
 func (bl *BooleanLiteral) String() string {
 	if bl != nil {
 		return bl.Token.Literal
@@ -84,6 +101,20 @@ func (a *ArrayLiteral) TokenLiteral() string {
 	return "[ARRAYLITERAL]: " + a.String()
 }
 
+func (a *ArrayLiteral) Pos() scanner.Position {
+	if len(a.Elements) == 0 {
+		return scanner.Position{}
+	}
+	return startOf(a.Elements[0])
+}
+
+func (a *ArrayLiteral) End() scanner.Position {
+	if len(a.Elements) == 0 {
+		return scanner.Position{}
+	}
+	return endOf(a.Elements[len(a.Elements)-1])
+}
+
 func (a *ArrayLiteral) String() string {
 	if a == nil {
 		return ""
@@ -101,8 +132,10 @@ func (a *ArrayLiteral) String() string {
 
 type FunctionLiteral struct {
 	Token      token.Token // the 'fn' token
-	Parameters []*Identifier
-	Body       *BlockStatement
+	Parameters []*Parameter
+	// ReturnTypes holds the type of the value the function returns, if any
+	ReturnTypes []*Identifier
+	Body        *BlockStatement
 }
 
 func (fl *FunctionLiteral) expressionNode() {}
@@ -114,6 +147,15 @@ func (fl *FunctionLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
 
+func (fl *FunctionLiteral) Pos() scanner.Position { return fl.Token.Position }
+
+func (fl *FunctionLiteral) End() scanner.Position {
+	if fl.Body != nil {
+		return fl.Body.End()
+	}
+	return TokenEnd(fl.Token)
+}
+
 func (fl *FunctionLiteral) String() string {
 	if fl == nil {
 		return ""
@@ -127,13 +169,25 @@ func (fl *FunctionLiteral) String() string {
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
+	for _, r := range fl.ReturnTypes {
+		out.WriteString(r.String() + " ")
+	}
 	out.WriteString(fl.Body.String())
 	return out.String()
 }
 
+// HashLiteral is a map literal such as {"a": 1, "b": 2}. Its pairs are kept
+// in the order they are written, which is the order they are inserted in.
 type HashLiteral struct {
-	Token token.Token
-	Pairs map[Expression]Expression
+	Token  token.Token // The '{' token
+	Pairs  []*HashPair
+	Rbrace token.Token // The closing '}' token
+}
+
+// HashPair is a key and its value in a map literal.
+type HashPair struct {
+	Key   Expression
+	Value Expression
 }
 
 func (hl *HashLiteral) expressionNode() {}
@@ -145,14 +199,23 @@ func (hl *HashLiteral) TokenLiteral() string {
 	return hl.Token.Literal
 }
 
+func (hl *HashLiteral) Pos() scanner.Position { return hl.Token.Position }
+
+func (hl *HashLiteral) End() scanner.Position {
+	if hl.Rbrace.Position.IsValid() {
+		return TokenEnd(hl.Rbrace)
+	}
+	return TokenEnd(hl.Token)
+}
+
 func (hl *HashLiteral) String() string {
 	if hl == nil {
 		return ""
 	}
 	var out bytes.Buffer
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
 	}
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ", "))
@@ -171,6 +234,10 @@ func (nt *NumberType) TokenLiteral() string {
 	return nt.Token.Literal
 }
 
+func (nt *NumberType) Pos() scanner.Position { return nt.Token.Position }
+
+func (nt *NumberType) End() scanner.Position { return TokenEnd(nt.Token) }
+
 func (nt *NumberType) String() string {
 	return nt.Token.Literal
 }
@@ -0,0 +1,47 @@
+package ast
+
+import (
+	"reflect"
+	"text/scanner"
+
+	"github.com/dfirebaugh/punch/token"
+)
+
+// TokenEnd returns the position immediately after tok. Tokens synthesized by
+// the parser don't always carry an end so it is derived from the literal.
+func TokenEnd(tok token.Token) scanner.Position {
+	if tok.End.IsValid() {
+		return tok.End
+	}
+	end := tok.Position
+	if !end.IsValid() {
+		return end
+	}
+	end.Offset += len(tok.Literal)
+	end.Column += len(tok.Literal)
+	return end
+}
+
+// startOf returns the start of a node that may be missing.
+func startOf(node Node) scanner.Position {
+	if isNil(node) {
+		return scanner.Position{}
+	}
+	return node.Pos()
+}
+
+// endOf returns the end of a node that may be missing.
+func endOf(node Node) scanner.Position {
+	if isNil(node) {
+		return scanner.Position{}
+	}
+	return node.End()
+}
+
+func isNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
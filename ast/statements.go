@@ -2,6 +2,8 @@ package ast
 
 import (
 	"bytes"
+	"strings"
+	"text/scanner"
 
 	"github.com/dfirebaugh/punch/token"
 )
@@ -17,6 +19,20 @@ func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
 
+func (es *ExpressionStatement) Pos() scanner.Position {
+	if isNil(es.Expression) {
+		return es.Token.Position
+	}
+	return es.Expression.Pos()
+}
+
+func (es *ExpressionStatement) End() scanner.Position {
+	if isNil(es.Expression) {
+		return TokenEnd(es.Token)
+	}
+	return es.Expression.End()
+}
+
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -34,6 +50,15 @@ func (ls *LetStatement) statementNode() {}
 
 func (ls *LetStatement) TokenLiteral() string { return string(ls.Token.Literal) }
 
+func (ls *LetStatement) Pos() scanner.Position { return ls.Token.Position }
+
+func (ls *LetStatement) End() scanner.Position {
+	if isNil(ls.Value) {
+		return ls.Name.End()
+	}
+	return ls.Value.End()
+}
+
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ls.Token.Literal + " ")
@@ -65,6 +90,18 @@ func (ie *IfStatement) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+func (ie *IfStatement) Pos() scanner.Position { return ie.Token.Position }
+
+func (ie *IfStatement) End() scanner.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	if ie.Consequence != nil {
+		return ie.Consequence.End()
+	}
+	return endOf(ie.Condition)
+}
+
 func (ie *IfStatement) String() string {
 	if ie == nil {
 		return ""
@@ -88,6 +125,7 @@ func (ie *IfStatement) String() string {
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	Rbrace     token.Token
 }
 
 func (bs *BlockStatement) expressionNode() {}
@@ -97,6 +135,18 @@ func (bs *BlockStatement) TokenLiteral() string {
 	return bs.Token.Literal
 }
 
+func (bs *BlockStatement) Pos() scanner.Position { return bs.Token.Position }
+
+func (bs *BlockStatement) End() scanner.Position {
+	if bs.Rbrace.Position.IsValid() {
+		return TokenEnd(bs.Rbrace)
+	}
+	if len(bs.Statements) > 0 {
+		return endOf(bs.Statements[len(bs.Statements)-1])
+	}
+	return TokenEnd(bs.Token)
+}
+
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("{ ")
@@ -118,6 +168,15 @@ func (ds *DeferStatement) TokenLiteral() string {
 	return ds.Token.Literal
 }
 
+func (ds *DeferStatement) Pos() scanner.Position { return ds.Token.Position }
+
+func (ds *DeferStatement) End() scanner.Position {
+	if isNil(ds.Statement) {
+		return TokenEnd(ds.Token)
+	}
+	return ds.Statement.End()
+}
+
 func (ds *DeferStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ds.TokenLiteral() + " ")
@@ -139,6 +198,21 @@ func (vd *VariableDeclaration) TokenLiteral() string {
 	return vd.Type.Literal
 }
 
+// Pos returns the start of the type, or of the name when the type is inferred.
+func (vd *VariableDeclaration) Pos() scanner.Position {
+	if vd.Type.Position.IsValid() {
+		return vd.Type.Position
+	}
+	return vd.Name.Pos()
+}
+
+func (vd *VariableDeclaration) End() scanner.Position {
+	if isNil(vd.Value) {
+		return vd.Name.End()
+	}
+	return vd.Value.End()
+}
+
 func (vd *VariableDeclaration) String() string {
 	var out bytes.Buffer
 
@@ -156,19 +230,66 @@ func (vd *VariableDeclaration) String() string {
 	return out.String()
 }
 
+// DestructuringDeclaration declares a variable for each value a call
+// returns, e.g. `i32 s, bool eq = add_eq(a, b)`. The declarations in Vars
+// have no values.
+type DestructuringDeclaration struct {
+	Vars  []*VariableDeclaration
+	Value Expression
+}
+
+func (dd *DestructuringDeclaration) statementNode() {}
+
+func (dd *DestructuringDeclaration) TokenLiteral() string {
+	return dd.Vars[0].TokenLiteral()
+}
+
+func (dd *DestructuringDeclaration) Pos() scanner.Position { return dd.Vars[0].Pos() }
+
+func (dd *DestructuringDeclaration) End() scanner.Position {
+	if isNil(dd.Value) {
+		return dd.Vars[len(dd.Vars)-1].End()
+	}
+	return dd.Value.End()
+}
+
+func (dd *DestructuringDeclaration) String() string {
+	vars := make([]string, len(dd.Vars))
+	for i, v := range dd.Vars {
+		vars[i] = v.Type.Literal + " " + v.Name.String()
+	}
+	var out bytes.Buffer
+	out.WriteString(strings.Join(vars, ", "))
+	out.WriteString(" = ")
+	if dd.Value != nil {
+		out.WriteString(dd.Value.String())
+	}
+	out.WriteString(";")
+	return out.String()
+}
+
 type ForStatement struct {
 	Token     token.Token
+	Label     *Identifier // The label that names the loop, or nil
 	Init      Statement
 	Condition Expression
 	Post      Statement
 	Body      *BlockStatement
 }
 
-func (fs *ForStatement) statementNode()       {}
-func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) statementNode()        {}
+func (fs *ForStatement) TokenLiteral() string  { return fs.Token.Literal }
+func (fs *ForStatement) Pos() scanner.Position { return loopPos(fs.Label, fs.Token) }
+func (fs *ForStatement) End() scanner.Position {
+	if fs.Body != nil {
+		return fs.Body.End()
+	}
+	return TokenEnd(fs.Token)
+}
 func (fs *ForStatement) String() string {
 	var out bytes.Buffer
 
+	out.WriteString(labelString(fs.Label))
 	out.WriteString("for ")
 	if fs.Init != nil {
 		out.WriteString(fs.Init.String())
@@ -186,3 +307,110 @@ func (fs *ForStatement) String() string {
 
 	return out.String()
 }
+
+// ForInStatement is a loop over the elements of a list, the bytes of a
+// string, the keys of a map or a range of integers, such as
+// `for i, name in names { }`. With two variables the first is the index of
+// the element or the key and the second its value.
+type ForInStatement struct {
+	Token    token.Token   // The 'for' token
+	Label    *Identifier   // The label that names the loop, or nil
+	Vars     []*Identifier // One or two variables
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForInStatement) statementNode()        {}
+func (fs *ForInStatement) TokenLiteral() string  { return fs.Token.Literal }
+func (fs *ForInStatement) Pos() scanner.Position { return loopPos(fs.Label, fs.Token) }
+func (fs *ForInStatement) End() scanner.Position {
+	if fs.Body != nil {
+		return fs.Body.End()
+	}
+	return endOf(fs.Iterable)
+}
+func (fs *ForInStatement) String() string {
+	vars := make([]string, len(fs.Vars))
+	for i, v := range fs.Vars {
+		vars[i] = v.String()
+	}
+	var out bytes.Buffer
+	out.WriteString(labelString(fs.Label))
+	out.WriteString("for ")
+	out.WriteString(strings.Join(vars, ", "))
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(" ")
+	out.WriteString(fs.Body.String())
+	return out.String()
+}
+
+// RangeExpression is the range of integers from Low up to but not
+// including High that a for statement iterates over, such as `0..n`.
+type RangeExpression struct {
+	Token token.Token // The '..' token
+	Low   Expression
+	High  Expression
+}
+
+func (re *RangeExpression) expressionNode()       {}
+func (re *RangeExpression) TokenLiteral() string  { return re.Token.Literal }
+func (re *RangeExpression) Pos() scanner.Position { return startOf(re.Low) }
+func (re *RangeExpression) End() scanner.Position { return endOf(re.High) }
+func (re *RangeExpression) String() string {
+	return re.Low.String() + ".." + re.High.String()
+}
+
+// loopPos returns the start of a loop, which is its label if it has one.
+func loopPos(label *Identifier, tok token.Token) scanner.Position {
+	if label != nil {
+		return label.Pos()
+	}
+	return tok.Position
+}
+
+func labelString(label *Identifier) string {
+	if label == nil {
+		return ""
+	}
+	return label.String() + ": "
+}
+
+// BreakStatement leaves the innermost loop, or the loop its label names.
+type BreakStatement struct {
+	Token token.Token
+	Label *Identifier // The label of the loop to leave, or nil
+}
+
+func (bs *BreakStatement) statementNode()        {}
+func (bs *BreakStatement) TokenLiteral() string  { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() scanner.Position { return bs.Token.Position }
+func (bs *BreakStatement) End() scanner.Position { return branchEnd(bs.Label, bs.Token) }
+func (bs *BreakStatement) String() string        { return branchString(bs.Label, bs.Token) }
+
+// ContinueStatement starts the next iteration of the innermost loop, or of
+// the loop its label names.
+type ContinueStatement struct {
+	Token token.Token
+	Label *Identifier // The label of the loop to continue, or nil
+}
+
+func (cs *ContinueStatement) statementNode()        {}
+func (cs *ContinueStatement) TokenLiteral() string  { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() scanner.Position { return cs.Token.Position }
+func (cs *ContinueStatement) End() scanner.Position { return branchEnd(cs.Label, cs.Token) }
+func (cs *ContinueStatement) String() string        { return branchString(cs.Label, cs.Token) }
+
+func branchEnd(label *Identifier, tok token.Token) scanner.Position {
+	if label != nil {
+		return label.End()
+	}
+	return TokenEnd(tok)
+}
+
+func branchString(label *Identifier, tok token.Token) string {
+	if label == nil {
+		return tok.Literal
+	}
+	return tok.Literal + " " + label.String()
+}
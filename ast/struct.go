@@ -3,6 +3,7 @@ package ast
 import (
 	"bytes"
 	"strings"
+	"text/scanner"
 
 	"github.com/dfirebaugh/punch/token"
 )
@@ -19,6 +20,10 @@ func (sf *StructField) TokenLiteral() string {
 	return sf.Token.Literal
 }
 
+func (sf *StructField) Pos() scanner.Position { return sf.Token.Position }
+
+func (sf *StructField) End() scanner.Position { return TokenEnd(sf.Token) }
+
 func (sf *StructField) String() string {
 	var out bytes.Buffer
 	if sf.Name != nil {
@@ -33,6 +38,7 @@ type StructDefinition struct {
 	Token  token.Token
 	Name   *Identifier
 	Fields []*StructField
+	Rbrace token.Token
 }
 
 func (sd *StructDefinition) statementNode() {}
@@ -41,6 +47,18 @@ func (sd *StructDefinition) TokenLiteral() string {
 	return sd.Token.Literal
 }
 
+func (sd *StructDefinition) Pos() scanner.Position { return sd.Token.Position }
+
+func (sd *StructDefinition) End() scanner.Position {
+	if sd.Rbrace.Position.IsValid() {
+		return TokenEnd(sd.Rbrace)
+	}
+	if len(sd.Fields) > 0 {
+		return sd.Fields[len(sd.Fields)-1].End()
+	}
+	return sd.Name.End()
+}
+
 func (sd *StructDefinition) String() string {
 	var out bytes.Buffer
 	out.WriteString(sd.TokenLiteral() + " ")
@@ -63,6 +81,7 @@ type StructLiteral struct {
 	Token      token.Token
 	Fields     map[string]Expression
 	StructName *Identifier
+	Rbrace     token.Token
 }
 
 func (sl *StructLiteral) expressionNode() {}
@@ -71,6 +90,15 @@ func (sl *StructLiteral) TokenLiteral() string {
 	return sl.Token.Literal
 }
 
+func (sl *StructLiteral) Pos() scanner.Position { return sl.Token.Position }
+
+func (sl *StructLiteral) End() scanner.Position {
+	if sl.Rbrace.Position.IsValid() {
+		return TokenEnd(sl.Rbrace)
+	}
+	return TokenEnd(sl.Token)
+}
+
 func (sl *StructLiteral) String() string {
 	var out bytes.Buffer
 	if sl.StructName != nil {
@@ -98,6 +126,10 @@ func (s *StructFieldAccess) TokenLiteral() string {
 	return s.Token.Literal
 }
 
+func (s *StructFieldAccess) Pos() scanner.Position { return startOf(s.Left) }
+
+func (s *StructFieldAccess) End() scanner.Position { return s.Field.End() }
+
 func (s *StructFieldAccess) String() string {
 	return s.Left.String() + "." + s.Field.String()
 }
@@ -114,6 +146,15 @@ func (sfa *StructFieldAssignment) TokenLiteral() string {
 	return sfa.Token.Literal
 }
 
+func (sfa *StructFieldAssignment) Pos() scanner.Position { return sfa.Left.Pos() }
+
+func (sfa *StructFieldAssignment) End() scanner.Position {
+	if isNil(sfa.Right) {
+		return TokenEnd(sfa.Token)
+	}
+	return sfa.Right.End()
+}
+
 func (sfa *StructFieldAssignment) String() string {
 	var out bytes.Buffer
 	out.WriteString(sfa.Left.String())
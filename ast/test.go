@@ -0,0 +1,38 @@
+package ast
+
+import (
+	"text/scanner"
+
+	"github.com/dfirebaugh/punch/token"
+)
+
+// TestBlock is a named block of assertions run by `punch test`. Test blocks
+// are left out of normal builds.
+type TestBlock struct {
+	Token token.Token // the 'test' token
+	Name  *StringLiteral
+	Body  *BlockStatement
+}
+
+func (tb *TestBlock) statementNode() {}
+
+func (tb *TestBlock) TokenLiteral() string {
+	return tb.Token.Literal
+}
+
+func (tb *TestBlock) Pos() scanner.Position { return tb.Token.Position }
+
+func (tb *TestBlock) End() scanner.Position {
+	if tb.Body != nil {
+		return tb.Body.End()
+	}
+	return tb.Name.End()
+}
+
+func (tb *TestBlock) String() string {
+	out := tb.TokenLiteral() + " \"" + tb.Name.Value + "\" "
+	if tb.Body != nil {
+		out += tb.Body.String()
+	}
+	return out
+}
@@ -0,0 +1,575 @@
+package checker
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/diagnostic"
+	"github.com/dfirebaugh/punch/token"
+)
+
+// Info holds the results of type checking.
+type Info struct {
+	// Types maps every checked expression to its type.
+	Types map[ast.Expression]Type
+	// Defs maps identifiers to the symbols they declare.
+	Defs map[*ast.Identifier]*Symbol
+	// Uses maps identifiers to the symbols they refer to.
+	Uses map[*ast.Identifier]*Symbol
+
+	// Structs, Enums and Interfaces are keyed by name, which is unique
+	// across the packages of a program.
+	Structs    map[string]*Struct
+	Enums      map[string]*Enum
+	Interfaces map[string]*Interface
+	// Functions is keyed by name for the package a program is loaded from
+	// and by path.name for imported packages.
+	Functions map[string]*Signature
+
+	// Variants maps qualified accesses such as Color.Red to the variant they
+	// refer to.
+	Variants map[*ast.StructFieldAccess]*EnumVariant
+
+	// Conversions maps struct values that are used where an interface is
+	// expected to the interface they are converted to.
+	Conversions map[ast.Expression]*Interface
+	// NumericConversions maps calls such as i64(n) that convert a number to
+	// another numeric type to the type they convert to.
+	NumericConversions map[ast.Expression]*Basic
+
+	// Captures maps each function literal to the variables of enclosing
+	// functions it refers to, in the order it first refers to them. The
+	// variables are captured by reference.
+	Captures map[*ast.FunctionLiteral][]*Symbol
+}
+
+// TypeOf returns the type of an expression or nil if it was not checked.
+func (info *Info) TypeOf(expr ast.Expression) Type {
+	return info.Types[expr]
+}
+
+// EnumVariant returns the variant a qualified access such as Color.Red refers
+// to, or false if the access is not an enum variant.
+func (info *Info) EnumVariant(expr ast.Expression) (*EnumVariant, bool) {
+	access, ok := expr.(*ast.StructFieldAccess)
+	if !ok {
+		return nil, false
+	}
+	v, ok := info.Variants[access]
+	return v, ok
+}
+
+// PackageMember returns the symbol a qualified identifier such as math.add
+// refers to, or false if the expression is not a member of an imported
+// package.
+func (info *Info) PackageMember(expr ast.Expression) (*Symbol, bool) {
+	access, ok := expr.(*ast.StructFieldAccess)
+	if !ok {
+		return nil, false
+	}
+	if ident, ok := access.Left.(*ast.Identifier); !ok || info.Uses[ident] == nil || info.Uses[ident].Kind != PackageSymbol {
+		return nil, false
+	}
+	sym, ok := info.Uses[access.Field]
+	return sym, ok
+}
+
+// IsBuiltin reports whether a call is to the builtin function name rather
+// than to a function that shadows its name.
+func (info *Info) IsBuiltin(call *ast.FunctionCall, name string) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok || ident.Value != name {
+		return false
+	}
+	sym := info.Uses[ident]
+	return sym != nil && sym.Kind == BuiltinSymbol
+}
+
+// Program is a program that passed type checking. The emitters only accept a
+// Program so code is never generated for a program with type errors.
+type Program struct {
+	*ast.Program
+	Info *Info
+}
+
+// pkg is a package being checked. Its top level declarations are in scope,
+// which is shared by all of its files.
+type pkg struct {
+	path  string
+	name  string
+	scope *Scope
+	files []*ast.File
+}
+
+type Checker struct {
+	info   *Info
+	scope  *Scope
+	errors diagnostic.List
+
+	// pkg is the package currently being checked
+	pkg      *pkg
+	packages map[string]*pkg
+	// typeNames maps every declared type name to the package declaring it
+	typeNames map[string]*pkg
+
+	// signature of the function currently being checked, nil at the top level
+	fn *Signature
+	// literals holds the function literals around the statement being
+	// checked, innermost last
+	literals []*literal
+	// inTest is set while checking the body of a test block
+	inTest bool
+	tests  map[string]*ast.TestBlock
+}
+
+func New() *Checker {
+	return &Checker{
+		info: &Info{
+			Types:              make(map[ast.Expression]Type),
+			Defs:               make(map[*ast.Identifier]*Symbol),
+			Uses:               make(map[*ast.Identifier]*Symbol),
+			Structs:            make(map[string]*Struct),
+			Enums:              make(map[string]*Enum),
+			Interfaces:         make(map[string]*Interface),
+			Functions:          make(map[string]*Signature),
+			Variants:           make(map[*ast.StructFieldAccess]*EnumVariant),
+			Conversions:        make(map[ast.Expression]*Interface),
+			NumericConversions: make(map[ast.Expression]*Basic),
+			Captures:           make(map[*ast.FunctionLiteral][]*Symbol),
+		},
+		scope:     NewScope(universe),
+		packages:  make(map[string]*pkg),
+		typeNames: make(map[string]*pkg),
+		tests:     make(map[string]*ast.TestBlock),
+	}
+}
+
+// Check type checks a program. All errors found are returned as a
+// diagnostic.List.
+func Check(program *ast.Program) (*Program, error) {
+	return New().Check(program)
+}
+
+func (c *Checker) Check(program *ast.Program) (*Program, error) {
+	packages := c.collectPackages(program.Files)
+	for _, p := range packages {
+		c.enterPackage(p)
+		for _, file := range p.files {
+			c.collectTypes(file.Statements)
+		}
+	}
+	for _, p := range packages {
+		c.enterPackage(p)
+		for _, file := range p.files {
+			c.collectFunctions(file.Statements)
+		}
+	}
+	for _, p := range packages {
+		c.enterPackage(p)
+		for _, file := range p.files {
+			c.enterFile(file)
+			for _, stmt := range file.Statements {
+				c.checkStatement(stmt)
+			}
+		}
+	}
+
+	if len(c.errors) > 0 {
+		return nil, c.errors
+	}
+	return &Program{Program: program, Info: c.info}, nil
+}
+
+// collectPackages groups files by the package they belong to, keeping the
+// order in which the packages first appear.
+func (c *Checker) collectPackages(files []*ast.File) []*pkg {
+	var packages []*pkg
+	for _, file := range files {
+		p, ok := c.packages[file.ImportPath]
+		if !ok {
+			p = &pkg{path: file.ImportPath, name: file.PackageName, scope: NewScope(universe)}
+			c.packages[p.path] = p
+			packages = append(packages, p)
+		}
+		p.files = append(p.files, file)
+	}
+	return packages
+}
+
+func (c *Checker) enterPackage(p *pkg) {
+	c.pkg = p
+	c.scope = p.scope
+}
+
+// enterFile opens the scope of a file, which holds the packages it imports.
+func (c *Checker) enterFile(file *ast.File) {
+	c.scope = NewScope(c.pkg.scope)
+	for _, imp := range file.Imports {
+		dep, ok := c.packages[imp.Path]
+		if !ok || dep == c.pkg {
+			c.errorf(imp, "could not import %s (package not found)", imp.Path)
+			continue
+		}
+		sym := &Symbol{Name: dep.name, Kind: PackageSymbol, Pos: imp.Pos(), Pkg: dep.path}
+		if existing := c.scope.Insert(sym); existing != nil {
+			c.errorf(imp, "%s redeclared in this file (previous import at %d:%d)", dep.name, existing.Pos.Line, existing.Pos.Column)
+		}
+	}
+}
+
+// qualify returns the name a function of the current package is recorded
+// under in Info.Functions.
+func (c *Checker) qualify(name string) string {
+	if c.pkg == nil || c.pkg.path == "" {
+		return name
+	}
+	return c.pkg.path + "." + name
+}
+
+// collectTypes declares every struct, enum and interface up front so that
+// types can be used before the definition appears in the source.
+func (c *Checker) collectTypes(stmts []ast.Statement) {
+	var defs []*ast.StructDefinition
+	var interfaces []*ast.InterfaceDefinition
+	for _, stmt := range stmts {
+		switch def := stmt.(type) {
+		case *ast.EnumDefinition:
+			c.collectEnum(def)
+		case *ast.InterfaceDefinition:
+			i := &Interface{Name: def.Name.Value}
+			if c.declareType(def.Name, i) {
+				c.info.Interfaces[i.Name] = i
+				interfaces = append(interfaces, def)
+			}
+		case *ast.StructDefinition:
+			s := &Struct{Name: def.Name.Value}
+			if c.declareType(def.Name, s) {
+				c.info.Structs[s.Name] = s
+				defs = append(defs, def)
+			}
+		}
+	}
+	for _, def := range defs {
+		s := c.info.Structs[def.Name.Value]
+		for _, field := range def.Fields {
+			if _, exists := s.Field(field.Name.Value); exists {
+				c.errorf(field.Name, "duplicate field %s in struct %s", field.Name.Value, s.Name)
+				continue
+			}
+			s.Fields = append(s.Fields, &Field{
+				Name: field.Name.Value,
+				Type: c.resolveType(string(field.Type), field.Name),
+			})
+		}
+	}
+	for _, def := range interfaces {
+		i := c.info.Interfaces[def.Name.Value]
+		for _, method := range def.Methods {
+			if _, exists := i.Method(method.Name.Value); exists {
+				c.errorf(method.Name, "duplicate method %s in interface %s", method.Name.Value, i.Name)
+				continue
+			}
+			i.Methods = append(i.Methods, &Method{
+				Name: method.Name.Value,
+				Sig:  c.signature(method.Parameters, resultTypes(method.ReturnType)),
+			})
+		}
+	}
+}
+
+// collectEnum declares an enum and works out the value of each variant. A
+// variant without an explicit value is one more than the variant before it.
+func (c *Checker) collectEnum(def *ast.EnumDefinition) {
+	e := &Enum{Name: def.Name.Value}
+	if !c.declareType(def.Name, e) {
+		return
+	}
+	c.info.Enums[e.Name] = e
+
+	var next int64
+	for _, variant := range def.Variants {
+		if _, exists := e.Variant(variant.Name.Value); exists {
+			c.errorf(variant.Name, "duplicate variant %s in enum %s", variant.Name.Value, e.Name)
+			continue
+		}
+		value := next
+		if variant.Value != nil {
+			v, ok := c.constantInt(variant.Value)
+			if !ok {
+				c.errorf(variant.Value, "enum value %s is not an integer constant", variant.Value.String())
+				continue
+			}
+			value = v
+		}
+		if value < math.MinInt32 || value > math.MaxInt32 {
+			c.errorf(variant.Name, "value %d of %s.%s overflows i32", value, e.Name, variant.Name.Value)
+			continue
+		}
+		e.Variants = append(e.Variants, &EnumVariant{Name: variant.Name.Value, Value: value})
+		next = value + 1
+	}
+}
+
+// constantInt evaluates an integer literal, optionally negated.
+func (c *Checker) constantInt(expr ast.Expression) (int64, bool) {
+	switch e := expr.(type) {
+	case *ast.IntegerLiteral:
+		c.record(e, Typ[I32])
+		return e.Value, true
+	case *ast.PrefixExpression:
+		if e.Operator.Type != token.MINUS {
+			return 0, false
+		}
+		v, ok := c.constantInt(e.Right)
+		if ok {
+			c.record(e, Typ[I32])
+		}
+		return -v, ok
+	}
+	return 0, false
+}
+
+// collectFunctions declares every function and method up front so that they
+// can be called before they are defined.
+func (c *Checker) collectFunctions(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		fn, ok := stmt.(*ast.FunctionStatement)
+		if !ok {
+			continue
+		}
+		sig := c.signature(fn.Parameters, fn.ReturnTypes)
+		if fn.Receiver != nil {
+			c.collectMethod(fn, sig)
+			continue
+		}
+		if c.declare(fn.Name, FuncSymbol, sig) {
+			c.info.Defs[fn.Name].Exported = fn.IsExported
+			c.info.Functions[c.qualify(fn.Name.Value)] = sig
+		}
+	}
+}
+
+// collectMethod attaches a method to the struct named by its receiver.
+func (c *Checker) collectMethod(fn *ast.FunctionStatement, sig *Signature) {
+	recv := c.resolveType(string(fn.Receiver.Type), fn.Receiver.Identifier)
+	if isInvalid(recv) {
+		return
+	}
+	s, ok := recv.(*Struct)
+	if !ok {
+		c.errorf(fn.Receiver.Identifier, "invalid receiver type %s (methods can only be declared on structs)", recv)
+		return
+	}
+	name := fn.Name.Value
+	if _, exists := s.Method(name); exists {
+		c.errorf(fn.Name, "method %s.%s already declared", s.Name, name)
+		return
+	}
+	if _, exists := s.Field(name); exists {
+		c.errorf(fn.Name, "field and method with the same name %s in struct %s", name, s.Name)
+		return
+	}
+	s.Methods = append(s.Methods, &Method{Name: name, Sig: sig})
+}
+
+func (c *Checker) signature(params []*ast.Parameter, returnTypes []*ast.Identifier) *Signature {
+	sig := &Signature{}
+	for _, param := range params {
+		sig.Params = append(sig.Params, c.resolveType(string(param.Type), param.Identifier))
+	}
+	for _, returnType := range returnTypes {
+		sig.Results = append(sig.Results, c.resolveType(returnType.Value, returnType))
+	}
+	return sig
+}
+
+// resultTypes returns the result types of a declaration with at most one.
+func resultTypes(returnType *ast.Identifier) []*ast.Identifier {
+	if returnType == nil {
+		return nil
+	}
+	return []*ast.Identifier{returnType}
+}
+
+// resolveType finds the type referred to by a type name in the AST.
+func (c *Checker) resolveType(name string, at ast.Node) Type {
+	if elem, ok := strings.CutPrefix(name, "[]"); ok {
+		return &List{Elem: c.resolveType(elem, at)}
+	}
+	if strings.HasPrefix(name, "fn(") {
+		return c.resolveFunctionType(name, at)
+	}
+	if strings.HasPrefix(name, "map[") {
+		return c.resolveMapType(name, at)
+	}
+	if t, ok := basicTypes[token.Type(name)]; ok {
+		return t
+	}
+	if sym := c.scope.Lookup(name); sym != nil && sym.Kind == TypeSymbol {
+		return sym.Type
+	}
+	c.errorf(at, "undefined type %s", name)
+	return Typ[Invalid]
+}
+
+// resolveFunctionType resolves a function type such as `fn(i32, str) bool`,
+// which the parser spells out as a single name.
+func (c *Checker) resolveFunctionType(name string, at ast.Node) Type {
+	sig := &Signature{}
+	depth, start := 0, len("fn(")
+	for i := start; i < len(name); i++ {
+		switch name[i] {
+		case '(':
+			depth++
+		case ',', ')':
+			if depth > 0 {
+				if name[i] == ')' {
+					depth--
+				}
+				continue
+			}
+			if param := strings.TrimSpace(name[start:i]); param != "" {
+				sig.Params = append(sig.Params, c.resolveType(param, at))
+			}
+			start = i + 1
+			if name[i] == ')' {
+				if result := strings.TrimSpace(name[start:]); result != "" {
+					sig.Results = append(sig.Results, c.resolveType(result, at))
+				}
+				return sig
+			}
+		}
+	}
+	c.errorf(at, "invalid function type %s", name)
+	return Typ[Invalid]
+}
+
+// resolveMapType resolves a map type such as `map[str]i32`, which the
+// parser spells out as a single name.
+func (c *Checker) resolveMapType(name string, at ast.Node) Type {
+	depth := 0
+	for i := len("map["); i < len(name); i++ {
+		switch name[i] {
+		case '[', '(':
+			depth++
+		case ')':
+			depth--
+		case ']':
+			if depth > 0 {
+				depth--
+				continue
+			}
+			key := c.resolveType(name[len("map["):i], at)
+			elem := c.resolveType(name[i+1:], at)
+			if !isInvalid(key) && !IsComparable(key) {
+				c.errorf(at, "invalid map key type %s", key)
+			}
+			return &Map{Key: key, Elem: elem}
+		}
+	}
+	c.errorf(at, "invalid map type %s", name)
+	return Typ[Invalid]
+}
+
+// declare adds a symbol to the current scope, reporting redeclarations.
+func (c *Checker) declare(ident *ast.Identifier, kind SymbolKind, t Type) bool {
+	sym := &Symbol{Name: ident.Value, Kind: kind, Type: t, Pos: ident.Token.Position}
+	if c.pkg != nil {
+		sym.Pkg = c.pkg.path
+	}
+	if existing := c.scope.Insert(sym); existing != nil {
+		c.errorf(ident, "%s redeclared in this scope (previous declaration at %d:%d)", ident.Value, existing.Pos.Line, existing.Pos.Column)
+		return false
+	}
+	c.info.Defs[ident] = sym
+	return true
+}
+
+// declareType declares a struct, enum or interface. Type names must be unique
+// across packages because the emitters refer to types by name.
+func (c *Checker) declareType(ident *ast.Identifier, t Type) bool {
+	if !c.declare(ident, TypeSymbol, t) {
+		return false
+	}
+	if other, ok := c.typeNames[ident.Value]; ok && other != c.pkg {
+		c.errorf(ident, "type %s is also declared in package %s (type names must be unique across packages)", ident.Value, other.displayName())
+		return false
+	}
+	c.typeNames[ident.Value] = c.pkg
+	return true
+}
+
+func (p *pkg) displayName() string {
+	if p.path == "" {
+		return p.name
+	}
+	return p.path
+}
+
+func (c *Checker) openScope() {
+	c.scope = NewScope(c.scope)
+}
+
+func (c *Checker) closeScope() {
+	c.scope = c.scope.parent
+}
+
+// assignable reports an error if a value of type v cannot be assigned to a
+// destination of type t. Struct values assigned to an interface are recorded
+// in Info.Conversions.
+func (c *Checker) assignable(v, t Type, at ast.Node, context string) {
+	if isInvalid(v) || isInvalid(t) {
+		return
+	}
+	if IsVoid(v) {
+		c.errorf(at, "%s (no value) used as value", at.String())
+		return
+	}
+	if !AssignableTo(v, t) {
+		if iface, ok := t.(*Interface); ok && (IsInterface(v) || isStruct(v)) {
+			c.errorf(at, "cannot use %s (%s) as %s in %s: %s does not implement %s %s",
+				at.String(), v, t, context, v, t, missingMethodReason(v, iface))
+			return
+		}
+		c.errorf(at, "cannot use %s (%s) as %s in %s", at.String(), v, t, context)
+		return
+	}
+	if iface, ok := t.(*Interface); ok && isStruct(v) {
+		if expr, ok := at.(ast.Expression); ok {
+			c.info.Conversions[expr] = iface
+		}
+	}
+}
+
+func missingMethodReason(t Type, iface *Interface) string {
+	want := MissingMethod(t, iface)
+	var have *Method
+	switch t := t.(type) {
+	case *Struct:
+		have, _ = t.Method(want.Name)
+	case *Interface:
+		have, _ = t.Method(want.Name)
+	}
+	if have == nil {
+		return "(missing method " + want.Name + ")"
+	}
+	return fmt.Sprintf("(wrong type for method %s)\n\t\thave %s\n\t\twant %s", want.Name, have.Sig, want.Sig)
+}
+
+func isStruct(t Type) bool {
+	_, ok := t.(*Struct)
+	return ok
+}
+
+// record stores the type of an expression.
+func (c *Checker) record(expr ast.Expression, t Type) Type {
+	c.info.Types[expr] = t
+	return t
+}
+
+func isInvalid(t Type) bool {
+	b, ok := t.(*Basic)
+	return t == nil || ok && b.Kind == Invalid
+}
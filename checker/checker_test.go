@@ -0,0 +1,763 @@
+package checker_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/checker"
+	"github.com/dfirebaugh/punch/diagnostic"
+	"github.com/dfirebaugh/punch/lexer"
+	"github.com/dfirebaugh/punch/parser"
+)
+
+func check(t *testing.T, source string) (*checker.Program, error) {
+	t.Helper()
+	p := parser.New(lexer.New("test.pun", source))
+	program, err := p.ParseProgram("test.pun")
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	return checker.Check(program)
+}
+
+func TestCheckExamples(t *testing.T) {
+	files, err := filepath.Glob("../examples/*.pun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := check(t, string(source)); err != nil {
+			t.Errorf("%s: unexpected error:\n%v", file, err)
+		}
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		errors []string
+	}{
+		{
+			name: "assignment type mismatch",
+			source: `pkg main
+fn main() {
+	i32 a = "hello"
+}`,
+			errors: []string{"cannot use hello (str) as i32 in variable declaration"},
+		},
+		{
+			name: "slice of a number",
+			source: `pkg main
+fn main() {
+	i32 n = 4
+	println(n[1:])
+}`,
+			errors: []string{"cannot slice n (i32)"},
+		},
+		{
+			name: "slice bound type",
+			source: `pkg main
+fn main() {
+	str s = "abc"
+	println(s[:true])
+}`,
+			errors: []string{"invalid slice index true (bool must be integer)"},
+		},
+		{
+			name: "list field literal",
+			source: `pkg main
+struct bag {
+	[]i32 items
+}
+fn main() {
+	bag b = bag {
+		items: {1, "two"},
+	}
+	b.items = {3}
+	b.items = 4
+}`,
+			errors: []string{
+				"cannot use two (str) as i32 in list literal",
+				"cannot use 4 (untyped int) as []i32 in assignment",
+			},
+		},
+		{
+			name: "undefined identifier",
+			source: `pkg main
+fn main() {
+	println(a)
+}`,
+			errors: []string{"undefined: a"},
+		},
+		{
+			name: "argument count",
+			source: `pkg main
+i32 add(i32 a, i32 b) {
+	return a + b
+}
+add(1)`,
+			errors: []string{"not enough arguments in call to add"},
+		},
+		{
+			name: "argument type",
+			source: `pkg main
+i32 add(i32 a, i32 b) {
+	return a + b
+}
+add(1, "two")`,
+			errors: []string{"cannot use two (str) as i32 in argument to add"},
+		},
+		{
+			name: "return type",
+			source: `pkg main
+bool is_zero(i32 a) {
+	return a
+}`,
+			errors: []string{"cannot use a (i32) as bool in return statement"},
+		},
+		{
+			name: "missing return value",
+			source: `pkg main
+i32 zero() {
+	return
+}`,
+			errors: []string{"not enough return values"},
+		},
+		{
+			name: "missing return",
+			source: `pkg main
+i32 f(i32 x) {
+	println(x)
+}
+i32 sign(i32 x) {
+	if x < 0 {
+		return -1
+	} else if x > 0 {
+		return 1
+	} else {
+		return 0
+	}
+}
+i32 positive(i32 x) {
+	if x > 0 {
+		return x
+	}
+}
+i32 forever(i32 x) {
+	for {
+		for {
+			break
+		}
+		if x > 0 {
+			return x
+		}
+	}
+}
+i32 escapes(i32 x) {
+	lp: for {
+		for {
+			break lp
+		}
+	}
+}
+fn main() {
+	fn(i32) i32 g = fn(i32 x) i32 {
+		println(x)
+	}
+}`,
+			errors: []string{"missing return", "missing return", "missing return", "missing return"},
+		},
+		{
+			name: "constant overflow",
+			source: `pkg main
+u8 small(u8 x) {
+	return x + 256
+}
+fn main() {
+	i32 a = 5000000000
+	u8 b = 200 + 100 - 100
+	u8 c = 300
+	u32 d = -1
+	i8 e = -128
+	u64 f = 18446744073709551615
+	i64 g = 18446744073709551615
+	println(a, b, c, d, e, f, g)
+}`,
+			errors: []string{
+				"constant 256 overflows u8",
+				"constant 5000000000 overflows i32",
+				"constant 300 overflows u8",
+				"constant -1 overflows u32",
+				"constant 18446744073709551615 overflows i64",
+			},
+		},
+		{
+			name: "unknown struct field",
+			source: `pkg main
+struct point {
+	i32 x
+}
+fn main() {
+	point p = point {
+		x: 1,
+	}
+	println(p.y)
+}`,
+			errors: []string{"p.y undefined (type point has no field y)"},
+		},
+		{
+			name: "struct field type",
+			source: `pkg main
+struct point {
+	i32 x
+}
+fn main() {
+	point p = point {
+		x: "one",
+	}
+}`,
+			errors: []string{"cannot use one (str) as i32 in struct literal"},
+		},
+		{
+			name: "mismatched operands",
+			source: `pkg main
+fn main() {
+	i32 a = 1
+	i64 b = 2
+	println(a + b)
+}`,
+			errors: []string{"mismatched types i32 and i64"},
+		},
+		{
+			name: "non-boolean condition",
+			source: `pkg main
+fn main() {
+	if 1 {
+		println("one")
+	}
+}`,
+			errors: []string{"non-boolean condition"},
+		},
+		{
+			name: "void used as value",
+			source: `pkg main
+fn nothing() {
+}
+fn main() {
+	i32 a = nothing()
+}`,
+			errors: []string{"nothing() (no value) used as value"},
+		},
+		{
+			name: "unknown enum variant",
+			source: `pkg main
+enum Color { Red, Green }
+fn main() {
+	Color c = Color.Blue
+}`,
+			errors: []string{"Color.Blue undefined (type Color has no variant Blue)"},
+		},
+		{
+			name: "duplicate enum variant",
+			source: `pkg main
+enum Color { Red, Green, Red }`,
+			errors: []string{"duplicate variant Red in enum Color"},
+		},
+		{
+			name: "enum compared with integer",
+			source: `pkg main
+enum Color { Red, Green }
+bool is_red(Color c) {
+	return c == 0
+}`,
+			errors: []string{"mismatched types Color and untyped int"},
+		},
+		{
+			name: "missing interface method",
+			source: `pkg main
+interface shape {
+	i32 area()
+}
+struct rect {
+	i32 w
+}
+fn main() {
+	rect r = rect {
+		w: 1,
+	}
+	shape s = r
+}`,
+			errors: []string{"cannot use r (rect) as shape in variable declaration: rect does not implement shape (missing method area)"},
+		},
+		{
+			name: "wrong method signature",
+			source: `pkg main
+interface shape {
+	i32 area()
+}
+struct rect {
+	i32 w
+}
+i64 (rect r) area() {
+	return 1
+}
+i32 measure(shape s) {
+	return s.area()
+}
+fn main() {
+	rect r = rect {
+		w: 1,
+	}
+	measure(r)
+}`,
+			errors: []string{"rect does not implement shape (wrong type for method area)"},
+		},
+		{
+			name: "unknown method",
+			source: `pkg main
+interface shape {
+	i32 area()
+}
+i32 perimeter(shape s) {
+	return s.perimeter()
+}`,
+			errors: []string{"s.perimeter undefined (type shape has no method perimeter)"},
+		},
+		{
+			name: "method on enum",
+			source: `pkg main
+enum Color { Red, Green }
+i32 (Color c) value() {
+	return 0
+}`,
+			errors: []string{"invalid receiver type Color (methods can only be declared on structs)"},
+		},
+		{
+			name: "assert outside of test",
+			source: `pkg main
+fn main() {
+	assert(true)
+}`,
+			errors: []string{"assert is only allowed in test blocks"},
+		},
+		{
+			name: "non-boolean assert",
+			source: `pkg main
+test "one" {
+	assert(1)
+}`,
+			errors: []string{"non-boolean condition 1 (i32) in assert"},
+		},
+		{
+			name: "duplicate test",
+			source: `pkg main
+test "one" {
+	assert(true)
+}
+test "one" {
+	assert(true)
+}`,
+			errors: []string{`test "one" redeclared`},
+		},
+		{
+			name: "multiple errors",
+			source: `pkg main
+fn main() {
+	i32 a = "hello"
+	println(b)
+}`,
+			errors: []string{"cannot use hello", "undefined: b"},
+		},
+		{
+			name: "conversion arguments",
+			source: `pkg main
+fn main() {
+	f64 a = f64(1, 2)
+	i32 b = i32("one")
+}`,
+			errors: []string{
+				"conversion to f64 takes exactly one argument",
+				"cannot convert one (str) to i32",
+			},
+		},
+		{
+			name: "deferred conversion",
+			source: `pkg main
+fn main() {
+	defer i32(1.5)
+}`,
+			errors: []string{"defer requires function call, not conversion"},
+		},
+		{
+			name: "multiple results",
+			source: `pkg main
+(i32, bool) pair() {
+	return 1, true
+}
+fn main() {
+	i32 a = pair()
+	i32 b, bool c, i32 d = pair()
+	i32 e, i32 f = pair()
+}`,
+			errors: []string{
+				"multiple-value pair() (value of type (i32, bool)) in single-value context",
+				"assignment mismatch: 3 variables but pair() returns 2 values",
+				"cannot use value 2 of pair() (bool) as i32 in variable declaration",
+			},
+		},
+		{
+			name: "function values",
+			source: `pkg main
+bool odd(i32 n) {
+	return n % 2 == 1
+}
+fn main() {
+	fn(i32) i32 f = odd
+	fn(i32) bool g = fn(i32 n) bool {
+		return n
+	}
+	bool b = g("one")
+}`,
+			errors: []string{
+				"cannot use odd (fn(i32) bool) as fn(i32) i32 in variable declaration",
+				"cannot use n (i32) as bool in return statement",
+				"cannot use one (str) as i32 in argument to g",
+			},
+		},
+		{
+			name: "maps",
+			source: `pkg main
+fn main() {
+	map[str]i32 ages = {"ann": 31, "bob": "old"}
+	map[f32]str names = {}
+	i32 n = ages[1]
+	str s = ages["ann"]
+	delete(ages, 2)
+	bool ok = has(n, "ann")
+	[]str ks = keys(ages)
+	[]i32 ns = keys(ages)
+	ages = {1, 2}
+}`,
+			errors: []string{
+				"cannot use old (str) as i32 in map literal",
+				"invalid map key type f32",
+				"cannot use 1 (untyped int) as str in map index",
+				"cannot use (ages[ann]) (i32) as str in variable declaration",
+				"cannot use 2 (untyped int) as str in argument to delete",
+				"invalid argument: n (i32) is not a map",
+				"cannot use keys(ages) ([]str) as []i32 in variable declaration",
+				"list literal [1, 2] must be used where a list is expected",
+			},
+		},
+		{
+			name: "for in",
+			source: `pkg main
+fn main() {
+	[]str names = {"ann"}
+	map[str]i32 ages = {"ann": 31}
+	i64 big = 10
+	for i, name in names {
+		i32 n = name
+	}
+	for ch in "abc" {
+		str c = ch
+	}
+	for k, v in ages {
+		i32 x = k
+	}
+	for i in 0..big {
+		i32 m = i
+	}
+	for i, j in 0..3 {
+	}
+	for x in 7 {
+	}
+	for i in 0.."a" {
+	}
+	for i in 2..big {
+	}
+}`,
+			errors: []string{
+				"cannot use name (str) as i32 in variable declaration",
+				"cannot use ch (u8) as str in variable declaration",
+				"cannot use k (str) as i32 in variable declaration",
+				"cannot use i (i64) as i32 in variable declaration",
+				"range over 0..3 permits only 1 variable",
+				"cannot range over 7 (untyped int)",
+				"invalid range bound a (str must be integer)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := check(t, tt.source)
+			if err == nil {
+				t.Fatalf("expected errors, got none")
+			}
+			list, ok := err.(diagnostic.List)
+			if !ok {
+				t.Fatalf("expected diagnostic.List, got %T", err)
+			}
+			if len(list) != len(tt.errors) {
+				t.Fatalf("expected %d errors, got %d:\n%v", len(tt.errors), len(list), err)
+			}
+			for i, want := range tt.errors {
+				if !strings.Contains(list[i].Message, want) {
+					t.Errorf("error %d: got %q, want it to contain %q", i, list[i].Message, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckErrorPositions(t *testing.T) {
+	_, err := check(t, `pkg main
+fn main() {
+	i32 v = fn(i32 x) i32 {
+		return x
+	}
+	fn() i32 f = fn() i32 {
+		println(v)
+	}
+}`)
+	list, ok := err.(diagnostic.List)
+	if !ok {
+		t.Fatalf("expected diagnostic.List, got %T", err)
+	}
+	want := []string{"3:10", "8:2"}
+	if len(list) != len(want) {
+		t.Fatalf("expected %d errors, got %d:\n%v", len(want), len(list), err)
+	}
+	for i, d := range list {
+		if got := fmt.Sprintf("%d:%d", d.Pos.Line, d.Pos.Column); got != want[i] {
+			t.Errorf("error %d (%s): got position %s, want %s", i, d.Message, got, want[i])
+		}
+	}
+}
+
+func TestCheckTypes(t *testing.T) {
+	program, err := check(t, `pkg main
+struct point {
+	i32 x
+	i64 y
+}
+fn main() {
+	point p = point {
+		x: 1,
+		y: 2,
+	}
+	println(p.y + 7)
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{}
+	for expr, typ := range program.Info.Types {
+		got[expr.String()] = typ.String()
+	}
+	want := map[string]string{
+		"p.y":       "i64",
+		"(p.y + 7)": "i64",
+		"7":         "i64",
+		"2":         "i64",
+	}
+	for expr, typ := range want {
+		if got[expr] != typ {
+			t.Errorf("type of %s: got %q, want %q", expr, got[expr], typ)
+		}
+	}
+}
+
+func TestCheckEnumValues(t *testing.T) {
+	program, err := check(t, `pkg main
+enum Status { Ok = 200, Created, NotFound = 404, Low = -1, Next }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int64{"Ok": 200, "Created": 201, "NotFound": 404, "Low": -1, "Next": 0}
+	status := program.Info.Enums["Status"]
+	if status == nil || len(status.Variants) != len(want) {
+		t.Fatalf("expected %d variants, got %v", len(want), status)
+	}
+	for _, v := range status.Variants {
+		if v.Value != want[v.Name] {
+			t.Errorf("value of %s: got %d, want %d", v.Name, v.Value, want[v.Name])
+		}
+	}
+}
+
+func TestCheckInterfaceConversions(t *testing.T) {
+	program, err := check(t, `pkg main
+interface shape {
+	i32 area()
+}
+struct rect {
+	i32 w
+	i32 h
+}
+i32 (rect r) area() {
+	return r.w * r.h
+}
+i32 double(shape s) {
+	return s.area() * 2
+}
+fn main() {
+	rect r = rect {
+		w: 1,
+		h: 2,
+	}
+	shape s = r
+	println(double(r) + double(s))
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{}
+	for expr, iface := range program.Info.Conversions {
+		got[expr.String()] = iface.Name
+	}
+	// r is converted where it is assigned to s and where it is passed to
+	// double, s already is an interface value
+	if len(got) != 1 || got["r"] != "shape" {
+		t.Errorf("conversions: got %v, want r converted to shape", got)
+	}
+	if n := len(program.Info.Conversions); n != 2 {
+		t.Errorf("expected 2 conversions, got %d", n)
+	}
+	if rect := program.Info.Structs["rect"]; len(rect.Methods) != 1 || rect.Methods[0].Name != "area" {
+		t.Errorf("expected rect to have method area, got %v", rect.Methods)
+	}
+}
+
+// checkPackages checks a program with one file for each import path in
+// sources. The empty path is the package the program is loaded from.
+func checkPackages(t *testing.T, sources map[string]string) (*checker.Program, error) {
+	t.Helper()
+	program := &ast.Program{}
+	for path, source := range sources {
+		filename := path + "/test.pun"
+		parsed, err := parser.New(lexer.New(filename, source)).ParseProgram(filename)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", filename, err)
+		}
+		for _, file := range parsed.Files {
+			file.ImportPath = path
+		}
+		program.Files = append(program.Files, parsed.Files...)
+	}
+	return checker.Check(program)
+}
+
+func TestCheckPackages(t *testing.T) {
+	math := `pkg math
+pub i32 add(i32 a, i32 b) {
+	return helper(a) + b
+}
+i32 helper(i32 a) {
+	return a
+}
+struct point {
+	i32 x
+}`
+
+	program, err := checkPackages(t, map[string]string{
+		"math": math,
+		"": `pkg main
+import "math"
+i32 helper(i32 a) {
+	return a
+}
+fn main() {
+	println(math.add(helper(1), 2))
+}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if program.Info.Functions["math.add"] == nil || program.Info.Functions["helper"] == nil {
+		t.Errorf("expected math.add and helper to be recorded, got %v", program.Info.Functions)
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		errors []string
+	}{
+		{
+			name: "unexported function",
+			source: `pkg main
+import "math"
+fn main() {
+	println(math.helper(1))
+}`,
+			errors: []string{"helper is not exported by package math"},
+		},
+		{
+			name: "undefined member",
+			source: `pkg main
+import "math"
+fn main() {
+	println(math.sub(1, 2))
+}`,
+			errors: []string{"undefined: math.sub"},
+		},
+		{
+			name: "package without selector",
+			source: `pkg main
+import "math"
+fn main() {
+	println(math)
+}`,
+			errors: []string{"use of package math without selector"},
+		},
+		{
+			name: "missing package",
+			source: `pkg main
+import "geo"
+fn main() {
+}`,
+			errors: []string{"could not import geo (package not found)"},
+		},
+		{
+			name: "type declared in two packages",
+			source: `pkg main
+import "math"
+struct point {
+	i32 x
+}
+fn main() {
+}`,
+			errors: []string{"type point is also declared in package"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := checkPackages(t, map[string]string{"math": math, "": tt.source})
+			list, ok := err.(diagnostic.List)
+			if !ok {
+				t.Fatalf("expected diagnostic.List, got %v", err)
+			}
+			if len(list) != len(tt.errors) {
+				t.Fatalf("expected %d errors, got %d:\n%v", len(tt.errors), len(list), err)
+			}
+			for i, want := range tt.errors {
+				if !strings.Contains(list[i].Message, want) {
+					t.Errorf("error %d: got %q, want it to contain %q", i, list[i].Message, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package checker
+
+import (
+	"math/big"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/token"
+)
+
+// Untyped integer constants are evaluated exactly, so that only the value
+// a constant expression ends up with has to fit in the type it is used as.
+
+// constantValue evaluates an integer constant expression made of literals,
+// negation and arithmetic. It reports false for any other expression and
+// for a division by zero.
+func constantValue(expr ast.Expression) (*big.Int, bool) {
+	switch e := expr.(type) {
+	case *ast.IntegerLiteral:
+		// the value of a literal above the range of an i64 only fits
+		// in its text
+		if v, ok := new(big.Int).SetString(e.Token.Literal, 10); ok {
+			return v, true
+		}
+		return big.NewInt(e.Value), true
+	case *ast.PrefixExpression:
+		v, ok := constantValue(e.Right)
+		if !ok || e.Operator.Type != token.MINUS {
+			return nil, false
+		}
+		return v.Neg(v), true
+	case *ast.InfixExpression:
+		l, ok := constantValue(e.Left)
+		if !ok {
+			return nil, false
+		}
+		r, ok := constantValue(e.Right)
+		if !ok {
+			return nil, false
+		}
+		switch e.Operator.Type {
+		case token.PLUS:
+			return l.Add(l, r), true
+		case token.MINUS:
+			return l.Sub(l, r), true
+		case token.ASTERISK:
+			return l.Mul(l, r), true
+		case token.SLASH:
+			if r.Sign() != 0 {
+				return l.Quo(l, r), true
+			}
+		case token.MOD:
+			if r.Sign() != 0 {
+				return l.Rem(l, r), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// intBits holds the size in bits of each integer type.
+var intBits = map[BasicKind]uint{
+	U8: 8, U16: 16, U32: 32, U64: 64,
+	I8: 8, I16: 16, I32: 32, I64: 64,
+}
+
+// representable reports whether an integer fits in an integer type.
+func representable(v *big.Int, t Type) bool {
+	bits, ok := intBits[basicKind(t)]
+	if !ok {
+		return true
+	}
+	one := big.NewInt(1)
+	if IsUnsigned(t) {
+		max := new(big.Int).Lsh(one, bits)
+		return v.Sign() >= 0 && v.Cmp(max) < 0
+	}
+	limit := new(big.Int).Lsh(one, bits-1)
+	return v.Cmp(new(big.Int).Neg(limit)) >= 0 && v.Cmp(limit) < 0
+}
@@ -0,0 +1,17 @@
+package checker
+
+import (
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/diagnostic"
+	"github.com/dfirebaugh/punch/token"
+)
+
+func (c *Checker) errorf(at ast.Node, format string, args ...interface{}) {
+	c.errors = append(c.errors, diagnostic.At(at, format, args...))
+}
+
+// errorAt reports an error at a token that no node spans, such as the
+// closing brace of a block.
+func (c *Checker) errorAt(tok token.Token, format string, args ...interface{}) {
+	c.errors = append(c.errors, diagnostic.New(tok, format, args...))
+}
@@ -0,0 +1,843 @@
+package checker
+
+import (
+	"slices"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/token"
+)
+
+// checkValue checks an expression that must produce a value.
+func (c *Checker) checkValue(expr ast.Expression) Type {
+	t := c.checkExpression(expr)
+	if IsVoid(t) {
+		c.errorf(expr, "%s (no value) used as value", expr.String())
+		return Typ[Invalid]
+	}
+	if _, ok := t.(*Tuple); ok {
+		c.errorf(expr, "multiple-value %s (value of type %s) in single-value context", expr.String(), t)
+		return Typ[Invalid]
+	}
+	return t
+}
+
+func (c *Checker) checkExpression(expr ast.Expression) Type {
+	if expr == nil {
+		return Typ[Invalid]
+	}
+	return c.record(expr, c.expression(expr))
+}
+
+func (c *Checker) expression(expr ast.Expression) Type {
+	switch e := expr.(type) {
+	case *ast.IntegerLiteral:
+		return Typ[UntypedInt]
+	case *ast.Integer:
+		return Typ[UntypedInt]
+	case *ast.FloatLiteral:
+		return Typ[UntypedFloat]
+	case *ast.StringLiteral:
+		return Typ[Str]
+	case *ast.BooleanLiteral, *ast.Boolean:
+		return Typ[Bool]
+	case *ast.Identifier:
+		sym := c.lookup(e)
+		if sym == nil {
+			return Typ[Invalid]
+		}
+		if sym.Kind == TypeSymbol || sym.Kind == BuiltinSymbol {
+			c.errorf(e, "%s is not an expression", e.Value)
+			return Typ[Invalid]
+		}
+		if sym.Kind == PackageSymbol {
+			c.errorf(e, "use of package %s without selector", e.Value)
+			return Typ[Invalid]
+		}
+		return sym.Type
+	case *ast.PrefixExpression:
+		return c.checkPrefixExpression(e)
+	case *ast.InfixExpression:
+		return c.checkBinary(e, e.Left, e.Operator, e.Right)
+	case *ast.BinaryExpression:
+		return c.checkBinary(e, e.Left, e.Operator, e.Right)
+	case *ast.AssignmentExpression:
+		return c.checkAssignmentExpression(e)
+	case *ast.FunctionCall:
+		return c.checkCall(e, e.Function, e.Arguments)
+	case *ast.CallExpression:
+		return c.checkCall(e, e.Function, e.Arguments)
+	case *ast.ListOperation:
+		args := []ast.Expression{e.List}
+		if e.Element != nil {
+			args = append(args, e.Element)
+		}
+		return c.checkBuiltin(e, e.Operator, args)
+	case *ast.IndexExpression:
+		return c.checkIndexExpression(e)
+	case *ast.SliceExpression:
+		return c.checkSliceExpression(e)
+	case *ast.RangeExpression:
+		return c.checkRangeExpression(e)
+	case *ast.ListLiteral:
+		c.errorf(e, "list literal %s must be used where a list is expected", e.String())
+		return Typ[Invalid]
+	case *ast.HashLiteral:
+		c.errorf(e, "map literal %s must be used where a map is expected", e.String())
+		return Typ[Invalid]
+	case *ast.StructLiteral:
+		return c.checkStructLiteral(e)
+	case *ast.StructFieldAccess:
+		return c.checkStructFieldAccess(e)
+	case *ast.FunctionLiteral:
+		return c.checkFunctionLiteral(e)
+	case *ast.StructFieldAssignment:
+		left := c.checkStructFieldAccess(e.Left)
+		c.record(e.Left, left)
+		v := c.checkValueFor(e.Right, left)
+		c.assignable(v, left, e.Right, "assignment")
+		c.convertUntyped(e.Right, left)
+		return Typ[Void]
+	case *ast.IndexAssignment:
+		left := c.checkIndexExpression(e.Left)
+		c.record(e.Left, left)
+		if IsString(c.info.TypeOf(e.Left.Left)) {
+			c.errorf(e, "cannot assign to %s (strings are immutable)", e.Left.String())
+		}
+		v := c.checkValueFor(e.Right, left)
+		c.assignable(v, left, e.Right, "assignment")
+		c.convertUntyped(e.Right, left)
+		return Typ[Void]
+	}
+	c.errorf(expr, "unsupported expression %s", expr.String())
+	return Typ[Invalid]
+}
+
+func (c *Checker) lookup(ident *ast.Identifier) *Symbol {
+	sym := c.scope.Lookup(ident.Value)
+	if sym == nil {
+		c.errorf(ident, "undefined: %s", ident.Value)
+		return nil
+	}
+	c.info.Uses[ident] = sym
+	if sym.Kind == VarSymbol {
+		c.capture(sym)
+	}
+	return sym
+}
+
+// literal is a function literal whose body is being checked.
+type literal struct {
+	node *ast.FunctionLiteral
+	// scope holds the literal's parameters
+	scope *Scope
+}
+
+// checkFunctionLiteral checks the body of an anonymous function as if it
+// were a function of its own. Its type is its signature.
+func (c *Checker) checkFunctionLiteral(lit *ast.FunctionLiteral) Type {
+	sig := c.signature(lit.Parameters, lit.ReturnTypes)
+	fn := c.fn
+	c.fn = sig
+	c.openScope()
+	c.literals = append(c.literals, &literal{node: lit, scope: c.scope})
+	for i, param := range lit.Parameters {
+		c.declare(param.Identifier, VarSymbol, sig.Params[i])
+	}
+	if lit.Body != nil {
+		for _, stmt := range lit.Body.Statements {
+			c.checkStatement(stmt)
+		}
+	}
+	c.checkReturns(sig, lit.Body)
+	c.literals = c.literals[:len(c.literals)-1]
+	c.closeScope()
+	c.fn = fn
+	return sig
+}
+
+// capture records a variable used by the function literals around the
+// current scope that do not declare it.
+func (c *Checker) capture(sym *Symbol) {
+	if len(c.literals) == 0 {
+		return
+	}
+	declared := c.scope
+	for declared != nil && declared.symbols[sym.Name] != sym {
+		declared = declared.parent
+	}
+	for i := len(c.literals) - 1; i >= 0; i-- {
+		lit := c.literals[i]
+		if lit.scope.encloses(declared) {
+			// the literals around this one declare it too
+			return
+		}
+		if !slices.Contains(c.info.Captures[lit.node], sym) {
+			c.info.Captures[lit.node] = append(c.info.Captures[lit.node], sym)
+		}
+	}
+}
+
+func (c *Checker) checkPrefixExpression(e *ast.PrefixExpression) Type {
+	t := c.checkValue(e.Right)
+	if isInvalid(t) {
+		return t
+	}
+	switch e.Operator.Type {
+	case token.BANG:
+		if !IsBoolean(t) {
+			c.errorf(e, "operator ! not defined on %s (%s)", e.Right.String(), t)
+			return Typ[Invalid]
+		}
+	case token.MINUS, token.PLUS:
+		if !IsNumeric(t) {
+			c.errorf(e, "operator %s not defined on %s (%s)", e.Operator.Literal, e.Right.String(), t)
+			return Typ[Invalid]
+		}
+	default:
+		c.errorf(e, "unknown prefix operator %s", e.Operator.Literal)
+		return Typ[Invalid]
+	}
+	return t
+}
+
+func (c *Checker) checkBinary(e ast.Expression, left ast.Expression, op token.Token, right ast.Expression) Type {
+	lt := c.checkValue(left)
+	rt := c.checkValue(right)
+	if isInvalid(lt) || isInvalid(rt) {
+		return Typ[Invalid]
+	}
+
+	// an untyped operand takes on the type of the other operand
+	operand := lt
+	switch {
+	case IsUntyped(lt) && !IsUntyped(rt):
+		if !AssignableTo(lt, rt) {
+			return c.mismatch(e, lt, rt)
+		}
+		c.convertUntyped(left, rt)
+		operand = rt
+	case IsUntyped(rt) && !IsUntyped(lt):
+		if !AssignableTo(rt, lt) {
+			return c.mismatch(e, lt, rt)
+		}
+		c.convertUntyped(right, lt)
+	case IsUntyped(lt) && IsUntyped(rt):
+		if IsFloat(rt) {
+			operand = rt
+		}
+		if isComparison(op) {
+			c.convertUntyped(left, Default(operand))
+			c.convertUntyped(right, Default(operand))
+			operand = Default(operand)
+		}
+	case !Identical(lt, rt):
+		return c.mismatch(e, lt, rt)
+	}
+
+	switch op.Type {
+	case token.PLUS:
+		if IsNumeric(operand) || IsString(operand) {
+			return operand
+		}
+	case token.MINUS, token.ASTERISK, token.SLASH:
+		if IsNumeric(operand) {
+			return operand
+		}
+	case token.MOD:
+		if IsInteger(operand) {
+			return operand
+		}
+	case token.EQ, token.NOT_EQ:
+		if IsNumeric(operand) || IsString(operand) || IsBoolean(operand) || IsEnum(operand) {
+			return Typ[Bool]
+		}
+	case token.LT, token.GT, token.LT_EQUALS, token.GT_EQUALS:
+		if IsNumeric(operand) || IsString(operand) {
+			return Typ[Bool]
+		}
+	case token.AND, token.OR:
+		if IsBoolean(operand) {
+			return Typ[Bool]
+		}
+	default:
+		c.errorf(e, "unknown operator %s", op.Literal)
+		return Typ[Invalid]
+	}
+	c.errorf(e, "operator %s not defined on %s (%s)", op.Literal, e.String(), operand)
+	return Typ[Invalid]
+}
+
+func isComparison(op token.Token) bool {
+	switch op.Type {
+	case token.EQ, token.NOT_EQ, token.LT, token.GT, token.LT_EQUALS, token.GT_EQUALS:
+		return true
+	}
+	return false
+}
+
+func (c *Checker) mismatch(e ast.Expression, lt, rt Type) Type {
+	c.errorf(e, "invalid operation: %s (mismatched types %s and %s)", e.String(), lt, rt)
+	return Typ[Invalid]
+}
+
+func (c *Checker) checkAssignmentExpression(e *ast.AssignmentExpression) Type {
+	ident, ok := e.Left.(*ast.Identifier)
+	if !ok {
+		c.errorf(e, "cannot assign to %s", e.Left.String())
+		return Typ[Invalid]
+	}
+	if e.Token.Type == token.INFER {
+		t := Default(c.checkValue(e.Right))
+		c.convertUntyped(e.Right, t)
+		c.declare(ident, VarSymbol, t)
+		c.record(ident, t)
+		return Typ[Void]
+	}
+	c.checkAssignment(ident, e.Right)
+	if sym := c.info.Uses[ident]; sym != nil {
+		c.record(ident, sym.Type)
+	}
+	return Typ[Void]
+}
+
+func (c *Checker) checkCall(call ast.Expression, fn ast.Expression, args []ast.Expression) Type {
+	if access, ok := fn.(*ast.StructFieldAccess); ok {
+		return c.checkMethodCall(call, access, args)
+	}
+	ident, ok := fn.(*ast.Identifier)
+	if !ok {
+		return c.checkValueCall(call, fn, args)
+	}
+	if t, ok := basicTypes[token.Type(ident.Value)]; ok && IsNumeric(t) {
+		return c.checkNumericConversion(call, t, args)
+	}
+	sym := c.lookup(ident)
+	if sym == nil {
+		for _, arg := range args {
+			c.checkExpression(arg)
+		}
+		return Typ[Invalid]
+	}
+	if sym.Kind == BuiltinSymbol {
+		return c.checkBuiltin(call, ident.Value, args)
+	}
+	sig, ok := sym.Type.(*Signature)
+	if !ok {
+		c.errorf(call, "cannot call non-function %s (%s)", ident.Value, sym.Type)
+		return Typ[Invalid]
+	}
+	c.record(ident, sig)
+	c.checkArguments(call, ident.Value, sig, args)
+	return result(sig)
+}
+
+// checkValueCall checks a call of a function value that an expression other
+// than a name yields, such as adder(2)(3) or handlers[0]().
+func (c *Checker) checkValueCall(call ast.Expression, fn ast.Expression, args []ast.Expression) Type {
+	t := c.checkValue(fn)
+	sig, ok := t.(*Signature)
+	if !ok {
+		if !isInvalid(t) {
+			c.errorf(call, "cannot call non-function %s (%s)", fn.String(), t)
+		}
+		for _, arg := range args {
+			c.checkExpression(arg)
+		}
+		return Typ[Invalid]
+	}
+	c.checkArguments(call, fn.String(), sig, args)
+	return result(sig)
+}
+
+// checkNumericConversion checks a conversion such as f64(n) between numeric
+// types. Integers converted to a narrower type are truncated and floats
+// converted to an integer type are rounded toward zero.
+func (c *Checker) checkNumericConversion(call ast.Expression, t *Basic, args []ast.Expression) Type {
+	if len(args) != 1 {
+		for _, arg := range args {
+			c.checkExpression(arg)
+		}
+		c.errorf(call, "conversion to %s takes exactly one argument", t)
+		return Typ[Invalid]
+	}
+	v := c.checkValue(args[0])
+	if isInvalid(v) {
+		return Typ[Invalid]
+	}
+	if !IsNumeric(v) {
+		c.errorf(call, "cannot convert %s (%s) to %s", args[0].String(), v, t)
+		return Typ[Invalid]
+	}
+	if IsUntyped(v) {
+		// constants keep their own kind, 1.5 is converted from a float
+		if AssignableTo(v, t) {
+			c.convertUntyped(args[0], t)
+		} else {
+			c.convertUntyped(args[0], Default(v))
+		}
+	}
+	c.info.NumericConversions[call] = t
+	return t
+}
+
+// result returns the type of a call to a function with the given signature.
+func result(sig *Signature) Type {
+	switch len(sig.Results) {
+	case 0:
+		return Typ[Void]
+	case 1:
+		return sig.Results[0]
+	}
+	return &Tuple{Types: sig.Results}
+}
+
+// checkPackageCall checks a call such as math.add(1, 2) to a function of an
+// imported package.
+func (c *Checker) checkPackageCall(call ast.Expression, access *ast.StructFieldAccess, pkg *Symbol, args []ast.Expression) Type {
+	member := c.checkPackageMember(access, pkg)
+	sig, ok := member.Type.(*Signature)
+	if !ok {
+		if !isInvalid(member.Type) {
+			c.errorf(call, "cannot call non-function %s (%s)", access.String(), member.Type)
+		}
+		for _, arg := range args {
+			c.checkExpression(arg)
+		}
+		return Typ[Invalid]
+	}
+	c.record(access, sig)
+	c.checkArguments(call, access.String(), sig, args)
+	return result(sig)
+}
+
+// packageOf returns the symbol of the imported package an expression names,
+// or false if it does not name one.
+func (c *Checker) packageOf(expr ast.Expression) (*Symbol, bool) {
+	ident, ok := expr.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+	sym := c.scope.Lookup(ident.Value)
+	if sym == nil || sym.Kind != PackageSymbol {
+		return nil, false
+	}
+	c.info.Uses[ident] = sym
+	return sym, true
+}
+
+// checkPackageMember resolves a qualified identifier such as math.add. Only
+// the pub functions of a package can be used by other packages. An invalid
+// symbol is returned if the member cannot be used.
+func (c *Checker) checkPackageMember(access *ast.StructFieldAccess, pkg *Symbol) *Symbol {
+	invalid := &Symbol{Name: access.Field.Value, Type: Typ[Invalid]}
+	dep, ok := c.packages[pkg.Pkg]
+	if !ok {
+		return invalid
+	}
+	member, ok := dep.scope.symbols[access.Field.Value]
+	if !ok {
+		c.errorf(access, "undefined: %s", access.String())
+		return invalid
+	}
+	if !member.Exported {
+		c.errorf(access, "%s is not exported by package %s", access.Field.Value, pkg.Name)
+		return invalid
+	}
+	c.info.Uses[access.Field] = member
+	return member
+}
+
+// checkMethodCall checks a call such as r.area() on a struct or an interface
+// value. The access is recorded with the type of the method.
+func (c *Checker) checkMethodCall(call ast.Expression, access *ast.StructFieldAccess, args []ast.Expression) Type {
+	if pkg, ok := c.packageOf(access.Left); ok {
+		return c.checkPackageCall(call, access, pkg, args)
+	}
+	recv := c.checkValue(access.Left)
+	var method *Method
+	ok := false
+	switch t := recv.(type) {
+	case *Struct:
+		method, ok = t.Method(access.Field.Value)
+		if _, field := t.Field(access.Field.Value); !ok && field {
+			// a field that holds a function value
+			return c.checkValueCall(call, access, args)
+		}
+	case *Interface:
+		method, ok = t.Method(access.Field.Value)
+	}
+	if !ok {
+		if !isInvalid(recv) {
+			c.errorf(access, "%s undefined (type %s has no method %s)", access.String(), recv, access.Field.Value)
+		}
+		for _, arg := range args {
+			c.checkExpression(arg)
+		}
+		return Typ[Invalid]
+	}
+	c.record(access, method.Sig)
+	c.checkArguments(call, access.String(), method.Sig, args)
+	return result(method.Sig)
+}
+
+func (c *Checker) checkArguments(call ast.Expression, name string, sig *Signature, args []ast.Expression) {
+	types := make([]Type, len(args))
+	for i, arg := range args {
+		if i < len(sig.Params) {
+			types[i] = c.checkValueFor(arg, sig.Params[i])
+		} else {
+			types[i] = c.checkValue(arg)
+		}
+	}
+
+	if len(args) != len(sig.Params) {
+		msg := "not enough"
+		if len(args) > len(sig.Params) {
+			msg = "too many"
+		}
+		c.errorf(call, "%s arguments in call to %s\n\thave %s\n\twant %s", msg, name, typeList(types), typeList(sig.Params))
+		return
+	}
+	for i, arg := range args {
+		c.assignable(types[i], sig.Params[i], arg, "argument to "+name)
+		c.convertUntyped(arg, sig.Params[i])
+	}
+}
+
+func (c *Checker) checkBuiltin(call ast.Expression, name string, args []ast.Expression) Type {
+	types := make([]Type, len(args))
+	for i, arg := range args {
+		types[i] = c.checkValue(arg)
+		// an untyped element takes the type of the list it is appended to
+		// and an untyped key the type of the keys of its map
+		if (name == BuiltinAppend || name == BuiltinDelete || name == BuiltinHas) && i == 1 {
+			continue
+		}
+		if IsUntyped(types[i]) {
+			types[i] = Default(types[i])
+			c.convertUntyped(arg, types[i])
+		}
+	}
+
+	switch name {
+	case BuiltinPrintln:
+		return Typ[Void]
+	case BuiltinLen:
+		if len(args) != 1 {
+			c.errorf(call, "len expects 1 argument, got %d", len(args))
+			return Typ[Invalid]
+		}
+		switch types[0].(type) {
+		case *List, *Map:
+		default:
+			if !IsString(types[0]) && !isInvalid(types[0]) {
+				c.errorf(args[0], "invalid argument: %s (%s) for len", args[0].String(), types[0])
+			}
+		}
+		return Typ[I32]
+	case BuiltinAppend:
+		if len(args) != 2 {
+			c.errorf(call, "append expects 2 arguments, got %d", len(args))
+			return Typ[Invalid]
+		}
+		list, ok := types[0].(*List)
+		if !ok {
+			c.convertUntyped(args[1], Default(types[1]))
+			if !isInvalid(types[0]) {
+				c.errorf(args[0], "invalid argument: %s (%s) is not a list", args[0].String(), types[0])
+			}
+			return Typ[Void]
+		}
+		c.assignable(types[1], list.Elem, args[1], "argument to append")
+		c.convertUntyped(args[1], list.Elem)
+		return Typ[Void]
+	case BuiltinDelete, BuiltinHas:
+		result := Typ[Void]
+		if name == BuiltinHas {
+			result = Typ[Bool]
+		}
+		if len(args) != 2 {
+			c.errorf(call, "%s expects 2 arguments, got %d", name, len(args))
+			return result
+		}
+		m, ok := types[0].(*Map)
+		if !ok {
+			c.convertUntyped(args[1], Default(types[1]))
+			if !isInvalid(types[0]) {
+				c.errorf(args[0], "invalid argument: %s (%s) is not a map", args[0].String(), types[0])
+			}
+			return result
+		}
+		c.assignable(types[1], m.Key, args[1], "argument to "+name)
+		c.convertUntyped(args[1], m.Key)
+		return result
+	case BuiltinKeys:
+		if len(args) != 1 {
+			c.errorf(call, "keys expects 1 argument, got %d", len(args))
+			return Typ[Invalid]
+		}
+		m, ok := types[0].(*Map)
+		if !ok {
+			if !isInvalid(types[0]) {
+				c.errorf(args[0], "invalid argument: %s (%s) is not a map", args[0].String(), types[0])
+			}
+			return Typ[Invalid]
+		}
+		return &List{Elem: m.Key}
+	case BuiltinAssert:
+		if !c.inTest {
+			c.errorf(call, "assert is only allowed in test blocks")
+		}
+		if len(args) != 1 {
+			c.errorf(call, "assert expects 1 argument, got %d", len(args))
+			return Typ[Void]
+		}
+		if !isInvalid(types[0]) && !IsBoolean(types[0]) {
+			c.errorf(args[0], "non-boolean condition %s (%s) in assert", args[0].String(), types[0])
+		}
+		return Typ[Void]
+	}
+	c.errorf(call, "unknown builtin %s", name)
+	return Typ[Invalid]
+}
+
+func (c *Checker) checkIndexExpression(e *ast.IndexExpression) Type {
+	left := c.checkValue(e.Left)
+	if m, ok := left.(*Map); ok {
+		// a key that is not in the map reads as the zero value
+		key := c.checkValue(e.Index)
+		c.assignable(key, m.Key, e.Index, "map index")
+		c.convertUntyped(e.Index, m.Key)
+		return m.Elem
+	}
+	index := c.checkValue(e.Index)
+	if !isInvalid(index) && !IsInteger(index) {
+		c.errorf(e.Index, "invalid index %s (%s must be integer)", e.Index.String(), index)
+	}
+	if IsUntyped(index) {
+		c.convertUntyped(e.Index, Typ[I32])
+	}
+	switch t := left.(type) {
+	case *List:
+		return t.Elem
+	default:
+		if IsString(t) {
+			return Typ[U8]
+		}
+		if !isInvalid(t) {
+			c.errorf(e, "cannot index %s (%s)", e.Left.String(), t)
+		}
+	}
+	return Typ[Invalid]
+}
+
+// checkRangeExpression checks the bounds of a range, which are integers of
+// the same type. The range has the type of its bounds.
+func (c *Checker) checkRangeExpression(e *ast.RangeExpression) Type {
+	low, high := c.checkValue(e.Low), c.checkValue(e.High)
+	for _, bound := range []ast.Expression{e.Low, e.High} {
+		if t := c.info.Types[bound]; !isInvalid(t) && !IsInteger(t) {
+			c.errorf(bound, "invalid range bound %s (%s must be integer)", bound.String(), t)
+			return Typ[Invalid]
+		}
+	}
+	if isInvalid(low) || isInvalid(high) {
+		return Typ[Invalid]
+	}
+	if !IsUntyped(low) && !IsUntyped(high) && !Identical(low, high) {
+		return c.mismatch(e, low, high)
+	}
+	t := low
+	if IsUntyped(t) {
+		t = Default(high)
+	}
+	c.convertUntyped(e.Low, t)
+	c.convertUntyped(e.High, t)
+	return t
+}
+
+func (c *Checker) checkSliceExpression(e *ast.SliceExpression) Type {
+	left := c.checkValue(e.Left)
+	for _, bound := range []ast.Expression{e.Low, e.High} {
+		if bound == nil {
+			continue
+		}
+		t := c.checkValue(bound)
+		if !isInvalid(t) && !IsInteger(t) {
+			c.errorf(bound, "invalid slice index %s (%s must be integer)", bound.String(), t)
+		}
+		if IsUntyped(t) {
+			c.convertUntyped(bound, Typ[I32])
+		}
+	}
+	if IsString(left) {
+		return left
+	}
+	if !isInvalid(left) {
+		c.errorf(e, "cannot slice %s (%s)", e.Left.String(), left)
+	}
+	return Typ[Invalid]
+}
+
+// checkValueFor checks a value that is assigned to a variable or field of
+// type t, passed as an argument of type t or returned as a result of type
+// t. A list literal takes the type of the list it is assigned to, and {}
+// the type of a map.
+func (c *Checker) checkValueFor(value ast.Expression, t Type) Type {
+	if lit, ok := value.(*ast.ListLiteral); ok {
+		if list, ok := t.(*List); ok {
+			c.checkListLiteral(lit, list)
+			return list
+		}
+		// {} is parsed as a list but is an empty map where a map is
+		// expected
+		if m, ok := t.(*Map); ok && len(lit.Elements) == 0 {
+			c.record(lit, m)
+			return m
+		}
+	}
+	if lit, ok := value.(*ast.HashLiteral); ok {
+		if m, ok := t.(*Map); ok {
+			c.checkHashLiteral(lit, m)
+			return m
+		}
+	}
+	return c.checkValue(value)
+}
+
+func (c *Checker) checkListLiteral(lit *ast.ListLiteral, list *List) {
+	c.record(lit, list)
+	for _, el := range lit.Elements {
+		if el == nil {
+			continue
+		}
+		t := c.checkValue(el)
+		c.assignable(t, list.Elem, el, "list literal")
+		c.convertUntyped(el, list.Elem)
+	}
+}
+
+func (c *Checker) checkHashLiteral(lit *ast.HashLiteral, m *Map) {
+	c.record(lit, m)
+	for _, pair := range lit.Pairs {
+		key := c.checkValue(pair.Key)
+		c.assignable(key, m.Key, pair.Key, "map literal")
+		c.convertUntyped(pair.Key, m.Key)
+		v := c.checkValueFor(pair.Value, m.Elem)
+		c.assignable(v, m.Elem, pair.Value, "map literal")
+		c.convertUntyped(pair.Value, m.Elem)
+	}
+}
+
+func (c *Checker) checkStructLiteral(lit *ast.StructLiteral) Type {
+	sym := c.scope.Lookup(lit.StructName.Value)
+	s, ok := c.structOf(sym)
+	if !ok {
+		c.errorf(lit, "undefined struct %s", lit.StructName.Value)
+		for _, v := range lit.Fields {
+			c.checkExpression(v)
+		}
+		return Typ[Invalid]
+	}
+	c.info.Uses[lit.StructName] = sym
+	for name, value := range lit.Fields {
+		field, ok := s.Field(name)
+		if !ok {
+			c.checkValue(value)
+			c.errorf(value, "unknown field %s in struct literal of type %s", name, s.Name)
+			continue
+		}
+		v := c.checkValueFor(value, field.Type)
+		c.assignable(v, field.Type, value, "struct literal")
+		c.convertUntyped(value, field.Type)
+	}
+	return s
+}
+
+func (c *Checker) structOf(sym *Symbol) (*Struct, bool) {
+	if sym == nil || sym.Kind != TypeSymbol {
+		return nil, false
+	}
+	s, ok := sym.Type.(*Struct)
+	return s, ok
+}
+
+func (c *Checker) checkStructFieldAccess(access *ast.StructFieldAccess) Type {
+	if pkg, ok := c.packageOf(access.Left); ok {
+		return c.checkPackageMember(access, pkg).Type
+	}
+	if ident, ok := access.Left.(*ast.Identifier); ok {
+		if sym := c.scope.Lookup(ident.Value); sym != nil && sym.Kind == TypeSymbol {
+			return c.checkEnumVariant(access, ident, sym)
+		}
+	}
+	left := c.checkValue(access.Left)
+	if isInvalid(left) {
+		return Typ[Invalid]
+	}
+	s, ok := left.(*Struct)
+	if !ok {
+		c.errorf(access, "%s undefined (type %s has no field %s)", access.String(), left, access.Field.Value)
+		return Typ[Invalid]
+	}
+	field, ok := s.Field(access.Field.Value)
+	if !ok {
+		if _, isMethod := s.Method(access.Field.Value); isMethod {
+			c.errorf(access, "method %s must be called", access.String())
+			return Typ[Invalid]
+		}
+		c.errorf(access, "%s undefined (type %s has no field %s)", access.String(), s.Name, access.Field.Value)
+		return Typ[Invalid]
+	}
+	return field.Type
+}
+
+// checkEnumVariant checks a qualified access such as Color.Red.
+func (c *Checker) checkEnumVariant(access *ast.StructFieldAccess, ident *ast.Identifier, sym *Symbol) Type {
+	c.info.Uses[ident] = sym
+	e, ok := sym.Type.(*Enum)
+	if !ok {
+		c.errorf(ident, "%s is not an expression", ident.Value)
+		return Typ[Invalid]
+	}
+	c.record(ident, e)
+	variant, ok := e.Variant(access.Field.Value)
+	if !ok {
+		c.errorf(access, "%s undefined (type %s has no variant %s)", access.String(), e.Name, access.Field.Value)
+		return Typ[Invalid]
+	}
+	c.info.Variants[access] = variant
+	return e
+}
+
+// convertUntyped replaces the recorded untyped type of a constant expression
+// with the type required by its context, and reports a constant that does
+// not fit in that type.
+func (c *Checker) convertUntyped(expr ast.Expression, target Type) {
+	if !IsUntyped(c.info.Types[expr]) {
+		return
+	}
+	if isInvalid(target) || target == Any || !IsNumeric(target) {
+		target = Default(c.info.Types[expr])
+	}
+	if v, ok := constantValue(expr); ok && IsInteger(target) && !representable(v, target) {
+		c.errorf(expr, "constant %s overflows %s", v, target)
+	}
+	c.setUntyped(expr, target)
+}
+
+// setUntyped records the type of an untyped constant expression and of the
+// operands it is made of.
+func (c *Checker) setUntyped(expr ast.Expression, target Type) {
+	if !IsUntyped(c.info.Types[expr]) {
+		return
+	}
+	c.info.Types[expr] = target
+	switch e := expr.(type) {
+	case *ast.InfixExpression:
+		c.setUntyped(e.Left, target)
+		c.setUntyped(e.Right, target)
+	case *ast.PrefixExpression:
+		c.setUntyped(e.Right, target)
+	}
+}
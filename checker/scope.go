@@ -0,0 +1,89 @@
+package checker
+
+import (
+	"text/scanner"
+)
+
+type SymbolKind int
+
+const (
+	VarSymbol SymbolKind = iota
+	FuncSymbol
+	TypeSymbol
+	BuiltinSymbol
+	// PackageSymbol is the name an imported package is referred to by
+	PackageSymbol
+)
+
+type Symbol struct {
+	Name string
+	Kind SymbolKind
+	Type Type
+	Pos  scanner.Position
+	// Pkg is the import path of the package the symbol is declared in, or
+	// of the imported package for a PackageSymbol. It is empty for the
+	// package a program is loaded from and for builtins.
+	Pkg string
+	// Exported is set for `pub` functions, which other packages can use.
+	Exported bool
+}
+
+type Scope struct {
+	parent  *Scope
+	symbols map[string]*Symbol
+}
+
+func NewScope(parent *Scope) *Scope {
+	return &Scope{
+		parent:  parent,
+		symbols: make(map[string]*Symbol),
+	}
+}
+
+// Insert adds a symbol to the scope. If a symbol with the same name already
+// exists in this scope it is returned and the scope is left unchanged.
+func (s *Scope) Insert(sym *Symbol) *Symbol {
+	if existing, ok := s.symbols[sym.Name]; ok {
+		return existing
+	}
+	s.symbols[sym.Name] = sym
+	return nil
+}
+
+// Lookup finds a symbol by walking up the scope chain.
+func (s *Scope) Lookup(name string) *Symbol {
+	for scope := s; scope != nil; scope = scope.parent {
+		if sym, ok := scope.symbols[name]; ok {
+			return sym
+		}
+	}
+	return nil
+}
+
+// encloses reports whether a scope is s or one of the scopes nested in it.
+func (s *Scope) encloses(scope *Scope) bool {
+	for ; scope != nil; scope = scope.parent {
+		if scope == s {
+			return true
+		}
+	}
+	return false
+}
+
+var universe = NewScope(nil)
+
+const (
+	BuiltinPrintln = "println"
+	BuiltinLen     = "len"
+	BuiltinAppend  = "append"
+	BuiltinAssert  = "assert"
+	BuiltinDelete  = "delete"
+	BuiltinHas     = "has"
+	BuiltinKeys    = "keys"
+)
+
+func init() {
+	for _, name := range []string{BuiltinPrintln, BuiltinLen, BuiltinAppend, BuiltinAssert, BuiltinDelete, BuiltinHas, BuiltinKeys} {
+		universe.Insert(&Symbol{Name: name, Kind: BuiltinSymbol, Type: Typ[Invalid]})
+	}
+}
@@ -0,0 +1,410 @@
+package checker
+
+import (
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/token"
+)
+
+func (c *Checker) checkStatement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case nil:
+	case *ast.ExpressionStatement:
+		if s.Expression != nil {
+			c.checkExpression(s.Expression)
+		}
+	case *ast.VariableDeclaration:
+		c.checkVariableDeclaration(s)
+	case *ast.DestructuringDeclaration:
+		c.checkDestructuringDeclaration(s)
+	case *ast.LetStatement:
+		t := Default(c.checkValue(s.Value))
+		c.convertUntyped(s.Value, t)
+		c.declare(s.Name, VarSymbol, t)
+	case *ast.ListDeclaration:
+		c.checkListDeclaration(s)
+	case *ast.FunctionStatement:
+		c.checkFunctionStatement(s)
+	case *ast.StructDefinition, *ast.EnumDefinition, *ast.InterfaceDefinition:
+		// type definitions are resolved before any statements are checked
+	case *ast.TestBlock:
+		c.checkTestBlock(s)
+	case *ast.ReturnStatement:
+		c.checkReturnStatement(s)
+	case *ast.IfStatement:
+		c.checkCondition(s.Condition)
+		c.checkBlock(s.Consequence)
+		if s.Alternative != nil {
+			c.checkBlock(s.Alternative)
+		}
+	case *ast.ForStatement:
+		c.openScope()
+		c.checkStatement(s.Init)
+		if s.Condition != nil {
+			c.checkCondition(s.Condition)
+		}
+		c.checkStatement(s.Post)
+		c.checkBlock(s.Body)
+		c.closeScope()
+	case *ast.ForInStatement:
+		c.checkForInStatement(s)
+	case *ast.BreakStatement, *ast.ContinueStatement:
+		// the parser reports a branch that is not in a loop
+	case *ast.BlockStatement:
+		c.checkBlock(s)
+	case *ast.DeferStatement:
+		if c.fn == nil {
+			c.errorf(s, "defer outside of function")
+		}
+		c.checkStatement(s.Statement)
+		c.checkDeferredCall(s)
+	default:
+		c.errorf(stmt, "unsupported statement %s", stmt.String())
+	}
+}
+
+// checkForInStatement checks a loop over a list, a string, a map or a
+// range and declares its variables in the scope of the loop. A single
+// variable is the element, the byte, the key or the integer. With two
+// variables the first is the index or the key and the second the element,
+// the byte or the value.
+func (c *Checker) checkForInStatement(s *ast.ForInStatement) {
+	t := c.checkValue(s.Iterable)
+	var types []Type
+	single := 1
+	if _, ok := s.Iterable.(*ast.RangeExpression); ok {
+		types, single = []Type{t}, 0
+	} else {
+		switch it := t.(type) {
+		case *List:
+			types = []Type{Typ[I32], it.Elem}
+		case *Map:
+			types, single = []Type{it.Key, it.Elem}, 0
+		default:
+			if IsString(t) {
+				types = []Type{Typ[I32], Typ[U8]}
+			} else if !isInvalid(t) {
+				c.errorf(s.Iterable, "cannot range over %s (%s)", s.Iterable.String(), t)
+			}
+		}
+	}
+	if len(s.Vars) > len(types) && len(types) > 0 {
+		c.errorf(s.Vars[len(types)], "range over %s permits only %d variable%s", s.Iterable.String(), len(types), plural(len(types)))
+	}
+
+	c.openScope()
+	for i, v := range s.Vars {
+		var vt Type = Typ[Invalid]
+		if len(s.Vars) == 1 && single < len(types) {
+			vt = types[single]
+		} else if i < len(types) {
+			vt = types[i]
+		}
+		c.declare(v, VarSymbol, vt)
+	}
+	c.checkBlock(s.Body)
+	c.closeScope()
+}
+
+// checkDeferredCall reports a defer statement that does not defer a call.
+func (c *Checker) checkDeferredCall(s *ast.DeferStatement) {
+	stmt, ok := s.Statement.(*ast.ExpressionStatement)
+	if !ok {
+		c.errorf(s, "expression in defer must be function call")
+		return
+	}
+	call, ok := stmt.Expression.(*ast.FunctionCall)
+	if !ok {
+		c.errorf(s, "expression in defer must be function call")
+		return
+	}
+	if _, ok := c.info.NumericConversions[call]; ok {
+		c.errorf(s, "defer requires function call, not conversion")
+	}
+}
+
+func (c *Checker) checkBlock(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	c.openScope()
+	for _, stmt := range block.Statements {
+		c.checkStatement(stmt)
+	}
+	c.closeScope()
+}
+
+func (c *Checker) checkCondition(cond ast.Expression) {
+	t := c.checkValue(cond)
+	if !isInvalid(t) && !IsBoolean(t) {
+		c.errorf(cond, "non-boolean condition %s (%s)", cond.String(), t)
+	}
+}
+
+// checkVariableDeclaration handles both typed declarations (`i32 x = 1`) and
+// plain assignments (`x = 1`), which the parser also produces as a
+// VariableDeclaration whose type token is the variable name itself.
+func (c *Checker) checkVariableDeclaration(decl *ast.VariableDeclaration) {
+	if c.isPlainAssignment(decl) {
+		if c.scope.Lookup(decl.Name.Value) != nil {
+			c.checkAssignment(decl.Name, decl.Value)
+			return
+		}
+		// an assignment to an undeclared name declares it
+		t := Default(c.checkValue(decl.Value))
+		c.convertUntyped(decl.Value, t)
+		c.declare(decl.Name, VarSymbol, t)
+		return
+	}
+
+	t := c.resolveType(c.typeName(decl.Type), decl.Name)
+	if decl.Value != nil {
+		v := c.checkValueFor(decl.Value, t)
+		c.assignable(v, t, decl.Value, "variable declaration")
+		c.convertUntyped(decl.Value, t)
+	}
+	c.declare(decl.Name, VarSymbol, t)
+}
+
+// typeName returns the name of the type a declaration's type token refers
+// to.
+func (c *Checker) typeName(t token.Token) string {
+	if t.Type == token.IDENTIFIER {
+		return t.Literal
+	}
+	return string(t.Type)
+}
+
+// checkDestructuringDeclaration checks a declaration of a variable for each
+// value of a call. Each variable must have the type of its value.
+func (c *Checker) checkDestructuringDeclaration(decl *ast.DestructuringDeclaration) {
+	types := make([]Type, len(decl.Vars))
+	for i, v := range decl.Vars {
+		types[i] = c.resolveType(c.typeName(v.Type), v.Name)
+	}
+	values := []Type{c.checkExpression(decl.Value)}
+	if tuple, ok := values[0].(*Tuple); ok {
+		values = tuple.Types
+	}
+	if !isInvalid(values[0]) {
+		if _, call := decl.Value.(*ast.FunctionCall); call && len(values) != len(types) {
+			c.errorf(decl.Value, "assignment mismatch: %d variables but %s returns %d value%s",
+				len(types), decl.Value.String(), len(values), plural(len(values)))
+		} else if len(values) != len(types) {
+			c.errorf(decl.Value, "assignment mismatch: %d variables but 1 value", len(types))
+		} else {
+			// the values are not converted, so a struct cannot be
+			// destructured into an interface
+			for i, v := range values {
+				if !isInvalid(types[i]) && !Identical(v, types[i]) {
+					c.errorf(decl.Vars[i].Name, "cannot use value %d of %s (%s) as %s in variable declaration",
+						i+1, decl.Value.String(), v, types[i])
+				}
+			}
+		}
+	}
+	for i, v := range decl.Vars {
+		c.declare(v.Name, VarSymbol, types[i])
+	}
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// isPlainAssignment reports whether a VariableDeclaration is really `x = value`.
+func (c *Checker) isPlainAssignment(decl *ast.VariableDeclaration) bool {
+	if decl.Type.Type != token.IDENTIFIER || decl.Type.Literal != decl.Name.Value {
+		return false
+	}
+	sym := c.scope.Lookup(decl.Name.Value)
+	return sym == nil || sym.Kind != TypeSymbol
+}
+
+func (c *Checker) checkAssignment(left *ast.Identifier, value ast.Expression) {
+	sym := c.lookup(left)
+	if sym == nil {
+		c.checkValue(value)
+		return
+	}
+	v := c.checkValueFor(value, sym.Type)
+	if sym.Kind != VarSymbol {
+		c.errorf(left, "cannot assign to %s", left.Value)
+		return
+	}
+	c.assignable(v, sym.Type, value, "assignment")
+	c.convertUntyped(value, sym.Type)
+}
+
+func (c *Checker) checkListDeclaration(decl *ast.ListDeclaration) {
+	list := &List{Elem: c.resolveType(string(decl.Type), decl.Name)}
+	if decl.Value != nil {
+		c.checkListLiteral(decl.Value, list)
+	}
+	c.declare(decl.Name, VarSymbol, list)
+}
+
+func (c *Checker) checkFunctionStatement(fn *ast.FunctionStatement) {
+	if c.fn != nil {
+		c.errorf(fn, "function %s declared inside another function", fn.Name.Value)
+		return
+	}
+	var sig *Signature
+	var recv Type
+	if fn.Receiver != nil {
+		sym := c.scope.Lookup(string(fn.Receiver.Type))
+		s, ok := c.structOf(sym)
+		if !ok {
+			return
+		}
+		method, ok := s.Method(fn.Name.Value)
+		if !ok {
+			return
+		}
+		sig, recv = method.Sig, s
+	} else if sym := c.info.Defs[fn.Name]; sym != nil {
+		sig, _ = sym.Type.(*Signature)
+	}
+	if sig == nil {
+		return
+	}
+
+	c.fn = sig
+	c.openScope()
+	if recv != nil {
+		c.declare(fn.Receiver.Identifier, VarSymbol, recv)
+	}
+	for i, param := range fn.Parameters {
+		c.declare(param.Identifier, VarSymbol, sig.Params[i])
+	}
+	if fn.Body != nil {
+		for _, stmt := range fn.Body.Statements {
+			c.checkStatement(stmt)
+		}
+	}
+	c.checkReturns(sig, fn.Body)
+	c.closeScope()
+	c.fn = nil
+}
+
+// checkReturns reports a function with results whose body can finish
+// without returning them.
+func (c *Checker) checkReturns(sig *Signature, body *ast.BlockStatement) {
+	if len(sig.Results) == 0 || body == nil || terminates(body) {
+		return
+	}
+	c.errorAt(body.Rbrace, "missing return")
+}
+
+// terminates reports whether a statement always ends the function it is
+// in: a return, a block that ends with such a statement, an if whose
+// branches both do, or a for loop without a condition that nothing breaks
+// out of.
+func terminates(stmt ast.Statement) bool {
+	switch s := stmt.(type) {
+	case *ast.ReturnStatement:
+		return true
+	case *ast.BlockStatement:
+		return s != nil && len(s.Statements) > 0 && terminates(s.Statements[len(s.Statements)-1])
+	case *ast.IfStatement:
+		return s.Alternative != nil && terminates(s.Consequence) && terminates(s.Alternative)
+	case *ast.ForStatement:
+		return s.Condition == nil && !breaksOut(s.Body, s.Label, true)
+	}
+	return false
+}
+
+// breaksOut reports whether a statement has a break that leaves the loop
+// named by label. An unlabeled break only leaves it when it is directly in
+// the loop rather than in a nested one, which direct says.
+func breaksOut(stmt ast.Statement, label *ast.Identifier, direct bool) bool {
+	switch s := stmt.(type) {
+	case *ast.BreakStatement:
+		if s.Label == nil {
+			return direct
+		}
+		return label != nil && s.Label.Value == label.Value
+	case *ast.BlockStatement:
+		if s == nil {
+			return false
+		}
+		for _, stmt := range s.Statements {
+			if breaksOut(stmt, label, direct) {
+				return true
+			}
+		}
+	case *ast.IfStatement:
+		return breaksOut(s.Consequence, label, direct) || breaksOut(s.Alternative, label, direct)
+	case *ast.ForStatement:
+		return breaksOut(s.Body, label, false)
+	case *ast.ForInStatement:
+		return breaksOut(s.Body, label, false)
+	}
+	return false
+}
+
+// checkTestBlock checks a test body as if it were a function without
+// parameters or results.
+func (c *Checker) checkTestBlock(test *ast.TestBlock) {
+	if c.fn != nil {
+		c.errorf(test, "test %q declared inside a function", test.Name.Value)
+		return
+	}
+	if prev, exists := c.tests[test.Name.Value]; exists {
+		pos := prev.Pos()
+		c.errorf(test.Name, "test %q redeclared (previous declaration at %d:%d)", test.Name.Value, pos.Line, pos.Column)
+	} else {
+		c.tests[test.Name.Value] = test
+	}
+
+	c.fn = &Signature{}
+	c.inTest = true
+	c.checkBlock(test.Body)
+	c.inTest = false
+	c.fn = nil
+}
+
+func (c *Checker) checkReturnStatement(ret *ast.ReturnStatement) {
+	if c.fn == nil {
+		c.errorf(ret, "return outside of function")
+		return
+	}
+
+	results := c.fn.Results
+	var values []Type
+	for i, v := range ret.ReturnValues {
+		if len(ret.ReturnValues) == len(results) {
+			values = append(values, c.checkValueFor(v, results[i]))
+		} else {
+			values = append(values, c.checkValue(v))
+		}
+	}
+
+	if len(values) != len(results) {
+		if len(values) == 0 {
+			c.errorf(ret, "not enough return values\n\thave ()\n\twant %s", typeList(results))
+		} else if len(results) == 0 {
+			c.errorf(ret, "too many return values\n\thave %s\n\twant ()", typeList(values))
+		} else {
+			c.errorf(ret, "wrong number of return values\n\thave %s\n\twant %s", typeList(values), typeList(results))
+		}
+		return
+	}
+	for i, v := range ret.ReturnValues {
+		c.assignable(values[i], results[i], v, "return statement")
+		c.convertUntyped(v, results[i])
+	}
+}
+
+func typeList(types []Type) string {
+	s := "("
+	for i, t := range types {
+		if i > 0 {
+			s += ", "
+		}
+		s += t.String()
+	}
+	return s + ")"
+}
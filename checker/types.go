@@ -0,0 +1,393 @@
+package checker
+
+import (
+	"strings"
+
+	"github.com/dfirebaugh/punch/token"
+)
+
+type Type interface {
+	String() string
+}
+
+type BasicKind int
+
+const (
+	Invalid BasicKind = iota
+	Void
+	Bool
+	Str
+	U8
+	U16
+	U32
+	U64
+	I8
+	I16
+	I32
+	I64
+	F32
+	F64
+
+	// untyped constants take on the type of the context they are used in
+	UntypedInt
+	UntypedFloat
+)
+
+type Basic struct {
+	Kind BasicKind
+	Name string
+}
+
+func (b *Basic) String() string { return b.Name }
+
+var Typ = map[BasicKind]*Basic{
+	Invalid:      {Invalid, "invalid type"},
+	Void:         {Void, "void"},
+	Bool:         {Bool, "bool"},
+	Str:          {Str, "str"},
+	U8:           {U8, "u8"},
+	U16:          {U16, "u16"},
+	U32:          {U32, "u32"},
+	U64:          {U64, "u64"},
+	I8:           {I8, "i8"},
+	I16:          {I16, "i16"},
+	I32:          {I32, "i32"},
+	I64:          {I64, "i64"},
+	F32:          {F32, "f32"},
+	F64:          {F64, "f64"},
+	UntypedInt:   {UntypedInt, "untyped int"},
+	UntypedFloat: {UntypedFloat, "untyped float"},
+}
+
+type Field struct {
+	Name string
+	Type Type
+}
+
+type Struct struct {
+	Name    string
+	Fields  []*Field
+	Methods []*Method
+}
+
+func (s *Struct) String() string { return s.Name }
+
+// Method looks up a method by name.
+func (s *Struct) Method(name string) (*Method, bool) {
+	return lookupMethod(s.Methods, name)
+}
+
+// Field looks up a field by name.
+func (s *Struct) Field(name string) (*Field, bool) {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// Method is a function attached to a struct or a method listed in an
+// interface. The signature does not include the receiver.
+type Method struct {
+	Name string
+	Sig  *Signature
+}
+
+func lookupMethod(methods []*Method, name string) (*Method, bool) {
+	for _, m := range methods {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// Interface is a set of method signatures. A struct satisfies an interface
+// implicitly by declaring every method in it with an identical signature.
+type Interface struct {
+	Name    string
+	Methods []*Method
+}
+
+func (i *Interface) String() string { return i.Name }
+
+// Method looks up a method by name.
+func (i *Interface) Method(name string) (*Method, bool) {
+	return lookupMethod(i.Methods, name)
+}
+
+// MissingMethod returns a method of iface that t does not have, or that t
+// declares with a different signature. It returns nil if t implements iface.
+func MissingMethod(t Type, iface *Interface) *Method {
+	var methods []*Method
+	switch t := t.(type) {
+	case *Struct:
+		methods = t.Methods
+	case *Interface:
+		methods = t.Methods
+	}
+	for _, want := range iface.Methods {
+		have, ok := lookupMethod(methods, want.Name)
+		if !ok || !Identical(have.Sig, want.Sig) {
+			return want
+		}
+	}
+	return nil
+}
+
+// Implements reports whether a value of type t satisfies iface.
+func Implements(t Type, iface *Interface) bool {
+	switch t.(type) {
+	case *Struct, *Interface:
+		return MissingMethod(t, iface) == nil
+	}
+	return false
+}
+
+type EnumVariant struct {
+	Name  string
+	Value int64
+}
+
+// Enum is a named set of integer constants. Values of an enum type are
+// represented as i32.
+type Enum struct {
+	Name     string
+	Variants []*EnumVariant
+}
+
+func (e *Enum) String() string { return e.Name }
+
+// Variant looks up a variant by name.
+func (e *Enum) Variant(name string) (*EnumVariant, bool) {
+	for _, v := range e.Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+type List struct {
+	Elem Type
+}
+
+func (l *List) String() string { return "[]" + l.Elem.String() }
+
+// Map is a hash table from keys to values that remembers the order its
+// keys were inserted in.
+type Map struct {
+	Key  Type
+	Elem Type
+}
+
+func (m *Map) String() string { return "map[" + m.Key.String() + "]" + m.Elem.String() }
+
+// Tuple is the type of a call to a function that returns several values.
+// Tuples can only be destructured.
+type Tuple struct {
+	Types []Type
+}
+
+func (t *Tuple) String() string { return typeList(t.Types) }
+
+type Signature struct {
+	Params   []Type
+	Results  []Type
+	Variadic bool
+}
+
+func (s *Signature) String() string {
+	var out strings.Builder
+	out.WriteString("fn(")
+	for i, p := range s.Params {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		if s.Variadic && i == len(s.Params)-1 {
+			out.WriteString("...")
+		}
+		out.WriteString(p.String())
+	}
+	out.WriteString(")")
+	switch len(s.Results) {
+	case 0:
+	case 1:
+		out.WriteString(" " + s.Results[0].String())
+	default:
+		out.WriteString(" (")
+		for i, r := range s.Results {
+			if i > 0 {
+				out.WriteString(", ")
+			}
+			out.WriteString(r.String())
+		}
+		out.WriteString(")")
+	}
+	return out.String()
+}
+
+// Any is only used for the parameters of builtins such as println.
+type anyType struct{}
+
+func (anyType) String() string { return "any" }
+
+var Any Type = anyType{}
+
+func basicKind(t Type) BasicKind {
+	if b, ok := t.(*Basic); ok {
+		return b.Kind
+	}
+	return Invalid
+}
+
+func IsInteger(t Type) bool {
+	k := basicKind(t)
+	return k >= U8 && k <= I64 || k == UntypedInt
+}
+
+func IsUnsigned(t Type) bool {
+	k := basicKind(t)
+	return k >= U8 && k <= U64
+}
+
+func IsFloat(t Type) bool {
+	k := basicKind(t)
+	return k == F32 || k == F64 || k == UntypedFloat
+}
+
+func IsNumeric(t Type) bool {
+	return IsInteger(t) || IsFloat(t)
+}
+
+func IsUntyped(t Type) bool {
+	k := basicKind(t)
+	return k == UntypedInt || k == UntypedFloat
+}
+
+func IsString(t Type) bool {
+	return basicKind(t) == Str
+}
+
+func IsBoolean(t Type) bool {
+	return basicKind(t) == Bool
+}
+
+func IsVoid(t Type) bool {
+	return basicKind(t) == Void
+}
+
+func IsEnum(t Type) bool {
+	_, ok := t.(*Enum)
+	return ok
+}
+
+// IsComparable reports whether values of a type can be compared with ==
+// and so be the keys of a map.
+func IsComparable(t Type) bool {
+	return IsInteger(t) || IsString(t) || IsBoolean(t) || IsEnum(t)
+}
+
+func IsInterface(t Type) bool {
+	_, ok := t.(*Interface)
+	return ok
+}
+
+// Default returns the type an untyped constant takes when nothing else
+// constrains it.
+func Default(t Type) Type {
+	switch basicKind(t) {
+	case UntypedInt:
+		return Typ[I32]
+	case UntypedFloat:
+		return Typ[F32]
+	}
+	return t
+}
+
+// Identical reports whether two types are the same.
+func Identical(a, b Type) bool {
+	if a == b {
+		return true
+	}
+	switch a := a.(type) {
+	case *List:
+		if b, ok := b.(*List); ok {
+			return Identical(a.Elem, b.Elem)
+		}
+	case *Map:
+		if b, ok := b.(*Map); ok {
+			return Identical(a.Key, b.Key) && Identical(a.Elem, b.Elem)
+		}
+	case *Tuple:
+		b, ok := b.(*Tuple)
+		if !ok || len(a.Types) != len(b.Types) {
+			return false
+		}
+		for i := range a.Types {
+			if !Identical(a.Types[i], b.Types[i]) {
+				return false
+			}
+		}
+		return true
+	case *Signature:
+		b, ok := b.(*Signature)
+		if !ok || len(a.Params) != len(b.Params) || len(a.Results) != len(b.Results) || a.Variadic != b.Variadic {
+			return false
+		}
+		for i := range a.Params {
+			if !Identical(a.Params[i], b.Params[i]) {
+				return false
+			}
+		}
+		for i := range a.Results {
+			if !Identical(a.Results[i], b.Results[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// AssignableTo reports whether a value of type v can be assigned to a
+// variable of type t.
+func AssignableTo(v, t Type) bool {
+	if t == Any {
+		return !IsVoid(v)
+	}
+	if Identical(v, t) {
+		return true
+	}
+	if iface, ok := t.(*Interface); ok {
+		return Implements(v, iface)
+	}
+	switch basicKind(v) {
+	case UntypedInt:
+		return IsNumeric(t) && !IsUntyped(t)
+	case UntypedFloat:
+		return IsFloat(t) && !IsUntyped(t)
+	}
+	return false
+}
+
+// basicTypes maps the type names found in the AST to their type. The parser
+// records some types by their token type (e.g. STRING) and others by their
+// literal (e.g. str) so both spellings are accepted.
+var basicTypes = map[token.Type]*Basic{
+	token.U8:     Typ[U8],
+	token.U16:    Typ[U16],
+	token.U32:    Typ[U32],
+	token.U64:    Typ[U64],
+	token.I8:     Typ[I8],
+	token.I16:    Typ[I16],
+	token.I32:    Typ[I32],
+	token.I64:    Typ[I64],
+	token.F32:    Typ[F32],
+	token.F64:    Typ[F64],
+	token.BOOL:   Typ[Bool],
+	"bool":       Typ[Bool],
+	token.STRING: Typ[Str],
+	"str":        Typ[Str],
+}
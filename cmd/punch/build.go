@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bytecodealliance/wasmtime-go"
+	"github.com/dfirebaugh/punch/checker"
+	"github.com/dfirebaugh/punch/emitters/js"
+	"github.com/dfirebaugh/punch/emitters/wat"
+)
+
+const (
+	emitWasm = "wasm"
+	emitWat  = "wat"
+	emitJS   = "js"
+	emitAST  = "ast.json"
+)
+
+var emitKinds = []string{emitWasm, emitWat, emitJS, emitAST}
+
+// emitList collects the values of a repeatable --emit flag. Values can also
+// be separated by commas.
+type emitList []string
+
+func (e *emitList) String() string {
+	return strings.Join(*e, ",")
+}
+
+func (e *emitList) Set(value string) error {
+	for _, kind := range strings.Split(value, ",") {
+		if !isEmitKind(kind) {
+			return fmt.Errorf("unknown output %q (options: %s)", kind, strings.Join(emitKinds, ", "))
+		}
+		*e = append(*e, kind)
+	}
+	return nil
+}
+
+func isEmitKind(kind string) bool {
+	for _, k := range emitKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// buildCommand implements `punch build`. It returns the exit code.
+func buildCommand(args []string) int {
+	flags := newFlagSet("build", "[--emit kind]... [-o output_file] <filename>",
+		"Compiles a program and writes the requested outputs. With more than one\n"+
+			"--emit, -o names the output files without their extension. When the\n"+
+			"source is read from stdin the output goes to stdout unless -o is given.")
+	var emits emitList
+	flags.Var(&emits, "emit", "output to write, may be repeated (options: wasm, wat, js, ast.json) (default: wasm)")
+	output := flags.String("o", "", "output file, - for stdout (default: <input_filename>.<ext>)")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	if flags.NArg() != 1 {
+		return usageError(flags, "expected one file")
+	}
+	filename := flags.Arg(0)
+	if len(emits) == 0 {
+		emits = emitList{emitWasm}
+	}
+	if filename == "-" && *output == "" {
+		if len(emits) > 1 {
+			return usageError(flags, "-o is required to write several outputs from stdin")
+		}
+		*output = "-"
+	}
+
+	program, sources, ok := checkFile(filename)
+	if !ok {
+		return exitFailure
+	}
+
+	for _, kind := range emits {
+		data, err := emit(kind, program)
+		if err != nil {
+			printErrors(err, sources)
+			return exitFailure
+		}
+		path := outputPath(filename, *output, kind, len(emits) > 1)
+		if err := writeOutput(path, data); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+	}
+	return exitOK
+}
+
+// emit generates one kind of output for a program.
+func emit(kind string, program *checker.Program) ([]byte, error) {
+	switch kind {
+	case emitWasm:
+		watCode, err := generateWAT(program)
+		if err != nil {
+			return nil, err
+		}
+		wasm, err := wasmtime.Wat2Wasm(watCode)
+		if err != nil {
+			return nil, fmt.Errorf("error assembling wasm: %w", err)
+		}
+		return wasm, nil
+	case emitWat:
+		watCode, err := generateWAT(program)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(watCode), nil
+	case emitJS:
+		jsCode, err := js.NewTranspiler().Transpile(program)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(jsCode), nil
+	case emitAST:
+		ast, err := program.JSONPretty()
+		if err != nil {
+			return nil, err
+		}
+		return []byte(ast + "\n"), nil
+	}
+	return nil, fmt.Errorf("unknown output %q", kind)
+}
+
+// outputPath picks the file an output is written to. Without -o the input
+// file's extension is replaced, and a package directory is built into the
+// current directory under the directory's name. When several outputs are
+// written -o is used as the base name of each of them.
+func outputPath(input, output, kind string, multiple bool) string {
+	if output != "" && !multiple {
+		return output
+	}
+	base := output
+	if base == "" {
+		base = input
+		if info, err := os.Stat(input); err == nil && info.IsDir() {
+			if abs, err := filepath.Abs(input); err == nil {
+				return filepath.Base(abs) + "." + kind
+			}
+		}
+	}
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "." + kind
+}
+
+// writeOutput writes an output to a file, or to stdout if path is "-".
+func writeOutput(path string, data []byte) error {
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// generateWAT generates the WebAssembly text of a program with the memory
+// allocator included.
+func generateWAT(program *checker.Program) (string, error) {
+	return wat.NewGenerator(wat.Options{MemoryManagement: true}).Generate(program)
+}
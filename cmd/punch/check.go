@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dfirebaugh/punch/checker"
+	"github.com/dfirebaugh/punch/diagnostic"
+	"github.com/dfirebaugh/punch/loader"
+)
+
+// jsonDiagnostic is the form diagnostics take in the output of
+// `punch check -json`. Lines and columns start at 1.
+type jsonDiagnostic struct {
+	File      string `json:"file"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+	EndLine   int    `json:"endLine,omitempty"`
+	EndColumn int    `json:"endColumn,omitempty"`
+	Severity  string `json:"severity"`
+	Message   string `json:"message"`
+	Hint      string `json:"hint,omitempty"`
+}
+
+// checkCommand implements `punch check`. Files are lexed, parsed and type
+// checked without generating any code. It returns the exit code.
+func checkCommand(args []string) int {
+	flags := newFlagSet("check", "[-json] <filename>...",
+		"Reports syntax and type errors in the given files or packages and the\n"+
+			"packages they import without compiling them. The exit code is 1 if there\n"+
+			"are any errors.")
+	jsonOutput := flags.Bool("json", false, "print the diagnostics to stdout as a json array")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	if flags.NArg() == 0 {
+		return usageError(flags, "expected at least one file")
+	}
+
+	failed := false
+	diags := []jsonDiagnostic{}
+	for _, filename := range flags.Args() {
+		l := loader.New()
+		err := check(l, filename)
+		if err == nil {
+			continue
+		}
+		failed = true
+		if *jsonOutput {
+			diags = append(diags, toJSONDiagnostics(filename, err)...)
+		} else {
+			printErrors(err, l.Sources)
+		}
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(diags); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+	}
+	if failed {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// check loads and type checks a program.
+func check(l *loader.Loader, filename string) error {
+	program, err := load(l, filename)
+	if err != nil {
+		return err
+	}
+	_, err = checker.Check(program)
+	return err
+}
+
+func toJSONDiagnostics(filename string, err error) []jsonDiagnostic {
+	var diags diagnostic.List
+	if !errors.As(err, &diags) {
+		return []jsonDiagnostic{{
+			File:     filename,
+			Severity: diagnostic.Error.String(),
+			Message:  err.Error(),
+		}}
+	}
+
+	out := make([]jsonDiagnostic, len(diags))
+	for i, d := range diags {
+		file := d.Pos.Filename
+		if file == "" {
+			file = filename
+		}
+		out[i] = jsonDiagnostic{
+			File:      file,
+			Line:      d.Pos.Line,
+			Column:    d.Pos.Column,
+			EndLine:   d.End.Line,
+			EndColumn: d.End.Column,
+			Severity:  d.Severity.String(),
+			Message:   d.Message,
+			Hint:      d.Hint,
+		}
+	}
+	return out
+}
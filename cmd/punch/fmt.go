@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dfirebaugh/punch/format"
+	"github.com/dfirebaugh/punch/lexer"
+	"github.com/dfirebaugh/punch/parser"
+)
+
+// fmtCommand implements `punch fmt`. It returns the exit code.
+func fmtCommand(args []string) int {
+	flags := newFlagSet("fmt", "[-l] [-w] [packages]",
+		"Formats source files and prints the result. Directories are expanded like\n"+
+			"in punch test. Without files, or for a file named -, the source is read\n"+
+			"from stdin. Files that do not parse are left unchanged.")
+	write := flags.Bool("w", false, "write the result to the source file instead of stdout")
+	list := flags.Bool("l", false, "list the files whose formatting differs")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+
+	files := []string{"-"}
+	if flags.NArg() > 0 && !(flags.NArg() == 1 && flags.Arg(0) == "-") {
+		var err error
+		files, err = findSourceFiles(flags.Args())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+	}
+	code := exitOK
+	for _, filename := range files {
+		if !formatFile(filename, *write, *list) {
+			code = exitFailure
+		}
+	}
+	return code
+}
+
+// formatFile formats a single file and reports whether it succeeded.
+func formatFile(filename string, write, list bool) bool {
+	name, source, err := readSource(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	// formatting is only based on brackets, so refuse to touch code that
+	// does not parse rather than guess at what it means
+	if _, err := parser.New(lexer.New(name, source)).ParseProgram(name); err != nil {
+		printErrors(err, map[string]string{name: source})
+		return false
+	}
+
+	formatted := format.Source(source)
+	changed := formatted != source
+	if list && changed {
+		fmt.Println(name)
+	}
+	if write && filename != "-" {
+		if !changed {
+			return true
+		}
+		info, err := os.Stat(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return false
+		}
+		if err := os.WriteFile(filename, []byte(formatted), info.Mode().Perm()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return false
+		}
+		return true
+	}
+	if !list {
+		fmt.Print(formatted)
+	}
+	return true
+}
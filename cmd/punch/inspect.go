@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dfirebaugh/punch/lexer"
+	"github.com/dfirebaugh/punch/token"
+)
+
+// tokensCommand implements `punch tokens`. It returns the exit code, which
+// is 1 if the file contains illegal tokens.
+func tokensCommand(args []string) int {
+	flags := newFlagSet("tokens", "<filename>",
+		"Prints the tokens of a file, one per line, as line:column:offset, type and literal.")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	if flags.NArg() != 1 {
+		return usageError(flags, "expected one file")
+	}
+
+	name, source, err := readSource(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	code := exitOK
+	for _, tok := range lexer.New(name, source).Run() {
+		fmt.Println(tok)
+		if tok.Type == token.ILLEGAL {
+			code = exitFailure
+		}
+	}
+	return code
+}
+
+// astCommand implements `punch ast`. It returns the exit code.
+func astCommand(args []string) int {
+	flags := newFlagSet("ast", "<filename>",
+		"Parses a file or package and the packages it imports and prints their\n"+
+			"Abstract Syntax Tree (AST) as json. The program is not type checked.")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	if flags.NArg() != 1 {
+		return usageError(flags, "expected one file")
+	}
+
+	program, _, ok := loadFile(flags.Arg(0))
+	if !ok {
+		return exitFailure
+	}
+	ast, err := program.JSONPretty()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	fmt.Println(ast)
+	return exitOK
+}
@@ -1,98 +1,196 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 
-	"github.com/dfirebaugh/punch/emitters/js"
-	"github.com/dfirebaugh/punch/lexer"
-	"github.com/dfirebaugh/punch/parser"
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/checker"
+	"github.com/dfirebaugh/punch/diagnostic"
+	"github.com/dfirebaugh/punch/loader"
 	"github.com/sirupsen/logrus"
 )
 
-func main() {
-	var outputFile string
-	var outputTokens bool
-	var outputJS bool
-	var outputAst bool
-	var showHelp bool
-	var logLevel string
+// exit codes shared by every command
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
 
-	flag.StringVar(&outputFile, "o", "", "output file (default: <input_filename>.wasm)")
-	flag.BoolVar(&outputTokens, "tokens", false, "output tokens")
-	flag.BoolVar(&outputAst, "ast", false, "output Abstract Syntax Tree (AST) file")
-	flag.BoolVar(&outputJS, "js", false, "outputs js to stdout")
-	flag.BoolVar(&showHelp, "help", false, "show help message")
-	flag.StringVar(&logLevel, "log", "error", "set log level (options: trace, debug, info, warn, error, fatal, panic)")
-	flag.Parse()
+// stdinName is the file name used in diagnostics for source read from stdin.
+const stdinName = "<stdin>"
 
-	if showHelp {
-		printUsage()
-		os.Exit(0)
-	}
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
 
-	setLogLevel(logLevel)
+var commands = []command{
+	{"build", "compile a program to wasm, wat, js or ast.json", buildCommand},
+	{"run", "compile and run a program", runCommand},
+	{"test", "run test blocks", runTests},
+	{"check", "report syntax and type errors without compiling", checkCommand},
+	{"fmt", "format source files", fmtCommand},
+	{"tokens", "print the tokens of a file", tokensCommand},
+	{"ast", "print the syntax tree of a file as json", astCommand},
+}
 
-	if flag.NArg() < 1 {
-		printUsage()
-		os.Exit(1)
-	}
+func main() {
+	os.Exit(dispatch(os.Args[1:]))
+}
 
-	filename := flag.Arg(0)
-	fileContents, err := os.ReadFile(filename)
-	if err != nil {
-		logrus.Error(err)
+// dispatch runs the command named by the first argument and returns the exit
+// code.
+func dispatch(args []string) int {
+	if len(args) == 0 {
+		printUsage(os.Stderr)
+		return exitUsage
 	}
 
-	l := lexer.New(filename, string(fileContents))
-
-	if outputTokens {
-		tokens := l.Run()
-		for _, token := range tokens {
-			fmt.Println(token)
+	name := args[0]
+	switch name {
+	case "help", "-h", "-help", "--help":
+		if len(args) > 1 {
+			// `punch help build` is the same as `punch build -h`
+			return dispatch([]string{args[1], "-h"})
 		}
-		return
+		printUsage(os.Stdout)
+		return exitOK
 	}
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(args[1:])
+		}
+	}
+	fmt.Fprintf(os.Stderr, "punch: unknown command %q\n", name)
+	fmt.Fprintln(os.Stderr, "Run 'punch help' for usage.")
+	return exitUsage
+}
 
-	p := parser.New(l)
-	program, err := p.ParseProgram(filename)
-	if err != nil {
-		logrus.Error(err)
-		return
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Punch is a tool for compiling and running punch programs.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Usage:")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "\tpunch <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "The commands are:")
+	fmt.Fprintln(w)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "\t%-8s %s\n", cmd.name, cmd.summary)
 	}
-	ast, err := program.JSONPretty()
-	if err != nil {
-		logrus.Error(err)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "A file name of - reads the source from stdin.")
+	fmt.Fprintln(w, "Use 'punch help <command>' for more information about a command.")
+}
+
+// newFlagSet creates the flag set of a command. Every command accepts --log.
+// usage is printed after the command name and description explains what the
+// command does.
+func newFlagSet(name, usage, description string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.String("log", "error", "set log level (options: trace, debug, info, warn, error, fatal, panic)")
+	flags.Usage = func() {
+		w := flags.Output()
+		fmt.Fprintf(w, "Usage: punch %s %s\n\n", name, usage)
+		fmt.Fprintln(w, description)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Flags:")
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseFlags parses the arguments of a command and applies --log. When the
+// command should stop, e.g. after -h or a bad flag, ok is false and code is
+// the exit code to return.
+func parseFlags(flags *flag.FlagSet, args []string) (code int, ok bool) {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK, false
+		}
+		return exitUsage, false
 	}
+	setLogLevel(flags.Lookup("log").Value.String())
+	return exitOK, true
+}
+
+// usageError reports a wrong use of a command and returns the usage exit
+// code.
+func usageError(flags *flag.FlagSet, format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, "punch %s: %s\n", flags.Name(), fmt.Sprintf(format, args...))
+	fmt.Fprintf(os.Stderr, "Run 'punch help %s' for usage.\n", flags.Name())
+	return exitUsage
+}
 
-	if outputFile == "" {
-		outputFile = filename
+// readSource reads a source file, or stdin if filename is "-". It returns the
+// name to use in diagnostics along with the source.
+func readSource(filename string) (string, string, error) {
+	if filename == "-" {
+		source, err := io.ReadAll(os.Stdin)
+		return stdinName, string(source), err
 	}
+	source, err := os.ReadFile(filename)
+	return filename, string(source), err
+}
 
-	if outputAst {
-		fmt.Printf("%s\n", ast)
+// loadFile loads the program in a file or directory along with the packages
+// it imports, printing any diagnostics. It also returns the sources of the
+// files that were read.
+func loadFile(filename string) (*ast.Program, map[string]string, bool) {
+	l := loader.New()
+	program, err := load(l, filename)
+	if err != nil {
+		printErrors(err, l.Sources)
+		return nil, l.Sources, false
 	}
+	return program, l.Sources, true
+}
 
-	t := js.NewTranspiler()
-	jsCode, err := t.Transpile(program)
+// load loads a program with l, reading its source from stdin if filename is
+// "-".
+func load(l *loader.Loader, filename string) (*ast.Program, error) {
+	if filename != "-" {
+		return l.Load(filename)
+	}
+	name, source, err := readSource(filename)
 	if err != nil {
-		log.Fatalf("error transpiling to js: %v", err)
+		return nil, err
 	}
+	return l.LoadSource(name, source)
+}
 
-	if outputJS {
-		fmt.Printf("%s\n", jsCode)
-		return
+// checkFile loads and type checks a program, printing any diagnostics. It
+// also returns the sources of the files that were read.
+func checkFile(filename string) (*checker.Program, map[string]string, bool) {
+	program, sources, ok := loadFile(filename)
+	if !ok {
+		return nil, sources, false
+	}
+	checked, err := checker.Check(program)
+	if err != nil {
+		printErrors(err, sources)
+		return nil, sources, false
 	}
+	return checked, sources, true
+}
 
+// runJS runs javascript with bun, falling back to node if bun is not
+// installed.
+func runJS(jsCode string) error {
 	bunPath, err := exec.LookPath("bun")
 	if err != nil {
 		log.Printf("bun is not available on the system, trying node: %v", err)
 		nodePath, err := exec.LookPath("node")
 		if err != nil {
-			log.Fatalf("neither bun nor node is available on the system. Please install one of them.")
+			return errors.New("neither bun nor node is available on the system. Please install one of them")
 		}
 		cmd := exec.Command(nodePath, "--input-type=module")
 		cmd.Stdout = os.Stdout
@@ -100,7 +198,7 @@ func main() {
 
 		nodeStdin, err := cmd.StdinPipe()
 		if err != nil {
-			log.Fatalf("failed to open pipe to node: %v", err)
+			return fmt.Errorf("failed to open pipe to node: %w", err)
 		}
 
 		go func() {
@@ -108,21 +206,32 @@ func main() {
 			nodeStdin.Write([]byte(jsCode))
 		}()
 
-		err = cmd.Run()
-		if err != nil {
-			log.Fatalf("failed to run node: %v", err)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to run node: %w", err)
 		}
-		return
+		return nil
 	}
 
 	cmd := exec.Command(bunPath, "-e", jsCode)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	err = cmd.Run()
-	if err != nil {
-		log.Fatalf("failed to run bun: %v", err)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run bun: %w", err)
 	}
+	return nil
+}
+
+// printErrors prints diagnostics with the offending source line, falling
+// back to the plain error message for any other error. sources maps file
+// names to their source.
+func printErrors(err error, sources map[string]string) {
+	var diags diagnostic.List
+	if !errors.As(err, &diags) {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	diagnostic.Fprint(os.Stderr, diags, sources)
 }
 
 func setLogLevel(level string) {
@@ -145,20 +254,3 @@ func setLogLevel(level string) {
 		logrus.SetLevel(logrus.ErrorLevel)
 	}
 }
-
-func printUsage() {
-	fmt.Println("Usage:", os.Args[0], "[-o output_file] [--tokens] [--wat] [--ast] [--js] [--log log_level] <filename>")
-	fmt.Println("Options:")
-	fmt.Println("  -o string")
-	fmt.Println("        output file (default: <input_filename>.wasm)")
-	fmt.Println("  --tokens")
-	fmt.Println("        output tokens")
-	fmt.Println("  --ast")
-	fmt.Println("        output Abstract Syntax Tree (AST) file")
-	fmt.Println("  --js")
-	fmt.Println("        output Javascript to stdout")
-	fmt.Println("  --log string")
-	fmt.Println("        set log level (options: trace, debug, info, warn, error, fatal, panic)")
-	fmt.Println("  --help")
-	fmt.Println("        show help message")
-}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bytecodealliance/wasmtime-go"
+	"github.com/dfirebaugh/punch/compiler"
+	"github.com/dfirebaugh/punch/emitters/js"
+)
+
+const (
+	targetJS   = "js"
+	targetWasm = "wasm"
+)
+
+// runCommand implements `punch run`. It returns the exit code.
+func runCommand(args []string) int {
+	flags := newFlagSet("run", "[--target js|wasm] <filename>",
+		"Runs a program with node or bun (js) or in process with wasmtime (wasm).")
+	target := flags.String("target", targetJS, "where to run the program (options: js, wasm)")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	if flags.NArg() != 1 {
+		return usageError(flags, "expected one file")
+	}
+	if *target != targetJS && *target != targetWasm {
+		return usageError(flags, "unknown target %q (options: js, wasm)", *target)
+	}
+
+	program, sources, ok := checkFile(flags.Arg(0))
+	if !ok {
+		return exitFailure
+	}
+
+	switch *target {
+	case targetJS:
+		jsCode, err := js.NewTranspiler().Transpile(program)
+		if err != nil {
+			printErrors(err, sources)
+			return exitFailure
+		}
+		if err := runJS(jsCode); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+	case targetWasm:
+		watCode, err := generateWAT(program)
+		if err != nil {
+			printErrors(err, sources)
+			return exitFailure
+		}
+		wasm, err := wasmtime.Wat2Wasm(watCode)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error assembling wasm: %v\n", err)
+			return exitFailure
+		}
+		if err := compiler.Run(wasm, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+	}
+	return exitOK
+}
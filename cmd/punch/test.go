@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/checker"
+	"github.com/dfirebaugh/punch/emitters/js"
+	"github.com/dfirebaugh/punch/loader"
+)
+
+// runTests implements `punch test`. The files are grouped into packages by
+// directory and each package with test blocks is compiled to javascript with
+// its tests and run. It returns the exit code.
+func runTests(args []string) int {
+	flags := newFlagSet("test", "[packages]",
+		"Runs the test blocks in the given files or directories. A path\n"+
+			"ending in /... includes every subdirectory (default: ./...).")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+
+	patterns := flags.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	files, err := findSourceFiles(patterns)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	failed := false
+	for _, pkg := range groupByDirectory(files) {
+		if !runTestPackage(pkg) {
+			failed = true
+		}
+	}
+	if failed {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// groupByDirectory groups files by the directory they are in, so that the
+// files of a package are tested together. The directories keep the order
+// they are first seen in.
+func groupByDirectory(files []string) [][]string {
+	var groups [][]string
+	index := make(map[string]int)
+	seen := make(map[string]bool)
+	for _, file := range files {
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+		dir := filepath.Dir(file)
+		i, ok := index[dir]
+		if !ok {
+			i = len(groups)
+			index[dir] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], file)
+	}
+	return groups
+}
+
+// runTestPackage runs the tests in the files of a package and reports
+// whether they all passed.
+func runTestPackage(files []string) bool {
+	name := filepath.Dir(files[0])
+	l := loader.New()
+	program, err := l.LoadFiles(files...)
+	if err != nil {
+		printErrors(err, l.Sources)
+		fmt.Printf("FAIL\t%s [build failed]\n", name)
+		return false
+	}
+	if !hasTests(program) {
+		fmt.Printf("?   \t%s\t[no test files]\n", name)
+		return true
+	}
+	checked, err := checker.Check(program)
+	if err != nil {
+		printErrors(err, l.Sources)
+		fmt.Printf("FAIL\t%s [build failed]\n", name)
+		return false
+	}
+
+	jsCode, err := js.NewTranspiler().TranspileTests(checked)
+	if err != nil {
+		printErrors(err, l.Sources)
+		fmt.Printf("FAIL\t%s [build failed]\n", name)
+		return false
+	}
+	if err := runJS(jsCode); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		fmt.Printf("FAIL\t%s\n", name)
+		return false
+	}
+	fmt.Printf("ok  \t%s\n", name)
+	return true
+}
+
+func hasTests(program *ast.Program) bool {
+	for _, file := range program.Files {
+		for _, stmt := range file.Statements {
+			if _, ok := stmt.(*ast.TestBlock); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findSourceFiles expands the arguments of `punch test` and `punch fmt` into
+// source files. A directory includes the .pun files in it and a trailing /...
+// also includes its subdirectories.
+func findSourceFiles(patterns []string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		if dir, recursive := strings.CutSuffix(pattern, "..."); recursive {
+			dir = filepath.Clean(dir)
+			err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.IsDir() && filepath.Ext(path) == ".pun" {
+					files = append(files, path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		info, err := os.Stat(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, pattern)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(pattern, "*.pun"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
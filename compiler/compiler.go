@@ -2,6 +2,7 @@ package compiler
 
 import (
 	"github.com/bytecodealliance/wasmtime-go"
+	"github.com/dfirebaugh/punch/checker"
 	"github.com/dfirebaugh/punch/emitters/wat"
 	"github.com/dfirebaugh/punch/lexer"
 	"github.com/dfirebaugh/punch/parser"
@@ -21,8 +22,17 @@ func Compile(filename string, source string) (string, []byte, string) {
 		logrus.Error(err)
 		return "", nil, ""
 	}
+	checked, err := checker.Check(program)
+	if err != nil {
+		logrus.Error(err)
+		return "", nil, ""
+	}
 	var ast string
-	wat := wat.GenerateWAT(program, true)
+	wat, err := wat.NewGenerator(wat.Options{MemoryManagement: true}).Generate(checked)
+	if err != nil {
+		logrus.Error(err)
+		return "", nil, ""
+	}
 	if !astDisabled {
 		ast, _ = program.JSONPretty()
 	}
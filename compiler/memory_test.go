@@ -0,0 +1,406 @@
+package compiler
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bytecodealliance/wasmtime-go"
+	"github.com/dfirebaugh/punch/emitters/wat"
+)
+
+// heap calls the allocator a module exports.
+type heap struct {
+	t        *testing.T
+	store    *wasmtime.Store
+	instance *wasmtime.Instance
+}
+
+func newHeap(t *testing.T, source string) *heap {
+	t.Helper()
+	_, wasm, _ := Compile("test.pun", source)
+	if wasm == nil {
+		t.Fatal("failed to compile")
+	}
+	store := wasmtime.NewStore(wasmtime.NewEngine())
+	instance, err := instantiate(store, wasm, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &heap{t: t, store: store, instance: instance}
+}
+
+func (h *heap) call(name string, args ...interface{}) (interface{}, error) {
+	h.t.Helper()
+	fn := h.instance.GetFunc(h.store, name)
+	if fn == nil {
+		h.t.Fatalf("module does not export %s", name)
+	}
+	return fn.Call(h.store, args...)
+}
+
+func (h *heap) allocate(size int32) int32 {
+	h.t.Helper()
+	ptr, err := h.call(wat.MemoryAllocateFunc, size)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return ptr.(int32)
+}
+
+func (h *heap) free(ptr int32) {
+	h.t.Helper()
+	if _, err := h.call(wat.MemoryDeallocateFunc, ptr); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+// stats returns the live allocations, used bytes and free bytes.
+func (h *heap) stats() [3]int32 {
+	h.t.Helper()
+	results, err := h.call(wat.MemoryStatsFunc)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	var stats [3]int32
+	for i, v := range results.([]wasmtime.Val) {
+		stats[i] = v.I32()
+	}
+	return stats
+}
+
+func (h *heap) pages() uint64 {
+	return h.instance.GetExport(h.store, "memory").Memory().Size(h.store)
+}
+
+func TestAllocator(t *testing.T) {
+	h := newHeap(t, "pkg main\nfn main() {\n}\n")
+
+	a := h.allocate(10)
+	b := h.allocate(1)
+	if a == 0 || a%8 != 0 || b%8 != 0 {
+		t.Fatalf("expected aligned non-null payloads, got %d and %d", a, b)
+	}
+	if b-a != 24 {
+		t.Errorf("expected a 10 byte payload to take a 24 byte block, got %d", b-a)
+	}
+	if got, want := h.stats(), [3]int32{2, 40, 0}; got != want {
+		t.Errorf("got stats %v, want %v", got, want)
+	}
+
+	h.free(a)
+	if got := h.allocate(16); got != a {
+		t.Errorf("expected the freed block at %d to be reused, got %d", a, got)
+	}
+	h.free(a)
+	h.free(b)
+	if got, want := h.stats(), [3]int32{0, 0, 40}; got != want {
+		t.Errorf("got stats %v, want %v", got, want)
+	}
+
+	// the freed blocks were merged, so a payload that needs both of them
+	// fits without growing the heap
+	if got := h.allocate(32); got != a {
+		t.Errorf("expected the merged block at %d, got %d", a, got)
+	}
+	if got, want := h.stats(), [3]int32{1, 40, 0}; got != want {
+		t.Errorf("got stats %v, want %v", got, want)
+	}
+}
+
+func TestAllocatorGrowsMemory(t *testing.T) {
+	h := newHeap(t, "pkg main\nfn main() {\n}\n")
+	pages := h.pages()
+
+	var ptrs []int32
+	for i := 0; i < 100; i++ {
+		ptrs = append(ptrs, h.allocate(4096))
+	}
+	if h.pages() <= pages {
+		t.Fatalf("expected the memory to grow past %d pages", pages)
+	}
+	for _, ptr := range ptrs {
+		h.free(ptr)
+	}
+	if got := h.stats(); got[0] != 0 || got[1] != 0 {
+		t.Errorf("expected no live allocations, got stats %v", got)
+	}
+
+	grown := h.pages()
+	h.allocate(100 * 4096)
+	if h.pages() != grown {
+		t.Errorf("expected the freed blocks to be reused, memory grew from %d to %d pages", grown, h.pages())
+	}
+
+	if _, err := h.call(wat.MemoryAllocateFunc, int32(-1)); err == nil || !strings.Contains(err.Error(), "unreachable") {
+		t.Errorf("expected allocating 4GB to trap, got %v", err)
+	}
+}
+
+// TestReferenceCounting runs a loop that builds strings, structs, lists,
+// interface values and closures and expects every one of them to be freed.
+func TestReferenceCounting(t *testing.T) {
+	h := newHeap(t, `pkg main
+
+interface named {
+  str name()
+}
+
+struct person {
+  str first
+  i32 age
+}
+
+struct pair {
+  person a
+  person b
+}
+
+str (person p) name() {
+  return p.first
+}
+
+person older(person a, person b) {
+  if a.age > b.age {
+    return a
+  }
+  return b
+}
+
+str describe(named n) {
+  return n.name()
+}
+
+(str, person) shout(person p) {
+  defer describe(p)
+  return p.first + "!", p
+}
+
+fn() str greeter(person p) {
+  return fn() str {
+    return p.first + "!"
+  }
+}
+
+pair make(str first) {
+  person p = person {
+    first: first,
+    age: 3,
+  }
+  return pair {
+    a: p,
+    b: person {
+      first: "anon",
+      age: 4,
+    },
+  }
+}
+
+fn main() {
+  for i32 i = 0; i < 1000; i = i + 1 {
+    person a = person {
+      first: "ann",
+      age: i,
+    }
+    person o = older(a, person {
+      first: "bob",
+      age: 500,
+    })
+    str n = describe(o)
+    pair p = make("x")
+    str m = p.b.first
+    describe(older(a, o))
+    str c = n + "-" + m[1:] + n[:2]
+    if c < "a" + m {
+      c = c[1:2]
+    }
+    []person people = {a, o}
+    for i32 j = 0; j < 5; j = j + 1 {
+      append(people, person {
+        first: c + n,
+        age: j,
+      })
+    }
+    person last = people[len(people) - 1]
+    []str names = {last.first}
+    p.b.first = c + p.b.first
+    p.a = person {
+      first: n,
+      age: i,
+    }
+    str loud, person same = shout(p.a)
+    shout(same)
+    loud = loud + "?"
+    fn() str greet = greeter(same)
+    i32 calls = 0
+    fn() bump = fn() {
+      calls = calls + 1
+      loud = loud + greet()
+    }
+    bump()
+    fn(named) str d = describe
+    d(a)
+  }
+}
+`)
+	if _, err := h.call("main"); err != nil {
+		t.Fatal(err)
+	}
+	stats := h.stats()
+	if stats[0] != 0 || stats[1] != 0 {
+		t.Errorf("expected every allocation to be freed, got stats %v", stats)
+	}
+	// the blocks of one iteration are reused by the next
+	if stats[2] > 1024 {
+		t.Errorf("expected the heap to stay small, %d bytes are free", stats[2])
+	}
+}
+
+// TestReferenceCountingMaps runs a loop that builds maps of managed keys
+// and values, replaces and deletes some of them and expects every one of
+// them to be freed.
+func TestReferenceCountingMaps(t *testing.T) {
+	h := newHeap(t, `pkg main
+
+struct person {
+  str first
+  i32 age
+}
+
+map[str]i32 count(map[str]i32 m, str k) {
+  m[k] = m[k] + 1
+  return m
+}
+
+fn main() {
+  for i32 i = 0; i < 1000; i = i + 1 {
+    str n = "ann" + "!"
+    person a = person {
+      first: n,
+      age: i,
+    }
+    map[str]person byName = {n: a, "bob": a}
+    byName[n + n] = a
+    byName[n] = person {
+      first: "cy",
+      age: 2,
+    }
+    person found = byName["bob"]
+    delete(byName, "bob")
+    map[str][]str groups = {}
+    for i32 j = 0; j < 4; j = j + 1 {
+      groups[n[:j]] = {n, found.first}
+    }
+    []str missing = groups["none"]
+    []str ks = keys(groups)
+    str k = ks[1] + found.first
+    map[str]i32 counts = {}
+    counts = count(count(counts, k), k)
+    map[i32]map[str]i32 nested = {i: counts}
+    map[str]i32 inner = nested[i]
+    inner[n] = len(missing)
+  }
+}
+`)
+	if _, err := h.call("main"); err != nil {
+		t.Fatal(err)
+	}
+	stats := h.stats()
+	if stats[0] != 0 || stats[1] != 0 {
+		t.Errorf("expected every allocation to be freed, got stats %v", stats)
+	}
+	// the blocks of one iteration are reused by the next, and the entries
+	// and the indexes of maps are larger than most blocks
+	if stats[2] > 4096 {
+		t.Errorf("expected the heap to stay small, %d bytes are free", stats[2])
+	}
+}
+
+// TestReferenceCountingLoops runs a loop that iterates over lists, strings
+// and maps of managed values, leaving some of the loops early, also from
+// loops inside them, and expects every one of them to be freed.
+func TestReferenceCountingLoops(t *testing.T) {
+	h := newHeap(t, `pkg main
+
+struct person {
+  str first
+  i32 age
+}
+
+str first(map[str][]person groups, i32 min) {
+  for name, people in groups {
+    for p in people {
+      if p.age >= min {
+        return name + p.first
+      }
+    }
+  }
+  return ""
+}
+
+fn main() {
+  for i32 i = 0; i < 1000; i = i + 1 {
+    str n = "ann" + "!"
+    person a = person {
+      first: n,
+      age: i,
+    }
+    []person people = {a, a}
+    for j in 0..4 {
+      append(people, person {
+        first: n[:j],
+        age: j,
+      })
+    }
+    map[str][]person groups = {n: people, "cy": {a}}
+    str f = first(groups, 2)
+    for i, p in people {
+      if i == 3 {
+        break
+      }
+      f = f + p.first
+    }
+    fn() str last = fn() str {
+      return ""
+    }
+    for ch in n + f {
+      if ch == 33 {
+        continue
+      }
+      last = fn() str {
+        return f + n
+      }
+    }
+    outer: for i, p in people {
+      for k, v in groups {
+        for ch in k + p.first {
+          if i == 1 {
+            continue outer
+          }
+          if len(v) > 2 {
+            break outer
+          }
+        }
+      }
+    }
+    for k, v in groups {
+      delete(groups, n)
+      person head = v[0]
+      f = k + head.first + last()
+    }
+  }
+}
+`)
+	if _, err := h.call("main"); err != nil {
+		t.Fatal(err)
+	}
+	stats := h.stats()
+	if stats[0] != 0 || stats[1] != 0 {
+		t.Errorf("expected every allocation to be freed, got stats %v", stats)
+	}
+	// as with maps, the entries and the indexes of the maps iterated over
+	// are larger than most blocks
+	if stats[2] > 4096 {
+		t.Errorf("expected the heap to stay small, %d bytes are free", stats[2])
+	}
+}
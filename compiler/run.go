@@ -0,0 +1,116 @@
+package compiler
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bytecodealliance/wasmtime-go"
+	"github.com/dfirebaugh/punch/emitters/wat"
+)
+
+// ImportModule is the module name the WAT emitter uses for host functions.
+const ImportModule = wat.DefaultImportModule
+
+// Run instantiates a compiled module, provides the host functions the WAT
+// emitter imports and calls the module's main export. Output from println is
+// written to out. Traps are returned as errors that name the failing
+// functions.
+func Run(wasm []byte, out io.Writer) error {
+	store := wasmtime.NewStore(wasmtime.NewEngine())
+	instance, err := instantiate(store, wasm, out)
+	if err != nil {
+		return err
+	}
+	main := instance.GetFunc(store, "main")
+	if main == nil {
+		return errors.New("module does not export a main function")
+	}
+	if _, err := main.Call(store); err != nil {
+		return runtimeError(err)
+	}
+	return nil
+}
+
+// instantiate links a compiled module against the host functions and
+// instantiates it in a store.
+func instantiate(store *wasmtime.Store, wasm []byte, out io.Writer) (*wasmtime.Instance, error) {
+	module, err := wasmtime.NewModule(store.Engine, wasm)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wasm module: %w", err)
+	}
+
+	linker := wasmtime.NewLinker(store.Engine)
+	hostFunctions := map[string]interface{}{
+		"print_i32":  func(v int32) { fmt.Fprint(out, v) },
+		"print_i64":  func(v int64) { fmt.Fprint(out, v) },
+		"print_u64":  func(v int64) { fmt.Fprint(out, uint64(v)) },
+		"print_f32":  func(v float32) { fmt.Fprint(out, v) },
+		"print_f64":  func(v float64) { fmt.Fprint(out, v) },
+		"print_bool": func(v int32) { fmt.Fprint(out, v != 0) },
+		"print_char": func(c int32) { fmt.Fprint(out, string(rune(c))) },
+		"print_str": func(caller *wasmtime.Caller, ptr int32) {
+			fmt.Fprint(out, readString(caller, ptr))
+		},
+		"panic": func(caller *wasmtime.Caller, ptr int32) *wasmtime.Trap {
+			return wasmtime.NewTrap(readString(caller, ptr))
+		},
+	}
+	for name, fn := range hostFunctions {
+		if err := linker.FuncWrap(ImportModule, name, fn); err != nil {
+			return nil, err
+		}
+	}
+
+	instance, err := linker.Instantiate(store, module)
+	if err != nil {
+		return nil, runtimeError(err)
+	}
+	return instance, nil
+}
+
+// readString reads the string at an address in the memory of the module
+// that calls a host function: a little endian length followed by the bytes.
+func readString(caller *wasmtime.Caller, ptr int32) string {
+	memory := caller.GetExport("memory").Memory()
+	if memory == nil {
+		return ""
+	}
+	data := memory.UnsafeData(caller)
+	start := int(ptr) + 4
+	if ptr < 0 || start > len(data) {
+		return ""
+	}
+	end := start + int(binary.LittleEndian.Uint32(data[ptr:start]))
+	if end > len(data) || end < start {
+		return ""
+	}
+	return string(data[start:end])
+}
+
+// runtimeError turns a trap into an error with a readable backtrace.
+func runtimeError(err error) error {
+	var trap *wasmtime.Trap
+	if !errors.As(err, &trap) {
+		return err
+	}
+
+	var out strings.Builder
+	message := trap.Message()
+	// wasmtime appends its own backtrace to the message, ours names the
+	// punch functions instead
+	if i := strings.Index(message, "\nwasm backtrace:"); i >= 0 {
+		message = message[:i]
+	}
+	out.WriteString("runtime error: " + message)
+	for _, frame := range trap.Frames() {
+		name := fmt.Sprintf("function %d", frame.FuncIndex())
+		if n := frame.FuncName(); n != nil {
+			name = *n
+		}
+		fmt.Fprintf(&out, "\n\tat %s", name)
+	}
+	return errors.New(out.String())
+}
@@ -0,0 +1,909 @@
+package compiler_test
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dfirebaugh/punch/checker"
+	"github.com/dfirebaugh/punch/compiler"
+	"github.com/dfirebaugh/punch/emitters/js"
+	"github.com/dfirebaugh/punch/lexer"
+	"github.com/dfirebaugh/punch/parser"
+)
+
+func compile(t *testing.T, source string) []byte {
+	t.Helper()
+	_, wasm, _ := compiler.Compile("test.pun", source)
+	if wasm == nil {
+		t.Fatal("failed to compile")
+	}
+	return wasm
+}
+
+// run runs a program on the wasm backend and, when node is installed, on the
+// js backend too, failing the test unless both print the same output and
+// either both succeed or both fail. It returns the output and error of the
+// wasm backend.
+func run(t *testing.T, source string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	err := compiler.Run(compile(t, source), &out)
+	node, nodeErr := exec.LookPath("node")
+	if nodeErr != nil {
+		return out.String(), err
+	}
+	jsOut, jsErr := runJS(t, node, "test.pun", source)
+	if out.String() != jsOut {
+		t.Errorf("wasm output:\n%s\njs output:\n%s", out.String(), jsOut)
+	}
+	if (err == nil) != (jsErr == nil) {
+		t.Errorf("wasm error: %v\njs error: %v", err, jsErr)
+	}
+	return out.String(), err
+}
+
+func TestRun(t *testing.T) {
+	out, err := run(t, `pkg main
+i32 add(i32 a, i32 b) {
+	return a + b
+}
+fn main() {
+	i32 a = add(2, 3)
+	println(a)
+}
+main()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "5\n" {
+		t.Errorf("got output %q, want %q", out, "5\n")
+	}
+}
+
+func TestRunInferredDeclarations(t *testing.T) {
+	out, err := run(t, `pkg main
+
+fn main() {
+	x := 5
+	s := "a" + "b"
+	for i := 0; i < 3; i = i + 1 {
+		x = x + i
+		s = s + "c"
+	}
+	f := fn(i32 n) i32 {
+		return n * 2
+	}
+	println(x, s, f(x))
+}
+
+main()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "8 abccc 16\n" {
+		t.Errorf("got output %q, want %q", out, "8 abccc 16\n")
+	}
+}
+
+func TestRunMainCalledTwice(t *testing.T) {
+	out, err := run(t, `pkg main
+
+fn main() {
+	println("main")
+}
+
+main()
+main()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "main\nmain\n" {
+		t.Errorf("got output %q, want %q", out, "main\nmain\n")
+	}
+}
+
+func TestRunImplicitMain(t *testing.T) {
+	out, err := run(t, `pkg main
+
+struct pt {
+	i32 x
+}
+
+fn main() {
+	println("main")
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "main\n" {
+		t.Errorf("got output %q, want %q", out, "main\n")
+	}
+}
+
+func TestRunArithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"i64", "i64 a = 3000000000\n\tprintln(a * 2)", "6000000000"},
+		{"u32 division", "u32 a = 4000000000\n\tprintln(a / 3)", "1333333333"},
+		{"u32 comparison", "u32 a = 4000000000\n\tprintln(a > 1)", "true"},
+		{"u8 wraps", "u8 a = 250\n\tprintln(a + 10)", "4"},
+		{"i8 wraps", "i8 a = 127\n\tprintln(a + 1)", "-128"},
+		{"u16 wraps", "u16 a = 0\n\tprintln(a - 1)", "65535"},
+		{"f64", "f64 a = 7.5\n\tprintln(a / 2.0)", "3.75"},
+		{"f32", "f32 a = 1.5\n\tprintln(a * a)", "2.25"},
+		{"negation", "f64 a = 7.5\n\tprintln(-a)", "-7.5"},
+		{"int to float", "i32 a = 7\n\tprintln(f64(a) / 2.0)", "3.5"},
+		{"float to int", "f64 a = -7.9\n\tprintln(i32(a))", "-7"},
+		{"saturating", "f64 a = 1e20\n\tprintln(i32(a))", "2147483647"},
+		{"sign extension", "i32 a = -7\n\tprintln(i64(a) * 1000000000)", "-7000000000"},
+		{"zero extension", "u32 a = 4000000000\n\tprintln(i64(a))", "4000000000"},
+		{"narrowing", "i32 a = 7\n\tprintln(u8(300 + a))", "51"},
+		{"signed to unsigned", "i32 a = -7\n\tprintln(u32(a) / 2)", "2147483644"},
+		{"signed remainder", "i32 a = -7\n\tprintln(a % 3)", "-1"},
+		{"u16 wraps up", "u16 a = 65535\n\tprintln(a + 1)", "0"},
+		{"i32 wraps", "i32 a = 2147483647\n\tprintln(a + 1, a * a)", "-2147483648 1"},
+		{"u32 wraps", "u32 a = 4294967295\n\tprintln(a + 1, a * a)", "0 1"},
+		{"signed division", "i32 a = -7\n\tprintln(a / 2)", "-3"},
+		{"smallest by -1", "i32 a = -2147483648\n\ti32 b = -1\n\tprintln(a / b, a % b, i64(a) / i64(b))", "-2147483648 0 2147483648"},
+		{"unsigned negation", "u8 a = 10\n\tprintln(-a)", "246"},
+		{"u64 max", "u64 a = 18446744073709551615\n\tprintln(a == 18446744073709551615, a / 1000000000000)", "true 18446744"},
+		{"u64 above i64", "u64 a = 10000000000000000000\n\tprintln(a, a > 9223372036854775807)", "10000000000000000000 true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := run(t, "pkg main\nfn main() {\n\t"+tt.body+"\n}\nmain()")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(out); got != tt.want {
+				t.Errorf("got output %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunControlFlow(t *testing.T) {
+	out, err := run(t, `pkg main
+
+str sign(i32 n) {
+	if n < 0 {
+		return "negative"
+	} else if n == 0 {
+		return "zero"
+	} else {
+		return "positive"
+	}
+}
+
+bool loud(bool b) {
+	println("evaluated")
+	return b
+}
+
+fn main() {
+	i32 total = 0
+	for i32 i = 0; i < 10; i = i + 1 {
+		if i == 2 {
+			continue
+		}
+		if i == 6 {
+			break
+		}
+		for i32 j = 0; j < 10; j = j + 1 {
+			if j == 1 {
+				break
+			}
+			total = total + 100
+		}
+		total = total + i
+	}
+	println(total)
+	println(sign(-4), sign(0), sign(9))
+	println(false && loud(true), true || loud(false))
+	println(true && loud(true))
+}
+
+main()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "513\nnegative zero positive\nfalse true\nevaluated\ntrue\n"
+	if out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestRunStrings(t *testing.T) {
+	out, err := run(t, `pkg main
+
+str greet(str name) {
+	return "hello, " + name
+}
+
+fn main() {
+	str s = greet("bob")
+	println(s, len(s), len("héllo"), s[0])
+	println(s[7:], s[:5], s[1:2])
+	println(s == "hello, bob", "abc" < "abd", "ab" < "a", s != "")
+	println("tab\tquote\"")
+}
+
+main()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "hello, bob 10 6 104\nbob hello e\ntrue true false true\ntab\tquote\"\n"
+	if out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestRunStringBounds(t *testing.T) {
+	tests := map[string]string{
+		`println(s[3])`:   "index out of range",
+		`println(s[2:4])`: "slice bounds out of range",
+		`println(s[2:1])`: "slice bounds out of range",
+	}
+	for stmt, want := range tests {
+		_, err := run(t, "pkg main\nfn main() {\n\tstr s = \"abc\"\n\t"+stmt+"\n}\nmain()")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got error %v, want %q", stmt, err, want)
+		}
+	}
+}
+
+func TestRunLists(t *testing.T) {
+	out, err := run(t, `pkg main
+
+fn main() {
+	[]i64 big = {1, 2}
+	for i32 i = 0; i < 100; i = i + 1 {
+		append(big, i64(i) * 1000000000)
+	}
+	println(len(big), big[0], big[101])
+	[]f64 halves = {0.5}
+	append(halves, 1.5)
+	println(halves[0] + halves[1])
+	[]str words = {"x"}
+	for i32 j = 0; j < 10; j = j + 1 {
+		append(words, words[j] + "y")
+	}
+	println(words[10], len(words))
+	println(words[11])
+}
+
+main()`)
+	if err == nil || !strings.Contains(err.Error(), "index out of range") {
+		t.Errorf("got error %v, want index out of range", err)
+	}
+	want := "102 1 99000000000\n2\nxyyyyyyyyyy 11\n"
+	if out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestRunStructs(t *testing.T) {
+	out, err := run(t, `pkg main
+
+struct inner {
+	str note
+	[]i32 counts
+}
+
+struct outer {
+	u8 small
+	i64 big
+	i16 medium
+	bool flag
+	f64 ratio
+	inner in
+}
+
+fn main() {
+	outer o = outer {
+		small: 200,
+		big: 9000000000,
+		medium: -300,
+		flag: true,
+		ratio: 0.25,
+		in: inner {
+			note: "a",
+			counts: {1, 2},
+		},
+	}
+	o.small = o.small + 50
+	o.big = o.big * 2
+	o.in.note = o.in.note + "b"
+	append(o.in.counts, 3)
+	println(o.small, o.big, o.medium, o.flag, o.ratio)
+	println(o.in.note, len(o.in.counts), o.in.counts[2])
+	o.in = inner {
+		note: "c",
+		counts: {},
+	}
+	println(o.in.note, len(o.in.counts))
+}
+
+main()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "250 18000000000 -300 true 0.25\nab 3 3\nc 0\n"
+	if out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestRunStructsShareValues(t *testing.T) {
+	out, err := run(t, `pkg main
+
+struct pt {
+	i32 x
+	i32 y
+}
+
+fn move(pt p) {
+	p.y = 50
+}
+
+fn main() {
+	pt a = pt {
+		x: 1,
+		y: 2,
+	}
+	pt b = a
+	b.x = 100
+	move(b)
+	println(a.x, a.y, b.x, b.y)
+}
+
+main()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "100 50 100 50\n"
+	if out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestRunMultipleResults(t *testing.T) {
+	out, err := run(t, `pkg main
+
+(i32, bool) add_eq(i32 a, i32 b) {
+	return a + b, a == b
+}
+
+(str, i64, f64) describe(str name) {
+	if len(name) > 3 {
+		return name[:3], i64(len(name)), 0.5
+	}
+	return name + "!", 0, 1.5
+}
+
+fn main() {
+	i32 s, bool eq = add_eq(2, 2)
+	println(s, eq)
+	str short, i64 n, f64 f = describe("punch")
+	println(short, n, f)
+	str other, i64 m, f64 g = describe("wa")
+	println(other, m, g)
+	add_eq(1, 2)
+}
+
+main()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "4 true\npun 5 0.5\nwa! 0 1.5\n"
+	if out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestRunDefer(t *testing.T) {
+	out, err := run(t, `pkg main
+
+struct counter {
+	str name
+	i32 n
+}
+
+fn (counter c) report(str when) {
+	println(c.name, c.n, when)
+}
+
+fn log(str msg, i32 n) {
+	println(msg, n)
+}
+
+i32 work(i32 x) {
+	defer log("first", x)
+	x = x + 1
+	defer log("second", x)
+	if x > 5 {
+		defer log("big", x)
+		return x * 2
+	}
+	return x + 100
+}
+
+fn main() {
+	counter c = counter {
+		name: "c" + "1",
+		n: 7,
+	}
+	defer c.report("deferred")
+	c = counter {
+		name: "c2",
+		n: 8,
+	}
+	println(work(1))
+	println(work(9))
+}
+
+main()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "second 2\nfirst 1\n102\nbig 10\nsecond 10\nfirst 9\n20\nc1 7 deferred\n"
+	if out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestRunDeferInLoops(t *testing.T) {
+	out, err := run(t, `pkg main
+
+struct res {
+	str name
+}
+
+fn (res r) close(i32 i) {
+	println("close", r.name, i)
+}
+
+i32 find(i32 limit) {
+	defer println("done")
+	for i32 i = 0; i < 3; i = i + 1 {
+		defer println("iter", i, f64(i) / 2.0)
+		if i == limit {
+			return i
+		}
+		for j in 0..2 {
+			defer println("inner", i, j)
+		}
+	}
+	return -1
+}
+
+fn main() {
+	for i32 i = 0; i < 2; i = i + 1 {
+		res r = res {
+			name: "r" + "x",
+		}
+		defer r.close(i)
+	}
+	println(find(1))
+	println(find(5))
+}
+
+main()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "iter 1 0.5\ninner 0 1\ninner 0 0\niter 0 0\ndone\n1\n" +
+		"inner 2 1\ninner 2 0\niter 2 1\ninner 1 1\ninner 1 0\niter 1 0.5\ninner 0 1\ninner 0 0\niter 0 0\ndone\n-1\n" +
+		"close rx 1\nclose rx 0\n"
+	if out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestRunClosures(t *testing.T) {
+	out, err := run(t, `pkg main
+
+i32 double(i32 n) {
+	return n * 2
+}
+
+i32 apply(fn(i32) i32 f, i32 v) {
+	return f(v)
+}
+
+fn(i32) i32 adder(i32 n) {
+	return fn(i32 x) i32 {
+		return x + n
+	}
+}
+
+fn main() {
+	i32 count = 0
+	fn() inc = fn() {
+		count = count + 1
+	}
+	inc()
+	inc()
+	println(count)
+
+	fn(i32) i32 add5 = adder(5)
+	println(add5(10), apply(add5, 1))
+	println(apply(double, 21))
+	println(apply(fn(i32 x) i32 { return x * x }, 9))
+
+	str greeting = "hi "
+	fn(str) str greet = fn(str name) str {
+		fn() str both = fn() str {
+			return greeting + name
+		}
+		return both()
+	}
+	println(greet("bob"))
+	greeting = "bye "
+	println(greet("ann"))
+}
+
+main()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "2\n15 6\n42\n81\nhi bob\nbye ann\n"
+	if out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestRunFunctionValues(t *testing.T) {
+	out, err := run(t, `pkg main
+
+struct calc {
+	fn(i32) i32 op
+	i32 base
+}
+
+i32 double(i32 n) {
+	return n * 2
+}
+
+fn(i32) i32 adder(i32 n) {
+	return fn(i32 x) i32 {
+		return x + n
+	}
+}
+
+fn main() {
+	println(adder(2)(3))
+
+	[]fn(i32) i32 ops = {double, adder(10)}
+	for i in 0..2 {
+		println(ops[i](i + 1))
+	}
+
+	calc c = calc {
+		op: adder(1),
+		base: 3,
+	}
+	println(c.op(c.base))
+	c.op = double
+	println(c.op(c.base))
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "5\n2\n12\n4\n6\n"
+	if out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestRunMaps(t *testing.T) {
+	out, err := run(t, `pkg main
+
+map[str]i32 count(map[str]i32 m, str k) {
+	m[k] = m[k] + 1
+	return m
+}
+
+map[str]i32 empty() {
+	return {}
+}
+
+fn main() {
+	map[str]i32 ages = {
+		"ann": 31,
+		"bob": 42,
+	}
+	ages["cy"] = 7
+	delete(ages, "bob")
+	println(len(ages), has(ages, "bob"), ages["ann"], ages["zed"])
+	[]str ks = keys(ages)
+	println(ks[0], ks[1])
+	count(ages, "ann")
+	count(ages, "dee")
+	println(ages["ann"], ages["dee"], len(ages))
+
+	map[i32]str squares = {}
+	for i32 i = 0; i < 50; i = i + 1 {
+		squares[i * i] = "sq"
+	}
+	for i32 i = 0; i < 50; i = i + 2 {
+		delete(squares, i * i)
+	}
+	squares[4] = "again"
+	[]i32 sq = keys(squares)
+	println(len(squares), squares[4], squares[9], squares[16], sq[0], sq[len(sq) - 1])
+
+	map[str][]i32 groups = {"odd": {1, 3}}
+	[]i32 none = groups["even"]
+	println(len(none), len(groups["odd"]))
+
+	ages = {}
+	groups["odd"] = {}
+	map[str]map[str]i32 nested = {"a": {"b": 1}}
+	nested["a"] = {}
+	println(len(ages), len(groups["odd"]), len(nested["a"]), len(empty()), len(count({}, "x")))
+}
+
+main()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "2 false 31 0\nann cy\n32 1 3\n26 again sq  1 4\n0 2\n0 0 0 0 1\n"
+	if out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestRunForIn(t *testing.T) {
+	out, err := run(t, `pkg main
+
+fn main() {
+	[]str names = {"ann", "bob", "cy"}
+	for i, name in names {
+		println(i, name)
+	}
+	str s = "hi!"
+	for i, ch in s {
+		if ch == 33 {
+			continue
+		}
+		println(i, ch)
+	}
+	map[str]i32 ages = {
+		"ann": 31,
+		"bob": 42,
+		"cy": 7,
+	}
+	for k, v in ages {
+		delete(ages, "bob")
+		println(k, v)
+	}
+	i64 total = 0
+	i64 n = 5
+	for i in 0..n {
+		for j in i..n {
+			if j == 3 {
+				break
+			}
+			total = total + j
+		}
+	}
+	[]i32 xs = {1, 2, 3}
+	i32 sum = 0
+	for x in xs {
+		sum = sum + x
+	}
+	println(total, sum)
+}
+
+main()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "0 ann\n1 bob\n2 cy\n0 104\n1 105\nann 31\ncy 7\n12 6\n"
+	if out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestRunLabeledLoops(t *testing.T) {
+	out, err := run(t, `pkg main
+
+i32 find(map[str][]i32 groups, i32 want) {
+	i32 seen = 0
+	search: for k, xs in groups {
+		for x in xs {
+			seen = seen + 1
+			if x == want {
+				break search
+			}
+		}
+	}
+	return seen
+}
+
+fn main() {
+	str found = ""
+	outer: for i32 i = 0; i < 4; i = i + 1 {
+		for j in 0..4 {
+			if j > i {
+				continue outer
+			}
+			if i == 3 {
+				break outer
+			}
+			found = found + "x"
+		}
+		found = found + "|"
+	}
+	println(found)
+
+	[]str words = {"ab", "cd", "ef"}
+	i32 count = 0
+	words: for w in words {
+		for ch in w + w {
+			if ch == 100 {
+				continue words
+			}
+			count = count + 1
+		}
+	}
+	map[str][]i32 groups = {"a": {1, 2}, "b": {3, 4}}
+	println(count, find(groups, 2), find(groups, 9))
+}
+
+main()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "xxxxxx\n9 2 4\n"
+	if out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestRunLoopForms(t *testing.T) {
+	out, err := run(t, `pkg main
+
+i32 firstOver(i32 n) {
+	i32 i = 0
+	for {
+		if i * i > n {
+			return i
+		}
+		i = i + 1
+	}
+}
+
+fn main() {
+	i32 n = 0
+	for n < 5 {
+		n = n + 1
+	}
+	bool going = true
+	for going {
+		going = false
+	}
+	i32 total = 0
+	for true {
+		total = total + 1
+		if total == 3 {
+			break
+		}
+	}
+	for i := 0; i < 3; i = i + 1 {
+		total = total + i
+	}
+	outer: for {
+		for {
+			break outer
+		}
+	}
+	println(n, going, total, firstOver(20))
+}
+
+main()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "5 false 6 5\n"
+	if out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestRunTrap(t *testing.T) {
+	_, err := run(t, `pkg main
+i32 divide(i32 a, i32 b) {
+	return a / b
+}
+fn main() {
+	i32 a = divide(1, 0)
+	println(a)
+}
+
+main()`)
+	if err == nil {
+		t.Fatal("expected a trap")
+	}
+	for _, want := range []string{"integer divide by zero", "at divide", "at main"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+}
+
+// wasmUnsupported are the examples that use features the wat backend does
+// not support yet.
+var wasmUnsupported = map[string]string{
+	"struct.pun": "printing structs",
+}
+
+// TestRunExamples runs every example on both backends and expects the same
+// output from each. The js backend is skipped when node is not installed.
+func TestRunExamples(t *testing.T) {
+	files, err := filepath.Glob("../examples/*.pun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, nodeErr := exec.LookPath("node")
+
+	for _, file := range files {
+		name := filepath.Base(file)
+		t.Run(name, func(t *testing.T) {
+			if reason, ok := wasmUnsupported[name]; ok {
+				t.Skipf("the wat backend does not support %s", reason)
+			}
+			source, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var wasmOut bytes.Buffer
+			if err := compiler.Run(compile(t, string(source)), &wasmOut); err != nil {
+				t.Fatal(err)
+			}
+			if nodeErr != nil {
+				return
+			}
+
+			jsOut, err := runJS(t, node, name, string(source))
+			if err != nil {
+				t.Fatalf("node: %v", err)
+			}
+			if wasmOut.String() != jsOut {
+				t.Errorf("wasm output:\n%s\njs output:\n%s", wasmOut.String(), jsOut)
+			}
+		})
+	}
+}
+
+// runJS transpiles a program to javascript and runs it with node, returning
+// its output and the error of a program that failed.
+func runJS(t *testing.T, node, name, source string) (string, error) {
+	t.Helper()
+	program, err := parser.New(lexer.New(name, source)).ParseProgram(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checked, err := checker.Check(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsCode, err := js.NewTranspiler().Transpile(checked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(node, "--input-type=module")
+	cmd.Stdin = strings.NewReader(jsCode)
+	out, err := cmd.Output()
+	return string(out), err
+}
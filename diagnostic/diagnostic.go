@@ -0,0 +1,106 @@
+package diagnostic
+
+import (
+	"fmt"
+	"strings"
+	"text/scanner"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/token"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	default:
+		return "unknown"
+	}
+}
+
+// Diagnostic is a message about a range of source code.
+type Diagnostic struct {
+	Severity Severity
+	Message  string
+	Pos      scanner.Position
+	End      scanner.Position
+	Hint     string
+}
+
+// New creates an error diagnostic spanning a single token.
+func New(tok token.Token, format string, args ...interface{}) Diagnostic {
+	return Diagnostic{
+		Severity: Error,
+		Message:  fmt.Sprintf(format, args...),
+		Pos:      tok.Position,
+		End:      ast.TokenEnd(tok),
+	}
+}
+
+// At creates an error diagnostic spanning a node. A nil node gives a
+// diagnostic without a position.
+func At(node ast.Node, format string, args ...interface{}) Diagnostic {
+	d := Diagnostic{
+		Severity: Error,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	if node != nil {
+		d.Pos, d.End = node.Pos(), node.End()
+	}
+	return d
+}
+
+// WithHint returns a copy of the diagnostic with a hint attached.
+func (d Diagnostic) WithHint(format string, args ...interface{}) Diagnostic {
+	d.Hint = fmt.Sprintf(format, args...)
+	return d
+}
+
+func (d Diagnostic) Error() string {
+	if d.Pos.Filename == "" {
+		return fmt.Sprintf("[%d:%d]: %s", d.Pos.Line, d.Pos.Column, d.Message)
+	}
+	return fmt.Sprintf("%s:[%d:%d]: %s", d.Pos.Filename, d.Pos.Line, d.Pos.Column, d.Message)
+}
+
+// List is a collection of diagnostics. It implements error so that every
+// problem found in a pass can be returned at once.
+type List []Diagnostic
+
+func (l List) Error() string {
+	msgs := make([]string, len(l))
+	for i, d := range l {
+		msgs[i] = d.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// HasErrors reports whether any diagnostic in the list is an error.
+func (l List) HasErrors() bool {
+	for _, d := range l {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns the list as an error, or nil if it contains no errors.
+func (l List) Err() error {
+	if !l.HasErrors() {
+		return nil
+	}
+	return l
+}
@@ -0,0 +1,81 @@
+package diagnostic
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Fprint writes diagnostics to w in a rustc like format, showing the
+// offending source line with the range underlined:
+//
+//	error: undefined: x
+//	 --> main.pun:4:13
+//	  |
+//	4 |     println(x)
+//	  |             ^
+//
+// sources maps file names to their contents. Diagnostics for files without
+// a source are printed without the source excerpt.
+func Fprint(w io.Writer, diags List, sources map[string]string) {
+	for i, d := range diags {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fprint(w, d, sources[d.Pos.Filename])
+	}
+}
+
+func fprint(w io.Writer, d Diagnostic, source string) {
+	fmt.Fprintf(w, "%s: %s\n", d.Severity, d.Message)
+
+	line, ok := sourceLine(source, d.Pos.Line)
+	gutter := strings.Repeat(" ", len(strconv.Itoa(d.Pos.Line)))
+
+	fmt.Fprintf(w, "%s--> %s:%d:%d\n", gutter, d.Pos.Filename, d.Pos.Line, d.Pos.Column)
+	if ok {
+		fmt.Fprintf(w, "%s |\n", gutter)
+		fmt.Fprintf(w, "%d | %s\n", d.Pos.Line, line)
+		fmt.Fprintf(w, "%s | %s%s\n", gutter, caretIndent(line, d.Pos.Column), carets(d))
+	}
+	if d.Hint != "" {
+		fmt.Fprintf(w, "%s = hint: %s\n", gutter, d.Hint)
+	}
+}
+
+func sourceLine(source string, line int) (string, bool) {
+	if source == "" || line < 1 {
+		return "", false
+	}
+	lines := strings.Split(source, "\n")
+	if line > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[line-1], "\r"), true
+}
+
+// caretIndent returns the whitespace needed to line a caret up with a column,
+// keeping tabs so the caret lines up no matter the tab width.
+func caretIndent(line string, column int) string {
+	var out strings.Builder
+	for i, r := range []rune(line) {
+		if i >= column-1 {
+			break
+		}
+		if r == '\t' {
+			out.WriteRune('\t')
+		} else {
+			out.WriteRune(' ')
+		}
+	}
+	return out.String()
+}
+
+func carets(d Diagnostic) string {
+	width := 1
+	if d.End.Line == d.Pos.Line && d.End.Column > d.Pos.Column {
+		width = d.End.Column - d.Pos.Column
+	}
+	return strings.Repeat("^", width)
+}
@@ -0,0 +1,56 @@
+package diagnostic
+
+import (
+	"bytes"
+	"testing"
+	"text/scanner"
+)
+
+func TestFprint(t *testing.T) {
+	source := "pkg main\n\nfn main() {\n\tprintln(xyz)\n}\n"
+	diags := List{
+		{
+			Severity: Error,
+			Message:  "undefined: xyz",
+			Pos:      scanner.Position{Filename: "main.pun", Line: 4, Column: 10},
+			End:      scanner.Position{Filename: "main.pun", Line: 4, Column: 13},
+			Hint:     "declare xyz before using it",
+		},
+		{
+			Severity: Warning,
+			Message:  "no source",
+			Pos:      scanner.Position{Filename: "other.pun", Line: 1, Column: 1},
+		},
+	}
+
+	var out bytes.Buffer
+	Fprint(&out, diags, map[string]string{"main.pun": source})
+
+	want := "error: undefined: xyz\n" +
+		" --> main.pun:4:10\n" +
+		"  |\n" +
+		"4 | \tprintln(xyz)\n" +
+		"  | \t        ^^^\n" +
+		"  = hint: declare xyz before using it\n" +
+		"\n" +
+		"warning: no source\n" +
+		" --> other.pun:1:1\n"
+	if out.String() != want {
+		t.Errorf("Fprint:\ngot:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestListErr(t *testing.T) {
+	var l List
+	if l.Err() != nil {
+		t.Errorf("empty list should not be an error")
+	}
+	l = append(l, Diagnostic{Severity: Warning, Message: "careful"})
+	if l.Err() != nil {
+		t.Errorf("list of warnings should not be an error")
+	}
+	l = append(l, Diagnostic{Severity: Error, Message: "broken"})
+	if l.Err() == nil {
+		t.Errorf("list with an error should be an error")
+	}
+}
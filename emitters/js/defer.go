@@ -0,0 +1,103 @@
+package js
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/dfirebaugh/punch/ast"
+)
+
+// jsDefers is the array a function with defer statements collects its
+// deferred calls in.
+const jsDefers = "__punch_defers"
+
+// hasDefer reports whether a block contains a defer statement outside of
+// nested functions.
+func hasDefer(block *ast.BlockStatement) bool {
+	for _, stmt := range block.Statements {
+		switch s := stmt.(type) {
+		case *ast.DeferStatement:
+			return true
+		case *ast.BlockStatement:
+			if hasDefer(s) {
+				return true
+			}
+		case *ast.IfStatement:
+			if hasDefer(s.Consequence) || s.Alternative != nil && hasDefer(s.Alternative) {
+				return true
+			}
+		case *ast.ForStatement:
+			if hasDefer(s.Body) {
+				return true
+			}
+		case *ast.ForInStatement:
+			if hasDefer(s.Body) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// transpileFunctionBody returns the block of a function, with prologue
+// placed before its statements. The statements of a function with defer
+// statements run in a try block whose finally block makes the deferred
+// calls, last deferred first, however the function exits.
+func (t *Transpiler) transpileFunctionBody(prologue string, body *ast.BlockStatement) string {
+	var out bytes.Buffer
+	out.WriteString("{\n" + prologue)
+	if !hasDefer(body) {
+		for _, s := range body.Statements {
+			out.WriteString(t.transpileStatement(s))
+			out.WriteString("\n")
+		}
+		out.WriteString("}")
+		return out.String()
+	}
+
+	out.WriteString(fmt.Sprintf("%s %s = [];\n", JSConst, jsDefers))
+	out.WriteString("try {\n")
+	for _, s := range body.Statements {
+		out.WriteString(t.transpileStatement(s))
+		out.WriteString("\n")
+	}
+	out.WriteString("} finally {\n")
+	out.WriteString(fmt.Sprintf("for (let i = %s.length - 1; i >= 0; i--) {\n%[1]s[i]();\n}\n", jsDefers))
+	out.WriteString("}\n}")
+	return out.String()
+}
+
+// transpileDeferStatement adds a call to the deferred calls of its
+// function. The receiver and the arguments of the call are evaluated
+// where the statement runs.
+func (t *Transpiler) transpileDeferStatement(stmt *ast.DeferStatement) string {
+	expr, ok := stmt.Statement.(*ast.ExpressionStatement)
+	if !ok {
+		t.unsupported(stmt)
+		return ""
+	}
+	call, ok := expr.Expression.(*ast.FunctionCall)
+	if !ok {
+		t.unsupported(stmt)
+		return ""
+	}
+
+	values := call.Arguments
+	if _, ok := t.info.PackageMember(call.Function); ok {
+		// the package object is not a value of the call
+	} else if access, ok := call.Function.(*ast.StructFieldAccess); ok {
+		values = append([]ast.Expression{access.Left}, values...)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("{\n")
+	for _, value := range values {
+		t.deferCounter++
+		name := fmt.Sprintf("__punch_defer_%d", t.deferCounter)
+		out.WriteString(fmt.Sprintf("%s %s = %s;\n", JSConst, name, t.transpileExpression(value)))
+		t.evaluated[value] = name
+	}
+	out.WriteString(fmt.Sprintf("%s.push(() => %s);\n", jsDefers, t.transpileExpression(call)))
+	out.WriteString("}")
+	return out.String()
+}
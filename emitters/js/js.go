@@ -3,9 +3,12 @@ package js
 import (
 	"bytes"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/checker"
+	"github.com/dfirebaugh/punch/diagnostic"
 	"github.com/dfirebaugh/punch/token"
 )
 
@@ -15,56 +18,203 @@ const (
 	JSReturn         = "return"
 	JSIf             = "if"
 	JSElse           = "else"
+	JSBreak          = "break"
+	JSContinue       = "continue"
 	JSClass          = "class"
 	JSConstructor    = "constructor"
 	JSNew            = "new"
 	JSExport         = "export"
+	JSConst          = "const"
 	JSConsoleLog     = "console.log"
-	JSUnsupported    = "// Unsupported"
 	JSFileComment    = "// File: %s\n"
 	JSPackageComment = "// Package: %s\n\n"
 )
 
 type Transpiler struct {
-	definedStructs map[string]bool
+	info *checker.Info
+
+	// methods holds the methods of each struct so that they can be emitted
+	// as part of the struct's class
+	methods map[string][]*ast.FunctionStatement
+
+	// tests is set while transpiling with TranspileTests
+	tests bool
+	// usesStrings, usesLists and usesDivision are set when the program
+	// calls the string, list or division helpers
+	usesStrings  bool
+	usesLists    bool
+	usesDivision bool
+	// evaluated maps the values of deferred calls to the constants they
+	// were evaluated into by their defer statement
+	evaluated    map[ast.Expression]string
+	deferCounter int
+	loopCounter  int
+
+	errors diagnostic.List
 }
 
 func NewTranspiler() *Transpiler {
 	return &Transpiler{
-		definedStructs: make(map[string]bool),
+		methods:   make(map[string][]*ast.FunctionStatement),
+		evaluated: make(map[ast.Expression]string),
 	}
 }
 
-func (t *Transpiler) Transpile(program *ast.Program) (string, error) {
+// Transpile returns the javascript of a program. Constructs the transpiler
+// does not support are returned as a diagnostic.List, in which case no code
+// is returned.
+func (t *Transpiler) Transpile(program *checker.Program) (string, error) {
 	var out bytes.Buffer
 
+	t.info = program.Info
+	t.errors = nil
+	t.usesStrings = false
+	t.usesLists = false
+	t.usesDivision = false
+
 	for _, file := range program.Files {
+		for _, stmt := range file.Statements {
+			if fn, ok := stmt.(*ast.FunctionStatement); ok && fn.Receiver != nil {
+				recv := string(fn.Receiver.Type)
+				t.methods[recv] = append(t.methods[recv], fn)
+			}
+		}
+	}
+
+	for _, files := range packages(program.Files) {
+		if files[0].ImportPath != "" {
+			out.WriteString(t.transpilePackage(files))
+			out.WriteString("\n")
+			continue
+		}
+		for _, file := range files {
+			out.WriteString(t.transpileFile(file))
+			out.WriteString("\n")
+		}
+		if !t.tests && callsMain(files) {
+			out.WriteString(identifier("main") + "();\n")
+		}
+	}
+
+	if err := t.errors.Err(); err != nil {
+		return "", err
+	}
+	var runtime strings.Builder
+	if t.usesStrings {
+		runtime.WriteString(jsStringRuntime)
+	}
+	if t.usesLists {
+		runtime.WriteString(jsListRuntime)
+	}
+	if t.usesDivision {
+		runtime.WriteString(jsDivisionRuntime)
+	}
+	return runtime.String() + out.String(), nil
+}
+
+// callsMain reports whether a program runs its main function without a
+// call to it. As on the wasm backend, main runs when the files of the main
+// package declare it and have no statements outside of functions.
+func callsMain(files []*ast.File) bool {
+	declared := false
+	for _, file := range files {
+		for _, stmt := range file.Statements {
+			switch s := stmt.(type) {
+			case nil, *ast.TestBlock, *ast.StructDefinition, *ast.EnumDefinition, *ast.InterfaceDefinition:
+			case *ast.FunctionStatement:
+				declared = declared || s.Receiver == nil && s.Name.Value == "main"
+			default:
+				return false
+			}
+		}
+	}
+	return declared
+}
+
+// unsupported reports a construct the transpiler cannot lower.
+func (t *Transpiler) unsupported(at ast.Node) {
+	t.errors = append(t.errors, diagnostic.At(at, "%s is not supported by the js backend", ast.Kind(at)))
+}
+
+// packages splits the files of a program into runs of files from the same
+// package.
+func packages(files []*ast.File) [][]*ast.File {
+	var out [][]*ast.File
+	for i, file := range files {
+		if i == 0 || file.ImportPath != files[i-1].ImportPath {
+			out = append(out, nil)
+		}
+		out[len(out)-1] = append(out[len(out)-1], file)
+	}
+	return out
+}
+
+// packageName returns the name of the object an imported package is stored
+// in.
+func packageName(importPath string) string {
+	return "pkg_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, importPath)
+}
+
+// transpilePackage wraps the files of an imported package in a function so
+// that its declarations stay private. The object it returns holds the
+// package's pub functions. Test blocks of imported packages are not run.
+func (t *Transpiler) transpilePackage(files []*ast.File) string {
+	var out bytes.Buffer
+	var exports []string
+
+	tests := t.tests
+	t.tests = false
+	defer func() { t.tests = tests }()
+
+	out.WriteString(fmt.Sprintf("%s %s = (() => {\n", JSConst, packageName(files[0].ImportPath)))
+	for _, file := range files {
 		out.WriteString(t.transpileFile(file))
 		out.WriteString("\n")
+		for _, export := range exportedFunctions(file) {
+			exports = append(exports, exportProperty(export))
+		}
 	}
+	out.WriteString(fmt.Sprintf("%s { %s };\n", JSReturn, strings.Join(exports, ", ")))
+	out.WriteString("})();\n")
 
-	return out.String(), nil
+	return out.String()
+}
+
+func exportedFunctions(file *ast.File) []string {
+	var names []string
+	for _, stmt := range file.Statements {
+		if functionStmt, ok := stmt.(*ast.FunctionStatement); ok && functionStmt.IsExported && functionStmt.Receiver == nil {
+			names = append(names, functionStmt.Name.String())
+		}
+	}
+	return names
 }
 
 func (t *Transpiler) transpileFile(file *ast.File) string {
 	var out bytes.Buffer
-	var exports []string
 
 	out.WriteString(fmt.Sprintf(JSFileComment, file.Filename))
 	out.WriteString(fmt.Sprintf(JSPackageComment, file.PackageName))
 
 	for _, stmt := range file.Statements {
-		if functionStmt, ok := stmt.(*ast.FunctionStatement); ok && functionStmt.IsExported {
-			exports = append(exports, functionStmt.Name.String())
+		if t.tests && !t.isDeclaration(stmt) {
+			continue
 		}
 		out.WriteString(t.transpileStatement(stmt))
 		out.WriteString("\n")
 	}
 
-	if len(exports) > 0 {
+	// the pub functions of an imported package are returned from the
+	// function it is wrapped in instead
+	if exports := exportedFunctions(file); len(exports) > 0 && file.ImportPath == "" {
 		out.WriteString("\n" + JSExport + " {\n")
 		for _, export := range exports {
-			out.WriteString(fmt.Sprintf("  %s,\n", export))
+			out.WriteString(fmt.Sprintf("  %s,\n", exportSpecifier(export)))
 		}
 		out.WriteString("};\n")
 	}
@@ -78,9 +228,13 @@ func (t *Transpiler) transpileStatement(stmt ast.Statement) string {
 		return t.transpileExpression(stmt.Expression) + ";"
 
 	case *ast.LetStatement:
-		return fmt.Sprintf("%s %s = %s;", JSLet, stmt.Name.String(), t.transpileExpression(stmt.Value))
+		return fmt.Sprintf("%s %s = %s;", JSLet, identifier(stmt.Name.Value), t.transpileExpression(stmt.Value))
 
 	case *ast.ReturnStatement:
+		// several values are returned as an array
+		if len(stmt.ReturnValues) > 1 {
+			return JSReturn + " [" + t.transpileExpressions(stmt.ReturnValues) + "];"
+		}
 		return JSReturn + " " + t.transpileExpressions(stmt.ReturnValues) + ";"
 
 	case *ast.FunctionStatement:
@@ -95,35 +249,82 @@ func (t *Transpiler) transpileStatement(stmt ast.Statement) string {
 	case *ast.StructDefinition:
 		return t.transpileStructDefinition(stmt)
 
+	case *ast.EnumDefinition:
+		return t.transpileEnumDefinition(stmt)
+
+	case *ast.TestBlock:
+		return t.transpileTestBlock(stmt)
+
+	case *ast.InterfaceDefinition:
+		// interfaces are satisfied implicitly and need no runtime value
+		return "// interface " + stmt.Name.String()
+
 	case *ast.VariableDeclaration:
 		return t.transpileVariableDeclaration(stmt)
 
+	case *ast.DestructuringDeclaration:
+		names := make([]string, len(stmt.Vars))
+		for i, v := range stmt.Vars {
+			names[i] = identifier(v.Name.Value)
+		}
+		return fmt.Sprintf("%s [%s] = %s;", JSLet, strings.Join(names, ", "), t.transpileExpression(stmt.Value))
+
 	case *ast.ForStatement:
 		return t.transpileForStatement(stmt)
 
+	case *ast.ForInStatement:
+		return t.transpileForInStatement(stmt)
+
+	case *ast.BreakStatement:
+		return transpileBranch(JSBreak, stmt.Label)
+
+	case *ast.ContinueStatement:
+		return transpileBranch(JSContinue, stmt.Label)
+
 	case *ast.ListDeclaration:
 		return t.transpileListDeclaration(stmt)
 
+	case *ast.DeferStatement:
+		return t.transpileDeferStatement(stmt)
+
+	case nil:
+		return ""
+
 	default:
-		return JSUnsupported + " statement"
+		t.unsupported(stmt)
+		return ""
 	}
 }
 
 func (t *Transpiler) transpileExpression(expr ast.Expression) string {
+	if name, ok := t.evaluated[expr]; ok {
+		return name
+	}
 	switch expr := expr.(type) {
 	case *ast.Identifier:
-		return expr.String()
+		if sym := t.info.Uses[expr]; sym != nil && sym.Kind == checker.PackageSymbol {
+			return packageName(sym.Pkg)
+		}
+		return identifier(expr.Value)
 
 	case *ast.IntegerLiteral:
+		// the value holds constants above the range of i64 as their bits,
+		// so the literal is written as it appears in the source
+		return expr.Token.Literal
+
+	case *ast.FloatLiteral:
 		return expr.String()
 
 	case *ast.StringLiteral:
-		return fmt.Sprintf(`"%s"`, expr.String())
+		return strconv.Quote(expr.Value)
 
 	case *ast.BooleanLiteral:
 		return expr.String()
 
 	case *ast.BinaryExpression:
+		if out, ok := t.transpileIntegerArithmetic(expr, expr.Left, expr.Operator, expr.Right); ok {
+			return out
+		}
 		return fmt.Sprintf("(%s %s %s)",
 			t.transpileExpression(expr.Left),
 			expr.Operator.Literal,
@@ -137,18 +338,27 @@ func (t *Transpiler) transpileExpression(expr ast.Expression) string {
 		return t.transpileFunctionCall(expr)
 
 	case *ast.IndexExpression:
-		return fmt.Sprintf("%s[%s]",
-			t.transpileExpression(expr.Left),
-			t.transpileExpression(expr.Index),
-		)
+		return t.transpileIndexExpression(expr)
+
+	case *ast.SliceExpression:
+		return t.transpileSliceExpression(expr)
 
 	case *ast.PrefixExpression:
+		if out, ok := t.transpileIntegerNegation(expr); ok {
+			return out
+		}
 		return fmt.Sprintf("(%s%s)",
 			expr.Operator.Literal,
 			t.transpileExpression(expr.Right),
 		)
 
 	case *ast.InfixExpression:
+		if out, ok := t.transpileStringComparison(expr); ok {
+			return out
+		}
+		if out, ok := t.transpileIntegerArithmetic(expr, expr.Left, expr.Operator, expr.Right); ok {
+			return out
+		}
 		return fmt.Sprintf("(%s %s %s)",
 			t.transpileExpression(expr.Left),
 			expr.Operator.Literal,
@@ -176,12 +386,30 @@ func (t *Transpiler) transpileExpression(expr ast.Expression) string {
 	case *ast.ListLiteral:
 		return t.transpileListLiteral(expr)
 
+	case *ast.HashLiteral:
+		return t.transpileHashLiteral(expr)
+
+	case *ast.IndexAssignment:
+		return t.transpileIndexAssignment(expr)
+
+	case nil:
+		return ""
+
 	default:
-		return JSUnsupported + " expression"
+		t.unsupported(expr)
+		return ""
 	}
 }
 
+// transpileAssignmentExpression lowers `x = value`, and `x := value`, which
+// declares x.
 func (t *Transpiler) transpileAssignmentExpression(expr *ast.AssignmentExpression) string {
+	if expr.Token.Type == token.INFER {
+		return fmt.Sprintf("%s %s = %s", JSLet,
+			t.transpileExpression(expr.Left),
+			t.transpileExpression(expr.Right),
+		)
+	}
 	return fmt.Sprintf("%s = %s",
 		t.transpileExpression(expr.Left),
 		t.transpileExpression(expr.Right),
@@ -197,19 +425,42 @@ func (t *Transpiler) transpileExpressions(exprs []ast.Expression) string {
 }
 
 func (t *Transpiler) transpileFunctionStatement(stmt *ast.FunctionStatement) string {
+	if stmt.Receiver != nil {
+		// methods are emitted with the class of their struct
+		return ""
+	}
+
 	var out bytes.Buffer
 	out.WriteString(JSFunction + " ")
-	out.WriteString(stmt.Name.String())
+	out.WriteString(identifier(stmt.Name.Value))
 	out.WriteString("(")
 
 	params := []string{}
 	for _, param := range stmt.Parameters {
-		params = append(params, param.Identifier.Token.Literal)
+		params = append(params, identifier(param.Identifier.Value))
 	}
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
 
-	out.WriteString(t.transpileBlockStatement(stmt.Body))
+	out.WriteString(t.transpileFunctionBody("", stmt.Body))
+	return out.String()
+}
+
+// transpileMethod emits a method on the prototype of its struct's class. The
+// receiver is bound to this so the body can use the receiver's name.
+func (t *Transpiler) transpileMethod(stmt *ast.FunctionStatement) string {
+	var out bytes.Buffer
+	out.WriteString(stmt.Name.String())
+	out.WriteString("(")
+
+	params := []string{}
+	for _, param := range stmt.Parameters {
+		params = append(params, identifier(param.Identifier.Value))
+	}
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(t.transpileFunctionBody(fmt.Sprintf("const %s = this;\n", identifier(stmt.Receiver.Identifier.Value)), stmt.Body))
+	out.WriteString("\n")
 	return out.String()
 }
 
@@ -245,18 +496,30 @@ func (t *Transpiler) transpileBlockStatement(stmt *ast.BlockStatement) string {
 func (t *Transpiler) transpileFunctionCall(expr *ast.FunctionCall) string {
 	var out bytes.Buffer
 
+	if to, ok := t.info.NumericConversions[expr]; ok {
+		return t.transpileNumericConversion(expr, to)
+	}
+	if out, ok := t.transpileMapCall(expr); ok {
+		return out
+	}
+
 	if expr.Function.String() == "println" {
 		out.WriteString(JSConsoleLog + "(")
 	} else if expr.Function.String() == "len" && len(expr.Arguments) == 1 {
+		if t.isString(expr.Arguments[0]) {
+			return t.transpileStringCall("len", t.transpileExpression(expr.Arguments[0]))
+		}
 		out.WriteString(t.transpileExpression(expr.Arguments[0]) + ".length")
 		return out.String()
+	} else if expr.Function.String() == "assert" && len(expr.Arguments) == 1 {
+		return t.transpileAssert(expr)
 	} else if expr.Function.String() == "append" && len(expr.Arguments) == 2 {
 		out.WriteString(t.transpileExpression(expr.Arguments[0]) + ".push(")
 		out.WriteString(t.transpileExpression(expr.Arguments[1]))
 		out.WriteString(")")
 		return out.String()
 	} else {
-		out.WriteString(expr.Function.String() + "(")
+		out.WriteString(t.transpileExpression(expr.Function) + "(")
 	}
 
 	args := []string{}
@@ -282,11 +545,11 @@ func (t *Transpiler) transpileFunctionLiteral(expr *ast.FunctionLiteral) string
 	out.WriteString(JSFunction + "(")
 	params := []string{}
 	for _, param := range expr.Parameters {
-		params = append(params, param.String())
+		params = append(params, identifier(param.Identifier.Value))
 	}
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
-	out.WriteString(t.transpileBlockStatement(expr.Body))
+	out.WriteString(t.transpileFunctionBody("", expr.Body))
 
 	return out.String()
 }
@@ -308,35 +571,44 @@ func (t *Transpiler) transpileArrayLiteral(expr *ast.ArrayLiteral) string {
 func (t *Transpiler) transpileStructDefinition(stmt *ast.StructDefinition) string {
 	var out bytes.Buffer
 
-	if t.definedStructs == nil {
-		t.definedStructs = make(map[string]bool)
-	}
-	t.definedStructs[stmt.Name.String()] = true
-
 	out.WriteString(JSClass + " ")
-	out.WriteString(stmt.Name.String())
+	out.WriteString(identifier(stmt.Name.Value))
 	out.WriteString(" {\n")
-	out.WriteString(JSConstructor + "({")
-	fields := []string{}
-	for _, field := range stmt.Fields {
-		fields = append(fields, field.Name.String())
-	}
-	out.WriteString(strings.Join(fields, ", "))
-	out.WriteString("}) {\n")
+	// the fields are read from an object rather than destructured, since
+	// a field can be named by a word javascript reserves
+	out.WriteString(JSConstructor + "(fields) {\n")
 	for _, field := range stmt.Fields {
-		out.WriteString(fmt.Sprintf("this.%s = %s;\n", field.Name.String(), field.Name.String()))
+		out.WriteString(fmt.Sprintf("this.%[1]s = fields.%[1]s;\n", field.Name.String()))
 	}
 	out.WriteString("}\n")
+	for _, method := range t.methods[stmt.Name.String()] {
+		out.WriteString(t.transpileMethod(method))
+	}
 	out.WriteString("}")
 
 	return out.String()
 }
 
+// transpileEnumDefinition lowers an enum to a frozen object mapping each
+// variant to its value.
+func (t *Transpiler) transpileEnumDefinition(stmt *ast.EnumDefinition) string {
+	var out bytes.Buffer
+
+	enum := t.info.Enums[stmt.Name.String()]
+	out.WriteString(fmt.Sprintf("const %s = Object.freeze({\n", identifier(stmt.Name.Value)))
+	for _, variant := range enum.Variants {
+		out.WriteString(fmt.Sprintf("%s: %d,\n", variant.Name, variant.Value))
+	}
+	out.WriteString("});")
+
+	return out.String()
+}
+
 func (t *Transpiler) transpileStructLiteral(expr *ast.StructLiteral) string {
 	var out bytes.Buffer
 
 	out.WriteString(JSNew + " ")
-	out.WriteString(expr.StructName.String())
+	out.WriteString(identifier(expr.StructName.Value))
 	out.WriteString("({")
 	fields := []string{}
 	for name, value := range expr.Fields {
@@ -364,37 +636,52 @@ func (t *Transpiler) transpileStructFieldAssignment(expr *ast.StructFieldAssignm
 }
 
 func (t *Transpiler) transpileVariableDeclaration(stmt *ast.VariableDeclaration) string {
-	if stmt.Type.Type == token.IDENTIFIER && t.definedStructs[stmt.Type.Literal] {
-		return fmt.Sprintf("const %s = new %s(%s);",
-			stmt.Name.String(),
-			stmt.Type.Literal,
-			t.transpileExpression(stmt.Value),
-		)
-	}
-	if stmt.Type.Type == token.IDENTIFIER {
+	// a struct value is shared by reference as it is on the wasm backend,
+	// so a declaration does not copy it
+	// plain assignments are parsed as declarations, the checker knows which
+	// ones actually declare a new variable
+	if _, declares := t.info.Defs[stmt.Name]; !declares {
 		return fmt.Sprintf("%s = %s;",
-			stmt.Name.String(),
+			identifier(stmt.Name.Value),
 			t.transpileExpression(stmt.Value),
 		)
 	}
 
 	return fmt.Sprintf("%s %s = %s;",
 		JSLet,
-		stmt.Name.String(),
+		identifier(stmt.Name.Value),
 		t.transpileExpression(stmt.Value),
 	)
 }
 
+// transpileBranch lowers break and continue, which name the same labels
+// in Javascript.
+func transpileBranch(keyword string, label *ast.Identifier) string {
+	if label == nil {
+		return keyword + ";"
+	}
+	return keyword + " " + identifier(label.Value) + ";"
+}
+
+// transpileLabel returns the label that names a loop, if it has one.
+func transpileLabel(label *ast.Identifier) string {
+	if label == nil {
+		return ""
+	}
+	return identifier(label.Value) + ": "
+}
+
 func (t *Transpiler) transpileForStatement(stmt *ast.ForStatement) string {
 	var out bytes.Buffer
 
+	out.WriteString(transpileLabel(stmt.Label))
 	out.WriteString("for (")
 
 	if stmt.Init != nil {
 		if letStmt, ok := stmt.Init.(*ast.VariableDeclaration); ok {
 			out.WriteString(fmt.Sprintf("%s %s = %s;",
 				JSLet,
-				letStmt.Name.String(),
+				identifier(letStmt.Name.Value),
 				t.transpileExpression(letStmt.Value),
 			))
 		} else {
@@ -412,7 +699,7 @@ func (t *Transpiler) transpileForStatement(stmt *ast.ForStatement) string {
 
 	if stmt.Post != nil {
 		if letStmt, ok := stmt.Post.(*ast.VariableDeclaration); ok {
-			out.WriteString(" " + letStmt.Name.String() + " = " + t.transpileExpression(letStmt.Value))
+			out.WriteString(" " + identifier(letStmt.Name.Value) + " = " + t.transpileExpression(letStmt.Value))
 		} else if exprStmt, ok := stmt.Post.(*ast.ExpressionStatement); ok {
 			out.WriteString(" " + t.transpileExpression(exprStmt.Expression))
 		} else {
@@ -426,6 +713,10 @@ func (t *Transpiler) transpileForStatement(stmt *ast.ForStatement) string {
 }
 
 func (t *Transpiler) transpileListLiteral(expr *ast.ListLiteral) string {
+	// the checker gives {} the type of a map where one is expected
+	if _, ok := t.info.TypeOf(expr).(*checker.Map); ok {
+		return "new Map()"
+	}
 	var out bytes.Buffer
 
 	out.WriteString("[")
@@ -443,7 +734,7 @@ func (t *Transpiler) transpileListDeclaration(stmt *ast.ListDeclaration) string
 	var out bytes.Buffer
 
 	out.WriteString(JSLet + " ")
-	out.WriteString(stmt.Name.String())
+	out.WriteString(identifier(stmt.Name.Value))
 	out.WriteString(" = ")
 	out.WriteString(t.transpileListLiteral(stmt.Value))
 	out.WriteString(";")
@@ -0,0 +1,94 @@
+package js
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dfirebaugh/punch/checker"
+	"github.com/dfirebaugh/punch/lexer"
+	"github.com/dfirebaugh/punch/parser"
+)
+
+func check(t *testing.T, source string) *checker.Program {
+	t.Helper()
+	program, err := parser.New(lexer.New("test.pun", source)).ParseProgram("test.pun")
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	checked, err := checker.Check(program)
+	if err != nil {
+		t.Fatalf("failed to check: %v", err)
+	}
+	return checked
+}
+
+func TestTranspileTestsLeavesOutTopLevelStatements(t *testing.T) {
+	program := check(t, `pkg main
+i32 twice(i32 x) {
+	return x * 2
+}
+println("top level")
+i32 base = 3
+base = 4
+fn main() {
+	println("main")
+}
+main()
+test "twice" {
+	assert(twice(base) == 6)
+}
+`)
+	got, err := NewTranspiler().TranspileTests(program)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"function twice(", "let base = 3;", `__punch_test("twice"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected the tests to contain %q:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{`"top level"`, "base = 4;", "main();"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("expected the tests to leave out %q:\n%s", unwanted, got)
+		}
+	}
+}
+
+func TestTranspileReservedWords(t *testing.T) {
+	program := check(t, `pkg main
+struct box {
+	i32 in
+}
+i32 new(i32 class) {
+	return class
+}
+fn main() {
+	box b = box {
+		in: new(1),
+	}
+	println(b.in)
+}
+`)
+	got, err := NewTranspiler().Transpile(program)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"function new$(class$)", "return class$;", "this.in = fields.in;", "b.in"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected the output to contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestTranspileLargeIntegerLiterals(t *testing.T) {
+	program := check(t, `pkg main
+u64 a = 18446744073709551615
+`)
+	out, err := NewTranspiler().Transpile(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "= 18446744073709551615;") {
+		t.Errorf("expected the literal as written, got:\n%s", out)
+	}
+}
@@ -0,0 +1,30 @@
+package js
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Lists are javascript arrays. Reading or writing past their end stops the
+// program as it does in the wat backend, rather than reading undefined or
+// growing the array. The helpers are only emitted into programs that use
+// them.
+const jsListRuntime = `function __punch_list_index(xs, i) {
+if (i < 0 || i >= xs.length) {
+throw new RangeError("index out of range");
+}
+return xs[i];
+}
+function __punch_list_set(xs, i, value) {
+if (i < 0 || i >= xs.length) {
+throw new RangeError("index out of range");
+}
+xs[i] = value;
+}
+`
+
+// transpileListCall calls one of the list helpers.
+func (t *Transpiler) transpileListCall(name string, args ...string) string {
+	t.usesLists = true
+	return fmt.Sprintf("__punch_list_%s(%s)", name, strings.Join(args, ", "))
+}
@@ -0,0 +1,79 @@
+package js
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/checker"
+)
+
+// Maps are lowered to Javascript Maps, which also iterate over their keys
+// in the order they were inserted.
+
+// isMap reports whether an expression is a map.
+func (t *Transpiler) isMap(expr ast.Expression) bool {
+	_, ok := t.info.TypeOf(expr).(*checker.Map)
+	return ok
+}
+
+// zeroValue returns the value a read of a key that is not in a map yields.
+func zeroValue(typ checker.Type) string {
+	switch typ.(type) {
+	case *checker.List:
+		return "[]"
+	case *checker.Map:
+		return "new Map()"
+	}
+	switch {
+	case checker.IsString(typ):
+		return `""`
+	case checker.IsBoolean(typ):
+		return "false"
+	case checker.IsNumeric(typ), checker.IsEnum(typ):
+		return "0"
+	}
+	return "null"
+}
+
+func (t *Transpiler) transpileHashLiteral(expr *ast.HashLiteral) string {
+	pairs := make([]string, len(expr.Pairs))
+	for i, pair := range expr.Pairs {
+		pairs[i] = fmt.Sprintf("[%s, %s]", t.transpileExpression(pair.Key), t.transpileExpression(pair.Value))
+	}
+	return fmt.Sprintf("new Map([%s])", strings.Join(pairs, ", "))
+}
+
+func (t *Transpiler) transpileMapIndex(expr *ast.IndexExpression) string {
+	return fmt.Sprintf("(%s.get(%s) ?? %s)",
+		t.transpileExpression(expr.Left),
+		t.transpileExpression(expr.Index),
+		zeroValue(t.info.TypeOf(expr)),
+	)
+}
+
+func (t *Transpiler) transpileIndexAssignment(expr *ast.IndexAssignment) string {
+	left := t.transpileExpression(expr.Left.Left)
+	index := t.transpileExpression(expr.Left.Index)
+	right := t.transpileExpression(expr.Right)
+	if t.isMap(expr.Left.Left) {
+		return fmt.Sprintf("%s.set(%s, %s)", left, index, right)
+	}
+	return t.transpileListCall("set", left, index, right)
+}
+
+// transpileMapCall lowers the builtins that work on maps, reporting
+// whether the call is to one of them.
+func (t *Transpiler) transpileMapCall(call *ast.FunctionCall) (string, bool) {
+	switch {
+	case t.info.IsBuiltin(call, checker.BuiltinDelete) && len(call.Arguments) == 2:
+		return fmt.Sprintf("%s.delete(%s)", t.transpileExpression(call.Arguments[0]), t.transpileExpression(call.Arguments[1])), true
+	case t.info.IsBuiltin(call, checker.BuiltinHas) && len(call.Arguments) == 2:
+		return fmt.Sprintf("%s.has(%s)", t.transpileExpression(call.Arguments[0]), t.transpileExpression(call.Arguments[1])), true
+	case t.info.IsBuiltin(call, checker.BuiltinKeys) && len(call.Arguments) == 1:
+		return fmt.Sprintf("[...%s.keys()]", t.transpileExpression(call.Arguments[0])), true
+	case t.info.IsBuiltin(call, checker.BuiltinLen) && len(call.Arguments) == 1 && t.isMap(call.Arguments[0]):
+		return t.transpileExpression(call.Arguments[0]) + ".size", true
+	}
+	return "", false
+}
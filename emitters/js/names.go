@@ -0,0 +1,48 @@
+package js
+
+// reserved are the words that punch identifiers can use but javascript
+// bindings cannot, along with the globals the emitted code relies on.
+var reserved = map[string]bool{
+	"arguments": true, "await": true, "break": true, "case": true, "catch": true,
+	"class": true, "const": true, "continue": true, "debugger": true, "default": true,
+	"delete": true, "do": true, "else": true, "enum": true, "eval": true,
+	"export": true, "extends": true, "false": true, "finally": true, "for": true,
+	"function": true, "if": true, "implements": true, "import": true, "in": true,
+	"instanceof": true, "interface": true, "let": true, "new": true, "null": true,
+	"package": true, "private": true, "protected": true, "public": true, "return": true,
+	"static": true, "super": true, "switch": true, "this": true, "throw": true,
+	"true": true, "try": true, "typeof": true, "var": true, "void": true,
+	"while": true, "with": true, "yield": true,
+
+	"Error": true, "Map": true, "Math": true, "Object": true, "RangeError": true,
+	"TextDecoder": true, "TextEncoder": true, "console": true,
+}
+
+// identifier returns the javascript name of a variable, function or type.
+// A name javascript reserves gets a $ appended, which a punch identifier
+// cannot contain. Fields and methods keep their names since any word can
+// name a property.
+func identifier(name string) string {
+	if reserved[name] {
+		return name + "$"
+	}
+	return name
+}
+
+// exportSpecifier returns how a pub function is listed in an export clause,
+// which names it by its punch name.
+func exportSpecifier(name string) string {
+	if reserved[name] {
+		return identifier(name) + " as " + name
+	}
+	return name
+}
+
+// exportProperty returns the property of a pub function in the object an
+// imported package is stored in.
+func exportProperty(name string) string {
+	if reserved[name] {
+		return name + ": " + identifier(name)
+	}
+	return name
+}
@@ -0,0 +1,131 @@
+package js
+
+import (
+	"fmt"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/checker"
+	"github.com/dfirebaugh/punch/token"
+)
+
+// Integer division by zero stops the program as it does in the wat backend,
+// rather than giving Infinity or NaN.
+const jsDivisionRuntime = `function __punch_div(a, b) {
+if (b === 0) {
+throw new RangeError("integer divide by zero");
+}
+return Math.trunc(a / b);
+}
+function __punch_rem(a, b) {
+if (b === 0) {
+throw new RangeError("integer divide by zero");
+}
+return a % b;
+}
+`
+
+// transpileNumericConversion converts a number to the range of a numeric
+// type. Javascript has a single number type, so integer conversions
+// truncate toward zero and wrap 8, 16 and 32 bit values. Floats saturate
+// at the bounds of the 32 or 64 bit integer that holds the type, like
+// they do on the wasm backend.
+func (t *Transpiler) transpileNumericConversion(call *ast.FunctionCall, to checker.Type) string {
+	value := t.transpileExpression(call.Arguments[0])
+	fromFloat := checker.IsFloat(t.info.TypeOf(call.Arguments[0]))
+	if !fromFloat && checker.IsFloat(to) {
+		return value
+	}
+
+	switch to {
+	case checker.Typ[checker.F32]:
+		return fmt.Sprintf("Math.fround(%s)", value)
+	case checker.Typ[checker.F64]:
+		return value
+	}
+	if fromFloat {
+		lo, hi := saturationBounds(to)
+		value = fmt.Sprintf("Math.min(Math.max(%s, %s), %s)", value, lo, hi)
+	}
+	return wrapInteger(fmt.Sprintf("Math.trunc(%s)", value), to)
+}
+
+// saturationBounds returns the range a float is clamped to when it is
+// converted to an integer type.
+func saturationBounds(t checker.Type) (lo, hi string) {
+	switch t {
+	case checker.Typ[checker.I64]:
+		return "-9223372036854775808", "9223372036854775807"
+	case checker.Typ[checker.U64]:
+		return "0", "18446744073709551615"
+	}
+	if checker.IsUnsigned(t) {
+		return "0", "4294967295"
+	}
+	return "-2147483648", "2147483647"
+}
+
+// transpileIntegerArithmetic lowers arithmetic on integers so that the
+// result stays in the range of its type the way it does on the wasm
+// backend: division truncates toward zero, dividing by zero stops the
+// program and 8, 16 and 32 bit results wrap. It reports false for any other
+// operation.
+func (t *Transpiler) transpileIntegerArithmetic(expr ast.Expression, left ast.Expression, op token.Token, right ast.Expression) (string, bool) {
+	typ := t.info.TypeOf(expr)
+	if checker.IsUntyped(typ) {
+		typ = checker.Default(typ)
+	}
+	if !checker.IsInteger(typ) {
+		return "", false
+	}
+
+	l, r := t.transpileExpression(left), t.transpileExpression(right)
+	switch op.Type {
+	case token.PLUS, token.MINUS:
+		return wrapInteger(fmt.Sprintf("(%s %s %s)", l, op.Literal, r), typ), true
+	case token.ASTERISK:
+		// the product of two 32 bit integers can need more bits than a
+		// float has, so it is multiplied as an integer
+		if typ == checker.Typ[checker.I32] || typ == checker.Typ[checker.U32] {
+			return wrapInteger(fmt.Sprintf("Math.imul(%s, %s)", l, r), typ), true
+		}
+		return wrapInteger(fmt.Sprintf("(%s * %s)", l, r), typ), true
+	case token.SLASH:
+		t.usesDivision = true
+		return wrapInteger(fmt.Sprintf("__punch_div(%s, %s)", l, r), typ), true
+	case token.MOD:
+		t.usesDivision = true
+		return wrapInteger(fmt.Sprintf("__punch_rem(%s, %s)", l, r), typ), true
+	}
+	return "", false
+}
+
+// transpileIntegerNegation negates an integer, wrapping the result like
+// transpileIntegerArithmetic does.
+func (t *Transpiler) transpileIntegerNegation(expr *ast.PrefixExpression) (string, bool) {
+	typ := t.info.TypeOf(expr)
+	if expr.Operator.Type != token.MINUS || !checker.IsInteger(typ) || checker.IsUntyped(typ) {
+		return "", false
+	}
+	return wrapInteger(fmt.Sprintf("(-%s)", t.transpileExpression(expr.Right)), typ), true
+}
+
+// wrapInteger wraps an integer value to the range of an 8, 16 or 32 bit
+// integer type. 64 bit integers are left as they are since javascript
+// numbers can't hold all of their values anyway.
+func wrapInteger(value string, t checker.Type) string {
+	switch t {
+	case checker.Typ[checker.U8]:
+		return fmt.Sprintf("(%s & 0xff)", value)
+	case checker.Typ[checker.U16]:
+		return fmt.Sprintf("(%s & 0xffff)", value)
+	case checker.Typ[checker.U32]:
+		return fmt.Sprintf("(%s >>> 0)", value)
+	case checker.Typ[checker.I8]:
+		return fmt.Sprintf("(%s << 24 >> 24)", value)
+	case checker.Typ[checker.I16]:
+		return fmt.Sprintf("(%s << 16 >> 16)", value)
+	case checker.Typ[checker.I32]:
+		return fmt.Sprintf("(%s | 0)", value)
+	}
+	return value
+}
@@ -0,0 +1,68 @@
+package js
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/checker"
+)
+
+// A for in loop is lowered to a loop over indexes. What it iterates over is
+// evaluated once before the loop: a list and its length, the bytes of a
+// string, the keys of a map or the bounds of a range. The variables are
+// declared in the body so that each iteration, and each closure made in
+// it, has its own.
+
+func (t *Transpiler) transpileForInStatement(stmt *ast.ForInStatement) string {
+	t.loopCounter++
+	i := fmt.Sprintf("__punch_i_%d", t.loopCounter)
+	seq := fmt.Sprintf("__punch_seq_%d", t.loopCounter)
+	end := fmt.Sprintf("__punch_end_%d", t.loopCounter)
+
+	// values holds the value of a first and a second variable, and single
+	// is the one a single variable takes
+	var init, skip string
+	var values []string
+	single := 1
+	if rng, ok := stmt.Iterable.(*ast.RangeExpression); ok {
+		init = fmt.Sprintf("%s = %s, %s = %s", i, t.transpileExpression(rng.Low), end, t.transpileExpression(rng.High))
+		values, single = []string{i}, 0
+	} else {
+		iterable := t.transpileExpression(stmt.Iterable)
+		switch typ := t.info.TypeOf(stmt.Iterable).(type) {
+		case *checker.Map:
+			m := fmt.Sprintf("__punch_map_%d", t.loopCounter)
+			init = fmt.Sprintf("%[1]s = 0, %[2]s = %[3]s, %[4]s = [...%[2]s.keys()], %[5]s = %[4]s.length", i, m, iterable, seq, end)
+			key := fmt.Sprintf("%s[%s]", seq, i)
+			values = []string{key, fmt.Sprintf("(%s.get(%s) ?? %s)", m, key, zeroValue(typ.Elem))}
+			single = 0
+			// keys deleted by an earlier iteration are skipped
+			skip = fmt.Sprintf("if (!%s.has(%s)) {\n%s;\n}\n", m, key, JSContinue)
+		default:
+			if t.isString(stmt.Iterable) {
+				iterable = t.transpileStringCall("bytes", iterable)
+			}
+			init = fmt.Sprintf("%[1]s = 0, %[2]s = %[3]s, %[4]s = %[2]s.length", i, seq, iterable, end)
+			values = []string{i, fmt.Sprintf("%s[%s]", seq, i)}
+		}
+	}
+
+	var out bytes.Buffer
+	out.WriteString(transpileLabel(stmt.Label))
+	out.WriteString(fmt.Sprintf("for (%s %s; %[3]s < %[4]s; %[3]s++) {\n", JSLet, init, i, end))
+	out.WriteString(skip)
+	for n, v := range stmt.Vars {
+		value := values[n]
+		if len(stmt.Vars) == 1 {
+			value = values[single]
+		}
+		out.WriteString(fmt.Sprintf("%s %s = %s;\n", JSLet, identifier(v.Value), value))
+	}
+	for _, s := range stmt.Body.Statements {
+		out.WriteString(t.transpileStatement(s))
+		out.WriteString("\n")
+	}
+	out.WriteString("}")
+	return out.String()
+}
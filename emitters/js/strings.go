@@ -0,0 +1,98 @@
+package js
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/checker"
+	"github.com/dfirebaugh/punch/token"
+)
+
+// Strings are sequences of UTF-8 bytes as they are in the wat backend, so
+// len, indexing, slicing and ordering work on the encoded bytes rather than
+// on UTF-16 code units. The helpers are only emitted into programs that
+// use them.
+const jsStringRuntime = `const __punch_utf8 = new TextEncoder();
+function __punch_str_len(s) {
+return __punch_utf8.encode(s).length;
+}
+function __punch_str_index(s, i) {
+const bytes = __punch_utf8.encode(s);
+if (i < 0 || i >= bytes.length) {
+throw new RangeError("index out of range");
+}
+return bytes[i];
+}
+function __punch_str_bytes(s) {
+return __punch_utf8.encode(s);
+}
+function __punch_str_slice(s, low, high) {
+const bytes = __punch_utf8.encode(s);
+if (high === undefined) {
+high = bytes.length;
+}
+if (low < 0 || low > high || high > bytes.length) {
+throw new RangeError("slice bounds out of range");
+}
+return new TextDecoder().decode(bytes.subarray(low, high));
+}
+function __punch_str_compare(a, b) {
+const x = __punch_utf8.encode(a);
+const y = __punch_utf8.encode(b);
+for (let i = 0; i < x.length && i < y.length; i++) {
+if (x[i] !== y[i]) {
+return x[i] < y[i] ? -1 : 1;
+}
+}
+return Math.sign(x.length - y.length);
+}
+`
+
+func (t *Transpiler) isString(expr ast.Expression) bool {
+	return checker.IsString(t.info.TypeOf(expr))
+}
+
+// transpileStringCall calls one of the string helpers.
+func (t *Transpiler) transpileStringCall(name string, args ...string) string {
+	t.usesStrings = true
+	return fmt.Sprintf("__punch_str_%s(%s)", name, strings.Join(args, ", "))
+}
+
+func (t *Transpiler) transpileIndexExpression(expr *ast.IndexExpression) string {
+	if t.isMap(expr.Left) {
+		return t.transpileMapIndex(expr)
+	}
+	left := t.transpileExpression(expr.Left)
+	index := t.transpileExpression(expr.Index)
+	if t.isString(expr.Left) {
+		return t.transpileStringCall("index", left, index)
+	}
+	return t.transpileListCall("index", left, index)
+}
+
+func (t *Transpiler) transpileSliceExpression(expr *ast.SliceExpression) string {
+	low, high := "0", "undefined"
+	if expr.Low != nil {
+		low = t.transpileExpression(expr.Low)
+	}
+	if expr.High != nil {
+		high = t.transpileExpression(expr.High)
+	}
+	return t.transpileStringCall("slice", t.transpileExpression(expr.Left), low, high)
+}
+
+// transpileStringComparison orders strings by their bytes. Equality is the
+// same for bytes and code units, so only the ordering operators need it.
+func (t *Transpiler) transpileStringComparison(expr *ast.InfixExpression) (string, bool) {
+	switch expr.Operator.Type {
+	case token.LT, token.GT, token.LT_EQUALS, token.GT_EQUALS:
+	default:
+		return "", false
+	}
+	if !t.isString(expr.Left) {
+		return "", false
+	}
+	compare := t.transpileStringCall("compare", t.transpileExpression(expr.Left), t.transpileExpression(expr.Right))
+	return fmt.Sprintf("(%s %s 0)", compare, expr.Operator.Literal), true
+}
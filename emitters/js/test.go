@@ -0,0 +1,100 @@
+package js
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/checker"
+)
+
+const jsTestPrelude = `const __punch_tests = [];
+function __punch_test(name, pos, fn) {
+__punch_tests.push({ name, pos, fn });
+}
+class __PunchAssertionError extends Error {}
+function __punch_assert(cond, pos, expr) {
+if (!cond) {
+throw new __PunchAssertionError(pos + ": assertion failed: " + expr);
+}
+}
+`
+
+// jsTestRunner runs every registered test, reports the failures and sets a
+// non-zero exit code if any test failed.
+const jsTestRunner = `let __punch_failed = 0;
+for (const test of __punch_tests) {
+try {
+test.fn();
+} catch (err) {
+__punch_failed++;
+console.log("--- FAIL: " + test.name + " (" + test.pos + ")");
+if (err instanceof __PunchAssertionError) {
+console.log("    " + err.message);
+} else {
+console.log("    " + test.pos + ": " + err);
+}
+}
+}
+console.log((__punch_tests.length - __punch_failed) + " passed, " + __punch_failed + " failed");
+if (__punch_failed > 0) {
+process.exitCode = 1;
+}
+`
+
+// TranspileTests transpiles a program together with its test blocks and a
+// runner that executes them. Top level statements other than declarations,
+// such as a call to main, are left out so that testing a program does not
+// run it.
+func (t *Transpiler) TranspileTests(program *checker.Program) (string, error) {
+	t.tests = true
+	defer func() { t.tests = false }()
+
+	code, err := t.Transpile(program)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	out.WriteString(jsTestPrelude)
+	out.WriteString(code)
+	out.WriteString(jsTestRunner)
+	return out.String(), nil
+}
+
+func (t *Transpiler) transpileTestBlock(test *ast.TestBlock) string {
+	if !t.tests {
+		// tests are left out of normal builds
+		return ""
+	}
+	pos := test.Pos()
+	return fmt.Sprintf("__punch_test(%s, %s, () => %s);",
+		strconv.Quote(test.Name.Value),
+		strconv.Quote(fmt.Sprintf("%s:%d", pos.Filename, pos.Line)),
+		t.transpileBlockStatement(test.Body),
+	)
+}
+
+func (t *Transpiler) transpileAssert(call *ast.FunctionCall) string {
+	pos := call.Pos()
+	return fmt.Sprintf("__punch_assert(%s, %s, %s)",
+		t.transpileExpressions(call.Arguments),
+		strconv.Quote(fmt.Sprintf("%s:%d:%d", pos.Filename, pos.Line, pos.Column)),
+		strconv.Quote(call.Arguments[0].String()),
+	)
+}
+
+// isDeclaration reports whether a top level statement declares something
+// rather than running when the program starts.
+func (t *Transpiler) isDeclaration(stmt ast.Statement) bool {
+	switch s := stmt.(type) {
+	case *ast.FunctionStatement, *ast.FunctionDeclaration, *ast.StructDefinition, *ast.EnumDefinition,
+		*ast.InterfaceDefinition, *ast.TestBlock, *ast.ListDeclaration, *ast.DestructuringDeclaration, *ast.LetStatement:
+		return true
+	case *ast.VariableDeclaration:
+		// plain assignments are parsed as declarations too
+		return t.info.Defs[s.Name] != nil
+	}
+	return false
+}
@@ -0,0 +1,465 @@
+package wat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/checker"
+)
+
+// Function values are pointers to a closure, a heap block that holds the
+// table index of the function implementing the value, the table index of
+// the function that releases what the closure captured and then the
+// addresses of the boxes of the captured variables:
+//
+//	offset 0: index of the function
+//	offset 4: index of the function releasing the boxes
+//	offset 8: address of the first box, and so on
+//
+// The implementing function takes the closure as an extra first parameter
+// and loads the boxes from it, so calls through a function value use
+// call_indirect. Captured variables live in an 8 byte box on the heap that
+// the function declaring them and the closures capturing them share, which
+// captures them by reference. Every declaration of a captured variable that
+// runs makes a new box. Named functions used as values and literals that
+// capture nothing are closures placed in the data, which are never freed.
+
+const (
+	releaseClosureFunc = releaseFunc + "_closure"
+	releaseBoxFunc     = releaseFunc + "_box"
+
+	// closureHeader is the size of a closure without captures.
+	closureHeader = 8
+	// envParam is the parameter that holds the closure in the function
+	// implementing a function literal.
+	envParam = "__env"
+)
+
+// box is the type of the heap block a captured variable lives in. Boxes
+// are reference counted and release the value they hold when they are
+// freed.
+type box struct {
+	elem checker.Type
+}
+
+func (b *box) String() string {
+	return "box(" + b.elem.String() + ")"
+}
+
+// staticClosure is a closure placed in the data.
+type staticClosure struct {
+	addr  int
+	index int
+	name  string
+}
+
+// boxName returns the name of the local holding the box of a captured
+// variable.
+func boxName(name string) string {
+	return name + ".box"
+}
+
+// hasFunctionType reports whether values of a type are or contain
+// function values.
+func hasFunctionType(t checker.Type) bool {
+	switch t := t.(type) {
+	case *checker.Signature:
+		return true
+	case *checker.List:
+		return hasFunctionType(t.Elem)
+	}
+	return false
+}
+
+// usesFunctionValues reports whether a program has variables, fields or
+// results of function types, which need the closure runtime.
+func (m *module) usesFunctionValues() bool {
+	if len(m.info.Captures) > 0 {
+		return true
+	}
+	for _, sym := range m.info.Defs {
+		if sym.Kind == checker.VarSymbol && hasFunctionType(sym.Type) {
+			return true
+		}
+	}
+	for _, s := range m.info.Structs {
+		for _, field := range s.Fields {
+			if hasFunctionType(field.Type) {
+				return true
+			}
+		}
+	}
+	for _, sig := range m.info.Functions {
+		for _, result := range sig.Results {
+			if hasFunctionType(result) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tableIndex returns the index of a function in the function table,
+// adding it the first time.
+func (m *module) tableIndex(name string) int {
+	if index, ok := m.methodTable[name]; ok {
+		return index
+	}
+	m.methodTable[name] = len(m.methodOrder)
+	m.methodOrder = append(m.methodOrder, name)
+	return m.methodTable[name]
+}
+
+// boxType returns the box of a captured variable of type t, adding its
+// release function to the runtime.
+func (m *module) boxType(t checker.Type) *box {
+	b := &box{elem: t}
+	name := releaseName(b)
+	if existing, ok := m.boxes[name]; ok {
+		return existing
+	}
+	m.boxes[name] = b
+	m.boxOrder = append(m.boxOrder, b)
+	m.runtime[name] = true
+	return b
+}
+
+// isCaptured reports whether an identifier refers to a variable that
+// closures capture.
+func (m *module) isCaptured(ident *ast.Identifier) bool {
+	sym := m.info.Defs[ident]
+	if sym == nil {
+		sym = m.info.Uses[ident]
+	}
+	return sym != nil && m.captured[sym]
+}
+
+// declareLocal declares the local of a variable, or the local holding its
+// box if closures capture it. The local owns the variable's value or box.
+// A variable that shares its name with another variable of the function
+// gets a local of its own, so that an inner variable does not overwrite
+// the outer one it shadows.
+func (m *module) declareLocal(ident *ast.Identifier, sym *checker.Symbol, declaredLocals map[string]bool, locals *[]string) {
+	name := ident.Value
+	if other, ok := m.variables[name]; ok && other != sym {
+		name = m.generateUniqueLocalVarName(name)
+		m.locals[sym] = name
+	}
+	m.variables[name] = sym
+	if m.captured[sym] {
+		name = boxName(name)
+		if !declaredLocals[name] {
+			*locals = append(*locals, fmt.Sprintf("(local $%s i32)\n", name))
+			declaredLocals[name] = true
+			m.owners = append(m.owners, owner{name, m.boxType(sym.Type)})
+		}
+		return
+	}
+	if declaredLocals[name] {
+		return
+	}
+	*locals = append(*locals, fmt.Sprintf("(local $%s %s)\n", name, valueType(sym.Type)))
+	declaredLocals[name] = true
+	if managed(sym.Type) {
+		m.owners = append(m.owners, owner{name, sym.Type})
+	}
+}
+
+// isDeclared reports whether a variable belongs to the function being
+// generated: a parameter, a variable its closure captured or a local that
+// declareLocal declared.
+func (m *module) isDeclared(sym *checker.Symbol) bool {
+	for _, v := range m.variables {
+		if v == sym {
+			return true
+		}
+	}
+	return false
+}
+
+// localName returns the name of the local of a variable, which is the
+// variable's name unless declareLocal had to rename it.
+func (m *module) localName(sym *checker.Symbol, name string) string {
+	if local, ok := m.locals[sym]; ok {
+		return local
+	}
+	return name
+}
+
+// generateStore stores a value in a variable. A variable of a managed type
+// owns the value and releases the one it held.
+func (m *module) generateStore(name *ast.Identifier, sym *checker.Symbol, value string) string {
+	local := m.localName(sym, name.Value)
+	if !m.captured[sym] {
+		if managed(sym.Type) {
+			return m.generateAssignment(local, sym.Type, value)
+		}
+		return fmt.Sprintf("(local.set $%s %s)\n", local, value)
+	}
+
+	t := sym.Type
+	b := boxName(local)
+	temp := m.generateTemp(valueType(t))
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("(local.set $%s %s)\n", temp, value))
+	if _, declares := m.info.Defs[name]; declares {
+		// the closures made before keep the variable they captured
+		out.WriteString(generateRelease(m.boxType(t), fmt.Sprintf("(local.get $%s)", b)))
+		out.WriteString(fmt.Sprintf("(local.set $%s (call $%s (i32.const 8)))\n", b, MemoryAllocateFunc))
+	} else if managed(t) {
+		out.WriteString(generateRelease(t, fmt.Sprintf("(i32.load (local.get $%s))", b)))
+	}
+	out.WriteString(fmt.Sprintf("(%s.store (local.get $%s) (local.get $%s))\n", valueType(t), b, temp))
+	return out.String()
+}
+
+// generateIdentifier returns the value of a variable, or the closure of a
+// function used as a value.
+func (m *module) generateIdentifier(ident *ast.Identifier) string {
+	sym := m.info.Uses[ident]
+	switch {
+	case sym != nil && sym.Kind == checker.FuncSymbol:
+		return m.generateFunctionValue(ident, sym)
+	case sym != nil && m.captured[sym]:
+		return fmt.Sprintf("(%s.load (local.get $%s))", valueType(sym.Type), boxName(m.localName(sym, ident.Value)))
+	}
+	return fmt.Sprintf("(local.get $%s)", m.localName(sym, ident.Value))
+}
+
+// staticClosure places a closure of the function at a table index in the
+// data and returns its address.
+func (m *module) staticClosure(index int, name string) int {
+	addr := m.dataBase() + m.dataSize + blockHeader
+	m.closures = append(m.closures, staticClosure{addr: addr, index: index, name: name})
+	m.dataSize += blockHeader + closureHeader
+	return addr
+}
+
+// generateClosureData emits the closures placed in the data.
+func (m *module) generateClosureData() string {
+	var out strings.Builder
+	for _, c := range m.closures {
+		var data strings.Builder
+		for _, word := range []int{blockHeader + closureHeader, 1, c.index, 0} {
+			for i := 0; i < 4; i++ {
+				data.WriteString(fmt.Sprintf("\\%02x", byte(word>>(8*i))))
+			}
+		}
+		out.WriteString(fmt.Sprintf("(data (i32.const %d) \"%s\") ;; closure of %s\n", c.addr-blockHeader, data.String(), c.name))
+	}
+	return out.String()
+}
+
+// generateFunctionValue returns the closure of a named function used as a
+// value. It calls the function through a wrapper that takes the closure.
+func (m *module) generateFunctionValue(at ast.Node, sym *checker.Symbol) string {
+	name := qualifiedName(sym)
+	if addr, ok := m.functionValues[name]; ok {
+		return fmt.Sprintf("(i32.const %d)", addr)
+	}
+	sig, ok := sym.Type.(*checker.Signature)
+	if !ok {
+		m.unsupported(at)
+		return ""
+	}
+	m.runtime[releaseClosureFunc] = true
+	wrapper := name + ".value"
+	addr := m.staticClosure(m.tableIndex(wrapper), name)
+	m.functionValues[name] = addr
+
+	var params, args, results strings.Builder
+	for i, param := range sig.Params {
+		params.WriteString(fmt.Sprintf(" (param $p%d %s)", i, m.watType(at, param)))
+		args.WriteString(fmt.Sprintf(" (local.get $p%d)", i))
+	}
+	for _, result := range sig.Results {
+		results.WriteString(fmt.Sprintf(" (result %s)", m.watType(at, result)))
+	}
+	m.wrappers = append(m.wrappers, fmt.Sprintf("\n(func $%s (param $%s i32)%s%s\n\t(call $%s%s)\n)\n",
+		wrapper, envParam, params.String(), results.String(), name, args.String()))
+	return fmt.Sprintf("(i32.const %d)", addr)
+}
+
+// generateFunctionLiteral returns a closure of a function literal, whose
+// function is generated after the other functions. A closure that
+// captures variables holds a reference to each of their boxes.
+func (m *module) generateFunctionLiteral(lit *ast.FunctionLiteral) string {
+	m.runtime[releaseClosureFunc] = true
+	name, ok := m.literalNames[lit]
+	if !ok {
+		name = m.generateUniqueLocalVarName("closure")
+		m.literalNames[lit] = name
+		m.literalOrder = append(m.literalOrder, lit)
+	}
+	captures := m.info.Captures[lit]
+	if len(captures) == 0 {
+		addr, ok := m.functionValues[name]
+		if !ok {
+			addr = m.staticClosure(m.tableIndex(name), name)
+			m.functionValues[name] = addr
+		}
+		return fmt.Sprintf("(i32.const %d)", addr)
+	}
+
+	closure := m.generateTemp("i32")
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("(local.set $%s (call $%s (i32.const %d)))\n", closure, MemoryAllocateFunc, closureHeader+4*len(captures)))
+	out.WriteString(fmt.Sprintf("(i32.store (local.get $%s) (i32.const %d))\n", closure, m.tableIndex(name)))
+	out.WriteString(fmt.Sprintf("(i32.store offset=4 (local.get $%s) (i32.const %d))\n", closure, m.tableIndex(name+".release")))
+	for i, sym := range captures {
+		out.WriteString(fmt.Sprintf("(i32.store offset=%d (local.get $%s) (call $%s (local.get $%s)))\n",
+			closureHeader+4*i, closure, retainFunc, boxName(m.localName(sym, sym.Name))))
+	}
+	out.WriteString(fmt.Sprintf("(local.get $%s)", closure))
+	return out.String()
+}
+
+// generateFunctionLiterals generates the functions of the function
+// literals, including the ones found while generating them, along with
+// the functions that release what their closures capture.
+func (m *module) generateFunctionLiterals() string {
+	var out strings.Builder
+	for i := 0; i < len(m.literalOrder); i++ {
+		lit := m.literalOrder[i]
+		name := m.literalNames[lit]
+		m.literal = lit
+		out.WriteString(m.generateFunction(name, "", &ast.FunctionStatement{
+			Parameters:  lit.Parameters,
+			ReturnTypes: lit.ReturnTypes,
+			Body:        lit.Body,
+		}))
+		m.literal = nil
+
+		captures := m.info.Captures[lit]
+		if len(captures) == 0 {
+			continue
+		}
+		out.WriteString(fmt.Sprintf("(func $%s.release (param $%s i32)\n", name, envParam))
+		for i, sym := range captures {
+			out.WriteString("\t" + generateRelease(m.boxType(sym.Type), fmt.Sprintf("(i32.load offset=%d (local.get $%s))", closureHeader+4*i, envParam)))
+		}
+		out.WriteString(")\n")
+	}
+	return out.String()
+}
+
+// generateEnvironment returns the code that starts the function of a
+// function literal, which loads the boxes of the variables it captures
+// from its closure. The closure is retained while the function runs.
+func (m *module) generateEnvironment(lit *ast.FunctionLiteral, declaredLocals map[string]bool, locals *[]string) string {
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("(drop (call $%s (local.get $%s)))\n", retainFunc, envParam))
+	m.owners = append(m.owners, owner{envParam, m.info.TypeOf(lit)})
+	for i, sym := range m.info.Captures[lit] {
+		m.variables[sym.Name] = sym
+		name := boxName(sym.Name)
+		*locals = append(*locals, fmt.Sprintf("(local $%s i32)\n", name))
+		declaredLocals[name] = true
+		out.WriteString(fmt.Sprintf("(local.set $%s (i32.load offset=%d (local.get $%s)))\n", name, closureHeader+4*i, envParam))
+	}
+	return out.String()
+}
+
+// generateBoxedParameter moves a parameter that closures capture into a
+// box, which owns the parameter's value.
+func (m *module) generateBoxedParameter(param *ast.Parameter, t checker.Type, declaredLocals map[string]bool, locals *[]string) string {
+	name := boxName(param.Identifier.Value)
+	*locals = append(*locals, fmt.Sprintf("(local $%s i32)\n", name))
+	declaredLocals[name] = true
+	m.owners = append(m.owners, owner{name, m.boxType(t)})
+
+	value := fmt.Sprintf("(local.get $%s)", param.Identifier.Value)
+	if managed(t) {
+		value = fmt.Sprintf("(call $%s %s)", retainFunc, value)
+	}
+	return fmt.Sprintf("(local.set $%s (call $%s (i32.const 8)))\n(%s.store (local.get $%s) %s)\n",
+		name, MemoryAllocateFunc, valueType(t), name, value)
+}
+
+// closureType returns the name of the type of the functions implementing
+// values of a function type, declaring it the first time.
+func (m *module) closureType(at ast.Node, sig *checker.Signature) string {
+	var name, signature strings.Builder
+	name.WriteString("fn")
+	signature.WriteString("(param i32)")
+	for _, param := range sig.Params {
+		t := m.watType(at, param)
+		name.WriteString("." + t)
+		signature.WriteString(fmt.Sprintf(" (param %s)", t))
+	}
+	name.WriteString("->")
+	for i, result := range sig.Results {
+		t := m.watType(at, result)
+		if i > 0 {
+			name.WriteString(".")
+		}
+		name.WriteString(t)
+		signature.WriteString(fmt.Sprintf(" (result %s)", t))
+	}
+	if _, ok := m.closureTypes[name.String()]; !ok {
+		m.closureTypes[name.String()] = signature.String()
+		m.closureTypeOrder = append(m.closureTypeOrder, name.String())
+	}
+	return name.String()
+}
+
+// generateClosureCall calls a function value with call_indirect, passing
+// the closure to the function it holds the index of. A closure that the
+// call owns, such as the result of adder(2) in adder(2)(3), is released
+// after the call.
+func (m *module) generateClosureCall(call *ast.FunctionCall) string {
+	sig, ok := m.typeOf(call.Function).(*checker.Signature)
+	if !ok {
+		m.unsupported(call)
+		return ""
+	}
+	closure := m.generateTemp("i32")
+	values, release := m.generateArguments(call.Arguments)
+	if m.owned(call.Function) {
+		release += generateRelease(sig, fmt.Sprintf("(local.get $%s)", closure))
+	}
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("(call_indirect (type $%s) (local.tee $%s %s)", m.closureType(call, sig), closure, m.generateExpression(call.Function)))
+	for _, value := range values {
+		out.WriteString(" ")
+		out.WriteString(value)
+	}
+	out.WriteString(fmt.Sprintf(" (i32.load (local.get $%s)))\n", closure))
+	return m.generateReleaseAfter(out.String(), m.typeOf(call), release)
+}
+
+// generateClosureFunctions emits the closure types, the wrappers of named
+// functions used as values and the release functions of closures and
+// boxes.
+func (m *module) generateClosureFunctions() string {
+	var out strings.Builder
+	for _, name := range m.closureTypeOrder {
+		out.WriteString(fmt.Sprintf("\n(type $%s (func %s))\n", name, m.closureTypes[name]))
+	}
+	for _, wrapper := range m.wrappers {
+		out.WriteString(wrapper)
+	}
+	if m.runtime[releaseClosureFunc] {
+		out.WriteString(fmt.Sprintf(`
+;; a closure releases the boxes it captured with the function it names
+(func $%s (param $ptr i32)
+	(if (call $%s (local.get $ptr))
+		(then
+			(call_indirect (type $%s)
+				(local.get $ptr)
+				(i32.load offset=4 (local.get $ptr)))
+			(call $%s (local.get $ptr))))
+)
+`, releaseClosureFunc, releaseFunc, releaseFunc, MemoryDeallocateFunc))
+	}
+	for _, b := range m.boxOrder {
+		out.WriteString(fmt.Sprintf("\n(func $%s (param $ptr i32)\n", releaseName(b)))
+		out.WriteString(fmt.Sprintf("\t(if (call $%s (local.get $ptr))\n\t\t(then\n", releaseFunc))
+		if managed(b.elem) {
+			out.WriteString("\t\t\t" + generateRelease(b.elem, "(i32.load (local.get $ptr))"))
+		}
+		out.WriteString(fmt.Sprintf("\t\t\t(call $%s (local.get $ptr))))\n)\n", MemoryDeallocateFunc))
+	}
+	return out.String()
+}
@@ -0,0 +1,267 @@
+package wat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/checker"
+	"github.com/dfirebaugh/punch/token"
+)
+
+// A loop is lowered to a block around a loop around another block:
+//
+//	(block $break_1
+//	  (loop $loop_1
+//	    (br_if $break_1 (i32.eqz condition))
+//	    (block $continue_1
+//	      body)
+//	    post
+//	    (br $loop_1)))
+//
+// break branches out of the outer block and continue out of the inner one,
+// which runs the post statement before the next iteration. A break or a
+// continue that names the label of an outer loop branches to the blocks of
+// that loop instead.
+
+// loopLabels are the labels of a loop. break and continue branch to the
+// first two. name is the label the loop is named by, if any, and held the
+// number of owners the function had before the loop held references of
+// its own.
+type loopLabels struct {
+	breakLabel, continueLabel, loopLabel string
+	name                                 string
+	held                                 int
+}
+
+func (m *module) generateForStatement(s *ast.ForStatement) string {
+	var out strings.Builder
+	out.WriteString(m.generateStatement(s.Init))
+	out.WriteString(m.generateLoop(s.Label, s.Condition, s.Body, s.Post))
+	return out.String()
+}
+
+func (m *module) generateLoop(label *ast.Identifier, condition ast.Expression, body ast.Statement, post ast.Statement) string {
+	m.deferLoop(body)
+	cond := ""
+	if condition != nil {
+		cond = m.generateExpression(condition)
+	}
+	var out strings.Builder
+	out.WriteString(m.beginLoop(label, len(m.owners), cond))
+	out.WriteString(m.generateStatement(body))
+	out.WriteString(m.endLoop(m.generateStatement(post)))
+	return out.String()
+}
+
+// beginLoop opens the blocks of a loop that runs while a condition holds,
+// or until it breaks when there is none, up to its body. The labels of the
+// loop are the innermost until endLoop closes it.
+func (m *module) beginLoop(label *ast.Identifier, held int, condition string) string {
+	m.labelCounter++
+	labels := loopLabels{
+		breakLabel:    fmt.Sprintf("$break_%d", m.labelCounter),
+		continueLabel: fmt.Sprintf("$continue_%d", m.labelCounter),
+		loopLabel:     fmt.Sprintf("$loop_%d", m.labelCounter),
+		held:          held,
+	}
+	if label != nil {
+		labels.name = label.Value
+	}
+	m.loops = append(m.loops, labels)
+
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("(block %s\n", labels.breakLabel))
+	out.WriteString(fmt.Sprintf("(loop %s\n", labels.loopLabel))
+	if condition != "" {
+		out.WriteString(fmt.Sprintf("(br_if %s (i32.eqz %s))\n", labels.breakLabel, condition))
+	}
+	out.WriteString(fmt.Sprintf("(block %s\n", labels.continueLabel))
+	return out.String()
+}
+
+// endLoop closes the innermost loop after its body, running post before the
+// next iteration.
+func (m *module) endLoop(post string) string {
+	labels := m.loops[len(m.loops)-1]
+	m.loops = m.loops[:len(m.loops)-1]
+
+	var out strings.Builder
+	out.WriteString(")\n")
+	out.WriteString(post)
+	out.WriteString(fmt.Sprintf("(br %s)\n", labels.loopLabel))
+	out.WriteString(")\n")
+	out.WriteString(")\n")
+	return out.String()
+}
+
+// A for in loop counts its iterations in an index from zero, or from the
+// start of a range, up to an end computed before the loop: the length of a
+// list or a string, the number of keys of a map or the end of a range. The
+// list, the string or the map is held in a temporary until the loop ends
+// so that the body cannot free it, and the keys of a map are listed before
+// the loop. Keys that an earlier iteration deleted are skipped. The
+// variables are stored at the start of each iteration.
+func (m *module) generateForInStatement(s *ast.ForInStatement) string {
+	m.deferLoop(s.Body)
+	var out strings.Builder
+	owners := len(m.owners)
+
+	// values holds the value of a first and a second variable, and single
+	// is the one a single variable takes
+	var values []string
+	single := 1
+	var index, cond, post string
+	var mt *checker.Map
+	var seq, entry string
+	if rng, ok := s.Iterable.(*ast.RangeExpression); ok {
+		t := m.typeOf(rng)
+		vt := valueType(t)
+		index = m.generateTemp(vt)
+		end := m.generateTemp(vt)
+		out.WriteString(fmt.Sprintf("(local.set $%s %s)\n", index, m.generateExpression(rng.Low)))
+		out.WriteString(fmt.Sprintf("(local.set $%s %s)\n", end, m.generateExpression(rng.High)))
+		lt := instructions[token.LT].signed
+		if checker.IsUnsigned(t) {
+			lt = instructions[token.LT].unsigned
+		}
+		cond = fmt.Sprintf("(%s.%s (local.get $%s) (local.get $%s))", vt, lt, index, end)
+		post = fmt.Sprintf("(local.set $%[2]s (%[1]s.add (local.get $%[2]s) (%[1]s.const 1)))\n", vt, index)
+		values, single = []string{fmt.Sprintf("(local.get $%s)", index)}, 0
+	} else {
+		index = m.generateTemp("i32")
+		out.WriteString(fmt.Sprintf("(local.set $%s (i32.const 0))\n", index))
+		seq = m.generateTemp("i32")
+		out.WriteString(m.generateHeld(seq, m.heapType(s.Iterable), m.generateOwned(s.Iterable)))
+		// the length of a list or a string is its first word
+		length := fmt.Sprintf("(i32.load (local.get $%s))", seq)
+		switch t := m.typeOf(s.Iterable).(type) {
+		case *checker.Map:
+			mt = t
+			keys := m.generateTemp("i32")
+			out.WriteString(m.generateHeld(keys, &checker.List{Elem: t.Key},
+				fmt.Sprintf("(call $%s (local.get $%s))", m.mapFunc(mapKeysFunc, t.Key), seq)))
+			length = fmt.Sprintf("(i32.load (local.get $%s))", keys)
+			entry = m.generateTemp("i32")
+			m.runtime[listSlotFunc] = true
+			key := fmt.Sprintf("(%s.load (call $%s (local.get $%s) (local.get $%s)))", valueType(t.Key), listSlotFunc, keys, index)
+			values = []string{key, fmt.Sprintf("(%s.load offset=16 (local.get $%s))", valueType(t.Elem), entry)}
+			single = 0
+		case *checker.List:
+			m.runtime[listSlotFunc] = true
+			values = []string{
+				fmt.Sprintf("(local.get $%s)", index),
+				fmt.Sprintf("(%s.load (call $%s (local.get $%s) (local.get $%s)))", valueType(t.Elem), listSlotFunc, seq, index),
+			}
+		default:
+			values = []string{
+				fmt.Sprintf("(local.get $%s)", index),
+				fmt.Sprintf("(i32.load8_u offset=4 (i32.add (local.get $%s) (local.get $%s)))", seq, index),
+			}
+		}
+		end := m.generateTemp("i32")
+		out.WriteString(fmt.Sprintf("(local.set $%s %s)\n", end, length))
+		cond = fmt.Sprintf("(i32.lt_s (local.get $%s) (local.get $%s))", index, end)
+		post = fmt.Sprintf("(local.set $%[1]s (i32.add (local.get $%[1]s) (i32.const 1)))\n", index)
+	}
+
+	out.WriteString(m.beginLoop(s.Label, owners, cond))
+	if mt != nil {
+		labels := m.loops[len(m.loops)-1]
+		out.WriteString(fmt.Sprintf("(br_if %s (i32.eqz (local.tee $%s (call $%s (local.get $%s) %s))))\n",
+			labels.continueLabel, entry, m.mapFunc(mapFindFunc, mt.Key), seq, values[0]))
+	}
+	for i, v := range s.Vars {
+		value := values[i]
+		if len(s.Vars) == 1 {
+			value = values[single]
+		}
+		sym := m.info.Defs[v]
+		if sym == nil {
+			continue
+		}
+		// the variable owns its value like any other
+		if managed(sym.Type) {
+			value = fmt.Sprintf("(call $%s %s)", retainFunc, value)
+		}
+		out.WriteString(m.generateStore(v, sym, value))
+	}
+	out.WriteString(m.generateStatement(s.Body))
+	out.WriteString(m.endLoop(post))
+
+	out.WriteString(generateReleaseHeld(m.owners[owners:]))
+	m.owners = m.owners[:owners]
+	return out.String()
+}
+
+// generateReleaseHeld releases the references held by temporaries and
+// clears the temporaries, so that a return does not release them again.
+func generateReleaseHeld(held []owner) string {
+	var out strings.Builder
+	for _, o := range held {
+		out.WriteString(generateRelease(o.t, fmt.Sprintf("(local.get $%s)", o.name)))
+		out.WriteString(fmt.Sprintf("(local.set $%s (i32.const 0))\n", o.name))
+	}
+	return out.String()
+}
+
+// generateHeld stores an owned reference in a temporary that owns it while
+// the statement that holds it runs. A return from the statement releases
+// it with the locals.
+func (m *module) generateHeld(temp string, t checker.Type, value string) string {
+	m.owners = append(m.owners, owner{temp, t})
+	return fmt.Sprintf("(local.set $%s %s)\n", temp, value)
+}
+
+// generateBranch lowers break and continue to a branch to the innermost
+// loop, or to the loop their label names. The loops inside that one are
+// left without running the code after them, so the references they hold
+// are released before the branch.
+func (m *module) generateBranch(stmt ast.Statement) string {
+	var label *ast.Identifier
+	isBreak := false
+	switch s := stmt.(type) {
+	case *ast.BreakStatement:
+		label, isBreak = s.Label, true
+	case *ast.ContinueStatement:
+		label = s.Label
+	}
+
+	target := len(m.loops) - 1
+	if label != nil {
+		for target >= 0 && m.loops[target].name != label.Value {
+			target--
+		}
+	}
+	if target < 0 {
+		if label != nil {
+			m.errorf(stmt, "no loop labeled %s around this %s", label.Value, stmt.TokenLiteral())
+		} else {
+			m.errorf(stmt, "%s is not in a loop", stmt.TokenLiteral())
+		}
+		return ""
+	}
+
+	var out strings.Builder
+	if target < len(m.loops)-1 {
+		out.WriteString(generateReleaseHeld(m.owners[m.loops[target+1].held:]))
+	}
+	labels := m.loops[target]
+	if isBreak {
+		out.WriteString(fmt.Sprintf("(br %s)\n", labels.breakLabel))
+	} else {
+		out.WriteString(fmt.Sprintf("(br %s)\n", labels.continueLabel))
+	}
+	return out.String()
+}
+
+// generateLogicalExpression lowers && and || to an if so that the right
+// operand is only evaluated when it decides the result.
+func (m *module) generateLogicalExpression(infix *ast.InfixExpression) string {
+	left := m.generateExpression(infix.Left)
+	right := m.generateExpression(infix.Right)
+	if infix.Operator.Type == token.AND {
+		return fmt.Sprintf("(if (result i32) %s (then %s) (else (i32.const 0)))", left, right)
+	}
+	return fmt.Sprintf("(if (result i32) %s (then (i32.const 1)) (else %s))", left, right)
+}
@@ -0,0 +1,229 @@
+package wat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dfirebaugh/punch/ast"
+)
+
+// A deferred call runs when its function returns, after the values it
+// returns are computed and before its locals are released. The receiver
+// and the arguments of the call are evaluated where the defer statement
+// runs and kept in temporaries, along with a flag that records that the
+// statement ran. Every exit of the function ends with an epilogue that
+// makes the flagged calls, last deferred first. Traps end the program
+// without running deferred calls.
+//
+// A defer statement in a loop can run any number of times, so each run
+// pushes a record on a stack that belongs to the outermost loop around
+// it, in place of the flag:
+//
+//	offset 0  the record pushed before it
+//	offset 4  the index of the defer statement in the loop
+//	offset 8  the values the call was deferred with, 8 bytes each
+//
+// The epilogue pops the records, loads their values into the temporaries
+// of their statement, makes the call and frees the record.
+
+// deferredCall is a defer statement of the function being generated, or
+// the stack of the defer statements of a loop.
+type deferredCall struct {
+	stmt *ast.DeferStatement
+	// flag is the temporary set once the statement runs, or the head of
+	// the stack
+	flag string
+	// release releases the values the call was deferred with
+	release string
+	// values holds the expressions the call is deferred with and temps
+	// the temporaries that hold them
+	values []ast.Expression
+	temps  []string
+	// calls holds the defer statements of the loop of a stack, and record
+	// the temporary that holds the record being pushed or popped
+	calls  []*deferredCall
+	record string
+}
+
+// deferredValues returns the expressions of a deferred call that are
+// evaluated by the defer statement.
+func (m *module) deferredValues(call *ast.FunctionCall) []ast.Expression {
+	if _, ok := m.info.PackageMember(call.Function); ok {
+		return call.Arguments
+	}
+	if access, ok := call.Function.(*ast.StructFieldAccess); ok {
+		return append([]ast.Expression{access.Left}, call.Arguments...)
+	}
+	return call.Arguments
+}
+
+// deferredCallOf returns the deferred call of a defer statement, with the
+// temporaries of its values, or nil when it does not defer a call.
+func (m *module) deferredCallOf(s *ast.DeferStatement) *deferredCall {
+	stmt, ok := s.Statement.(*ast.ExpressionStatement)
+	if !ok {
+		m.unsupported(s)
+		return nil
+	}
+	call, ok := stmt.Expression.(*ast.FunctionCall)
+	if !ok {
+		m.unsupported(s)
+		return nil
+	}
+
+	// the values hold a reference until the call is made
+	d := &deferredCall{stmt: s, values: m.deferredValues(call)}
+	var release strings.Builder
+	for _, expr := range d.values {
+		t := m.heapType(expr)
+		temp := m.generateTemp(valueType(t))
+		d.temps = append(d.temps, temp)
+		if managed(t) {
+			release.WriteString(generateRelease(t, fmt.Sprintf("(local.get $%s)", temp)))
+		}
+	}
+	d.release = release.String()
+	return d
+}
+
+// deferLoop adds the stack of the defer statements in the body of a loop
+// to the deferred calls when the loop is the outermost one. The
+// statements are known before the body is generated since a return in
+// the body pops the calls of the ones that come after it.
+func (m *module) deferLoop(body ast.Statement) {
+	if len(m.loops) > 0 {
+		return
+	}
+	var stmts []*ast.DeferStatement
+	collectDefers(body, &stmts)
+	if len(stmts) == 0 {
+		return
+	}
+	m.runtime[MemoryAllocateFunc] = true
+	stack := &deferredCall{flag: m.generateTemp("i32"), record: m.generateTemp("i32")}
+	for _, s := range stmts {
+		if d := m.deferredCallOf(s); d != nil {
+			stack.calls = append(stack.calls, d)
+		}
+	}
+	m.defers = append(m.defers, stack)
+}
+
+// collectDefers appends the defer statements of a statement, leaving out
+// the ones of function literals.
+func collectDefers(stmt ast.Statement, stmts *[]*ast.DeferStatement) {
+	switch s := stmt.(type) {
+	case *ast.DeferStatement:
+		*stmts = append(*stmts, s)
+	case *ast.BlockStatement:
+		for _, stmt := range s.Statements {
+			collectDefers(stmt, stmts)
+		}
+	case *ast.IfStatement:
+		collectDefers(s.Consequence, stmts)
+		if s.Alternative != nil {
+			collectDefers(s.Alternative, stmts)
+		}
+	case *ast.ForStatement:
+		collectDefers(s.Body, stmts)
+	case *ast.ForInStatement:
+		collectDefers(s.Body, stmts)
+	}
+}
+
+// stacked returns the stack a defer statement in a loop pushes on and the
+// index of the statement in it.
+func (m *module) stacked(s *ast.DeferStatement) (*deferredCall, int) {
+	for _, stack := range m.defers {
+		for i, d := range stack.calls {
+			if d.stmt == s {
+				return stack, i
+			}
+		}
+	}
+	return nil, 0
+}
+
+func (m *module) generateDeferStatement(s *ast.DeferStatement) string {
+	stack, index := m.stacked(s)
+	d := m.deferredCallOf(s)
+	if stack != nil {
+		d = stack.calls[index]
+	}
+	if d == nil {
+		return ""
+	}
+
+	var out strings.Builder
+	for i, expr := range d.values {
+		// an earlier exit can have generated the call from the temporary
+		delete(m.evaluated, expr)
+		out.WriteString(fmt.Sprintf("(local.set $%s %s)\n", d.temps[i], m.generateOwned(expr)))
+		m.evaluated[expr] = d.temps[i]
+	}
+	if stack == nil {
+		d.flag = m.generateTemp("i32")
+		out.WriteString(fmt.Sprintf("(local.set $%s (i32.const 1))\n", d.flag))
+		m.defers = append(m.defers, d)
+		return out.String()
+	}
+
+	out.WriteString(fmt.Sprintf("(local.set $%s (call $%s (i32.const %d)))\n", stack.record, MemoryAllocateFunc, 8+8*len(d.values)))
+	out.WriteString(fmt.Sprintf("(i32.store (local.get $%s) (local.get $%s))\n", stack.record, stack.flag))
+	out.WriteString(fmt.Sprintf("(i32.store offset=4 (local.get $%s) (i32.const %d))\n", stack.record, index))
+	for i, expr := range d.values {
+		out.WriteString(fmt.Sprintf("(%s.store offset=%d (local.get $%s) (local.get $%s))\n",
+			valueType(m.heapType(expr)), 8+8*i, stack.record, d.temps[i]))
+	}
+	out.WriteString(fmt.Sprintf("(local.set $%s (local.get $%s))\n", stack.flag, stack.record))
+	return out.String()
+}
+
+// generateExit returns the epilogue of an exit of the function being
+// generated, which makes the deferred calls and releases the locals.
+// Only defer statements before the exit can have run, so the ones that
+// are generated later are left out.
+func (m *module) generateExit() string {
+	var out strings.Builder
+	for i := len(m.defers) - 1; i >= 0; i-- {
+		d := m.defers[i]
+		if d.calls != nil {
+			out.WriteString(m.generatePopDeferred(d))
+			continue
+		}
+		out.WriteString(fmt.Sprintf("(if (local.get $%s)\n(then\n", d.flag))
+		out.WriteString(m.generateStatement(d.stmt.Statement))
+		out.WriteString(d.release)
+		out.WriteString("))\n")
+	}
+	out.WriteString(m.generateReleaseOwners())
+	return out.String()
+}
+
+// generatePopDeferred returns a loop that makes the calls on a stack of
+// deferred calls until it is empty.
+func (m *module) generatePopDeferred(stack *deferredCall) string {
+	m.labelCounter++
+	done := fmt.Sprintf("$deferred_%d", m.labelCounter)
+	next := fmt.Sprintf("$pop_%d", m.labelCounter)
+
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("(block %s\n(loop %s\n", done, next))
+	out.WriteString(fmt.Sprintf("(br_if %s (i32.eqz (local.get $%s)))\n", done, stack.flag))
+	out.WriteString(fmt.Sprintf("(local.set $%s (local.get $%s))\n", stack.record, stack.flag))
+	out.WriteString(fmt.Sprintf("(local.set $%s (i32.load (local.get $%s)))\n", stack.flag, stack.record))
+	for index, d := range stack.calls {
+		out.WriteString(fmt.Sprintf("(if (i32.eq (i32.load offset=4 (local.get $%s)) (i32.const %d))\n(then\n", stack.record, index))
+		for i, expr := range d.values {
+			out.WriteString(fmt.Sprintf("(local.set $%s (%s.load offset=%d (local.get $%s)))\n",
+				d.temps[i], valueType(m.heapType(expr)), 8+8*i, stack.record))
+			m.evaluated[expr] = d.temps[i]
+		}
+		out.WriteString(m.generateStatement(d.stmt.Statement))
+		out.WriteString(d.release)
+		out.WriteString("))\n")
+	}
+	out.WriteString(fmt.Sprintf("(call $%s (local.get $%s))\n", MemoryDeallocateFunc, stack.record))
+	out.WriteString(fmt.Sprintf("(br %s)\n))\n", next))
+	return out.String()
+}
@@ -2,195 +2,311 @@ package wat
 
 import (
 	"fmt"
-	"log"
 	"strings"
 
 	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/checker"
 )
 
-var (
-	scopeStack       []map[string]string
-	stringLiteralMap map[string]string
-)
-
-func pushScope() {
-	scopeStack = append(scopeStack, make(map[string]string))
+func (m *module) pushScope() {
+	m.scopeStack = append(m.scopeStack, make(map[string]string))
 }
 
-func popScope() {
-	scopeStack = scopeStack[:len(scopeStack)-1]
+func (m *module) popScope() {
+	m.scopeStack = m.scopeStack[:len(m.scopeStack)-1]
 }
 
-func declareVariable(name, watType string) string {
-	currentScope := scopeStack[len(scopeStack)-1]
-	if _, exists := currentScope[name]; exists {
-		log.Fatalf("Variable %s already declared in current scope", name)
+func (m *module) generateFunctionStatement(s *ast.FunctionStatement) string {
+	// main is exported since it is the entry point hosts call, unless the
+	// entry function runs the statements outside of functions instead. Pub
+	// functions of imported packages are only visible inside the module.
+	export := ""
+	if s.Receiver == nil && m.info.Defs[s.Name].Pkg == "" {
+		if s.Name.Value == "main" && !m.hasEntry || s.IsExported && s.Name.Value != "main" {
+			export = s.Name.Value
+		}
 	}
-	declaration := fmt.Sprintf("(local $%s %s)\n", name, watType)
-	currentScope[name] = declaration
-	return declaration
+	return m.generateFunction(m.functionName(s), export, s)
 }
 
-func lookupVariable(name string) string {
-	for i := len(scopeStack) - 1; i >= 0; i-- {
-		if declaration, exists := scopeStack[i][name]; exists {
-			return declaration
-		}
-	}
-	log.Fatalf("Variable %s not found in any scope", name)
-	return ""
+// generateEntryFunction generates the function that runs the statements
+// outside of functions in order. It is exported as main in place of the
+// program's main function, which it only calls if the program does.
+func (m *module) generateEntryFunction(stmts []ast.Statement) string {
+	return m.generateFunction(entryFunc, "main", &ast.FunctionStatement{
+		Body: &ast.BlockStatement{Statements: stmts},
+	})
 }
 
-func generateFunctionStatement(s *ast.FunctionStatement) string {
+func (m *module) generateFunction(name string, export string, s *ast.FunctionStatement) string {
 	var out strings.Builder
 
-	out.WriteString(fmt.Sprintf("(func $%s ", s.Name.Value))
-	if s.IsExported {
-		out.WriteString(fmt.Sprintf("(export \"%s\") ", s.Name.Value))
+	out.WriteString(fmt.Sprintf("(func $%s ", name))
+	if export != "" {
+		out.WriteString(fmt.Sprintf("(export \"%s\") ", export))
 	}
 
-	pushScope()
+	m.pushScope()
+	if m.literal != nil {
+		out.WriteString(fmt.Sprintf("(param $%s i32) ", envParam))
+	}
+	if s.Receiver != nil {
+		declaration := fmt.Sprintf("(param $%s i32) ", s.Receiver.Identifier.Value)
+		m.scopeStack[len(m.scopeStack)-1][s.Receiver.Identifier.Value] = declaration
+		out.WriteString(declaration)
+	}
 	for _, param := range s.Parameters {
-		declaration := fmt.Sprintf("(param $%s %s) ", param.Identifier.Value, mapTypeToWAT(string(param.Type)))
-		scopeStack[len(scopeStack)-1][param.Identifier.Value] = declaration
+		declaration := fmt.Sprintf("(param $%s %s) ", param.Identifier.Value, m.mapTypeToWAT(param.Identifier, string(param.Type)))
+		m.scopeStack[len(m.scopeStack)-1][param.Identifier.Value] = declaration
 		out.WriteString(declaration)
 	}
 
-	if s.ReturnType != nil {
-		out.WriteString(fmt.Sprintf("(result %s) ", mapTypeToWAT(s.ReturnType.Value)))
+	if len(s.ReturnTypes) > 0 {
+		out.WriteString("(result")
+		for _, t := range s.ReturnTypes {
+			out.WriteString(" " + m.mapTypeToWAT(t, t.Value))
+		}
+		out.WriteString(") ")
 	}
 	out.WriteString("\n")
 
-	stringLiteralMap = make(map[string]string)
-
+	// parameters own their values like the other locals, so they are
+	// retained on entry. The boxes of parameters that closures capture
+	// own their values instead.
+	m.owners = nil
+	m.variables = make(map[string]*checker.Symbol)
+	m.locals = make(map[*checker.Symbol]string)
 	declaredLocals := make(map[string]bool)
-	for _, param := range s.Parameters {
+	var locals []string
+	var retains strings.Builder
+	if m.literal != nil {
+		retains.WriteString(m.generateEnvironment(m.literal, declaredLocals, &locals))
+	}
+	params := s.Parameters
+	if s.Receiver != nil {
+		params = append([]*ast.Parameter{s.Receiver}, params...)
+	}
+	for _, param := range params {
 		declaredLocals[param.Identifier.Value] = true
+		sym := m.info.Defs[param.Identifier]
+		if sym != nil {
+			m.variables[param.Identifier.Value] = sym
+		}
+		switch {
+		case sym == nil:
+		case m.captured[sym]:
+			retains.WriteString(m.generateBoxedParameter(param, sym.Type, declaredLocals, &locals))
+		case managed(sym.Type):
+			m.owners = append(m.owners, owner{param.Identifier.Value, sym.Type})
+			retains.WriteString(fmt.Sprintf("(drop (call $%s (local.get $%s)))\n", retainFunc, param.Identifier.Value))
+		}
 	}
-	var locals []string
-	var initializations []string
-	var stringLiterals []string
 	for _, stmt := range s.Body.Statements {
-		collectLocalsAndInitializations(stmt, declaredLocals, &locals, &initializations, &stringLiterals)
+		m.collectLocals(stmt, declaredLocals, &locals)
 	}
 
-	for _, local := range locals {
-		out.WriteString(local)
+	// the body is generated before the locals are written since it can
+	// declare temporaries
+	m.temps = nil
+	m.defers = nil
+	var body strings.Builder
+	for _, stmt := range s.Body.Statements {
+		body.WriteString(m.generateStatement(stmt))
 	}
-
-	for _, strInit := range stringLiterals {
-		out.WriteString(strInit)
+	if len(s.ReturnTypes) > 0 {
+		// every path has returned, e.g. from both branches of an if
+		body.WriteString("(unreachable)\n")
+	} else {
+		body.WriteString(m.generateExit())
 	}
 
-	for _, init := range initializations {
-		out.WriteString(init)
+	for _, local := range append(locals, m.temps...) {
+		out.WriteString(local)
 	}
 
-	for _, stmt := range s.Body.Statements {
-		out.WriteString(generateStatement(stmt))
-	}
+	out.WriteString(retains.String())
+
+	out.WriteString(body.String())
 
-	popScope()
+	m.popScope()
 	out.WriteString(")\n")
 	return out.String()
 }
 
-func collectLocalsAndInitializations(stmt ast.Statement, declaredLocals map[string]bool, locals *[]string, initializations *[]string, stringLiterals *[]string) {
+func (m *module) collectLocals(stmt ast.Statement, declaredLocals map[string]bool, locals *[]string) {
 	switch s := stmt.(type) {
 	case *ast.VariableDeclaration:
-		if !declaredLocals[s.Name.Value] {
-			*locals = append(*locals, fmt.Sprintf("(local $%s %s)\n", s.Name.Value, mapTypeToWAT(s.Type.Literal)))
-			declaredLocals[s.Name.Value] = true
+		m.collectExpressionLocals(s.Value, declaredLocals, locals)
+		// an assignment to a declared variable has no definition
+		if sym := m.info.Defs[s.Name]; sym != nil {
+			m.declareLocal(s.Name, sym, declaredLocals, locals)
 		}
+		// the value is assigned where the declaration appears so that it is
+		// evaluated in order with the statements around it
+	case *ast.ListDeclaration:
 		if s.Value != nil {
-			*initializations = append(*initializations, fmt.Sprintf("(local.set $%s %s)\n", s.Name.Value, generateExpression(s.Value)))
+			m.collectExpressionLocals(s.Value, declaredLocals, locals)
+		}
+		if sym := m.info.Defs[s.Name]; sym != nil {
+			m.declareLocal(s.Name, sym, declaredLocals, locals)
+		}
+	case *ast.DestructuringDeclaration:
+		m.collectExpressionLocals(s.Value, declaredLocals, locals)
+		for _, v := range s.Vars {
+			m.collectLocals(v, declaredLocals, locals)
+		}
+	case *ast.ReturnStatement:
+		for _, value := range s.ReturnValues {
+			m.collectExpressionLocals(value, declaredLocals, locals)
 		}
 	case *ast.BlockStatement:
-		pushScope()
+		m.pushScope()
 		for _, stmt := range s.Statements {
-			collectLocalsAndInitializations(stmt, declaredLocals, locals, initializations, stringLiterals)
+			m.collectLocals(stmt, declaredLocals, locals)
 		}
-		popScope()
+		m.popScope()
 	case *ast.IfStatement:
-		collectLocalsAndInitializations(s.Consequence, declaredLocals, locals, initializations, stringLiterals)
+		m.collectExpressionLocals(s.Condition, declaredLocals, locals)
+		m.collectLocals(s.Consequence, declaredLocals, locals)
 		if s.Alternative != nil {
-			collectLocalsAndInitializations(s.Alternative, declaredLocals, locals, initializations, stringLiterals)
+			m.collectLocals(s.Alternative, declaredLocals, locals)
 		}
+	case *ast.ForStatement:
+		m.collectLocals(s.Init, declaredLocals, locals)
+		m.collectExpressionLocals(s.Condition, declaredLocals, locals)
+		m.collectLocals(s.Post, declaredLocals, locals)
+		m.collectLocals(s.Body, declaredLocals, locals)
+	case *ast.ForInStatement:
+		m.collectExpressionLocals(s.Iterable, declaredLocals, locals)
+		for _, v := range s.Vars {
+			if sym := m.info.Defs[v]; sym != nil {
+				m.declareLocal(v, sym, declaredLocals, locals)
+			}
+		}
+		m.collectLocals(s.Body, declaredLocals, locals)
 	case *ast.ExpressionStatement:
-		collectExpressionLocals(s.Expression, declaredLocals, locals, initializations, stringLiterals)
+		m.collectExpressionLocals(s.Expression, declaredLocals, locals)
+	case *ast.DeferStatement:
+		m.collectLocals(s.Statement, declaredLocals, locals)
 	}
 }
 
-func collectExpressionLocals(
+func (m *module) collectExpressionLocals(
 	expr ast.Expression,
 	declaredLocals map[string]bool,
 	locals *[]string,
-	initializations *[]string,
-	stringLiterals *[]string,
 ) {
 	switch e := expr.(type) {
 	case *ast.InfixExpression:
-		collectExpressionLocals(e.Left, declaredLocals, locals, initializations, stringLiterals)
-		collectExpressionLocals(e.Right, declaredLocals, locals, initializations, stringLiterals)
+		m.collectExpressionLocals(e.Left, declaredLocals, locals)
+		m.collectExpressionLocals(e.Right, declaredLocals, locals)
+	case *ast.PrefixExpression:
+		m.collectExpressionLocals(e.Right, declaredLocals, locals)
 	case *ast.FunctionCall:
+		if _, ok := m.info.PackageMember(e.Function); ok {
+			// the package name is not a value
+		} else if access, ok := e.Function.(*ast.StructFieldAccess); ok {
+			m.collectExpressionLocals(access.Left, declaredLocals, locals)
+		} else if ident, ok := e.Function.(*ast.Identifier); !ok || m.info.Uses[ident] != nil && m.info.Uses[ident].Kind == checker.VarSymbol {
+			// a call of a function value
+			m.collectExpressionLocals(e.Function, declaredLocals, locals)
+		}
 		for _, arg := range e.Arguments {
-			collectExpressionLocals(arg, declaredLocals, locals, initializations, stringLiterals)
+			m.collectExpressionLocals(arg, declaredLocals, locals)
 		}
 	case *ast.Identifier:
-		if !declaredLocals[e.Value] {
-			log.Fatalf("Undeclared identifier: %s", e.Value)
-		}
-	case *ast.StringLiteral:
-		if localVarName, exists := stringLiteralMap[e.Value]; exists {
-			*initializations = append(*initializations, fmt.Sprintf("(local.get $%s)\n", localVarName))
-		} else {
-			length := len(e.Value) + 1
-			localVarName := generateUniqueLocalVarName("str_ptr")
-			stringLiteralMap[e.Value] = localVarName
-			*locals = append(*locals, fmt.Sprintf("(local $%s i32)\n", localVarName))
-			var strInit strings.Builder
-			strInit.WriteString(fmt.Sprintf("(local.set $%s (call $%s (i32.const %d)))\n", localVarName, MemoryAllocateFunc, length))
-			for i, char := range e.Value {
-				strInit.WriteString(fmt.Sprintf("(i32.store8 offset=%d (local.get $%s) (i32.const %d)) ;; '%c'\n", i, localVarName, char, char))
+		// the checker has resolved the identifier, which leaves variables
+		// declared outside of any function as the only ones without a local
+		if sym := m.info.Uses[e]; sym != nil && sym.Kind == checker.VarSymbol && !m.isDeclared(sym) {
+			m.errorf(e, "package level variable %s is not supported by the wat backend", e.Value)
+		}
+	case *ast.IndexExpression:
+		m.collectExpressionLocals(e.Left, declaredLocals, locals)
+		m.collectExpressionLocals(e.Index, declaredLocals, locals)
+	case *ast.RangeExpression:
+		m.collectExpressionLocals(e.Low, declaredLocals, locals)
+		m.collectExpressionLocals(e.High, declaredLocals, locals)
+	case *ast.SliceExpression:
+		m.collectExpressionLocals(e.Left, declaredLocals, locals)
+		if e.Low != nil {
+			m.collectExpressionLocals(e.Low, declaredLocals, locals)
+		}
+		if e.High != nil {
+			m.collectExpressionLocals(e.High, declaredLocals, locals)
+		}
+	case *ast.ListLiteral:
+		for _, el := range e.Elements {
+			m.collectExpressionLocals(el, declaredLocals, locals)
+		}
+	case *ast.HashLiteral:
+		for _, pair := range e.Pairs {
+			m.collectExpressionLocals(pair.Key, declaredLocals, locals)
+			m.collectExpressionLocals(pair.Value, declaredLocals, locals)
+		}
+	case *ast.IndexAssignment:
+		m.collectExpressionLocals(e.Left, declaredLocals, locals)
+		m.collectExpressionLocals(e.Right, declaredLocals, locals)
+	case *ast.AssignmentExpression:
+		m.collectExpressionLocals(e.Right, declaredLocals, locals)
+		if ident, ok := e.Left.(*ast.Identifier); ok {
+			if sym := m.info.Defs[ident]; sym != nil {
+				m.declareLocal(ident, sym, declaredLocals, locals)
+			} else {
+				m.collectExpressionLocals(ident, declaredLocals, locals)
 			}
-			strInit.WriteString(fmt.Sprintf("(i32.store8 offset=%d (local.get $%s) (i32.const 0))\n", length-1, localVarName))
-			*stringLiterals = append(*stringLiterals, strInit.String())
-			// *initializations = append(*initializations, fmt.Sprintf("(local.get $%s)\n", localVarName))
 		}
 	case *ast.StructLiteral:
 		for _, fieldValue := range e.Fields {
-			collectExpressionLocals(fieldValue, declaredLocals, locals, initializations, stringLiterals)
+			m.collectExpressionLocals(fieldValue, declaredLocals, locals)
 		}
 	case *ast.StructFieldAccess:
-		collectExpressionLocals(e.Left, declaredLocals, locals, initializations, stringLiterals)
+		if _, ok := m.info.EnumVariant(e); ok {
+			break
+		}
+		m.collectExpressionLocals(e.Left, declaredLocals, locals)
+	case *ast.StructFieldAssignment:
+		m.collectExpressionLocals(e.Left, declaredLocals, locals)
+		m.collectExpressionLocals(e.Right, declaredLocals, locals)
 	}
 }
 
-func generateFunctionCall(call *ast.FunctionCall) string {
+func (m *module) generateFunctionCall(call *ast.FunctionCall) string {
 	var out strings.Builder
 
-	if call.FunctionName == "println" && len(call.Arguments) > 0 {
-		arg := call.Arguments[0]
-		if strLiteral, ok := arg.(*ast.StringLiteral); ok {
-			localVarName, exists := stringLiteralMap[strLiteral.Value]
-			if !exists {
-				log.Fatalf("String literal not found: %s", strLiteral.Value)
+	if access, ok := call.Function.(*ast.StructFieldAccess); ok {
+		return m.generateMethodCall(call, access)
+	}
+	if _, ok := call.Function.(*ast.Identifier); !ok {
+		return m.generateClosureCall(call)
+	}
+	if to, ok := m.info.NumericConversions[call]; ok {
+		return m.generateNumericConversion(call, to)
+	}
+	if out, ok := m.generateMapCall(call); ok {
+		return out
+	}
+	if call.FunctionName == "println" {
+		out.WriteString(m.generatePrintln(call))
+	} else if call.FunctionName == "len" && len(call.Arguments) == 1 {
+		return m.generateLen(call)
+	} else if call.FunctionName == "append" && len(call.Arguments) == 2 {
+		return m.generateAppend(call)
+	} else {
+		name := call.FunctionName
+		if ident, ok := call.Function.(*ast.Identifier); ok && m.info.Uses[ident] != nil {
+			if m.info.Uses[ident].Kind == checker.VarSymbol {
+				return m.generateClosureCall(call)
 			}
-			out.WriteString(fmt.Sprintf("(call $println (local.get $%s))\n", localVarName))
-		} else if fieldAccess, ok := arg.(*ast.StructFieldAccess); ok {
-			out.WriteString(fmt.Sprintf("(call $println %s)\n", generateStructFieldAccess(fieldAccess)))
-		} else if ident, ok := arg.(*ast.Identifier); ok {
-			out.WriteString(fmt.Sprintf("(call $println (local.get $%s))\n", ident.Value))
-		} else {
-			log.Fatal("println expects a string argument or struct field access")
+			name = qualifiedName(m.info.Uses[ident])
 		}
-	} else {
-		out.WriteString(fmt.Sprintf("(call $%s ", call.FunctionName))
-		for _, arg := range call.Arguments {
+		values, release := m.generateArguments(call.Arguments)
+		out.WriteString(fmt.Sprintf("(call $%s", name))
+		for _, value := range values {
 			out.WriteString(" ")
-			out.WriteString(generateExpression(arg))
+			out.WriteString(value)
 		}
 		out.WriteString(")\n")
+		return m.generateReleaseAfter(out.String(), m.typeOf(call), release)
 	}
 
 	return out.String()
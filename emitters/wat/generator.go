@@ -0,0 +1,186 @@
+package wat
+
+import (
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/checker"
+	"github.com/dfirebaugh/punch/diagnostic"
+	"github.com/dfirebaugh/punch/token"
+)
+
+// DefaultImportModule is the module host functions such as println are
+// imported from when Options.ImportModule is empty.
+const DefaultImportModule = "imports"
+
+// Options configure the module a Generator emits.
+type Options struct {
+	// MemoryManagement includes the memory and the allocator in every
+	// module. Modules that use interfaces always include them.
+	MemoryManagement bool
+	// MemoryPages is the initial size of the memory in 64KB pages. It
+	// defaults to 1.
+	MemoryPages int
+	// ImportModule is the module host functions are imported from. It
+	// defaults to DefaultImportModule.
+	ImportModule string
+}
+
+// Generator generates WebAssembly text from checked programs. A Generator
+// only holds its options, so a single Generator can be used from several
+// goroutines at once.
+type Generator struct {
+	opts Options
+}
+
+func NewGenerator(opts Options) *Generator {
+	if opts.MemoryPages <= 0 {
+		opts.MemoryPages = 1
+	}
+	if opts.ImportModule == "" {
+		opts.ImportModule = DefaultImportModule
+	}
+	return &Generator{opts: opts}
+}
+
+// Generate returns the WebAssembly text of a program. Constructs the
+// generator does not support are returned as a diagnostic.List, in which
+// case no text is returned.
+func (g *Generator) Generate(program *checker.Program) (string, error) {
+	m := &module{
+		opts:                 g.opts,
+		info:                 program.Info,
+		functionDeclarations: make(map[string]*ast.FunctionDeclaration),
+		structDefinitions:    make(map[string]*ast.StructDefinition),
+		imports:              make(map[string]bool),
+		runtime:              make(map[string]bool),
+		strings:              make(map[string]int),
+		evaluated:            make(map[ast.Expression]string),
+		captured:             make(map[*checker.Symbol]bool),
+		boxes:                make(map[string]*box),
+		literalNames:         make(map[*ast.FunctionLiteral]string),
+		functionValues:       make(map[string]int),
+		closureTypes:         make(map[string]string),
+	}
+	for _, captures := range program.Info.Captures {
+		for _, sym := range captures {
+			m.captured[sym] = true
+		}
+	}
+	if m.usesFunctionValues() {
+		m.runtime[releaseClosureFunc] = true
+	}
+	m.findFunctionDeclarations(program.Program)
+	m.findStructDefinitions(program.Program)
+	// every package is emitted into the same module, the names of functions
+	// from imported packages are prefixed with their path
+	var stmts []ast.Statement
+	for _, file := range program.Files {
+		stmts = append(stmts, file.Statements...)
+	}
+	m.collectDispatchTables(stmts)
+	out := m.generateStatements(stmts)
+	if err := m.errors.Err(); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// module holds the state of generating one module.
+type module struct {
+	opts Options
+	info *checker.Info
+
+	functionDeclarations map[string]*ast.FunctionDeclaration
+	structDefinitions    map[string]*ast.StructDefinition
+
+	// scopeStack holds the locals declared in each enclosing scope of the
+	// function being generated
+	scopeStack      []map[string]string
+	localVarCounter int
+	// temps holds the declarations of the temporaries used by the function
+	// being generated
+	temps []string
+	// owners holds the locals of the function being generated that own
+	// references
+	owners []owner
+	// variables holds the variable each local of the function being
+	// generated was declared for, and locals the names of the locals of
+	// variables that share their name with another variable
+	variables map[string]*checker.Symbol
+	locals    map[*checker.Symbol]string
+	// defers holds the defer statements of the function being generated
+	// so far, and evaluated the temporaries that hold the values they
+	// evaluated
+	defers    []*deferredCall
+	evaluated map[ast.Expression]string
+	// imports holds the host functions the module calls and runtime the
+	// runtime functions it calls
+	imports map[string]bool
+	runtime map[string]bool
+	// strings maps each string constant to its address, stringOrder holds
+	// them in the order they are placed and dataSize is the size of their
+	// data
+	strings     map[string]int
+	stringOrder []string
+	dataSize    int
+	// loops holds the labels of the loops around the statement being
+	// generated, innermost last
+	loops        []loopLabels
+	labelCounter int
+	// hasEntry is set when the program has statements outside of functions,
+	// which are generated into an entry function the host calls as main
+	hasEntry bool
+
+	// methodTable maps each method, e.g. rect.area, to its index in the
+	// function table
+	methodTable map[string]int
+	methodOrder []string
+	// vtables maps an interface and struct pair, e.g. shape.rect, to the
+	// address of its vtable
+	vtables     map[string]int
+	vtableOrder []*vtable
+	heapBase    int
+	// structOrder and interfaceOrder hold the declared types in the order
+	// they are declared, boxed holds the interfaces that have a vtable
+	structOrder    []*checker.Struct
+	interfaceOrder []*checker.Interface
+	boxed          map[*checker.Interface]bool
+	// layouts holds where the fields of each struct are stored
+	layouts map[*checker.Struct]*structLayout
+
+	// captured holds the variables closures capture and boxes the types of
+	// their boxes by the name of their release function
+	captured map[*checker.Symbol]bool
+	boxes    map[string]*box
+	boxOrder []*box
+	// literal is the function literal whose function is being generated.
+	// literalNames names the literals found so far and literalOrder holds
+	// them in the order their functions are generated.
+	literal      *ast.FunctionLiteral
+	literalNames map[*ast.FunctionLiteral]string
+	literalOrder []*ast.FunctionLiteral
+	// functionValues maps the functions used as values to the address of
+	// their closure in the data, closures holds those closures and
+	// wrappers the functions that call a named function from a closure
+	functionValues map[string]int
+	closures       []staticClosure
+	wrappers       []string
+	// closureTypes maps the name of the type of each kind of function
+	// value that is called to its signature
+	closureTypes     map[string]string
+	closureTypeOrder []string
+
+	errors diagnostic.List
+}
+
+func (m *module) errorf(at ast.Node, format string, args ...interface{}) {
+	m.errors = append(m.errors, diagnostic.At(at, format, args...))
+}
+
+func (m *module) operatorError(op token.Token) {
+	m.errors = append(m.errors, diagnostic.New(op, "operator %s is not supported by the wat backend", op.Literal))
+}
+
+// unsupported reports a construct the generator cannot lower yet.
+func (m *module) unsupported(at ast.Node) {
+	m.errorf(at, "%s is not supported by the wat backend", ast.Kind(at))
+}
@@ -0,0 +1,177 @@
+package wat
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dfirebaugh/punch/checker"
+	"github.com/dfirebaugh/punch/diagnostic"
+	"github.com/dfirebaugh/punch/lexer"
+	"github.com/dfirebaugh/punch/parser"
+)
+
+const source = `pkg main
+
+interface shape {
+  i32 area()
+}
+
+struct rect {
+  i32 width
+  i32 height
+}
+
+i32 (rect r) area() {
+  return r.width * r.height
+}
+
+i32 total(shape a, shape b) {
+  return a.area() + b.area()
+}
+
+fn main() {
+  rect r = rect {
+    width: 2,
+    height: 3,
+  }
+  println("hello")
+  i32 x = total(r, r)
+}
+`
+
+func check(t *testing.T, source string) *checker.Program {
+	t.Helper()
+	program, err := parser.New(lexer.New("test.pun", source)).ParseProgram("test.pun")
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	checked, err := checker.Check(program)
+	if err != nil {
+		t.Fatalf("failed to check: %v", err)
+	}
+	return checked
+}
+
+func TestGenerateConcurrently(t *testing.T) {
+	program := check(t, source)
+	g := NewGenerator(Options{MemoryManagement: true})
+	want, err := g.Generate(program)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// each goroutine gets its own copy of the program so that only the
+	// generator is shared
+	programs := make([]*checker.Program, 8)
+	for i := range programs {
+		programs[i] = check(t, source)
+	}
+	var wg sync.WaitGroup
+	results := make([]string, len(programs))
+	for i := range programs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = g.Generate(programs[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for i, got := range results {
+		if got != want {
+			t.Errorf("goroutine %d generated a different module:\n%s", i, got)
+		}
+	}
+}
+
+func TestGenerateOptions(t *testing.T) {
+	program := check(t, source)
+	got, err := NewGenerator(Options{MemoryPages: 4, ImportModule: "env"}).Generate(program)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{`(import "env" "print_str"`, "(memory 4)"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected the module to contain %q:\n%s", want, got)
+		}
+	}
+
+	got, err = NewGenerator(Options{}).Generate(check(t, "pkg main\nfn main() {\n\tprintln(1)\n}\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(got, `(import "`+DefaultImportModule+`" "print_i32"`) {
+		t.Errorf("expected the default import module:\n%s", got)
+	}
+	if strings.Contains(got, "(memory") {
+		t.Errorf("expected no memory without memory management:\n%s", got)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	program := check(t, `pkg main
+
+struct point {
+  i32 x
+}
+
+fn show(point p) {
+  println(p)
+}
+
+fn main() {
+  []i32 xs = {1, 2}
+  println(xs)
+}
+
+i32 base = 3
+
+i32 twice() {
+  return base * 2
+}
+`)
+	out, err := NewGenerator(Options{}).Generate(program)
+	if out != "" {
+		t.Errorf("expected no output, got:\n%s", out)
+	}
+	list, ok := err.(diagnostic.List)
+	if !ok {
+		t.Fatalf("expected diagnostic.List, got %v", err)
+	}
+	want := []string{
+		"8:11: printing a value of type point is not supported by the wat backend",
+		"13:11: printing a value of type []i32 is not supported by the wat backend",
+		"19:10: package level variable base is not supported by the wat backend",
+	}
+	if len(list) != len(want) {
+		t.Fatalf("expected %d errors, got %d:\n%v", len(want), len(list), err)
+	}
+	for i, d := range list {
+		got := fmt.Sprintf("%d:%d: %s", d.Pos.Line, d.Pos.Column, d.Message)
+		if got != want[i] {
+			t.Errorf("error %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestLayoutStruct(t *testing.T) {
+	s := &checker.Struct{Name: "mixed", Fields: []*checker.Field{
+		{Name: "a", Type: checker.Typ[checker.U8]},
+		{Name: "b", Type: checker.Typ[checker.I64]},
+		{Name: "c", Type: checker.Typ[checker.I16]},
+		{Name: "d", Type: checker.Typ[checker.Bool]},
+		{Name: "e", Type: checker.Typ[checker.F32]},
+		{Name: "f", Type: &checker.List{Elem: checker.Typ[checker.F64]}},
+		{Name: "g", Type: checker.Typ[checker.I8]},
+	}}
+	l := layoutStruct(s)
+	want := []int{0, 8, 16, 18, 20, 24, 28}
+	if fmt.Sprint(l.offsets) != fmt.Sprint(want) {
+		t.Errorf("got offsets %v, want %v", l.offsets, want)
+	}
+	if l.size != 32 {
+		t.Errorf("got size %d, want 32", l.size)
+	}
+}
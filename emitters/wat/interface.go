@@ -0,0 +1,251 @@
+package wat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/checker"
+)
+
+// Interface values are pointers to an 8 byte box holding the address of a
+// vtable followed by the address of the struct. A vtable is a list of
+// indices into the function table: the function that releases the struct
+// followed by one per interface method in the order the interface declares
+// them. Calls through an interface go to a dispatch function that loads
+// the index from the vtable and uses call_indirect.
+
+const (
+	InterfaceBoxFunc = "interface_box"
+
+	// vtables are placed after the allocation bitmap at the start of memory
+	vtableBase = 8
+)
+
+type vtable struct {
+	decl   *ast.InterfaceDefinition
+	iface  *checker.Interface
+	s      *checker.Struct
+	offset int
+}
+
+func methodName(receiver, method string) string {
+	return receiver + "." + method
+}
+
+// functionName returns the name of a function in the module. Methods are
+// named after their struct, e.g. rect.area.
+func (m *module) functionName(s *ast.FunctionStatement) string {
+	if s.Receiver != nil {
+		return methodName(string(s.Receiver.Type), s.Name.Value)
+	}
+	return qualifiedName(m.info.Defs[s.Name])
+}
+
+// qualifiedName returns the name of a function in the module. Functions of
+// imported packages are prefixed with the package's path, e.g. math/add.
+func qualifiedName(sym *checker.Symbol) string {
+	if sym.Pkg == "" {
+		return sym.Name
+	}
+	return sym.Pkg + "/" + sym.Name
+}
+
+// collectDispatchTables assigns a table index to every method and lays out
+// a vtable for every struct that satisfies an interface.
+func (m *module) collectDispatchTables(stmts []ast.Statement) {
+	m.methodTable = make(map[string]int)
+	m.methodOrder = nil
+	m.vtables = make(map[string]int)
+	m.vtableOrder = nil
+	m.heapBase = 0
+	m.structOrder = nil
+	m.interfaceOrder = nil
+	m.boxed = make(map[*checker.Interface]bool)
+	m.layouts = make(map[*checker.Struct]*structLayout)
+
+	var interfaces []*ast.InterfaceDefinition
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.FunctionStatement:
+			if s.Receiver != nil {
+				name := m.functionName(s)
+				m.methodTable[name] = len(m.methodOrder)
+				m.methodOrder = append(m.methodOrder, name)
+			}
+		case *ast.InterfaceDefinition:
+			interfaces = append(interfaces, s)
+			m.interfaceOrder = append(m.interfaceOrder, m.info.Interfaces[s.Name.Value])
+		case *ast.StructDefinition:
+			st := m.info.Structs[s.Name.Value]
+			m.structOrder = append(m.structOrder, st)
+			m.layouts[st] = layoutStruct(st)
+		}
+	}
+
+	offset := vtableBase
+	for _, decl := range interfaces {
+		iface := m.info.Interfaces[decl.Name.Value]
+		for _, s := range m.structOrder {
+			if !checker.Implements(s, iface) {
+				continue
+			}
+			if _, ok := m.methodTable[releaseName(s)]; !ok {
+				m.methodTable[releaseName(s)] = len(m.methodOrder)
+				m.methodOrder = append(m.methodOrder, releaseName(s))
+			}
+			m.vtables[methodName(iface.Name, s.Name)] = offset
+			m.vtableOrder = append(m.vtableOrder, &vtable{decl: decl, iface: iface, s: s, offset: offset})
+			m.boxed[iface] = true
+			offset += (len(iface.Methods) + 1) * 4
+		}
+	}
+	if len(m.vtableOrder) > 0 {
+		m.heapBase = offset
+	}
+}
+
+func (m *module) usesInterfaces() bool {
+	return len(m.vtableOrder) > 0
+}
+
+// generateDispatchTables emits the function table, the vtables and a
+// dispatch function for every interface method.
+func (m *module) generateDispatchTables() string {
+	// the closure runtime calls through the table even when it is empty
+	if len(m.methodOrder) == 0 && !m.runtime[releaseClosureFunc] {
+		return ""
+	}
+
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("\n(table %d funcref)\n", len(m.methodOrder)))
+	out.WriteString("(elem (i32.const 0)")
+	for _, name := range m.methodOrder {
+		out.WriteString(" $" + name)
+	}
+	out.WriteString(")\n")
+
+	if !m.usesInterfaces() {
+		return out.String()
+	}
+
+	for _, vt := range m.vtableOrder {
+		var data strings.Builder
+		indices := []string{releaseName(vt.s)}
+		for _, method := range vt.iface.Methods {
+			indices = append(indices, methodName(vt.s.Name, method.Name))
+		}
+		for _, name := range indices {
+			index := m.methodTable[name]
+			for i := 0; i < 4; i++ {
+				data.WriteString(fmt.Sprintf("\\%02x", byte(index>>(8*i))))
+			}
+		}
+		out.WriteString(fmt.Sprintf("(data (i32.const %d) \"%s\") ;; vtable for %s as %s\n", vt.offset, data.String(), vt.s.Name, vt.iface.Name))
+	}
+
+	generated := make(map[*checker.Interface]bool)
+	for _, vt := range m.vtableOrder {
+		if generated[vt.iface] {
+			continue
+		}
+		generated[vt.iface] = true
+		for i, method := range vt.iface.Methods {
+			out.WriteString(m.generateDispatchFunction(vt.decl, vt.iface, method, i))
+		}
+	}
+
+	out.WriteString(fmt.Sprintf(`
+(func $%s (param $vtable i32) (param $data i32) (result i32)
+	(local $box i32)
+	(local.set $box (call $%s (i32.const 8)))
+	(i32.store (local.get $box) (local.get $vtable))
+	(i32.store offset=4 (local.get $box) (local.get $data))
+	(local.get $box)
+)
+`, InterfaceBoxFunc, MemoryAllocateFunc))
+	return out.String()
+}
+
+// generateDispatchFunction emits the type of an interface method and a
+// function that calls the implementation found in the receiver's vtable.
+func (m *module) generateDispatchFunction(decl *ast.InterfaceDefinition, iface *checker.Interface, method *checker.Method, index int) string {
+	name := methodName(iface.Name, method.Name)
+
+	var signature strings.Builder
+	signature.WriteString("(param i32)")
+	for _, param := range method.Sig.Params {
+		signature.WriteString(fmt.Sprintf(" (param %s)", m.watType(decl, param)))
+	}
+	for _, result := range method.Sig.Results {
+		signature.WriteString(fmt.Sprintf(" (result %s)", m.watType(decl, result)))
+	}
+
+	var params, args strings.Builder
+	for i, param := range method.Sig.Params {
+		params.WriteString(fmt.Sprintf(" (param $p%d %s)", i, m.watType(decl, param)))
+		args.WriteString(fmt.Sprintf(" (local.get $p%d)", i))
+	}
+	var results strings.Builder
+	for _, result := range method.Sig.Results {
+		results.WriteString(fmt.Sprintf(" (result %s)", m.watType(decl, result)))
+	}
+
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("(type $%s (func %s))\n", name, signature.String()))
+	out.WriteString(fmt.Sprintf("(func $%s (param $self i32)%s%s\n", name, params.String(), results.String()))
+	out.WriteString(fmt.Sprintf("\t(call_indirect (type $%s)\n", name))
+	out.WriteString(fmt.Sprintf("\t\t(i32.load offset=4 (local.get $self))%s\n", args.String()))
+	out.WriteString(fmt.Sprintf("\t\t(i32.load offset=%d (i32.load (local.get $self))))\n", (index+1)*4))
+	out.WriteString(")\n")
+	return out.String()
+}
+
+// generateInterfaceConversion boxes a struct value that is used as an
+// interface value. The box owns a reference to the struct.
+func (m *module) generateInterfaceConversion(expr ast.Expression, value string, iface *checker.Interface) string {
+	if !m.ownedValue(expr) {
+		value = fmt.Sprintf("(call $%s %s)", retainFunc, value)
+	}
+	offset := m.vtables[methodName(iface.Name, m.info.TypeOf(expr).String())]
+	return fmt.Sprintf("(call $%s (i32.const %d) %s)", InterfaceBoxFunc, offset, value)
+}
+
+// generateMethodCall calls a struct's method directly, or goes through the
+// dispatch function when the receiver is an interface value.
+func (m *module) generateMethodCall(call *ast.FunctionCall, access *ast.StructFieldAccess) string {
+	var out strings.Builder
+	args := call.Arguments
+	if s, ok := m.typeOf(access.Left).(*checker.Struct); ok {
+		if _, ok := s.Method(access.Field.Value); !ok {
+			// a field that holds a function value
+			return m.generateClosureCall(call)
+		}
+	}
+	if member, ok := m.info.PackageMember(access); ok {
+		out.WriteString(fmt.Sprintf("(call $%s", qualifiedName(member)))
+	} else {
+		out.WriteString(fmt.Sprintf("(call $%s", methodName(m.info.TypeOf(access.Left).String(), access.Field.Value)))
+		args = append([]ast.Expression{access.Left}, args...)
+	}
+	values, release := m.generateArguments(args)
+	for _, value := range values {
+		out.WriteString(" ")
+		out.WriteString(value)
+	}
+	out.WriteString(")\n")
+	return m.generateReleaseAfter(out.String(), m.typeOf(call), release)
+}
+
+// watType maps a checked type to the WAT type used to represent it.
+// Unsupported types are reported at the given node.
+func (m *module) watType(at ast.Node, t checker.Type) string {
+	switch t.(type) {
+	case *checker.Basic:
+		if checker.IsString(t) {
+			return "i32"
+		}
+		return m.mapTypeToWAT(at, t.String())
+	}
+	return "i32"
+}
@@ -0,0 +1,280 @@
+package wat
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/checker"
+)
+
+// A list is a pointer to a header that describes its elements:
+//
+//	offset 0:  length, which is where a string keeps its length too so that
+//	           len reads both the same way
+//	offset 4:  capacity
+//	offset 8:  size of an element in bytes
+//	offset 12: address of the elements
+//
+// The elements are stored one after the other in a block of their own.
+// When append finds the list full the elements move to a block twice as
+// large. Lists are reference counted and own a reference to each of their
+// elements of a managed type.
+
+// The runtime functions lists are lowered to. A module only includes the
+// ones it calls.
+const (
+	listNewFunc  = "list_new"
+	listPushFunc = "list_push"
+	listSlotFunc = "list_slot"
+)
+
+const (
+	// listHeader is the size of the header a list points to.
+	listHeader = 16
+	// listMinCap is the capacity of a list that append grows from empty.
+	listMinCap = 4
+)
+
+// elemSize returns the size in bytes a list uses for each element of a
+// type.
+func elemSize(t checker.Type) int {
+	switch valueType(t) {
+	case "i64", "f64":
+		return 8
+	}
+	return 4
+}
+
+// listName returns the name of a list type that can be used in the names
+// of functions, since [] cannot.
+func listName(list *checker.List) string {
+	return "list_" + typeName(list.Elem)
+}
+
+// generateIndex returns the value of an index as an i32.
+func (m *module) generateIndex(expr ast.Expression) string {
+	value := m.generateExpression(expr)
+	if valueType(m.typeOf(expr)) == "i64" {
+		return fmt.Sprintf("(i32.wrap_i64 %s)", value)
+	}
+	return value
+}
+
+// generateListLiteral allocates a list with room for exactly the elements
+// of a literal. The list owns the elements.
+func (m *module) generateListLiteral(lit *ast.ListLiteral) string {
+	// the checker gives {} the type of a map where one is expected
+	if _, ok := m.typeOf(lit).(*checker.Map); ok {
+		m.runtime[mapNewFunc] = true
+		return fmt.Sprintf("(call $%s)", mapNewFunc)
+	}
+	list, ok := m.typeOf(lit).(*checker.List)
+	if !ok {
+		m.unsupported(lit)
+		return ""
+	}
+	m.runtime[listNewFunc] = true
+	ptr := m.generateTemp("i32")
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("(local.set $%s (call $%s (i32.const %d) (i32.const %d)))\n",
+		ptr, listNewFunc, elemSize(list.Elem), len(lit.Elements)))
+	if len(lit.Elements) > 0 {
+		m.runtime[listPushFunc] = true
+	}
+	for _, el := range lit.Elements {
+		out.WriteString(fmt.Sprintf("(%s.store (call $%s (local.get $%s)) %s)\n",
+			valueType(list.Elem), listPushFunc, ptr, m.generateOwned(el)))
+	}
+	out.WriteString(fmt.Sprintf("(local.get $%s)", ptr))
+	return out.String()
+}
+
+// generateListDeclaration assigns a list literal to a local, or an empty
+// list when the declaration has no literal.
+func (m *module) generateListDeclaration(decl *ast.ListDeclaration) string {
+	sym := m.info.Defs[decl.Name]
+	if sym == nil {
+		m.errorf(decl.Name, "undeclared identifier %s", decl.Name.Value)
+		return ""
+	}
+	if decl.Value != nil {
+		return m.generateStore(decl.Name, sym, m.generateOwned(decl.Value))
+	}
+	m.runtime[listNewFunc] = true
+	list := sym.Type.(*checker.List)
+	value := fmt.Sprintf("(call $%s (i32.const %d) (i32.const 0))", listNewFunc, elemSize(list.Elem))
+	return m.generateStore(decl.Name, sym, value)
+}
+
+// generateAppend adds an element to the end of a list. The list is
+// evaluated before the element, and the element before the list makes room
+// for it since evaluating it may append to the same list.
+func (m *module) generateAppend(call *ast.FunctionCall) string {
+	list, ok := m.typeOf(call.Arguments[0]).(*checker.List)
+	if !ok {
+		m.unsupported(call)
+		return ""
+	}
+	m.runtime[listPushFunc] = true
+	values, release := m.generateArguments(call.Arguments[:1])
+	ptr := m.generateTemp("i32")
+	elem := m.generateTemp(valueType(list.Elem))
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("(local.set $%s %s)\n", ptr, values[0]))
+	out.WriteString(fmt.Sprintf("(local.set $%s %s)\n", elem, m.generateOwned(call.Arguments[1])))
+	out.WriteString(fmt.Sprintf("(%s.store (call $%s (local.get $%s)) (local.get $%s))\n",
+		valueType(list.Elem), listPushFunc, ptr, elem))
+	out.WriteString(release)
+	return out.String()
+}
+
+// generateListIndex reads an element of a list. Indexes out of range stop
+// the program.
+func (m *module) generateListIndex(e *ast.IndexExpression, list *checker.List) string {
+	m.runtime[listSlotFunc] = true
+	left := m.generateExpression(e.Left)
+	load := valueType(list.Elem) + ".load"
+	if !m.owned(e.Left) {
+		return fmt.Sprintf("(%s (call $%s %s %s))", load, listSlotFunc, left, m.generateIndex(e.Index))
+	}
+
+	// the element is read before the list is released, and retained in
+	// case that was the list's last reference
+	ptr := m.generateTemp("i32")
+	value := fmt.Sprintf("(%s (call $%s (local.tee $%s %s) %s))", load, listSlotFunc, ptr, left, m.generateIndex(e.Index))
+	if managed(list.Elem) {
+		value = fmt.Sprintf("(call $%s %s)", retainFunc, value)
+	}
+	return m.generateReleaseAfter(value, list.Elem, generateRelease(list, fmt.Sprintf("(local.get $%s)", ptr)))
+}
+
+// listTypes returns the list types the program uses, ordered by name.
+func (m *module) listTypes() []*checker.List {
+	lists := make(map[string]*checker.List)
+	var add func(t checker.Type)
+	add = func(t checker.Type) {
+		switch t := t.(type) {
+		case *checker.List:
+			lists[listName(t)] = t
+			add(t.Elem)
+		case *checker.Map:
+			// keys and for in loops list the keys of a map
+			add(&checker.List{Elem: t.Key})
+			add(t.Elem)
+		}
+	}
+	for _, t := range m.info.Types {
+		add(t)
+	}
+	for _, sym := range m.info.Defs {
+		if sym != nil {
+			add(sym.Type)
+		}
+	}
+	for _, s := range m.structOrder {
+		for _, field := range s.Fields {
+			add(field.Type)
+		}
+	}
+
+	names := make([]string, 0, len(lists))
+	for name := range lists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]*checker.List, len(names))
+	for i, name := range names {
+		out[i] = lists[name]
+	}
+	return out
+}
+
+// generateListReleases emits the release function of every list type,
+// which releases the elements of a list along with it.
+func (m *module) generateListReleases() string {
+	var out strings.Builder
+	for _, list := range m.listTypes() {
+		out.WriteString(fmt.Sprintf("\n(func $%s (param $ptr i32)\n", releaseName(list)))
+		if managed(list.Elem) {
+			out.WriteString("\t(local $i i32)\n")
+		}
+		out.WriteString(fmt.Sprintf("\t(if (call $%s (local.get $ptr))\n\t\t(then\n", releaseFunc))
+		if managed(list.Elem) {
+			out.WriteString(fmt.Sprintf(`			(block $done
+				(loop $next
+					(br_if $done (i32.ge_u (local.get $i) (i32.load (local.get $ptr))))
+					%s					(local.set $i (i32.add (local.get $i) (i32.const 1)))
+					(br $next)))
+`, generateRelease(list.Elem, fmt.Sprintf("(i32.load (i32.add (i32.load offset=12 (local.get $ptr)) (i32.mul (local.get $i) (i32.const %d))))", elemSize(list.Elem)))))
+		}
+		out.WriteString(fmt.Sprintf("\t\t\t(call $%s (i32.load offset=12 (local.get $ptr)))\n", MemoryDeallocateFunc))
+		out.WriteString(fmt.Sprintf("\t\t\t(call $%s (local.get $ptr))))\n)\n", MemoryDeallocateFunc))
+	}
+	return out.String()
+}
+
+// generateListFunctions emits the list runtime functions the module calls.
+// Like the string functions it is called before the imports and the data
+// are generated.
+func (m *module) generateListFunctions() string {
+	var out strings.Builder
+	if m.runtime[listNewFunc] {
+		out.WriteString(fmt.Sprintf(`
+;; list_new allocates an empty list with room for cap elements of size
+;; bytes
+(func $%s (param $size i32) (param $cap i32) (result i32)
+	(local $l i32)
+	(local.set $l (call $%s (i32.const %d)))
+	(i32.store offset=4 (local.get $l) (local.get $cap))
+	(i32.store offset=8 (local.get $l) (local.get $size))
+	(i32.store offset=12 (local.get $l) (call $%[2]s (i32.mul (local.get $cap) (local.get $size))))
+	(local.get $l)
+)
+`, listNewFunc, MemoryAllocateFunc, listHeader))
+	}
+	if m.runtime[listPushFunc] {
+		out.WriteString(fmt.Sprintf(`
+;; list_push adds an element to the end of a list and returns its address,
+;; moving the elements to a block twice as large when the list is full
+(func $%s (param $l i32) (result i32)
+	(local $len i32)
+	(local $data i32)
+	(local.set $len (i32.load (local.get $l)))
+	(if (i32.eq (local.get $len) (i32.load offset=4 (local.get $l)))
+		(then
+			(i32.store offset=4 (local.get $l)
+				(select (i32.shl (local.get $len) (i32.const 1)) (i32.const %d) (local.get $len)))
+			(local.set $data (call $%s
+				(i32.mul (i32.load offset=4 (local.get $l)) (i32.load offset=8 (local.get $l)))))
+			(memory.copy
+				(local.get $data)
+				(i32.load offset=12 (local.get $l))
+				(i32.mul (local.get $len) (i32.load offset=8 (local.get $l))))
+			(call $%s (i32.load offset=12 (local.get $l)))
+			(i32.store offset=12 (local.get $l) (local.get $data))))
+	(i32.store (local.get $l) (i32.add (local.get $len) (i32.const 1)))
+	(i32.add
+		(i32.load offset=12 (local.get $l))
+		(i32.mul (local.get $len) (i32.load offset=8 (local.get $l))))
+)
+`, listPushFunc, listMinCap, MemoryAllocateFunc, MemoryDeallocateFunc))
+	}
+	if m.runtime[listSlotFunc] {
+		m.imports[panicFunc] = true
+		out.WriteString(fmt.Sprintf(`
+;; list_slot returns the address of an element of a list
+(func $%s (param $l i32) (param $i i32) (result i32)
+	(if (i32.ge_u (local.get $i) (i32.load (local.get $l)))
+		(then
+			(call $%s (i32.const %d))
+			(unreachable)))
+	(i32.add
+		(i32.load offset=12 (local.get $l))
+		(i32.mul (local.get $i) (i32.load offset=8 (local.get $l))))
+)
+`, listSlotFunc, panicFunc, m.stringConstant("index out of range")))
+	}
+	return out.String()
+}
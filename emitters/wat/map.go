@@ -0,0 +1,598 @@
+package wat
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/checker"
+)
+
+// A map is a pointer to a header that describes its entries and the index
+// used to find them:
+//
+//	offset 0:  number of keys, which len reads like the length of a list
+//	offset 4:  number of entries in use, deleted ones included
+//	offset 8:  capacity of the entries
+//	offset 12: address of the entries
+//	offset 16: address of the index
+//
+// The entries are stored in the order their keys were inserted, so keys
+// iterates over them in that order. An entry is 24 bytes:
+//
+//	offset 0:  1 while the key is in the map, 0 once it is deleted
+//	offset 8:  key
+//	offset 16: value
+//
+// The index is an open addressing hash table with twice as many slots as
+// the entries have room for. A slot holds the number of an entry counted
+// from 1, or 0 when it is free. Lookups probe the slots one after the other
+// from the slot of the key's hash until they find the key or a free slot.
+// Deleting a key only marks its entry, which keeps its slot so that the
+// probes of other keys go on past it. When the entries are all in use the
+// live ones move to a new block, twice as large unless deleting made enough
+// room, and the index is rebuilt. Maps are reference counted and own a
+// reference to each of their keys and values of a managed type.
+
+// The runtime functions maps are lowered to. The functions that work on
+// keys are emitted for each kind of key, e.g. map_find_str. A module only
+// includes the ones it calls.
+const (
+	mapNewFunc    = "map_new"
+	mapPlaceFunc  = "map_place"
+	mapHashFunc   = "map_hash"
+	mapFindFunc   = "map_find"
+	mapInsertFunc = "map_insert"
+	mapDeleteFunc = "map_delete"
+	mapGrowFunc   = "map_grow"
+	mapKeysFunc   = "map_keys"
+)
+
+const (
+	// mapHeader is the size of the header a map points to.
+	mapHeader = 20
+	// mapEntry is the size of an entry.
+	mapEntry = 24
+	// mapMinCap is the capacity of the entries of a new map.
+	mapMinCap = 4
+)
+
+// mapKeyKinds are the kinds of keys the runtime functions are emitted for.
+var mapKeyKinds = []string{"i32", "i64", "str"}
+
+// keyKind returns the kind of a type of key, which is how the key is
+// hashed and compared.
+func keyKind(t checker.Type) string {
+	if checker.IsString(t) {
+		return "str"
+	}
+	return valueType(t)
+}
+
+// mapFunc returns the name of the runtime function that does something
+// with a kind of key, and marks it as used.
+func (m *module) mapFunc(name string, key checker.Type) string {
+	name += "_" + keyKind(key)
+	m.runtime[name] = true
+	return name
+}
+
+// mapName returns the name of a map type that can be used in the names of
+// functions.
+func mapName(t *checker.Map) string {
+	return "map_" + typeName(t.Key) + "_" + typeName(t.Elem)
+}
+
+// typeName returns the name of a type that can be used in the names of
+// functions.
+func typeName(t checker.Type) string {
+	switch t := t.(type) {
+	case *checker.List:
+		return listName(t)
+	case *checker.Map:
+		return mapName(t)
+	case *checker.Signature:
+		// closures are all released alike, so the lists and maps of them
+		// can share their functions
+		return "fn"
+	}
+	return t.String()
+}
+
+// generateZero returns the value a read of a key that is not in a map
+// yields, which for a string is the empty string and for a list or a map
+// is a new empty one.
+func (m *module) generateZero(t checker.Type) string {
+	switch t := t.(type) {
+	case *checker.List:
+		m.runtime[listNewFunc] = true
+		return fmt.Sprintf("(call $%s (i32.const %d) (i32.const 0))", listNewFunc, elemSize(t.Elem))
+	case *checker.Map:
+		m.runtime[mapNewFunc] = true
+		return fmt.Sprintf("(call $%s)", mapNewFunc)
+	}
+	if checker.IsString(t) {
+		return fmt.Sprintf("(i32.const %d)", m.stringConstant(""))
+	}
+	return fmt.Sprintf("(%s.const 0)", valueType(t))
+}
+
+// allocatesZero reports whether the zero value of a type is allocated, so
+// that reading a map of it yields a reference the code around it owns.
+func allocatesZero(t checker.Type) bool {
+	switch t.(type) {
+	case *checker.List, *checker.Map:
+		return true
+	}
+	return false
+}
+
+// generateHashLiteral allocates a map and inserts the pairs of a literal
+// in order. The map owns the keys and the values.
+func (m *module) generateHashLiteral(lit *ast.HashLiteral) string {
+	mt, ok := m.typeOf(lit).(*checker.Map)
+	if !ok {
+		m.unsupported(lit)
+		return ""
+	}
+	m.runtime[mapNewFunc] = true
+	ptr := m.generateTemp("i32")
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("(local.set $%s (call $%s))\n", ptr, mapNewFunc))
+	for _, pair := range lit.Pairs {
+		out.WriteString(m.generateMapStore(ptr, mt, pair.Key, pair.Value))
+	}
+	out.WriteString(fmt.Sprintf("(local.get $%s)", ptr))
+	return out.String()
+}
+
+// generateMapStore stores a value under a key of the map a local points
+// to, releasing the value the key held. The key and the value are
+// evaluated before the map makes room for them since evaluating them may
+// change the same map.
+func (m *module) generateMapStore(ptr string, mt *checker.Map, key, value ast.Expression) string {
+	keys, release := m.generateArguments([]ast.Expression{key})
+	k := m.generateTemp(valueType(mt.Key))
+	v := m.generateTemp(valueType(mt.Elem))
+	slot := m.generateTemp("i32")
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("(local.set $%s %s)\n", k, keys[0]))
+	out.WriteString(fmt.Sprintf("(local.set $%s %s)\n", v, m.generateOwned(value)))
+	out.WriteString(fmt.Sprintf("(local.set $%s (call $%s (local.get $%s) (local.get $%s)))\n",
+		slot, m.mapFunc(mapInsertFunc, mt.Key), ptr, k))
+	if managed(mt.Elem) {
+		out.WriteString(generateRelease(mt.Elem, fmt.Sprintf("(i32.load (local.get $%s))", slot)))
+	}
+	out.WriteString(fmt.Sprintf("(%s.store (local.get $%s) (local.get $%s))\n", valueType(mt.Elem), slot, v))
+	out.WriteString(release)
+	return out.String()
+}
+
+// generateIndexAssignment stores a value in an element of a list or under
+// a key of a map.
+func (m *module) generateIndexAssignment(e *ast.IndexAssignment) string {
+	values, release := m.generateArguments([]ast.Expression{e.Left.Left})
+	ptr := m.generateTemp("i32")
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("(local.set $%s %s)\n", ptr, values[0]))
+	switch t := m.typeOf(e.Left.Left).(type) {
+	case *checker.Map:
+		out.WriteString(m.generateMapStore(ptr, t, e.Left.Index, e.Right))
+	case *checker.List:
+		m.runtime[listSlotFunc] = true
+		index := m.generateTemp("i32")
+		v := m.generateTemp(valueType(t.Elem))
+		slot := m.generateTemp("i32")
+		out.WriteString(fmt.Sprintf("(local.set $%s %s)\n", index, m.generateIndex(e.Left.Index)))
+		out.WriteString(fmt.Sprintf("(local.set $%s %s)\n", v, m.generateOwned(e.Right)))
+		out.WriteString(fmt.Sprintf("(local.set $%s (call $%s (local.get $%s) (local.get $%s)))\n",
+			slot, listSlotFunc, ptr, index))
+		if managed(t.Elem) {
+			out.WriteString(generateRelease(t.Elem, fmt.Sprintf("(i32.load (local.get $%s))", slot)))
+		}
+		out.WriteString(fmt.Sprintf("(%s.store (local.get $%s) (local.get $%s))\n", valueType(t.Elem), slot, v))
+	default:
+		m.unsupported(e)
+		return ""
+	}
+	out.WriteString(release)
+	return out.String()
+}
+
+// generateMapIndex reads the value of a key, or the zero value when the
+// key is not in the map.
+func (m *module) generateMapIndex(e *ast.IndexExpression, mt *checker.Map) string {
+	values, release := m.generateArguments([]ast.Expression{e.Left, e.Index})
+	entry := m.generateTemp("i32")
+	vt := valueType(mt.Elem)
+	found := fmt.Sprintf("(%s.load offset=16 (local.get $%s))", vt, entry)
+	// the value is retained in case the map it was read from is released
+	// along with its last reference, or since the new zero value of a
+	// missing key is owned alike
+	if (m.owned(e.Left) || allocatesZero(mt.Elem)) && managed(mt.Elem) {
+		found = fmt.Sprintf("(call $%s %s)", retainFunc, found)
+	}
+	value := fmt.Sprintf("(if (result %s) (local.tee $%s (call $%s %s %s))\n\t(then %s)\n\t(else %s))",
+		vt, entry, m.mapFunc(mapFindFunc, mt.Key), values[0], values[1], found, m.generateZero(mt.Elem))
+	return m.generateReleaseAfter(value, mt.Elem, release)
+}
+
+// generateMapCall lowers the builtins that work on maps, reporting whether
+// the call is to one of them.
+func (m *module) generateMapCall(call *ast.FunctionCall) (string, bool) {
+	var name string
+	switch {
+	case m.info.IsBuiltin(call, checker.BuiltinDelete) && len(call.Arguments) == 2:
+		name = mapDeleteFunc
+	case m.info.IsBuiltin(call, checker.BuiltinHas) && len(call.Arguments) == 2:
+		name = mapFindFunc
+	case m.info.IsBuiltin(call, checker.BuiltinKeys) && len(call.Arguments) == 1:
+		name = mapKeysFunc
+	default:
+		return "", false
+	}
+	mt, ok := m.typeOf(call.Arguments[0]).(*checker.Map)
+	if !ok {
+		m.unsupported(call)
+		return "", true
+	}
+	values, release := m.generateArguments(call.Arguments)
+	value := fmt.Sprintf("(call $%s %s)", m.mapFunc(name, mt.Key), strings.Join(values, " "))
+	switch name {
+	case mapDeleteFunc:
+		// the entry of the key keeps its value for the caller to release
+		if !managed(mt.Elem) {
+			return fmt.Sprintf("(drop %s)\n%s", value, release), true
+		}
+		entry := m.generateTemp("i32")
+		return fmt.Sprintf("(if (local.tee $%s %s)\n\t(then %s))\n%s", entry, value,
+			strings.TrimSuffix(generateRelease(mt.Elem, fmt.Sprintf("(i32.load offset=16 (local.get $%s))", entry)), "\n"), release), true
+	case mapFindFunc:
+		value = fmt.Sprintf("(i32.ne %s (i32.const 0))", value)
+	case mapKeysFunc:
+		m.runtime[listNewFunc] = true
+		m.runtime[listPushFunc] = true
+	}
+	return m.generateReleaseAfter(value, m.typeOf(call), release), true
+}
+
+// mapTypes returns the map types the program uses, ordered by name.
+func (m *module) mapTypes() []*checker.Map {
+	maps := make(map[string]*checker.Map)
+	var add func(t checker.Type)
+	add = func(t checker.Type) {
+		switch t := t.(type) {
+		case *checker.Map:
+			maps[mapName(t)] = t
+			add(t.Key)
+			add(t.Elem)
+		case *checker.List:
+			add(t.Elem)
+		}
+	}
+	for _, t := range m.info.Types {
+		add(t)
+	}
+	for _, sym := range m.info.Defs {
+		if sym != nil {
+			add(sym.Type)
+		}
+	}
+
+	names := make([]string, 0, len(maps))
+	for name := range maps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]*checker.Map, len(names))
+	for i, name := range names {
+		out[i] = maps[name]
+	}
+	return out
+}
+
+// generateMapReleases emits the release function of every map type, which
+// releases the keys and the values of a map along with it.
+func (m *module) generateMapReleases() string {
+	var out strings.Builder
+	for _, mt := range m.mapTypes() {
+		owns := managed(mt.Key) || managed(mt.Elem)
+		out.WriteString(fmt.Sprintf("\n(func $%s (param $ptr i32)\n", releaseName(mt)))
+		if owns {
+			out.WriteString("\t(local $i i32)\n\t(local $e i32)\n")
+		}
+		out.WriteString(fmt.Sprintf("\t(if (call $%s (local.get $ptr))\n\t\t(then\n", releaseFunc))
+		if owns {
+			var release strings.Builder
+			for _, field := range []struct {
+				t      checker.Type
+				offset int
+			}{{mt.Key, 8}, {mt.Elem, 16}} {
+				if managed(field.t) {
+					release.WriteString("\t\t\t\t\t\t\t" + generateRelease(field.t, fmt.Sprintf("(i32.load offset=%d (local.get $e))", field.offset)))
+				}
+			}
+			out.WriteString(fmt.Sprintf(`			(block $done
+				(loop $next
+					(br_if $done (i32.ge_u (local.get $i) (i32.load offset=4 (local.get $ptr))))
+					(local.set $e (i32.add (i32.load offset=12 (local.get $ptr)) (i32.mul (local.get $i) (i32.const %d))))
+					(if (i32.load (local.get $e))
+						(then
+%s					))
+					(local.set $i (i32.add (local.get $i) (i32.const 1)))
+					(br $next)))
+`, mapEntry, release.String()))
+		}
+		out.WriteString(fmt.Sprintf("\t\t\t(call $%s (i32.load offset=12 (local.get $ptr)))\n", MemoryDeallocateFunc))
+		out.WriteString(fmt.Sprintf("\t\t\t(call $%s (i32.load offset=16 (local.get $ptr)))\n", MemoryDeallocateFunc))
+		out.WriteString(fmt.Sprintf("\t\t\t(call $%s (local.get $ptr))))\n)\n", MemoryDeallocateFunc))
+	}
+	return out.String()
+}
+
+// generateMapFunctions emits the map runtime functions the module calls.
+// It is called before the string and list functions since the map
+// functions call some of them.
+func (m *module) generateMapFunctions() string {
+	// the functions that work on keys call each other
+	for _, kind := range mapKeyKinds {
+		if m.runtime[mapInsertFunc+"_"+kind] {
+			m.runtime[mapFindFunc+"_"+kind] = true
+			m.runtime[mapGrowFunc+"_"+kind] = true
+			m.runtime[mapPlaceFunc] = true
+		}
+		if m.runtime[mapDeleteFunc+"_"+kind] {
+			m.runtime[mapFindFunc+"_"+kind] = true
+		}
+		if m.runtime[mapFindFunc+"_"+kind] || m.runtime[mapGrowFunc+"_"+kind] {
+			m.runtime[mapHashFunc+"_"+kind] = true
+		}
+		if kind == "i64" && m.runtime[mapHashFunc+"_"+kind] {
+			m.runtime[mapHashFunc+"_i32"] = true
+		}
+		if kind == "str" && m.runtime[mapFindFunc+"_"+kind] {
+			m.runtime[strCompareFunc] = true
+		}
+		if m.runtime[mapKeysFunc+"_"+kind] {
+			m.runtime[listNewFunc] = true
+			m.runtime[listPushFunc] = true
+		}
+	}
+
+	var out strings.Builder
+	if m.runtime[mapNewFunc] {
+		out.WriteString(fmt.Sprintf(`
+;; map_new allocates an empty map
+(func $%s (result i32)
+	(local $m i32)
+	(local.set $m (call $%s (i32.const %d)))
+	(i32.store offset=8 (local.get $m) (i32.const %d))
+	(i32.store offset=12 (local.get $m) (call $%[2]s (i32.const %[5]d)))
+	(i32.store offset=16 (local.get $m) (call $%[2]s (i32.const %[6]d)))
+	(local.get $m)
+)
+`, mapNewFunc, MemoryAllocateFunc, mapHeader, mapMinCap, mapMinCap*mapEntry, 2*mapMinCap*4))
+	}
+	if m.runtime[mapPlaceFunc] {
+		out.WriteString(fmt.Sprintf(`
+;; map_place puts the number of an entry in the first free slot of the
+;; index from the slot of a hash on
+(func $%s (param $m i32) (param $h i32) (param $n i32)
+	(local $mask i32)
+	(local $slot i32)
+	(local.set $mask (i32.sub (i32.shl (i32.load offset=8 (local.get $m)) (i32.const 1)) (i32.const 1)))
+	(local.set $h (i32.and (local.get $h) (local.get $mask)))
+	(block $found
+		(loop $probe
+			(local.set $slot (i32.add (i32.load offset=16 (local.get $m)) (i32.shl (local.get $h) (i32.const 2))))
+			(br_if $found (i32.eqz (i32.load (local.get $slot))))
+			(local.set $h (i32.and (i32.add (local.get $h) (i32.const 1)) (local.get $mask)))
+			(br $probe)))
+	(i32.store (local.get $slot) (local.get $n))
+)
+`, mapPlaceFunc))
+	}
+	for _, kind := range mapKeyKinds {
+		out.WriteString(m.generateMapKeyFunctions(kind))
+	}
+	return out.String()
+}
+
+// generateMapKeyFunctions emits the runtime functions the module calls for
+// a kind of key.
+func (m *module) generateMapKeyFunctions(kind string) string {
+	kt, load, eq := kind, "i32.load", "(i32.eq (i32.load offset=8 (local.get $e)) (local.get $key))"
+	key := "(local.get $key)"
+	switch kind {
+	case "i64":
+		load = "i64.load"
+		eq = "(i64.eq (i64.load offset=8 (local.get $e)) (local.get $key))"
+	case "str":
+		kt = "i32"
+		eq = fmt.Sprintf("(i32.eqz (call $%s (i32.load offset=8 (local.get $e)) (local.get $key)))", strCompareFunc)
+		key = fmt.Sprintf("(call $%s (local.get $key))", retainFunc)
+	}
+	name := func(f string) string { return f + "_" + kind }
+
+	var out strings.Builder
+	if m.runtime[name(mapHashFunc)] {
+		switch kind {
+		case "i32":
+			out.WriteString(fmt.Sprintf(`
+;; map_hash_i32 mixes the bits of a key so that keys that differ in their
+;; high bits land in different slots
+(func $%s (param $key i32) (result i32)
+	(local.set $key (i32.mul (local.get $key) (i32.const 0x9e3779b1)))
+	(i32.xor (local.get $key) (i32.shr_u (local.get $key) (i32.const 16)))
+)
+`, name(mapHashFunc)))
+		case "i64":
+			out.WriteString(fmt.Sprintf(`
+;; map_hash_i64 folds a key in two before mixing it like an i32
+(func $%s (param $key i64) (result i32)
+	(call $%s (i32.wrap_i64 (i64.xor (local.get $key) (i64.shr_u (local.get $key) (i64.const 32)))))
+)
+`, name(mapHashFunc), mapHashFunc+"_i32"))
+		case "str":
+			out.WriteString(fmt.Sprintf(`
+;; map_hash_str hashes the bytes of a string with FNV-1a
+(func $%s (param $key i32) (result i32)
+	(local $h i32)
+	(local $i i32)
+	(local.set $h (i32.const 0x811c9dc5))
+	(block $done
+		(loop $next
+			(br_if $done (i32.ge_u (local.get $i) (i32.load (local.get $key))))
+			(local.set $h (i32.mul
+				(i32.xor (local.get $h) (i32.load8_u offset=4 (i32.add (local.get $key) (local.get $i))))
+				(i32.const 0x01000193)))
+			(local.set $i (i32.add (local.get $i) (i32.const 1)))
+			(br $next)))
+	(local.get $h)
+)
+`, name(mapHashFunc)))
+		}
+	}
+	if m.runtime[name(mapFindFunc)] {
+		out.WriteString(fmt.Sprintf(`
+;; %[1]s returns the address of the entry of a key, or 0 when the key is
+;; not in the map
+(func $%[1]s (param $m i32) (param $key %[2]s) (result i32)
+	(local $mask i32)
+	(local $h i32)
+	(local $slot i32)
+	(local $e i32)
+	(local.set $mask (i32.sub (i32.shl (i32.load offset=8 (local.get $m)) (i32.const 1)) (i32.const 1)))
+	(local.set $h (i32.and (call $%[3]s (local.get $key)) (local.get $mask)))
+	(loop $probe
+		(local.set $slot (i32.load (i32.add (i32.load offset=16 (local.get $m)) (i32.shl (local.get $h) (i32.const 2)))))
+		(if (i32.eqz (local.get $slot)) (then (return (i32.const 0))))
+		(local.set $e (i32.add
+			(i32.load offset=12 (local.get $m))
+			(i32.mul (i32.sub (local.get $slot) (i32.const 1)) (i32.const %[4]d))))
+		(if (i32.load (local.get $e))
+			(then (if %[5]s (then (return (local.get $e))))))
+		(local.set $h (i32.and (i32.add (local.get $h) (i32.const 1)) (local.get $mask)))
+		(br $probe))
+	(unreachable)
+)
+`, name(mapFindFunc), kt, name(mapHashFunc), mapEntry, eq))
+	}
+	if m.runtime[name(mapGrowFunc)] {
+		out.WriteString(fmt.Sprintf(`
+;; %[1]s moves the live entries of a map to a new block, twice as large
+;; unless deleted entries make enough room, and rebuilds the index
+(func $%[1]s (param $m i32)
+	(local $old i32)
+	(local $used i32)
+	(local $cap i32)
+	(local $i i32)
+	(local $e i32)
+	(local $n i32)
+	(local.set $old (i32.load offset=12 (local.get $m)))
+	(local.set $used (i32.load offset=4 (local.get $m)))
+	(local.set $cap (i32.load offset=8 (local.get $m)))
+	(if (i32.ge_u (i32.shl (i32.load (local.get $m)) (i32.const 1)) (local.get $cap))
+		(then (local.set $cap (i32.shl (local.get $cap) (i32.const 1)))))
+	(i32.store offset=8 (local.get $m) (local.get $cap))
+	(i32.store offset=12 (local.get $m) (call $%[2]s (i32.mul (local.get $cap) (i32.const %[4]d))))
+	(call $%[3]s (i32.load offset=16 (local.get $m)))
+	(i32.store offset=16 (local.get $m) (call $%[2]s (i32.shl (local.get $cap) (i32.const 3))))
+	(block $done
+		(loop $next
+			(br_if $done (i32.ge_u (local.get $i) (local.get $used)))
+			(local.set $e (i32.add (local.get $old) (i32.mul (local.get $i) (i32.const %[4]d))))
+			(if (i32.load (local.get $e))
+				(then
+					(memory.copy
+						(i32.add (i32.load offset=12 (local.get $m)) (i32.mul (local.get $n) (i32.const %[4]d)))
+						(local.get $e)
+						(i32.const %[4]d))
+					(local.set $n (i32.add (local.get $n) (i32.const 1)))
+					(call $%[5]s (local.get $m) (call $%[6]s (%[7]s offset=8 (local.get $e))) (local.get $n))))
+			(local.set $i (i32.add (local.get $i) (i32.const 1)))
+			(br $next)))
+	(call $%[3]s (local.get $old))
+	(i32.store offset=4 (local.get $m) (local.get $n))
+)
+`, name(mapGrowFunc), MemoryAllocateFunc, MemoryDeallocateFunc, mapEntry, mapPlaceFunc, name(mapHashFunc), load))
+	}
+	if m.runtime[name(mapInsertFunc)] {
+		out.WriteString(fmt.Sprintf(`
+;; %[1]s returns the address of the value of a key, adding the key with a
+;; zero value when it is not in the map
+(func $%[1]s (param $m i32) (param $key %[2]s) (result i32)
+	(local $e i32)
+	(local.set $e (call $%[3]s (local.get $m) (local.get $key)))
+	(if (i32.eqz (local.get $e))
+		(then
+			(if (i32.eq (i32.load offset=4 (local.get $m)) (i32.load offset=8 (local.get $m)))
+				(then (call $%[4]s (local.get $m))))
+			(local.set $e (i32.add
+				(i32.load offset=12 (local.get $m))
+				(i32.mul (i32.load offset=4 (local.get $m)) (i32.const %[5]d))))
+			(i32.store (local.get $e) (i32.const 1))
+			(%[2]s.store offset=8 (local.get $e) %[6]s)
+			(i64.store offset=16 (local.get $e) (i64.const 0))
+			(i32.store offset=4 (local.get $m) (i32.add (i32.load offset=4 (local.get $m)) (i32.const 1)))
+			(i32.store (local.get $m) (i32.add (i32.load (local.get $m)) (i32.const 1)))
+			(call $%[7]s (local.get $m) (call $%[8]s (local.get $key)) (i32.load offset=4 (local.get $m)))))
+	(i32.add (local.get $e) (i32.const 16))
+)
+`, name(mapInsertFunc), kt, name(mapFindFunc), name(mapGrowFunc), mapEntry, key, mapPlaceFunc, name(mapHashFunc)))
+	}
+	if m.runtime[name(mapDeleteFunc)] {
+		release := ""
+		if kind == "str" {
+			release = "\n\t\t\t" + strings.TrimSuffix(generateRelease(checker.Typ[checker.Str], "(i32.load offset=8 (local.get $e))"), "\n")
+		}
+		out.WriteString(fmt.Sprintf(`
+;; %[1]s removes a key from a map and returns the address of its entry,
+;; whose value the caller releases, or 0 when the key is not in the map
+(func $%[1]s (param $m i32) (param $key %[2]s) (result i32)
+	(local $e i32)
+	(local.set $e (call $%[3]s (local.get $m) (local.get $key)))
+	(if (local.get $e)
+		(then
+			(i32.store (local.get $e) (i32.const 0))
+			(i32.store (local.get $m) (i32.sub (i32.load (local.get $m)) (i32.const 1)))%[4]s))
+	(local.get $e)
+)
+`, name(mapDeleteFunc), kt, name(mapFindFunc), release))
+	}
+	if m.runtime[name(mapKeysFunc)] {
+		value := fmt.Sprintf("(%s offset=8 (local.get $e))", load)
+		if kind == "str" {
+			value = fmt.Sprintf("(call $%s %s)", retainFunc, value)
+		}
+		out.WriteString(fmt.Sprintf(`
+;; %[1]s returns a list of the keys of a map in the order they were
+;; inserted
+(func $%[1]s (param $m i32) (result i32)
+	(local $l i32)
+	(local $i i32)
+	(local $e i32)
+	(local.set $l (call $%[2]s (i32.const %[3]d) (i32.load (local.get $m))))
+	(block $done
+		(loop $next
+			(br_if $done (i32.ge_u (local.get $i) (i32.load offset=4 (local.get $m))))
+			(local.set $e (i32.add (i32.load offset=12 (local.get $m)) (i32.mul (local.get $i) (i32.const %[4]d))))
+			(if (i32.load (local.get $e))
+				(then (%[5]s.store (call $%[6]s (local.get $l)) %[7]s)))
+			(local.set $i (i32.add (local.get $i) (i32.const 1)))
+			(br $next)))
+	(local.get $l)
+)
+`, name(mapKeysFunc), listNewFunc, elemSizeOfKind(kind), mapEntry, kt, listPushFunc, value))
+	}
+	return out.String()
+}
+
+// elemSizeOfKind returns the size of a kind of key in a list.
+func elemSizeOfKind(kind string) int {
+	if kind == "i64" {
+		return 8
+	}
+	return 4
+}
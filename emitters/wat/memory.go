@@ -0,0 +1,165 @@
+package wat
+
+import "fmt"
+
+// The heap starts after the string constants and is made of blocks that
+// begin with an 8 byte header:
+//
+//	offset 0: size of the block, header included
+//	offset 4: address of the next free block while the block is free and
+//	          its reference count while it is allocated
+//
+// Free blocks form a list ordered by address. memory_allocate takes the
+// first free block that is large enough, splitting off what is left when
+// it can hold another block. When no free block fits, a new block is carved
+// off the end of the heap and the memory grows if it has to. Allocating
+// traps when the memory cannot grow. memory_deallocate puts a block back on
+// the list and merges it with the free blocks next to it.
+
+const (
+	// blockHeader is the size of the header in front of every payload.
+	blockHeader = 8
+	// blockAlign is the alignment of every block and so of every payload.
+	blockAlign = 8
+	// minBlock is the smallest free block worth splitting off.
+	minBlock = blockHeader + blockAlign
+	// maxAllocation is the largest payload that can be requested.
+	maxAllocation = 0x7ffffff0
+)
+
+// heapStart returns the address of the first block, which follows the
+// string constants.
+func (m *module) heapStart() int {
+	return m.dataBase() + m.dataSize
+}
+
+func (m *module) generateMemoryManagementFunctions() string {
+	return fmt.Sprintf(`
+;; Declare a memory section, each page is 64KB
+(memory %[1]d)
+(export "memory" (memory 0))
+
+(global $heap_end (mut i32) (i32.const %[2]d))
+(global $free_list (mut i32) (i32.const 0))
+(global $live_blocks (mut i32) (i32.const 0))
+(global $used_bytes (mut i32) (i32.const 0))
+(global $free_bytes (mut i32) (i32.const 0))
+
+;; memory_allocate returns a zeroed payload of at least size bytes
+(func $%[3]s (export "%[3]s") (param $size i32) (result i32)
+	(local $prev i32)
+	(local $block i32)
+	(local $next i32)
+	(local $rest i32)
+	(if (i32.gt_u (local.get $size) (i32.const %[4]d)) (then (unreachable)))
+	(local.set $size (i32.and (i32.add (local.get $size) (i32.const %[5]d)) (i32.const %[6]d)))
+
+	;; take the first free block that fits
+	(local.set $block (global.get $free_list))
+	(block $carve
+		(loop $search
+			(br_if $carve (i32.eqz (local.get $block)))
+			(if (i32.ge_u (i32.load (local.get $block)) (local.get $size))
+				(then
+					(local.set $next (i32.load offset=4 (local.get $block)))
+					(local.set $rest (i32.sub (i32.load (local.get $block)) (local.get $size)))
+					(if (i32.ge_u (local.get $rest) (i32.const %[7]d))
+						(then
+							;; what is left takes the place of the block in the list
+							(i32.store (i32.add (local.get $block) (local.get $size)) (local.get $rest))
+							(i32.store offset=4 (i32.add (local.get $block) (local.get $size)) (local.get $next))
+							(local.set $next (i32.add (local.get $block) (local.get $size)))
+							(i32.store (local.get $block) (local.get $size)))
+						(else
+							(local.set $size (i32.load (local.get $block)))))
+					(if (local.get $prev)
+						(then (i32.store offset=4 (local.get $prev) (local.get $next)))
+						(else (global.set $free_list (local.get $next))))
+					(global.set $free_bytes (i32.sub (global.get $free_bytes) (local.get $size)))
+					(return (call $use_block (local.get $block)))))
+			(local.set $prev (local.get $block))
+			(local.set $block (i32.load offset=4 (local.get $block)))
+			(br $search)))
+
+	;; carve a new block off the end of the heap
+	(local.set $block (global.get $heap_end))
+	(local.set $next (i32.add (local.get $block) (local.get $size)))
+	(if (i32.lt_u (local.get $next) (local.get $block)) (then (unreachable)))
+	(if (i32.gt_u (local.get $next) (i32.shl (memory.size) (i32.const 16)))
+		(then
+			(if (i32.eq
+					(memory.grow (i32.shr_u
+						(i32.add (i32.sub (local.get $next) (i32.shl (memory.size) (i32.const 16))) (i32.const 0xffff))
+						(i32.const 16)))
+					(i32.const -1))
+				(then (unreachable)))))
+	(global.set $heap_end (local.get $next))
+	(i32.store (local.get $block) (local.get $size))
+	(call $use_block (local.get $block))
+)
+
+;; use_block counts a block as allocated and returns its zeroed payload,
+;; which has a single reference
+(func $use_block (param $block i32) (result i32)
+	(global.set $live_blocks (i32.add (global.get $live_blocks) (i32.const 1)))
+	(global.set $used_bytes (i32.add (global.get $used_bytes) (i32.load (local.get $block))))
+	(i32.store offset=4 (local.get $block) (i32.const 1))
+	(memory.fill
+		(i32.add (local.get $block) (i32.const %[8]d))
+		(i32.const 0)
+		(i32.sub (i32.load (local.get $block)) (i32.const %[8]d)))
+	(i32.add (local.get $block) (i32.const %[8]d))
+)
+
+;; memory_deallocate frees a payload returned by memory_allocate
+(func $%[9]s (export "%[9]s") (param $ptr i32)
+	(local $block i32)
+	(local $size i32)
+	(local $prev i32)
+	(local $next i32)
+	(if (i32.eqz (local.get $ptr)) (then (return)))
+	(local.set $block (i32.sub (local.get $ptr) (i32.const %[8]d)))
+	(local.set $size (i32.load (local.get $block)))
+	(global.set $live_blocks (i32.sub (global.get $live_blocks) (i32.const 1)))
+	(global.set $used_bytes (i32.sub (global.get $used_bytes) (local.get $size)))
+	(global.set $free_bytes (i32.add (global.get $free_bytes) (local.get $size)))
+
+	;; find the free blocks before and after the block
+	(local.set $next (global.get $free_list))
+	(block $found
+		(loop $search
+			(br_if $found (i32.eqz (local.get $next)))
+			(br_if $found (i32.gt_u (local.get $next) (local.get $block)))
+			(local.set $prev (local.get $next))
+			(local.set $next (i32.load offset=4 (local.get $next)))
+			(br $search)))
+
+	(if (i32.eq (i32.add (local.get $block) (local.get $size)) (local.get $next))
+		(then
+			(local.set $size (i32.add (local.get $size) (i32.load (local.get $next))))
+			(local.set $next (i32.load offset=4 (local.get $next)))))
+	(i32.store (local.get $block) (local.get $size))
+	(i32.store offset=4 (local.get $block) (local.get $next))
+
+	(if (i32.eqz (local.get $prev))
+		(then
+			(global.set $free_list (local.get $block))
+			(return)))
+	(if (i32.eq (i32.add (local.get $prev) (i32.load (local.get $prev))) (local.get $block))
+		(then
+			(i32.store (local.get $prev) (i32.add (i32.load (local.get $prev)) (local.get $size)))
+			(i32.store offset=4 (local.get $prev) (local.get $next)))
+		(else
+			(i32.store offset=4 (local.get $prev) (local.get $block))))
+)
+
+;; memory_stats returns the number of live allocations, the bytes they
+;; occupy and the bytes held by free blocks, headers included
+(func $%[10]s (export "%[10]s") (result i32 i32 i32)
+	(global.get $live_blocks)
+	(global.get $used_bytes)
+	(global.get $free_bytes)
+)
+`, m.opts.MemoryPages, m.heapStart(), MemoryAllocateFunc, maxAllocation,
+		blockHeader+blockAlign-1, -blockAlign, minBlock, blockHeader, MemoryDeallocateFunc, MemoryStatsFunc)
+}
@@ -0,0 +1,209 @@
+package wat
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/checker"
+	"github.com/dfirebaugh/punch/token"
+)
+
+// Numbers are represented by the smallest WAT value type that holds them.
+// u8, i8, u16 and i16 live in an i32 that is kept within their range by
+// masking unsigned values and sign extending signed ones after every
+// operation that can overflow.
+
+// valueType returns the WAT value type of a checked type.
+func valueType(t checker.Type) string {
+	switch checker.Default(t) {
+	case checker.Typ[checker.U64], checker.Typ[checker.I64]:
+		return "i64"
+	case checker.Typ[checker.F32]:
+		return "f32"
+	case checker.Typ[checker.F64]:
+		return "f64"
+	}
+	return "i32"
+}
+
+// typeOf returns the type of an expression with untyped constants defaulted.
+func (m *module) typeOf(expr ast.Expression) checker.Type {
+	return checker.Default(m.info.TypeOf(expr))
+}
+
+// wrap keeps the result of an operation on a sub-word integer within the
+// range of its type.
+func wrap(t checker.Type, value string) string {
+	switch t {
+	case checker.Typ[checker.U8]:
+		return fmt.Sprintf("(i32.and %s (i32.const 0xff))", value)
+	case checker.Typ[checker.U16]:
+		return fmt.Sprintf("(i32.and %s (i32.const 0xffff))", value)
+	case checker.Typ[checker.I8]:
+		return fmt.Sprintf("(i32.extend8_s %s)", value)
+	case checker.Typ[checker.I16]:
+		return fmt.Sprintf("(i32.extend16_s %s)", value)
+	}
+	return value
+}
+
+// wrapConstant truncates an integer constant to the width of its type.
+func wrapConstant(t checker.Type, v int64) int64 {
+	switch t {
+	case checker.Typ[checker.U8]:
+		return int64(uint8(v))
+	case checker.Typ[checker.U16]:
+		return int64(uint16(v))
+	case checker.Typ[checker.U32]:
+		return int64(uint32(v))
+	case checker.Typ[checker.I8]:
+		return int64(int8(v))
+	case checker.Typ[checker.I16]:
+		return int64(int16(v))
+	case checker.Typ[checker.I32]:
+		return int64(int32(v))
+	}
+	return v
+}
+
+func (m *module) generateIntegerLiteral(e *ast.IntegerLiteral) string {
+	t := m.typeOf(e)
+	if checker.IsFloat(t) {
+		return fmt.Sprintf("(%s.const %d)", valueType(t), e.Value)
+	}
+	return fmt.Sprintf("(%s.const %d)", valueType(t), wrapConstant(t, e.Value))
+}
+
+func (m *module) generateFloatLiteral(e *ast.FloatLiteral) string {
+	return fmt.Sprintf("(%s.const %s)", valueType(m.typeOf(e)), strconv.FormatFloat(e.Value, 'g', -1, 64))
+}
+
+// instructions maps operators to the instruction used for each kind of
+// operand. Operators that only exist for some kinds leave the others empty.
+var instructions = map[token.Type]struct{ signed, unsigned, float string }{
+	token.PLUS:      {"add", "add", "add"},
+	token.MINUS:     {"sub", "sub", "sub"},
+	token.ASTERISK:  {"mul", "mul", "mul"},
+	token.SLASH:     {"div_s", "div_u", "div"},
+	token.MOD:       {"rem_s", "rem_u", ""},
+	token.EQ:        {"eq", "eq", "eq"},
+	token.NOT_EQ:    {"ne", "ne", "ne"},
+	token.LT:        {"lt_s", "lt_u", "lt"},
+	token.GT:        {"gt_s", "gt_u", "gt"},
+	token.LT_EQUALS: {"le_s", "le_u", "le"},
+	token.GT_EQUALS: {"ge_s", "ge_u", "ge"},
+}
+
+// generateInfixExpression picks the instruction for an operator from the
+// type of its operands, which the checker has made identical.
+func (m *module) generateInfixExpression(infix *ast.InfixExpression) string {
+	switch infix.Operator.Type {
+	case token.AND, token.OR:
+		return m.generateLogicalExpression(infix)
+	}
+	if checker.IsString(m.typeOf(infix.Left)) {
+		return m.generateStringOperation(infix)
+	}
+
+	left := m.generateExpression(infix.Left)
+	right := m.generateExpression(infix.Right)
+
+	t := m.typeOf(infix.Left)
+	instr, ok := instructions[infix.Operator.Type]
+	if !ok {
+		m.operatorError(infix.Operator)
+		return ""
+	}
+	name := instr.signed
+	switch {
+	case checker.IsFloat(t):
+		name = instr.float
+	case checker.IsUnsigned(t):
+		name = instr.unsigned
+	}
+	if name == "" {
+		m.operatorError(infix.Operator)
+		return ""
+	}
+
+	out := fmt.Sprintf("(%s.%s %s %s)", valueType(t), name, left, right)
+	if name == "div_s" {
+		out = m.generateSignedDivision(t, left, right)
+	}
+	switch infix.Operator.Type {
+	case token.PLUS, token.MINUS, token.ASTERISK, token.SLASH, token.MOD:
+		return wrap(t, out)
+	}
+	return out
+}
+
+// generateSignedDivision divides two signed integers. Dividing the
+// smallest value by -1 traps in wasm, so a divisor of -1 negates the
+// dividend instead, which wraps the way the other operations do.
+func (m *module) generateSignedDivision(t checker.Type, left, right string) string {
+	vt := valueType(t)
+	dividend, divisor := m.generateTemp(vt), m.generateTemp(vt)
+	return fmt.Sprintf(`(block (result %[1]s)
+	(local.set $%[2]s %[4]s)
+	(if (result %[1]s) (%[1]s.eq (local.tee $%[3]s %[5]s) (%[1]s.const -1))
+		(then (%[1]s.sub (%[1]s.const 0) (local.get $%[2]s)))
+		(else (%[1]s.div_s (local.get $%[2]s) (local.get $%[3]s)))))`, vt, dividend, divisor, left, right)
+}
+
+func (m *module) generatePrefixExpression(prefix *ast.PrefixExpression) string {
+	operand := m.generateExpression(prefix.Right)
+	t := m.typeOf(prefix.Right)
+	switch prefix.Operator.Type {
+	case token.BANG:
+		return fmt.Sprintf("(i32.eqz %s)", operand)
+	case token.PLUS:
+		return operand
+	case token.MINUS:
+		if checker.IsFloat(t) {
+			return fmt.Sprintf("(%s.neg %s)", valueType(t), operand)
+		}
+		return wrap(t, fmt.Sprintf("(%s.sub (%s.const 0) %s)", valueType(t), valueType(t), operand))
+	default:
+		m.operatorError(prefix.Operator)
+		return ""
+	}
+}
+
+// generateNumericConversion converts a value between numeric types. Floats
+// are truncated toward zero and saturate at the bounds of the integer type
+// instead of trapping.
+func (m *module) generateNumericConversion(call *ast.FunctionCall, to checker.Type) string {
+	arg := call.Arguments[0]
+	value := m.generateExpression(arg)
+	from := m.typeOf(arg)
+	fromType, toType := valueType(from), valueType(to)
+	sign := "_s"
+	if checker.IsUnsigned(from) {
+		sign = "_u"
+	}
+
+	switch {
+	case fromType == toType:
+	case fromType == "i32" && toType == "i64":
+		value = fmt.Sprintf("(i64.extend_i32%s %s)", sign, value)
+	case fromType == "i64" && toType == "i32":
+		value = fmt.Sprintf("(i32.wrap_i64 %s)", value)
+	case fromType == "f32" && toType == "f64":
+		value = fmt.Sprintf("(f64.promote_f32 %s)", value)
+	case fromType == "f64" && toType == "f32":
+		value = fmt.Sprintf("(f32.demote_f64 %s)", value)
+	case checker.IsFloat(to):
+		value = fmt.Sprintf("(%s.convert_%s%s %s)", toType, fromType, sign, value)
+	default:
+		sign = "_s"
+		if checker.IsUnsigned(to) {
+			sign = "_u"
+		}
+		value = fmt.Sprintf("(%s.trunc_sat_%s%s %s)", toType, fromType, sign, value)
+	}
+	if from == to {
+		return value
+	}
+	return wrap(to, value)
+}
@@ -0,0 +1,285 @@
+package wat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/checker"
+)
+
+// Strings, structs, lists, maps, interface boxes, closures and the boxes of
+// captured variables live on the heap and are reference
+// counted. The second word of a block's header counts the references to
+// it, starting at one when the block is allocated.
+//
+// An expression of a managed type either yields a reference that the code
+// around it owns, such as a new struct or the result of a call, or borrows
+// one, such as the value of a variable. Variables and parameters own their
+// values: assigning to one releases the value it held, and every exit from
+// a function releases them all. Calls borrow their arguments, so owned
+// arguments are released once the call returns. When its last reference
+// is released a value releases the values it refers to and is freed.
+// Values that refer to each other in a cycle are never freed.
+
+const (
+	retainFunc  = "retain"
+	releaseFunc = "release"
+)
+
+// owner is a local that owns a reference.
+type owner struct {
+	name string
+	t    checker.Type
+}
+
+// managed reports whether values of a type are reference counted.
+func managed(t checker.Type) bool {
+	switch t.(type) {
+	case *checker.Struct, *checker.Interface, *checker.List, *checker.Map, *checker.Signature, *box:
+		return true
+	}
+	return checker.IsString(t)
+}
+
+// releaseName returns the name of the function that releases a reference
+// to a value of a managed type.
+func releaseName(t checker.Type) string {
+	if checker.IsString(t) {
+		return releaseFunc + "_str"
+	}
+	switch t := t.(type) {
+	case *checker.List:
+		return releaseFunc + "_" + listName(t)
+	case *checker.Map:
+		return releaseFunc + "_" + mapName(t)
+	case *checker.Signature:
+		return releaseClosureFunc
+	case *box:
+		// boxes of values that are not managed are released alike
+		if !managed(t.elem) {
+			return releaseBoxFunc
+		}
+		return releaseBoxFunc + strings.TrimPrefix(releaseName(t.elem), releaseFunc)
+	}
+	return releaseFunc + "_" + t.String()
+}
+
+// heapType returns the type of the value an expression is generated to,
+// which is the interface for a struct that is converted to one.
+func (m *module) heapType(expr ast.Expression) checker.Type {
+	if iface, ok := m.info.Conversions[expr]; ok {
+		return iface
+	}
+	return m.typeOf(expr)
+}
+
+// owned reports whether the code around an expression owns the reference
+// it yields.
+func (m *module) owned(expr ast.Expression) bool {
+	if _, ok := m.evaluated[expr]; ok {
+		return false
+	}
+	if _, ok := m.info.Conversions[expr]; ok {
+		return true
+	}
+	return m.ownedValue(expr)
+}
+
+// ownedValue reports whether the code around an expression owns the
+// reference it yields before it is converted to an interface.
+func (m *module) ownedValue(expr ast.Expression) bool {
+	if !managed(m.typeOf(expr)) {
+		return false
+	}
+	switch e := expr.(type) {
+	case *ast.StructLiteral, *ast.ListLiteral, *ast.HashLiteral, *ast.FunctionCall, *ast.InfixExpression, *ast.SliceExpression:
+		return true
+	case *ast.FunctionLiteral:
+		return len(m.info.Captures[e]) > 0
+	case *ast.StructFieldAccess:
+		return m.owned(e.Left)
+	case *ast.IndexExpression:
+		if mt, ok := m.typeOf(e.Left).(*checker.Map); ok && allocatesZero(mt.Elem) {
+			return true
+		}
+		return m.owned(e.Left)
+	}
+	return false
+}
+
+// generateOwned returns the value of an expression as a reference that
+// the code around it owns.
+func (m *module) generateOwned(expr ast.Expression) string {
+	value := m.generateExpression(expr)
+	if managed(m.heapType(expr)) && !m.owned(expr) {
+		return fmt.Sprintf("(call $%s %s)", retainFunc, value)
+	}
+	return value
+}
+
+func generateRelease(t checker.Type, value string) string {
+	return fmt.Sprintf("(call $%s %s)\n", releaseName(t), value)
+}
+
+// generateArguments returns the values of the arguments of a call along
+// with the code that releases the ones the call only borrows.
+func (m *module) generateArguments(args []ast.Expression) ([]string, string) {
+	values := make([]string, len(args))
+	var release strings.Builder
+	for i, arg := range args {
+		values[i] = m.generateExpression(arg)
+		if m.owned(arg) {
+			temp := m.generateTemp("i32")
+			values[i] = fmt.Sprintf("(local.tee $%s %s)", temp, values[i])
+			release.WriteString(generateRelease(m.heapType(arg), fmt.Sprintf("(local.get $%s)", temp)))
+		}
+	}
+	return values, release.String()
+}
+
+// generatePop pops the values of a tuple off the stack into temporaries,
+// returning the code that does so and the temporaries in order.
+func (m *module) generatePop(tuple *checker.Tuple) (string, []string) {
+	temps := make([]string, len(tuple.Types))
+	for i, t := range tuple.Types {
+		temps[i] = m.generateTemp(valueType(t))
+	}
+	var out strings.Builder
+	for i := len(temps) - 1; i >= 0; i-- {
+		out.WriteString(fmt.Sprintf("(local.set $%s)\n", temps[i]))
+	}
+	return out.String(), temps
+}
+
+// generateReleaseAfter runs release after the code that computes a value
+// of type t and keeps the value on the stack.
+func (m *module) generateReleaseAfter(value string, t checker.Type, release string) string {
+	if release == "" {
+		return value
+	}
+	if t == nil || checker.IsVoid(t) {
+		return value + release
+	}
+	if tuple, ok := t.(*checker.Tuple); ok {
+		pop, temps := m.generatePop(tuple)
+		var out strings.Builder
+		out.WriteString(value + "\n" + pop + release)
+		for _, temp := range temps {
+			out.WriteString(fmt.Sprintf("(local.get $%s)\n", temp))
+		}
+		return out.String()
+	}
+	temp := m.generateTemp(valueType(t))
+	return fmt.Sprintf("(local.set $%s %s)\n%s(local.get $%s)", temp, value, release, temp)
+}
+
+// generateAssignment stores an owned reference in a local and releases the
+// reference the local held.
+func (m *module) generateAssignment(name string, t checker.Type, value string) string {
+	temp := m.generateTemp("i32")
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("(local.set $%s %s)\n", temp, value))
+	out.WriteString(generateRelease(t, fmt.Sprintf("(local.get $%s)", name)))
+	out.WriteString(fmt.Sprintf("(local.set $%s (local.get $%s))\n", name, temp))
+	return out.String()
+}
+
+// generateReleaseOwners releases the references held by the locals of the
+// function being generated.
+func (m *module) generateReleaseOwners() string {
+	var out strings.Builder
+	for _, o := range m.owners {
+		out.WriteString(generateRelease(o.t, fmt.Sprintf("(local.get $%s)", o.name)))
+	}
+	return out.String()
+}
+
+// generateDiscard drops the value of an expression statement.
+func (m *module) generateDiscard(expr ast.Expression, value string) string {
+	t := m.heapType(expr)
+	if tuple, ok := t.(*checker.Tuple); ok {
+		// the values of a call are owned
+		pop, temps := m.generatePop(tuple)
+		var out strings.Builder
+		out.WriteString(value + "\n" + pop)
+		for i, temp := range temps {
+			if managed(tuple.Types[i]) {
+				out.WriteString(generateRelease(tuple.Types[i], fmt.Sprintf("(local.get $%s)", temp)))
+			}
+		}
+		return out.String()
+	}
+	switch {
+	case t == nil || checker.IsVoid(t):
+		return value
+	case m.owned(expr):
+		return generateRelease(t, value)
+	}
+	return fmt.Sprintf("(drop %s)\n", value)
+}
+
+// generateReferenceCounting emits retain, the release function of every
+// managed type and the function type vtables use to release a struct.
+func (m *module) generateReferenceCounting() string {
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf(`
+;; retain adds a reference to a value and returns it
+(func $%[1]s (param $ptr i32) (result i32)
+	(if (local.get $ptr)
+		(then
+			(i32.store (i32.sub (local.get $ptr) (i32.const 4))
+				(i32.add (i32.load (i32.sub (local.get $ptr) (i32.const 4))) (i32.const 1)))))
+	(local.get $ptr)
+)
+
+;; release removes a reference to a value and reports whether it was the
+;; last one, in which case the caller frees the value
+(func $%[2]s (param $ptr i32) (result i32)
+	(if (i32.eqz (local.get $ptr)) (then (return (i32.const 0))))
+	(i32.store (i32.sub (local.get $ptr) (i32.const 4))
+		(i32.sub (i32.load (i32.sub (local.get $ptr) (i32.const 4))) (i32.const 1)))
+	(i32.eqz (i32.load (i32.sub (local.get $ptr) (i32.const 4))))
+)
+
+(type $%[2]s (func (param i32)))
+
+(func $%[3]s (param $ptr i32)
+	(if (call $%[2]s (local.get $ptr))
+		(then (call $%[4]s (local.get $ptr))))
+)
+`, retainFunc, releaseFunc, releaseName(checker.Typ[checker.Str]), MemoryDeallocateFunc))
+
+	for _, s := range m.structOrder {
+		out.WriteString(fmt.Sprintf("\n(func $%s (param $ptr i32)\n", releaseName(s)))
+		out.WriteString(fmt.Sprintf("\t(if (call $%s (local.get $ptr))\n\t\t(then\n", releaseFunc))
+		for i, field := range s.Fields {
+			if managed(field.Type) {
+				out.WriteString("\t\t\t" + generateRelease(field.Type, fmt.Sprintf("(i32.load offset=%d (local.get $ptr))", m.layouts[s].offsets[i])))
+			}
+		}
+		out.WriteString(fmt.Sprintf("\t\t\t(call $%s (local.get $ptr))))\n)\n", MemoryDeallocateFunc))
+	}
+	out.WriteString(m.generateListReleases())
+	out.WriteString(m.generateMapReleases())
+
+	// a box releases its struct with the function its vtable names. Boxes
+	// of interfaces no struct satisfies are never created.
+	for _, iface := range m.interfaceOrder {
+		if !m.boxed[iface] {
+			out.WriteString(fmt.Sprintf("\n(func $%s (param $box i32))\n", releaseName(iface)))
+			continue
+		}
+		out.WriteString(fmt.Sprintf(`
+(func $%s (param $box i32)
+	(if (call $%s (local.get $box))
+		(then
+			(call_indirect (type $%s)
+				(i32.load offset=4 (local.get $box))
+				(i32.load (i32.load (local.get $box))))
+			(call $%s (local.get $box))))
+)
+`, releaseName(iface), releaseFunc, releaseFunc, MemoryDeallocateFunc))
+	}
+	return out.String()
+}
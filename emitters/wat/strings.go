@@ -0,0 +1,251 @@
+package wat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/checker"
+	"github.com/dfirebaugh/punch/token"
+)
+
+// A string is a pointer to its length in bytes followed by its UTF-8
+// bytes. len, indexing, slicing and comparison work on the bytes.
+//
+// String constants are placed once in the data after the vtables. Each
+// gets a block header like the ones the allocator writes, holding a
+// reference that is never released, so constants are retained and
+// released like any other string and never freed.
+
+// The runtime functions strings are lowered to. A module only includes the
+// ones it calls.
+const (
+	strNewFunc     = "str_new"
+	strConcatFunc  = "str_concat"
+	strCompareFunc = "str_compare"
+	strIndexFunc   = "str_index"
+	strSliceFunc   = "str_slice"
+)
+
+// panicFunc is the host function that stops the program with the string
+// it is passed as the error.
+const panicFunc = "panic"
+
+// dataBase returns the address of the first string constant. Address 0 is
+// never used so that it can stand for a null pointer.
+func (m *module) dataBase() int {
+	start := max(m.heapBase, vtableBase)
+	return (start + blockAlign - 1) &^ (blockAlign - 1)
+}
+
+// stringConstant returns the address of a string constant, placing it in
+// the data the first time it is used.
+func (m *module) stringConstant(value string) int {
+	if addr, ok := m.strings[value]; ok {
+		return addr
+	}
+	addr := m.dataBase() + m.dataSize + blockHeader
+	m.strings[value] = addr
+	m.stringOrder = append(m.stringOrder, value)
+	size := blockHeader + 4 + len(value)
+	m.dataSize += (size + blockAlign - 1) &^ (blockAlign - 1)
+	return addr
+}
+
+// generateStringData emits the string constants.
+func (m *module) generateStringData() string {
+	var out strings.Builder
+	for _, value := range m.stringOrder {
+		addr := m.strings[value]
+		size := (blockHeader + 4 + len(value) + blockAlign - 1) &^ (blockAlign - 1)
+		var data strings.Builder
+		for _, word := range []int{size, 1, len(value)} {
+			for i := 0; i < 4; i++ {
+				data.WriteString(fmt.Sprintf("\\%02x", byte(word>>(8*i))))
+			}
+		}
+		for i := 0; i < len(value); i++ {
+			data.WriteString(fmt.Sprintf("\\%02x", value[i]))
+		}
+		out.WriteString(fmt.Sprintf("(data (i32.const %d) \"%s\") ;; %q\n", addr-blockHeader, data.String(), value))
+	}
+	return out.String()
+}
+
+func (m *module) generateStringLiteral(str *ast.StringLiteral) string {
+	return fmt.Sprintf("(i32.const %d)", m.stringConstant(str.Value))
+}
+
+// generateStringCall calls a string runtime function with the values of
+// some expressions, releasing the ones it is passed ownership of after it
+// returns.
+func (m *module) generateStringCall(name string, t checker.Type, args ...ast.Expression) string {
+	m.runtime[name] = true
+	values, release := m.generateArguments(args)
+	call := fmt.Sprintf("(call $%s %s)", name, strings.Join(values, " "))
+	return m.generateReleaseAfter(call, t, release)
+}
+
+// generateStringOperation lowers + to concatenation and compares strings
+// by their bytes.
+func (m *module) generateStringOperation(infix *ast.InfixExpression) string {
+	if infix.Operator.Type == token.PLUS {
+		return m.generateStringCall(strConcatFunc, checker.Typ[checker.Str], infix.Left, infix.Right)
+	}
+	if !isComparison(infix.Operator.Type) {
+		m.operatorError(infix.Operator)
+		return ""
+	}
+	compare := m.generateStringCall(strCompareFunc, checker.Typ[checker.I32], infix.Left, infix.Right)
+	return fmt.Sprintf("(i32.%s %s (i32.const 0))", instructions[infix.Operator.Type].signed, compare)
+}
+
+func isComparison(t token.Type) bool {
+	switch t {
+	case token.EQ, token.NOT_EQ, token.LT, token.GT, token.LT_EQUALS, token.GT_EQUALS:
+		return true
+	}
+	return false
+}
+
+func (m *module) generateIndexExpression(e *ast.IndexExpression) string {
+	if list, ok := m.typeOf(e.Left).(*checker.List); ok {
+		return m.generateListIndex(e, list)
+	}
+	if mt, ok := m.typeOf(e.Left).(*checker.Map); ok {
+		return m.generateMapIndex(e, mt)
+	}
+	if !checker.IsString(m.typeOf(e.Left)) {
+		m.unsupported(e)
+		return ""
+	}
+	return m.generateStringCall(strIndexFunc, m.typeOf(e), e.Left, e.Index)
+}
+
+func (m *module) generateSliceExpression(e *ast.SliceExpression) string {
+	m.runtime[strSliceFunc] = true
+	values, release := m.generateArguments([]ast.Expression{e.Left})
+	// the string is read again for its length when the slice runs to its end
+	temp := m.generateTemp("i32")
+	low, high := "(i32.const 0)", fmt.Sprintf("(i32.load (local.get $%s))", temp)
+	if e.Low != nil {
+		low = m.generateExpression(e.Low)
+	}
+	if e.High != nil {
+		high = m.generateExpression(e.High)
+	}
+	call := fmt.Sprintf("(call $%s (local.tee $%s %s) %s %s)", strSliceFunc, temp, values[0], low, high)
+	return m.generateReleaseAfter(call, m.typeOf(e), release)
+}
+
+// generateLen returns the length of a string, a list or a map, which all
+// keep it in their first word.
+func (m *module) generateLen(call *ast.FunctionCall) string {
+	arg := call.Arguments[0]
+	switch m.typeOf(arg).(type) {
+	case *checker.List, *checker.Map:
+	default:
+		if !checker.IsString(m.typeOf(arg)) {
+			m.unsupported(call)
+			return ""
+		}
+	}
+	values, release := m.generateArguments(call.Arguments)
+	return m.generateReleaseAfter(fmt.Sprintf("(i32.load %s)", values[0]), m.typeOf(call), release)
+}
+
+// generateStringFunctions emits the string runtime functions the module
+// calls. It is called before the imports and the data are generated since
+// the functions can import panic and add constants.
+func (m *module) generateStringFunctions() string {
+	var out strings.Builder
+	if m.runtime[strConcatFunc] || m.runtime[strSliceFunc] {
+		out.WriteString(fmt.Sprintf(`
+;; str_new allocates a string of len bytes
+(func $%s (param $len i32) (result i32)
+	(local $s i32)
+	(local.set $s (call $%s (i32.add (local.get $len) (i32.const 4))))
+	(i32.store (local.get $s) (local.get $len))
+	(local.get $s)
+)
+`, strNewFunc, MemoryAllocateFunc))
+	}
+	if m.runtime[strConcatFunc] {
+		out.WriteString(fmt.Sprintf(`
+(func $%s (param $a i32) (param $b i32) (result i32)
+	(local $s i32)
+	(local.set $s (call $%s (i32.add (i32.load (local.get $a)) (i32.load (local.get $b)))))
+	(memory.copy
+		(i32.add (local.get $s) (i32.const 4))
+		(i32.add (local.get $a) (i32.const 4))
+		(i32.load (local.get $a)))
+	(memory.copy
+		(i32.add (i32.add (local.get $s) (i32.const 4)) (i32.load (local.get $a)))
+		(i32.add (local.get $b) (i32.const 4))
+		(i32.load (local.get $b)))
+	(local.get $s)
+)
+`, strConcatFunc, strNewFunc))
+	}
+	if m.runtime[strCompareFunc] {
+		out.WriteString(fmt.Sprintf(`
+;; str_compare returns -1, 0 or 1 when a sorts before, the same as or
+;; after b
+(func $%s (param $a i32) (param $b i32) (result i32)
+	(local $i i32)
+	(local $n i32)
+	(local $x i32)
+	(local $y i32)
+	(local.set $n (select
+		(i32.load (local.get $a))
+		(i32.load (local.get $b))
+		(i32.lt_u (i32.load (local.get $a)) (i32.load (local.get $b)))))
+	(block $done
+		(loop $next
+			(br_if $done (i32.ge_u (local.get $i) (local.get $n)))
+			(local.set $x (i32.load8_u offset=4 (i32.add (local.get $a) (local.get $i))))
+			(local.set $y (i32.load8_u offset=4 (i32.add (local.get $b) (local.get $i))))
+			(if (i32.ne (local.get $x) (local.get $y))
+				(then (return (select (i32.const -1) (i32.const 1) (i32.lt_u (local.get $x) (local.get $y))))))
+			(local.set $i (i32.add (local.get $i) (i32.const 1)))
+			(br $next)))
+	(i32.sub
+		(i32.gt_u (i32.load (local.get $a)) (i32.load (local.get $b)))
+		(i32.lt_u (i32.load (local.get $a)) (i32.load (local.get $b))))
+)
+`, strCompareFunc))
+	}
+	if m.runtime[strIndexFunc] {
+		m.imports[panicFunc] = true
+		out.WriteString(fmt.Sprintf(`
+(func $%s (param $s i32) (param $i i32) (result i32)
+	(if (i32.ge_u (local.get $i) (i32.load (local.get $s)))
+		(then
+			(call $%s (i32.const %d))
+			(unreachable)))
+	(i32.load8_u offset=4 (i32.add (local.get $s) (local.get $i)))
+)
+`, strIndexFunc, panicFunc, m.stringConstant("index out of range")))
+	}
+	if m.runtime[strSliceFunc] {
+		m.imports[panicFunc] = true
+		out.WriteString(fmt.Sprintf(`
+(func $%s (param $s i32) (param $low i32) (param $high i32) (result i32)
+	(local $r i32)
+	(if (i32.or
+			(i32.gt_u (local.get $high) (i32.load (local.get $s)))
+			(i32.gt_u (local.get $low) (local.get $high)))
+		(then
+			(call $%s (i32.const %d))
+			(unreachable)))
+	(local.set $r (call $%s (i32.sub (local.get $high) (local.get $low))))
+	(memory.copy
+		(i32.add (local.get $r) (i32.const 4))
+		(i32.add (i32.add (local.get $s) (i32.const 4)) (local.get $low))
+		(i32.sub (local.get $high) (local.get $low)))
+	(local.get $r)
+)
+`, strSliceFunc, panicFunc, m.stringConstant("slice bounds out of range"), strNewFunc))
+	}
+	return out.String()
+}
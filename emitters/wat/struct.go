@@ -0,0 +1,177 @@
+package wat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/checker"
+)
+
+// A struct is a pointer to its fields, which are laid out in the order
+// they are declared. Each field is as wide as its type and aligned to its
+// width, so i64 and f64 fields are aligned to 8 bytes. Strings, lists,
+// interfaces and nested structs are stored as pointers.
+
+// structLayout is where the fields of a struct are stored.
+type structLayout struct {
+	// offsets holds the offset of each field in declaration order
+	offsets []int
+	size    int
+}
+
+// offset returns the offset of a field.
+func (l *structLayout) offset(s *checker.Struct, name string) int {
+	for i, field := range s.Fields {
+		if field.Name == name {
+			return l.offsets[i]
+		}
+	}
+	return 0
+}
+
+// fieldWidth returns the number of bytes a field of a type takes.
+func fieldWidth(t checker.Type) int {
+	switch t {
+	case checker.Typ[checker.U8], checker.Typ[checker.I8], checker.Typ[checker.Bool]:
+		return 1
+	case checker.Typ[checker.U16], checker.Typ[checker.I16]:
+		return 2
+	}
+	return elemSize(t)
+}
+
+// layoutStruct lays out the fields of a struct definition.
+func layoutStruct(s *checker.Struct) *structLayout {
+	l := &structLayout{offsets: make([]int, len(s.Fields))}
+	align := 1
+	for i, field := range s.Fields {
+		width := fieldWidth(field.Type)
+		l.size = (l.size + width - 1) &^ (width - 1)
+		l.offsets[i] = l.size
+		l.size += width
+		align = max(align, width)
+	}
+	l.size = (l.size + align - 1) &^ (align - 1)
+	return l
+}
+
+// loadOp returns the instruction that loads a field of a type.
+func loadOp(t checker.Type) string {
+	switch t {
+	case checker.Typ[checker.I8]:
+		return "i32.load8_s"
+	case checker.Typ[checker.U8], checker.Typ[checker.Bool]:
+		return "i32.load8_u"
+	case checker.Typ[checker.I16]:
+		return "i32.load16_s"
+	case checker.Typ[checker.U16]:
+		return "i32.load16_u"
+	}
+	return valueType(t) + ".load"
+}
+
+// storeOp returns the instruction that stores a field of a type.
+func storeOp(t checker.Type) string {
+	switch fieldWidth(t) {
+	case 1:
+		return "i32.store8"
+	case 2:
+		return "i32.store16"
+	}
+	return valueType(t) + ".store"
+}
+
+func (m *module) generateStructLiteral(lit *ast.StructLiteral) string {
+	s, ok := m.typeOf(lit).(*checker.Struct)
+	if !ok {
+		m.errorf(lit, "undefined struct %s", lit.StructName.Value)
+		return ""
+	}
+	layout := m.layouts[s]
+
+	var out strings.Builder
+	ptr := m.generateTemp("i32")
+	out.WriteString(fmt.Sprintf("(local.set $%s (call $%s (i32.const %d)))\n", ptr, MemoryAllocateFunc, layout.size))
+
+	// the struct owns the values of its fields
+	for i, field := range s.Fields {
+		fieldValue, ok := lit.Fields[field.Name]
+		if !ok {
+			m.errorf(lit, "missing value for field %s of %s", field.Name, s.Name)
+			continue
+		}
+		out.WriteString(fmt.Sprintf("(%s offset=%d (local.get $%s) %s)\n",
+			storeOp(field.Type), layout.offsets[i], ptr, m.generateOwned(fieldValue)))
+	}
+
+	out.WriteString(fmt.Sprintf("(local.get $%s)\n", ptr))
+	return out.String()
+}
+
+// structField returns the struct a field access reads from along with the
+// type and the offset of the field.
+func (m *module) structField(access *ast.StructFieldAccess) (checker.Type, int, bool) {
+	s, ok := m.typeOf(access.Left).(*checker.Struct)
+	if !ok {
+		m.errorf(access.Left, "undefined struct %s", m.typeOf(access.Left))
+		return nil, 0, false
+	}
+	field, ok := s.Field(access.Field.Value)
+	if !ok {
+		m.errorf(access, "undefined field %s of %s", access.Field.Value, s.Name)
+		return nil, 0, false
+	}
+	return field.Type, m.layouts[s].offset(s, field.Name), true
+}
+
+func (m *module) generateStructFieldAccess(access *ast.StructFieldAccess) string {
+	// enum variants are lowered to their value
+	if variant, ok := m.info.EnumVariant(access); ok {
+		return fmt.Sprintf("(i32.const %d)", variant.Value)
+	}
+
+	t, offset, ok := m.structField(access)
+	if !ok {
+		return ""
+	}
+	load := loadOp(t)
+	left := m.generateExpression(access.Left)
+	if !m.owned(access.Left) {
+		return fmt.Sprintf("(%s offset=%d %s)\n", load, offset, left)
+	}
+
+	// the field is read before the struct is released, and retained in
+	// case that was the struct's last reference
+	ptr := m.generateTemp("i32")
+	value := fmt.Sprintf("(%s offset=%d (local.tee $%s %s))", load, offset, ptr, left)
+	if managed(t) {
+		value = fmt.Sprintf("(call $%s %s)", retainFunc, value)
+	}
+	return m.generateReleaseAfter(value, t, generateRelease(m.heapType(access.Left), fmt.Sprintf("(local.get $%s)", ptr)))
+}
+
+// generateStructFieldAssignment stores a value in a field. The struct is
+// evaluated before the value, and a reference the field held is released
+// once the value is computed since the value may use it.
+func (m *module) generateStructFieldAssignment(assign *ast.StructFieldAssignment) string {
+	t, offset, ok := m.structField(assign.Left)
+	if !ok {
+		return ""
+	}
+	values, release := m.generateArguments([]ast.Expression{assign.Left.Left})
+	store := storeOp(t)
+	if !managed(t) {
+		return fmt.Sprintf("(%s offset=%d %s %s)\n", store, offset, values[0], m.generateExpression(assign.Right)) + release
+	}
+
+	ptr := m.generateTemp("i32")
+	value := m.generateTemp("i32")
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("(local.set $%s %s)\n", ptr, values[0]))
+	out.WriteString(fmt.Sprintf("(local.set $%s %s)\n", value, m.generateOwned(assign.Right)))
+	out.WriteString(generateRelease(t, fmt.Sprintf("(i32.load offset=%d (local.get $%s))", offset, ptr)))
+	out.WriteString(fmt.Sprintf("(i32.store offset=%d (local.get $%s) (local.get $%s))\n", offset, ptr, value))
+	out.WriteString(release)
+	return out.String()
+}
@@ -2,118 +2,163 @@ package wat
 
 import (
 	"fmt"
-	"log"
 	"strings"
 
 	"github.com/dfirebaugh/punch/ast"
-	"github.com/dfirebaugh/punch/token"
+	"github.com/dfirebaugh/punch/checker"
 )
 
 const (
 	MemoryAllocateFunc   = "memory_allocate"
 	MemoryDeallocateFunc = "memory_deallocate"
+	MemoryStatsFunc      = "memory_stats"
 )
 
-var (
-	functionDeclarations map[string]*ast.FunctionDeclaration
-	structDefinitions    map[string]*ast.StructDefinition
-)
+// entryFunc is the name of the function generated for the statements
+// outside of functions.
+const entryFunc = "_start"
 
-func findFunctionDeclarations(node ast.Node) {
+func (m *module) findFunctionDeclarations(node ast.Node) {
 	switch n := node.(type) {
 	case *ast.FunctionDeclaration:
-		functionDeclarations[n.Name.Value] = n
+		m.functionDeclarations[n.Name.Value] = n
 	case *ast.BlockStatement:
 		for _, stmt := range n.Statements {
-			findFunctionDeclarations(stmt)
+			m.findFunctionDeclarations(stmt)
 		}
 	case *ast.Program:
-		for _, stmt := range n.Files[0].Statements {
-			findFunctionDeclarations(stmt)
+		for _, file := range n.Files {
+			for _, stmt := range file.Statements {
+				m.findFunctionDeclarations(stmt)
+			}
 		}
 	}
 }
 
-func findStructDefinitions(node ast.Node) {
+func (m *module) findStructDefinitions(node ast.Node) {
 	switch n := node.(type) {
 	case *ast.StructDefinition:
-		structDefinitions[n.Name.Value] = n
+		m.structDefinitions[n.Name.Value] = n
 	case *ast.BlockStatement:
 		for _, stmt := range n.Statements {
-			findStructDefinitions(stmt)
+			m.findStructDefinitions(stmt)
 		}
 	case *ast.Program:
-		for _, stmt := range n.Files[0].Statements {
-			findStructDefinitions(stmt)
+		for _, file := range n.Files {
+			for _, stmt := range file.Statements {
+				m.findStructDefinitions(stmt)
+			}
 		}
 	}
 }
 
-func GenerateWAT(node ast.Node, withMemoryManagement bool) string {
-	functionDeclarations = make(map[string]*ast.FunctionDeclaration)
-	structDefinitions = make(map[string]*ast.StructDefinition)
-	findFunctionDeclarations(node)
-	findStructDefinitions(node)
-	switch n := node.(type) {
-	case *ast.Program:
-		return generateStatements(n.Files[0].Statements, withMemoryManagement)
-	}
-	return ""
+// hostFunctions are the functions a module imports, with the type of their
+// parameter. A module only imports the ones it calls. println is lowered to
+// the print functions for the type of each value: print_str prints the
+// string at an address in memory and print_char prints a single character,
+// which println uses for the spaces between its arguments and the newline
+// after them. panic stops the program with a string as the error.
+var hostFunctions = []struct{ name, param string }{
+	{"print_i32", "i32"},
+	{"print_i64", "i64"},
+	{"print_u64", "i64"},
+	{"print_f32", "f32"},
+	{"print_f64", "f64"},
+	{"print_bool", "i32"},
+	{"print_str", "i32"},
+	{"print_char", "i32"},
+	{panicFunc, "i32"},
 }
 
-func generateImports() string {
-	return `
-(import "imports" "println" (func $println (param i32)))
-`
+func (m *module) generateImports() string {
+	var out strings.Builder
+	out.WriteString("\n")
+	for _, fn := range hostFunctions {
+		if m.imports[fn.name] {
+			out.WriteString(fmt.Sprintf("(import %q %q (func $%s (param %s)))\n", m.opts.ImportModule, fn.name, fn.name, fn.param))
+		}
+	}
+	return out.String()
 }
 
-func generateMemoryManagementFunctions() string {
-	return `
-;; Declare a memory section with 1 page (64KB)
-(memory 1)
-(export "memory" (memory 0))
-
-;; Global variable to track the current memory allocation position
-(global $mem_alloc_ptr (mut i32) (i32.const 0))
-
-(func $memory_allocate (param $size i32) (result i32)
-	(local $ptr i32)
-	;; Call the function to find a free block
-	(local.set $ptr (call $find_free_block (local.get $size)))
-	;; Return the pointer
-	(local.get $ptr)
-)
-(func $memory_deallocate (param $ptr i32)
-    ;; Call the function to mark the block as free
-    (call $mark_block_free (local.get $ptr))
-)
-
-;; Function to find a free memory block
-(func $find_free_block (param $size i32) (result i32)
-  (local $ptr i32)
-
-  ;; Get the current allocation pointer
-  (local.set $ptr (global.get $mem_alloc_ptr))
-
-  ;; Update the allocation pointer (naive implementation, no checks for memory limits)
-  (global.set $mem_alloc_ptr (i32.add (global.get $mem_alloc_ptr) (local.get $size)))
+// generatePrintln prints the arguments of a println call separated by
+// spaces and followed by a newline. The arguments are all evaluated before
+// anything is printed.
+func (m *module) generatePrintln(call *ast.FunctionCall) string {
+	var out strings.Builder
+	var release strings.Builder
+	values := make([]string, len(call.Arguments))
+	for i, arg := range call.Arguments {
+		values[i] = m.generateExpression(arg)
+		if len(call.Arguments) > 1 || m.owned(arg) {
+			temp := m.generateTemp(valueType(m.typeOf(arg)))
+			out.WriteString(fmt.Sprintf("(local.set $%s %s)\n", temp, values[i]))
+			values[i] = fmt.Sprintf("(local.get $%s)", temp)
+			if m.owned(arg) {
+				release.WriteString(generateRelease(m.heapType(arg), values[i]))
+			}
+		}
+	}
+	for i, arg := range call.Arguments {
+		if i > 0 {
+			out.WriteString(m.generatePrintChar(' '))
+		}
+		out.WriteString(m.generatePrint(arg, values[i]))
+	}
+	out.WriteString(m.generatePrintChar('\n'))
+	out.WriteString(release.String())
+	return out.String()
+}
 
-  ;; Return the starting address of the allocated block
-  (local.get $ptr)
-)
+// generatePrint prints the value of an expression with the host function
+// for its type.
+func (m *module) generatePrint(arg ast.Expression, value string) string {
+	t := m.typeOf(arg)
+	var name string
+	switch {
+	case t == checker.Typ[checker.U32]:
+		name = "print_i64"
+		value = fmt.Sprintf("(i64.extend_i32_u %s)", value)
+	case t == checker.Typ[checker.I64]:
+		name = "print_i64"
+	case t == checker.Typ[checker.U64]:
+		name = "print_u64"
+	case t == checker.Typ[checker.F32]:
+		name = "print_f32"
+	case t == checker.Typ[checker.F64]:
+		name = "print_f64"
+	case checker.IsBoolean(t):
+		name = "print_bool"
+	case checker.IsString(t):
+		name = "print_str"
+	case checker.IsInteger(t), checker.IsEnum(t):
+		name = "print_i32"
+	default:
+		m.errorf(arg, "printing a value of type %s is not supported by the wat backend", t)
+		return ""
+	}
+	m.imports[name] = true
+	return fmt.Sprintf("(call $%s %s)\n", name, value)
+}
 
-(data (i32.const 0) "\00\00\00\00") ;; Memory allocation bitmap, initialized to all free
+// generateTemp declares a temporary local in the function being generated
+// and returns its name.
+func (m *module) generateTemp(t string) string {
+	name := m.generateUniqueLocalVarName("tmp")
+	m.temps = append(m.temps, fmt.Sprintf("(local $%s %s)\n", name, t))
+	return name
+}
 
-;; mark_block_free -- may need to be revisited
-(func $mark_block_free
-  (param $ptr i32)  ;; Pointer to the memory block to free
-)
-`
+func (m *module) generatePrintChar(c rune) string {
+	m.imports["print_char"] = true
+	return fmt.Sprintf("(call $print_char (i32.const %d))\n", c)
 }
 
-func mapTypeToWAT(t string) string {
+// mapTypeToWAT maps the name of a type to the WAT type used to represent it.
+// Unsupported types are reported at the given node.
+func (m *module) mapTypeToWAT(at ast.Node, t string) string {
 	switch t {
-	case "u8", "i8", "u16", "i16", "u32", "i32", "bool":
+	case "u8", "i8", "u16", "i16", "u32", "i32", "bool", "BOOL", "str", "STRING":
 		return "i32"
 	case "u64", "i64":
 		return "i64"
@@ -122,209 +167,227 @@ func mapTypeToWAT(t string) string {
 	case "f64":
 		return "f64"
 	default:
-		if _, ok := structDefinitions[t]; ok {
+		if strings.HasPrefix(t, "fn(") || strings.HasPrefix(t, "map[") {
+			// function values are pointers to a closure and maps to
+			// their header
+			return "i32"
+		}
+		if _, ok := m.structDefinitions[t]; ok {
+			return "i32"
+		}
+		if _, ok := m.info.Enums[t]; ok {
+			return "i32"
+		}
+		if _, ok := m.info.Interfaces[t]; ok {
 			return "i32"
 		}
-		log.Fatalf("Unsupported type: %s", t)
+		m.errorf(at, "type %s is not supported by the wat backend", t)
 		return ""
 	}
 }
 
-func generateStatements(stmts []ast.Statement, withMemoryManagement bool) string {
-	var out strings.Builder
-	out.WriteString("(module\n")
-
-	out.WriteString(generateImports())
-	if withMemoryManagement {
-		out.WriteString(generateMemoryManagementFunctions())
+func (m *module) generateStatements(stmts []ast.Statement) string {
+	// statements outside of functions run in order when the host calls
+	// main. A program whose only such statement is a call to main does not
+	// need an entry function since the host calls main itself.
+	var entry []ast.Statement
+	for _, stmt := range stmts {
+		switch stmt.(type) {
+		case nil, *ast.FunctionStatement, *ast.TestBlock,
+			*ast.StructDefinition, *ast.EnumDefinition, *ast.InterfaceDefinition:
+		default:
+			entry = append(entry, stmt)
+		}
 	}
+	m.hasEntry = len(entry) > 1 || len(entry) == 1 && !isMainCall(entry[0])
 
+	// the functions are generated first to find out which host functions
+	// they import
+	var body strings.Builder
 	for _, stmt := range stmts {
-		if stmt == nil {
-			continue
+		if s, ok := stmt.(*ast.FunctionStatement); ok {
+			body.WriteString(m.generateFunctionStatement(s))
 		}
-		out.WriteString(generateStatement(stmt))
 	}
-	out.WriteString(")\n")
-	return out.String()
-}
-
-var localVarCounter int
+	if m.hasEntry {
+		body.WriteString(m.generateEntryFunction(entry))
+	}
+	body.WriteString(m.generateFunctionLiterals())
 
-func generateUniqueLocalVarName(base string) string {
-	localVarCounter++
-	return fmt.Sprintf("%s_%d", base, localVarCounter)
-}
+	// the runtime functions can add imports and constants
+	runtime := m.generateMapFunctions() + m.generateStringFunctions() + m.generateListFunctions() + m.generateClosureFunctions()
 
-func generateStringLiteral(str *ast.StringLiteral) string {
-	length := len(str.Value) + 1
 	var out strings.Builder
-
-	localVarName := generateUniqueLocalVarName("str_ptr")
-
-	out.WriteString(fmt.Sprintf("(local $%s i32)\n", localVarName))
-
-	out.WriteString(fmt.Sprintf("(local.set $%s (call $%s (i32.const %d)))\n", localVarName, MemoryAllocateFunc, length))
-
-	for i, char := range str.Value {
-		if char == '\\' && i+1 < len(str.Value) && str.Value[i+1] == '"' {
-			out.WriteString(fmt.Sprintf("(i32.store8 offset=%d (local.get $%s) (i32.const %d)) ;; '\"'\n", i, localVarName, '"'))
-			i++
-		} else {
-			out.WriteString(fmt.Sprintf("(i32.store8 offset=%d (local.get $%s) (i32.const %d)) ;; '%c'\n", i, localVarName, char, char))
-		}
+	out.WriteString("(module\n")
+	out.WriteString(m.generateImports())
+	if m.opts.MemoryManagement || m.usesInterfaces() || len(m.stringOrder) > 0 || len(m.runtime) > 0 {
+		out.WriteString(m.generateMemoryManagementFunctions())
+		out.WriteString(m.generateStringData())
+		out.WriteString(m.generateClosureData())
+		out.WriteString(m.generateReferenceCounting())
 	}
-
-	out.WriteString(fmt.Sprintf("(i32.store8 offset=%d (local.get $%s) (i32.const 0))\n", length-1, localVarName))
-
-	// out.WriteString(fmt.Sprintf("(local.get $%s)\n", localVarName))
-
+	out.WriteString(runtime)
+	out.WriteString(m.generateDispatchTables())
+	out.WriteString(body.String())
+	out.WriteString(")\n")
 	return out.String()
 }
 
-func generateInfixExpression(infix *ast.InfixExpression) string {
-	left := generateExpression(infix.Left)
-	right := generateExpression(infix.Right)
-	operator := infix.Operator.Type
-
-	switch operator {
-	case token.PLUS:
-		return fmt.Sprintf("(i32.add %s %s)", left, right)
-	case token.MINUS:
-		return fmt.Sprintf("(i32.sub %s %s)", left, right)
-	case token.ASTERISK:
-		return fmt.Sprintf("(i32.mul %s %s)", left, right)
-	case token.SLASH:
-		return fmt.Sprintf("(i32.div_s %s %s)", left, right)
-	case token.LT:
-		return fmt.Sprintf("(i32.lt_s %s %s)", left, right)
-	case token.GT:
-		return fmt.Sprintf("(i32.gt_s %s %s)", left, right)
-	case token.EQ:
-		return fmt.Sprintf("(i32.eq %s %s)", left, right)
-	case token.NOT_EQ:
-		return fmt.Sprintf("(i32.ne %s %s)", left, right)
-	default:
-		return fmt.Sprintf(";; unhandled operator: %s\n", operator)
+// isMainCall reports whether a statement is a call to main.
+func isMainCall(stmt ast.Statement) bool {
+	expr, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return false
 	}
+	call, ok := expr.Expression.(*ast.FunctionCall)
+	return ok && call.FunctionName == "main"
 }
 
-func generatePrefixExpression(prefix *ast.PrefixExpression) string {
-	operand := generateExpression(prefix.Right)
-	operator := prefix.Operator.Type
-	switch operator {
-	case token.BANG:
-		return fmt.Sprintf("(i32.eqz %s)", operand)
-	case token.MINUS:
-		return fmt.Sprintf("(i32.sub (i32.const 0) %s)", operand)
-	default:
-		return fmt.Sprintf(";; unhandled operator: %s\n", operator)
+func (m *module) generateUniqueLocalVarName(base string) string {
+	m.localVarCounter++
+	return fmt.Sprintf("%s_%d", base, m.localVarCounter)
+}
+
+func generateBoolean(value bool) string {
+	if value {
+		return "(i32.const 1)"
 	}
+	return "(i32.const 0)"
 }
 
-func generateBlockStatement(block *ast.BlockStatement) string {
+func (m *module) generateBlockStatement(block *ast.BlockStatement) string {
 	var out strings.Builder
 	for _, stmt := range block.Statements {
 		out.WriteString("\t")
-		out.WriteString(generateStatement(stmt))
+		out.WriteString(m.generateStatement(stmt))
 		out.WriteString("\n")
 	}
 	return out.String()
 }
 
-func generateIfStatement(e *ast.IfStatement) string {
+func (m *module) generateIfStatement(e *ast.IfStatement) string {
 	if e == nil {
 		return ""
 	}
 	var out strings.Builder
 	out.WriteString("\t\t(if ")
-	out.WriteString(generateExpression(e.Condition))
+	out.WriteString(m.generateExpression(e.Condition))
 	out.WriteString("\n\t\t\t(then\n")
-	out.WriteString(generateBlockStatement(e.Consequence))
+	out.WriteString(m.generateBlockStatement(e.Consequence))
 	out.WriteString("\n\t\t\t)")
 	if e.Alternative != nil {
 		out.WriteString("\n\t\t\t(else\n")
-		out.WriteString(generateBlockStatement(e.Alternative))
+		out.WriteString(m.generateBlockStatement(e.Alternative))
 		out.WriteString("\n\t\t\t)")
 	}
 	out.WriteString("\n\t\t)")
 	return out.String()
 }
 
-func collectLocals(stmt ast.Statement, declaredLocals map[string]bool, locals *[]string) {
-	switch s := stmt.(type) {
-	case *ast.VariableDeclaration:
-		if !declaredLocals[s.Name.Value] {
-			*locals = append(*locals, fmt.Sprintf("(local $%s %s)\n", s.Name.Value, mapTypeToWAT(s.Type.Literal)))
-			declaredLocals[s.Name.Value] = true
-		}
-	case *ast.BlockStatement:
-		for _, stmt := range s.Statements {
-			collectLocals(stmt, declaredLocals, locals)
-		}
-	case *ast.IfStatement:
-		collectLocals(s.Consequence, declaredLocals, locals)
-		if s.Alternative != nil {
-			collectLocals(s.Alternative, declaredLocals, locals)
-		}
-	case *ast.FunctionStatement:
-		for _, stmt := range s.Body.Statements {
-			collectLocals(stmt, declaredLocals, locals)
-		}
-	case *ast.ExpressionStatement:
-		exp := stmt.(*ast.ExpressionStatement)
-		fn, ok := exp.Expression.(*ast.FunctionCall)
-		if !ok {
-			break
-		}
-		collectLocals(stmt, declaredLocals, locals)
-		for _, arg := range fn.Arguments {
-			println(arg.String())
+func (m *module) generateVariableDeclaration(decl *ast.VariableDeclaration) string {
+	// the local is declared at the start of the function. A declaration
+	// without a value sets it to zero since it may run more than once in a
+	// loop.
+	sym := m.info.Defs[decl.Name]
+	if sym == nil {
+		sym = m.info.Uses[decl.Name]
+	}
+	if sym != nil && managed(sym.Type) {
+		value := "(i32.const 0)"
+		if decl.Value != nil {
+			value = m.generateOwned(decl.Value)
 		}
+		return m.generateStore(decl.Name, sym, value)
 	}
-}
-
-func generateVariableDeclaration(decl *ast.VariableDeclaration) string {
-	var out strings.Builder
-	watType := mapTypeToWAT(decl.Type.Literal)
-
-	if decl.Value != nil {
-		out.WriteString(fmt.Sprintf("(local.set $%s ", decl.Name.Value))
-		out.WriteString(generateExpression(decl.Value))
-		out.WriteString(") \n")
+	var value string
+	if decl.Value == nil {
+		value = fmt.Sprintf("(%s.const 0)", valueType(m.info.Defs[decl.Name].Type))
 	} else {
-		out.WriteString(fmt.Sprintf("(local $%s %s)\n", decl.Name.Value, watType))
+		value = m.generateExpression(decl.Value)
+	}
+	if sym == nil {
+		return fmt.Sprintf("(local.set $%s %s)\n", decl.Name.Value, value)
 	}
+	return m.generateStore(decl.Name, sym, value)
+}
 
-	return out.String()
+// generateAssignmentExpression lowers `x = value`, and `x := value`, which
+// declares x like a variable declaration whose type is the value's.
+func (m *module) generateAssignmentExpression(e *ast.AssignmentExpression) string {
+	ident, ok := e.Left.(*ast.Identifier)
+	if !ok {
+		m.unsupported(e)
+		return ""
+	}
+	sym := m.info.Defs[ident]
+	if sym == nil {
+		sym = m.info.Uses[ident]
+	}
+	if sym == nil {
+		m.unsupported(e)
+		return ""
+	}
+	value := m.generateExpression(e.Right)
+	if managed(sym.Type) {
+		value = m.generateOwned(e.Right)
+	}
+	return m.generateStore(ident, sym, value)
 }
 
-func generateReturnStatement(s *ast.ReturnStatement) string {
+func (m *module) generateReturnStatement(s *ast.ReturnStatement) string {
 	if s == nil {
-		log.Println("Encountered nil *ast.ReturnStatement")
 		return ""
 	}
 
 	if len(s.ReturnValues) == 0 {
-		return "\t\t(return (i32.const 0)) ;; No return values, return null pointer\n"
+		return m.generateExit() + "\t\t(return)\n"
 	} else if len(s.ReturnValues) == 1 {
-		return fmt.Sprintf("\t\t(return %s)\n", generateExpression(s.ReturnValues[0]))
-	} else {
-		var out strings.Builder
-		out.WriteString("\t\t(local $retPtr i32)\n")
-		out.WriteString(fmt.Sprintf("\t\t(local.set $retPtr (call $%s (i32.const %d)))\n", MemoryAllocateFunc, len(s.ReturnValues)*4))
-
-		for i, retVal := range s.ReturnValues {
-			expr := generateExpression(retVal)
-			out.WriteString(fmt.Sprintf("\t\t(i32.store offset=%d (local.get $retPtr) %s)\n", i*4, expr))
+		// the value is computed before the locals it may use are released
+		// and is owned by the caller
+		value := m.generateOwned(s.ReturnValues[0])
+		if len(m.owners) == 0 && len(m.defers) == 0 {
+			return fmt.Sprintf("\t\t(return %s)\n", value)
 		}
+		temp := m.generateTemp(valueType(m.heapType(s.ReturnValues[0])))
+		return fmt.Sprintf("(local.set $%s %s)\n%s\t\t(return (local.get $%s))\n", temp, value, m.generateExit(), temp)
+	}
 
-		out.WriteString("\t\t(return (local.get $retPtr))\n")
-		return out.String()
+	// several values are returned on the stack, computed in order before
+	// the locals are released
+	var out strings.Builder
+	values := make([]string, len(s.ReturnValues))
+	for i, value := range s.ReturnValues {
+		temp := m.generateTemp(valueType(m.heapType(value)))
+		out.WriteString(fmt.Sprintf("(local.set $%s %s)\n", temp, m.generateOwned(value)))
+		values[i] = fmt.Sprintf("(local.get $%s)", temp)
 	}
+	out.WriteString(m.generateExit())
+	out.WriteString(fmt.Sprintf("\t\t(return %s)\n", strings.Join(values, " ")))
+	return out.String()
+}
+
+// generateDestructuringDeclaration assigns each value of a call to its
+// variable. The call owns the values it returns.
+func (m *module) generateDestructuringDeclaration(decl *ast.DestructuringDeclaration) string {
+	tuple, ok := m.typeOf(decl.Value).(*checker.Tuple)
+	if !ok {
+		m.unsupported(decl)
+		return ""
+	}
+	var out strings.Builder
+	out.WriteString(m.generateExpression(decl.Value))
+	pop, temps := m.generatePop(tuple)
+	out.WriteString(pop)
+	for i, v := range decl.Vars {
+		value := fmt.Sprintf("(local.get $%s)", temps[i])
+		if sym := m.info.Defs[v.Name]; sym != nil {
+			out.WriteString(m.generateStore(v.Name, sym, value))
+		}
+	}
+	return out.String()
 }
 
-func generateStatement(stmt ast.Statement) string {
+func (m *module) generateStatement(stmt ast.Statement) string {
 	if stmt == nil {
 		return ""
 	}
@@ -346,129 +409,102 @@ func generateStatement(stmt ast.Statement) string {
 				"%s\n"+
 				"(local.set $%s %s)\n",
 			s.Name.Value,
-			generateExpression(s.Value),
+			m.generateExpression(s.Value),
 			s.Name.Value,
 			s.Name.Value,
 		)
 	case *ast.VariableDeclaration:
-		return generateVariableDeclaration(s)
+		return m.generateVariableDeclaration(s)
+	case *ast.DestructuringDeclaration:
+		return m.generateDestructuringDeclaration(s)
+	case *ast.ListDeclaration:
+		return m.generateListDeclaration(s)
 	case *ast.ReturnStatement:
-		return generateReturnStatement(s)
+		return m.generateReturnStatement(s)
 	case *ast.IfStatement:
-		return generateIfStatement(s)
+		return m.generateIfStatement(s)
+	case *ast.ForStatement:
+		return m.generateForStatement(s)
+	case *ast.ForInStatement:
+		return m.generateForInStatement(s)
+	case *ast.BreakStatement, *ast.ContinueStatement:
+		return m.generateBranch(s)
+	case *ast.BlockStatement:
+		return m.generateBlockStatement(s)
 	case *ast.FunctionStatement:
-		return generateFunctionStatement(s)
+		return m.generateFunctionStatement(s)
 	case *ast.ExpressionStatement:
-		return generateExpression(s.Expression)
+		return m.generateDiscard(s.Expression, m.generateExpression(s.Expression))
+	case *ast.DeferStatement:
+		return m.generateDeferStatement(s)
 	}
+	m.unsupported(stmt)
 	return ""
 }
 
-func generateExpression(expr ast.Expression) string {
+func (m *module) generateExpression(expr ast.Expression) string {
+	if temp, ok := m.evaluated[expr]; ok {
+		return fmt.Sprintf("(local.get $%s)", temp)
+	}
+	out := m.generateValue(expr)
+	if iface, ok := m.info.Conversions[expr]; ok {
+		return m.generateInterfaceConversion(expr, out, iface)
+	}
+	return out
+}
+
+func (m *module) generateValue(expr ast.Expression) string {
 	switch e := expr.(type) {
 	case *ast.IntegerLiteral:
-		return fmt.Sprintf("(%s.const %d)", mapTypeToWAT(string(e.Token.Type)), e.Value)
+		return m.generateIntegerLiteral(e)
 	case *ast.FloatLiteral:
-		return fmt.Sprintf("(%s.const %f)", mapTypeToWAT(string(e.Token.Type)), e.Value)
+		return m.generateFloatLiteral(e)
 	case *ast.Boolean:
-		if e.Value {
-			return "(i32.const 1)"
-		} else {
-			return "(i32.const 0)"
-		}
+		return generateBoolean(e.Value)
+	case *ast.BooleanLiteral:
+		return generateBoolean(e.Value)
 	case *ast.StringLiteral:
-		return generateStringLiteral(e)
+		return m.generateStringLiteral(e)
 	case *ast.PrefixExpression:
-		return generatePrefixExpression(e)
+		return m.generatePrefixExpression(e)
 	case *ast.InfixExpression:
-		return generateInfixExpression(e)
+		return m.generateInfixExpression(e)
 	case *ast.Identifier:
-		return fmt.Sprintf("(local.get $%s)", e.Value)
+		return m.generateIdentifier(e)
+	case *ast.FunctionLiteral:
+		return m.generateFunctionLiteral(e)
 	case *ast.FunctionCall:
-		return generateFunctionCall(e)
-	case *ast.ArrayLiteral:
-		var out strings.Builder
-		out.WriteString(fmt.Sprintf("(i32.const %d)\n", len(e.Elements)))
-		out.WriteString(fmt.Sprintf("(i32.const %d)\n", len(e.Elements)))
-		out.WriteString("(i32.mul)\n")
-		out.WriteString("(memory.grow 1)\n")
-		out.WriteString("(i32.store8)\n")
-		for _, elem := range e.Elements {
-			out.WriteString(fmt.Sprintf("%s\n", generateExpression(elem)))
-		}
-		return out.String()
+		return m.generateFunctionCall(e)
+	case *ast.ListLiteral:
+		return m.generateListLiteral(e)
+	case *ast.HashLiteral:
+		return m.generateHashLiteral(e)
+	case *ast.AssignmentExpression:
+		return m.generateAssignmentExpression(e)
+	case *ast.IndexAssignment:
+		return m.generateIndexAssignment(e)
 	case *ast.IndexExpression:
-		var out strings.Builder
-		out.WriteString(fmt.Sprintf("%s\n", generateExpression(e.Left)))
-		out.WriteString(fmt.Sprintf("%s\n", generateExpression(e.Index)))
-		out.WriteString("(i32.add)\n")
-		out.WriteString("(i32.load8_s)\n")
-		return out.String()
+		return m.generateIndexExpression(e)
+	case *ast.SliceExpression:
+		return m.generateSliceExpression(e)
 	case *ast.CallExpression:
 		var out strings.Builder
 		for _, arg := range e.Arguments {
-			out.WriteString(fmt.Sprintf("%s\n", generateExpression(arg)))
+			out.WriteString(fmt.Sprintf("%s\n", m.generateExpression(arg)))
 		}
 		out.WriteString(fmt.Sprintf("(call $%s)\n", e.Function.Value))
 		return out.String()
 	case *ast.WhileExpression:
-		var out strings.Builder
-		out.WriteString("(block\n")
-		out.WriteString(fmt.Sprintf("(loop $%d\n", e.ID))
-		out.WriteString(fmt.Sprintf("%s\n", generateExpression(e.Condition)))
-		out.WriteString("(br_if 1\n")
-		out.WriteString(fmt.Sprintf("%s\n", generateStatement(e.Body)))
-		out.WriteString(")\n")
-		out.WriteString("(br 0)\n")
-		out.WriteString(")\n")
-		out.WriteString(")\n")
-		return out.String()
+		return m.generateLoop(nil, e.Condition, e.Body, nil)
 	case *ast.StructLiteral:
-		return generateStructLiteral(e)
+		return m.generateStructLiteral(e)
 	case *ast.StructFieldAccess:
-		return generateStructFieldAccess(e)
+		return m.generateStructFieldAccess(e)
+	case *ast.StructFieldAssignment:
+		return m.generateStructFieldAssignment(e)
+	case nil:
+		return ""
 	}
+	m.unsupported(expr)
 	return ""
 }
-
-func generateStructLiteral(lit *ast.StructLiteral) string {
-	structDef, ok := structDefinitions[lit.StructName.Value]
-	if !ok {
-		log.Fatalf("Undefined struct: %s", lit.StructName.Value)
-	}
-
-	var out strings.Builder
-	structSize := len(structDef.Fields) * 4
-	out.WriteString("(local $struct_ptr i32)\n")
-	out.WriteString(fmt.Sprintf("(local.set $struct_ptr (call $%s (i32.const %d)))\n", MemoryAllocateFunc, structSize))
-
-	for i, field := range structDef.Fields {
-		fieldValue, ok := lit.Fields[field.Name.Value]
-		if !ok {
-			log.Fatalf("Missing value for field: %s", field.Name.Value)
-		}
-		out.WriteString(fmt.Sprintf("(i32.store offset=%d (local.get $struct_ptr) %s)\n", i*4, generateExpression(fieldValue)))
-	}
-
-	out.WriteString("(local.get $struct_ptr)\n")
-	return out.String()
-}
-
-func generateStructFieldAccess(access *ast.StructFieldAccess) string {
-	structDef, ok := structDefinitions[access.Left.(*ast.Identifier).Value]
-	if !ok {
-		log.Fatalf("Undefined struct: %s", access.Left.(*ast.Identifier).Value)
-	}
-
-	var fieldIndex int
-	for i, field := range structDef.Fields {
-		if field.Name.Value == access.Field.Value {
-			fieldIndex = i
-			break
-		}
-	}
-
-	var out strings.Builder
-	out.WriteString(fmt.Sprintf("(i32.load offset=%d (local.get $%s))\n", fieldIndex*4, access.Left.(*ast.Identifier).Value))
-	return out.String()
-}
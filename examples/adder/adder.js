@@ -2,45 +2,52 @@ const fs = require('node:fs');
 
 const wasmBuffer = fs.readFileSync('./adder.punch.wasm');
 
-const encode = function stringToIntegerArray(string, array) {
-  const alphabet = "abcdefghijklmnopqrstuvwxyz";
-  for (let i = 0; i < string.length; i++) {
-    array[i] = alphabet.indexOf(string[i]);
-  }
+let memory;
+
+// strings are a little endian length followed by their utf-8 bytes
+const decode = function(offset) {
+  const view = new DataView(memory.buffer);
+  const length = view.getUint32(offset, true);
+  return new TextDecoder().decode(new Uint8Array(memory.buffer, offset + 4, length));
 };
 
-const decode = function(memory, offset) {
-  let string = "";
-  let char = memory[offset];
-  while (char !== 0) {
-    string += String.fromCharCode(char);
-    offset++;
-    char = memory[offset];
+// println writes its values one at a time and ends with a newline, so the
+// output is collected until a line is complete
+let line = "";
+const write = function(text) {
+  line += text;
+  const lines = line.split("\n");
+  line = lines.pop();
+  for (const complete of lines) {
+    console.log(complete);
   }
-  return string;
 };
 
 const importObject = {
   imports: {
-    println(offset) {
-      const memoryBuffer = new Uint8Array(importObject.env.memory.buffer);
-      console.log(decode(memoryBuffer, offset));
+    print_i32: (v) => write(String(v)),
+    print_i64: (v) => write(String(v)),
+    print_u64: (v) => write(String(BigInt.asUintN(64, v))),
+    print_f32: (v) => write(String(v)),
+    print_f64: (v) => write(String(v)),
+    print_bool: (v) => write(String(v !== 0)),
+    print_char: (c) => write(String.fromCodePoint(c)),
+    print_str: (offset) => write(decode(offset)),
+    panic: (offset) => {
+      throw new Error(decode(offset));
     },
   },
-  env: {
-    memory: new WebAssembly.Memory({ initial: 1 }) // 1 page = 64KiB
-  }
 };
 
 WebAssembly.instantiate(wasmBuffer, importObject).then(wasmModule => {
-  importObject.env.memory = wasmModule.instance.exports.memory;
+  memory = wasmModule.instance.exports.memory;
 
   const { add_two, add_four, hello } = wasmModule.instance.exports;
 
   const sum = add_four(1, 1, 2, 1);
-  const sum2 = add_two(2, 20);
+  const sum2 = add_two(2, 20, 0);
 
   console.log(`Sum from add_four: ${sum}`);
   console.log(`Sum from add_two: ${sum2}`);
-  hello(true)
+  hello(true);
 });
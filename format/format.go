@@ -0,0 +1,118 @@
+// Package format lays out punch source code consistently.
+package format
+
+import (
+	"strings"
+)
+
+const indent = "    "
+
+// Source formats punch source code. Each line is indented by the number of
+// brackets still open at its start, trailing whitespace is removed, runs of
+// blank lines are collapsed into one and the file ends with a single newline.
+// Comments are kept and the contents of strings and block comments are left
+// untouched.
+func Source(src string) string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+
+	var out strings.Builder
+	s := &state{}
+	blank := false
+	for _, line := range strings.Split(src, "\n") {
+		if s.inBlockComment || s.inRawString {
+			// a line that starts inside a comment or string is copied as is
+			out.WriteString(line + "\n")
+			s.scan(line)
+			blank = false
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			blank = out.Len() > 0
+			continue
+		}
+		if blank {
+			out.WriteString("\n")
+			blank = false
+		}
+
+		depth := s.depth - leadingClosers(trimmed)
+		if depth < 0 {
+			depth = 0
+		}
+		out.WriteString(strings.Repeat(indent, depth) + trimmed + "\n")
+		s.scan(trimmed)
+	}
+	return out.String()
+}
+
+// state tracks what is open at the end of each line.
+type state struct {
+	depth          int
+	inBlockComment bool
+	inRawString    bool
+}
+
+// scan updates the state with the brackets, comments and strings in a line.
+func (s *state) scan(line string) {
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case s.inBlockComment:
+			if c == '*' && i+1 < len(line) && line[i+1] == '/' {
+				s.inBlockComment = false
+				i++
+			}
+		case s.inRawString:
+			if c == '`' {
+				s.inRawString = false
+			}
+		case c == '/' && i+1 < len(line) && line[i+1] == '/':
+			return
+		case c == '/' && i+1 < len(line) && line[i+1] == '*':
+			s.inBlockComment = true
+			i++
+		case c == '`':
+			s.inRawString = true
+		case c == '"' || c == '\'':
+			i = skipQuoted(line, i)
+		case c == '{' || c == '(' || c == '[':
+			s.depth++
+		case c == '}' || c == ')' || c == ']':
+			if s.depth > 0 {
+				s.depth--
+			}
+		}
+	}
+}
+
+// skipQuoted returns the index of the quote that closes the string or
+// character starting at i.
+func skipQuoted(line string, i int) int {
+	quote := line[i]
+	for i++; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case quote:
+			return i
+		}
+	}
+	return i
+}
+
+// leadingClosers counts the closing brackets a line starts with.
+func leadingClosers(line string) int {
+	n := 0
+	for _, c := range line {
+		switch c {
+		case '}', ')', ']':
+			n++
+		case ' ', '\t':
+		default:
+			return n
+		}
+	}
+	return n
+}
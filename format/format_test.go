@@ -0,0 +1,82 @@
+package format_test
+
+import (
+	"testing"
+
+	"github.com/dfirebaugh/punch/format"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "indentation",
+			in: `pkg main
+fn main() {
+  if true {
+	println("yes")
+      }
+}
+`,
+			want: `pkg main
+fn main() {
+    if true {
+        println("yes")
+    }
+}
+`,
+		},
+		{
+			name: "blank lines and trailing whitespace",
+			in:   "\n\npkg main   \n\n\n\ni32 a = 1\t\n\n",
+			want: "pkg main\n\ni32 a = 1\n",
+		},
+		{
+			name: "brackets in strings and comments",
+			in: `fn main() {
+println("{ (")
+// }
+/* {
+   keep this as is
+*/
+println(")")
+}`,
+			want: `fn main() {
+    println("{ (")
+    // }
+    /* {
+   keep this as is
+*/
+    println(")")
+}
+`,
+		},
+		{
+			name: "struct literal",
+			in: `point p = point {
+x: 1,
+   y: 2,
+}`,
+			want: `point p = point {
+    x: 1,
+    y: 2,
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := format.Source(tt.in)
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+			if again := format.Source(got); again != got {
+				t.Errorf("formatting is not idempotent:\n%s", again)
+			}
+		})
+	}
+}
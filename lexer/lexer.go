@@ -11,6 +11,9 @@ type Lexer struct {
 	Collector    token.TokenCollector
 	scanner      scanner.Scanner
 	savedScanner scanner.Scanner
+	// next is a token that was scanned along with the one before it
+	next      *token.Token
+	savedNext *token.Token
 }
 
 func New(filename string, source string) *Lexer {
@@ -39,11 +42,18 @@ func (l *Lexer) Run() []token.Token {
 }
 
 func (l *Lexer) NextToken() token.Token {
+	if l.next != nil {
+		t := *l.next
+		l.next = nil
+		l.Collector.Collect(t)
+		return t
+	}
 	tok := l.scanner.Scan()
 	if tok == scanner.EOF {
 		return token.Token{
 			Literal:  "",
 			Position: scanner.Position{Line: -1, Offset: -1},
+			End:      scanner.Position{Line: -1, Offset: -1},
 			Type:     token.EOF,
 		}
 	}
@@ -52,7 +62,13 @@ func (l *Lexer) NextToken() token.Token {
 		Literal:  l.scanner.TokenText(),
 		Position: l.scanner.Position,
 	}
+	if tok == scanner.Float && strings.HasSuffix(t.Literal, ".") && l.scanner.Peek() == '.' {
+		t = l.splitRange(t)
+		l.Collector.Collect(t)
+		return t
+	}
 	t.Type = l.evaluateType(t)
+	t.End = l.scanner.Pos()
 	if l.isMultiCharOperator(t.Type) {
 		t.Literal = string(t.Type)
 	}
@@ -64,6 +80,20 @@ func (l *Lexer) NextToken() token.Token {
 	return t
 }
 
+// splitRange splits the integer that starts a range such as 0..n, which
+// the scanner reads as the float "0.", from the range operator after it.
+func (l *Lexer) splitRange(t token.Token) token.Token {
+	t.Literal = strings.TrimSuffix(t.Literal, ".")
+	t.Type = token.NUMBER
+	dot := t.Position
+	dot.Offset += len(t.Literal)
+	dot.Column += len(t.Literal)
+	t.End = dot
+	l.scanner.Next() // consume the second '.'
+	l.next = &token.Token{Type: token.RANGE, Literal: token.RANGE, Position: dot, End: l.scanner.Pos()}
+	return t
+}
+
 func (l *Lexer) evaluateType(t token.Token) token.Type {
 	switch {
 	case l.isSpecialCharacter(t.Literal):
@@ -120,7 +150,7 @@ func (l *Lexer) processStringLiteral(literal string) string {
 }
 
 func (l Lexer) isMultiCharOperator(t token.Type) bool {
-	return t == token.PLUS_EQUALS || t == token.MINUS_EQUALS || t == token.ASTERISK_EQUALS || t == token.SLASH_EQUALS || t == token.AND || t == token.OR || t == token.EQ || t == token.NOT_EQ || t == token.LT_EQUALS || t == token.GT_EQUALS
+	return t == token.RANGE || t == token.PLUS_EQUALS || t == token.MINUS_EQUALS || t == token.ASTERISK_EQUALS || t == token.SLASH_EQUALS || t == token.AND || t == token.OR || t == token.EQ || t == token.NOT_EQ || t == token.LT_EQUALS || t == token.GT_EQUALS
 }
 
 func (l Lexer) isSpecialCharacter(literal string) bool {
@@ -129,6 +159,14 @@ func (l Lexer) isSpecialCharacter(literal string) bool {
 
 func (l *Lexer) evaluateMultiCharOperators(literal string) token.Type {
 	switch literal {
+	case token.DOT:
+		if l.scanner.Peek() == rune('.') {
+			// Next rather than Scan since Scan would read .5 of a..5 as
+			// a float
+			l.scanner.Next()
+			return token.RANGE
+		}
+		return token.DOT
 	case token.COLON:
 		if l.scanner.Peek() == rune('=') {
 			l.scanner.Scan()
@@ -246,6 +284,10 @@ func (l Lexer) evaluateSpecialCharacter(literal string) token.Type {
 		return token.RBRACE
 	case token.BANG:
 		return token.BANG
+	case token.AMPERSAND:
+		return token.AMPERSAND
+	case token.PIPE:
+		return token.PIPE
 	case token.MOD:
 		return token.MOD
 	case token.LBRACKET:
@@ -287,8 +329,14 @@ func (l *Lexer) evaluateKeyword(literal string) token.Type {
 		return token.STRUCT
 	case token.Keywords[token.INTERFACE]:
 		return token.INTERFACE
+	case token.Keywords[token.ENUM]:
+		return token.ENUM
+	case token.Keywords[token.TEST]:
+		return token.TEST
 	case token.Keywords[token.DEFER]:
 		return token.DEFER
+	case token.Keywords[token.MAP]:
+		return token.MAP
 	case token.Keywords[token.PACKAGE]:
 		return token.PACKAGE
 	case token.Keywords[token.IMPORT]:
@@ -309,6 +357,10 @@ func (l *Lexer) evaluateKeyword(literal string) token.Type {
 		return token.TRUE
 	case token.Keywords[token.FOR]:
 		return token.FOR
+	case token.Keywords[token.BREAK]:
+		return token.BREAK
+	case token.Keywords[token.CONTINUE]:
+		return token.CONTINUE
 	case token.Keywords[token.FALSE]:
 		return token.FALSE
 	case token.Keywords[token.BOOL]:
@@ -322,8 +374,10 @@ func (l *Lexer) evaluateKeyword(literal string) token.Type {
 
 func (l *Lexer) SaveState() {
 	l.savedScanner = l.scanner
+	l.savedNext = l.next
 }
 
 func (l *Lexer) RestoreState() {
 	l.scanner = l.savedScanner
+	l.next = l.savedNext
 }
@@ -23,6 +23,23 @@ func TestLexer(t *testing.T) {
 				{Type: token.EOF, Literal: ""},
 			},
 		},
+		{
+			input: "for i in 0..n { x..10 }",
+			output: []token.Token{
+				{Type: token.FOR, Literal: "for"},
+				{Type: token.IDENTIFIER, Literal: "i"},
+				{Type: token.IDENTIFIER, Literal: "in"},
+				{Type: token.NUMBER, Literal: "0"},
+				{Type: token.RANGE, Literal: ".."},
+				{Type: token.IDENTIFIER, Literal: "n"},
+				{Type: token.LBRACE, Literal: "{"},
+				{Type: token.IDENTIFIER, Literal: "x"},
+				{Type: token.RANGE, Literal: ".."},
+				{Type: token.NUMBER, Literal: "10"},
+				{Type: token.RBRACE, Literal: "}"},
+				{Type: token.EOF, Literal: ""},
+			},
+		},
 	}
 
 	for _, tt := range tests {
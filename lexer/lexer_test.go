@@ -108,12 +108,13 @@ func TestLexLetStatement(t *testing.T) {
 }
 
 func Test_evaluateType(t *testing.T) {
-	input := `= 42 3.14 foo`
+	input := `= 42 18446744073709551615 3.14 foo`
 	l := New("", input)
 
 	expectedTokens := []token.Type{
 		token.ASSIGN,
 		token.NUMBER,
+		token.NUMBER,
 		token.FLOAT,
 		token.IDENTIFIER,
 	}
@@ -169,16 +170,16 @@ func Test_isMultiCharOperator(t *testing.T) {
 func TestBooleanLiterals(t *testing.T) {
 	source := "let a = true; let b = false;"
 	expectedTokens := []token.Token{
-		{Type: token.LET, Literal: "let", Position: scanner.Position{Line: 1, Column: 1, Offset: 0}},
-		{Type: token.IDENTIFIER, Literal: "a", Position: scanner.Position{Line: 1, Column: 5, Offset: 4}},
-		{Type: token.ASSIGN, Literal: "=", Position: scanner.Position{Line: 1, Column: 7, Offset: 6}},
-		{Type: token.TRUE, Literal: "true", Position: scanner.Position{Line: 1, Column: 9, Offset: 8}},
-		{Type: token.SEMICOLON, Literal: ";", Position: scanner.Position{Line: 1, Column: 13, Offset: 12}},
-		{Type: token.LET, Literal: "let", Position: scanner.Position{Line: 1, Column: 15, Offset: 14}},
-		{Type: token.IDENTIFIER, Literal: "b", Position: scanner.Position{Line: 1, Column: 19, Offset: 18}},
-		{Type: token.ASSIGN, Literal: "=", Position: scanner.Position{Line: 1, Column: 21, Offset: 20}},
-		{Type: token.FALSE, Literal: "false", Position: scanner.Position{Line: 1, Column: 23, Offset: 22}},
-		{Type: token.SEMICOLON, Literal: ";", Position: scanner.Position{Line: 1, Column: 28, Offset: 27}},
+		{Type: token.LET, Literal: "let", Position: scanner.Position{Line: 1, Column: 1, Offset: 0}, End: scanner.Position{Line: 1, Column: 4, Offset: 3}},
+		{Type: token.IDENTIFIER, Literal: "a", Position: scanner.Position{Line: 1, Column: 5, Offset: 4}, End: scanner.Position{Line: 1, Column: 6, Offset: 5}},
+		{Type: token.ASSIGN, Literal: "=", Position: scanner.Position{Line: 1, Column: 7, Offset: 6}, End: scanner.Position{Line: 1, Column: 8, Offset: 7}},
+		{Type: token.TRUE, Literal: "true", Position: scanner.Position{Line: 1, Column: 9, Offset: 8}, End: scanner.Position{Line: 1, Column: 13, Offset: 12}},
+		{Type: token.SEMICOLON, Literal: ";", Position: scanner.Position{Line: 1, Column: 13, Offset: 12}, End: scanner.Position{Line: 1, Column: 14, Offset: 13}},
+		{Type: token.LET, Literal: "let", Position: scanner.Position{Line: 1, Column: 15, Offset: 14}, End: scanner.Position{Line: 1, Column: 18, Offset: 17}},
+		{Type: token.IDENTIFIER, Literal: "b", Position: scanner.Position{Line: 1, Column: 19, Offset: 18}, End: scanner.Position{Line: 1, Column: 20, Offset: 19}},
+		{Type: token.ASSIGN, Literal: "=", Position: scanner.Position{Line: 1, Column: 21, Offset: 20}, End: scanner.Position{Line: 1, Column: 22, Offset: 21}},
+		{Type: token.FALSE, Literal: "false", Position: scanner.Position{Line: 1, Column: 23, Offset: 22}, End: scanner.Position{Line: 1, Column: 28, Offset: 27}},
+		{Type: token.SEMICOLON, Literal: ";", Position: scanner.Position{Line: 1, Column: 28, Offset: 27}, End: scanner.Position{Line: 1, Column: 29, Offset: 28}},
 		{Type: token.EOF},
 	}
 
@@ -202,6 +203,8 @@ func TestEvaluateKeyword(t *testing.T) {
 		{"if", token.IF},
 		{"true", token.TRUE},
 		{"false", token.FALSE},
+		{"enum", token.ENUM},
+		{"test", token.TEST},
 		{"foo", token.IDENTIFIER},
 	}
 
@@ -0,0 +1,299 @@
+// Package loader finds and parses the packages a program is made of.
+//
+// A package is a directory of .pun files that share a `pkg` clause. Import
+// paths are resolved relative to the module root, which is the closest
+// directory above the program that contains a punch.mod file, or the
+// program's own directory if there is none.
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/scanner"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/diagnostic"
+	"github.com/dfirebaugh/punch/lexer"
+	"github.com/dfirebaugh/punch/parser"
+)
+
+// ModFile marks the root of a module. Its contents are not read yet.
+const ModFile = "punch.mod"
+
+type state int
+
+const (
+	unvisited state = iota
+	visiting
+	visited
+)
+
+type pkg struct {
+	path  string
+	name  string
+	files []*ast.File
+	state state
+}
+
+// Loader loads a program and the packages it imports.
+type Loader struct {
+	// Sources holds the source of every file that was read, keyed by file
+	// name, so that diagnostics can show the offending lines.
+	Sources map[string]string
+
+	root     string
+	packages map[string]*pkg
+	order    []*ast.File
+	errors   diagnostic.List
+}
+
+func New() *Loader {
+	return &Loader{
+		Sources:  make(map[string]string),
+		packages: make(map[string]*pkg),
+	}
+}
+
+// Load loads the program in a file or a directory. A single file is loaded
+// as a package on its own. The files of the returned program are ordered so
+// that every package comes after the packages it imports, with the package
+// that was loaded last. Parse errors and import errors are returned as a
+// diagnostic.List along with whatever could be loaded.
+func (l *Loader) Load(filename string) (*ast.Program, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return l.LoadFiles(filename)
+	}
+	files, err := l.parseDir(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .pun files in %s", filename)
+	}
+	return l.load(filename, files)
+}
+
+// LoadFiles loads files from one directory as a single package, leaving out
+// the other files in the directory.
+func (l *Loader) LoadFiles(filenames ...string) (*ast.Program, error) {
+	if len(filenames) == 0 {
+		return nil, errors.New("no files to load")
+	}
+	dir := filepath.Dir(filenames[0])
+	var files []*ast.File
+	for _, filename := range filenames {
+		if filepath.Dir(filename) != dir {
+			return nil, fmt.Errorf("%s and %s are not in the same directory", filenames[0], filename)
+		}
+		source, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, l.parse(filename, string(source))...)
+	}
+	return l.load(dir, files)
+}
+
+// LoadSource loads a program from source that is not read from a file, such
+// as stdin. Its imports are resolved from the current directory.
+func (l *Loader) LoadSource(name, source string) (*ast.Program, error) {
+	return l.load(".", l.parse(name, source))
+}
+
+func (l *Loader) load(dir string, files []*ast.File) (*ast.Program, error) {
+	root, err := findRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	l.root = root
+
+	main := l.newPackage("", files)
+	// the loaded package can be reached through its import path as well, so
+	// that a cycle back to it is found
+	if rel, err := filepath.Rel(root, dir); err == nil && rel != "." {
+		l.packages[filepath.ToSlash(rel)] = main
+	}
+	l.visit(main, nil)
+	return &ast.Program{Files: l.order}, l.errors.Err()
+}
+
+// findRoot returns the closest directory at or above dir that contains
+// ModFile, or dir itself if there is none.
+func findRoot(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for d := abs; ; {
+		if _, err := os.Stat(filepath.Join(d, ModFile)); err == nil {
+			return d, nil
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return abs, nil
+		}
+		d = parent
+	}
+}
+
+// parse parses one source file. Parse errors are recorded and the partial
+// file is still returned so the rest of the program can be checked.
+func (l *Loader) parse(filename, source string) []*ast.File {
+	l.Sources[filename] = source
+	program, err := parser.New(lexer.New(filename, source)).ParseProgram(filename)
+	l.addError(err)
+	if program == nil {
+		return nil
+	}
+	return program.Files
+}
+
+// parseDir parses every .pun file in a directory.
+func (l *Loader) parseDir(dir string) ([]*ast.File, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []*ast.File
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".pun" {
+			continue
+		}
+		filename := filepath.Join(dir, entry.Name())
+		source, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, l.parse(filename, string(source))...)
+	}
+	return files, nil
+}
+
+// newPackage groups files into a package, reporting files whose `pkg`
+// clause does not match the first file's.
+func (l *Loader) newPackage(importPath string, files []*ast.File) *pkg {
+	p := &pkg{path: importPath, files: files}
+	for _, file := range files {
+		file.ImportPath = importPath
+		if p.name == "" {
+			p.name = file.PackageName
+			continue
+		}
+		if file.PackageName != p.name && file.PackageName != "" {
+			l.errorf(file.Pos(), file.Pos(), "found packages %s (%s) and %s (%s) in the same directory",
+				p.name, files[0].Filename, file.PackageName, file.Filename)
+		}
+	}
+	return p
+}
+
+// visit loads the imports of a package depth first and adds its files to
+// the program once all of its dependencies have been added.
+func (l *Loader) visit(p *pkg, stack []*pkg) {
+	p.state = visiting
+	stack = append(stack, p)
+	for _, file := range p.files {
+		for _, imp := range file.Imports {
+			dep := l.importPackage(imp)
+			if dep == nil {
+				continue
+			}
+			switch dep.state {
+			case visiting:
+				l.errorf(imp.Pos(), imp.End(), "import cycle not allowed: %s", cycle(stack, dep))
+			case unvisited:
+				l.visit(dep, stack)
+			}
+		}
+	}
+	p.state = visited
+	l.order = append(l.order, p.files...)
+}
+
+// cycle describes the chain of imports on the stack that leads back to dep.
+func cycle(stack []*pkg, dep *pkg) string {
+	var names []string
+	for i := len(stack) - 1; i >= 0; i-- {
+		names = append([]string{stack[i].displayName()}, names...)
+		if stack[i] == dep {
+			break
+		}
+	}
+	return strings.Join(append(names, dep.displayName()), " -> ")
+}
+
+func (p *pkg) displayName() string {
+	if p.path == "" {
+		return p.name
+	}
+	return p.path
+}
+
+// importPackage finds and parses the package an import refers to. Each
+// package is only parsed once.
+func (l *Loader) importPackage(imp *ast.Import) *pkg {
+	if p, ok := l.packages[imp.Path]; ok {
+		return p
+	}
+	if !validImportPath(imp.Path) {
+		l.errorf(imp.Pos(), imp.End(), "invalid import path %q", imp.Path)
+		return nil
+	}
+
+	dir := filepath.Join(l.root, filepath.FromSlash(imp.Path))
+	files, err := l.parseDir(dir)
+	if errors.Is(err, fs.ErrNotExist) || err == nil && len(files) == 0 {
+		l.errorf(imp.Pos(), imp.End(), "package %s not found (no .pun files in %s)", imp.Path, dir)
+		return nil
+	}
+	if err != nil {
+		l.errorf(imp.Pos(), imp.End(), "cannot import %s: %v", imp.Path, err)
+		return nil
+	}
+
+	p := l.newPackage(imp.Path, files)
+	l.packages[imp.Path] = p
+	if p.name == "main" {
+		l.errorf(imp.Pos(), imp.End(), "import %q is a program, not an importable package", imp.Path)
+	}
+	return p
+}
+
+// validImportPath reports whether an import path is a clean, relative,
+// slash separated path inside the module.
+func validImportPath(importPath string) bool {
+	if importPath == "" || path.IsAbs(importPath) || path.Clean(importPath) != importPath {
+		return false
+	}
+	return importPath != "." && importPath != ".." && !strings.HasPrefix(importPath, "../")
+}
+
+func (l *Loader) addError(err error) {
+	if err == nil {
+		return
+	}
+	var diags diagnostic.List
+	if errors.As(err, &diags) {
+		l.errors = append(l.errors, diags...)
+		return
+	}
+	l.errors = append(l.errors, diagnostic.Diagnostic{Severity: diagnostic.Error, Message: err.Error()})
+}
+
+func (l *Loader) errorf(pos, end scanner.Position, format string, args ...interface{}) {
+	l.errors = append(l.errors, diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Message:  fmt.Sprintf(format, args...),
+		Pos:      pos,
+		End:      end,
+	})
+}
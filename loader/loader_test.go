@@ -0,0 +1,159 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dfirebaugh/punch/diagnostic"
+)
+
+// writeModule creates a module in a temporary directory from a map of file
+// names to their contents and returns its root.
+func writeModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestLoad(t *testing.T) {
+	root := writeModule(t, map[string]string{
+		ModFile:               "",
+		"cmd/app/main.pun":    "pkg main\nimport \"lib/math\"\nimport \"lib/util\"\nfn main() {\n}\n",
+		"lib/math/add.pun":    "pkg math\nimport \"lib/util\"\npub i32 add(i32 a, i32 b) {\n    return a + b\n}\n",
+		"lib/math/sub.pun":    "pkg math\npub i32 sub(i32 a, i32 b) {\n    return a - b\n}\n",
+		"lib/util/util.pun":   "pkg util\npub fn noop() {\n}\n",
+		"lib/util/README.txt": "not a source file",
+	})
+
+	l := New()
+	program, err := l.Load(filepath.Join(root, "cmd/app"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []string
+	for _, file := range program.Files {
+		rel, _ := filepath.Rel(root, file.Filename)
+		got = append(got, filepath.ToSlash(rel)+"="+file.ImportPath)
+	}
+	want := []string{
+		"lib/util/util.pun=lib/util",
+		"lib/math/add.pun=lib/math",
+		"lib/math/sub.pun=lib/math",
+		"cmd/app/main.pun=",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("files:\ngot  %v\nwant %v", got, want)
+	}
+	if len(l.Sources) != 4 {
+		t.Errorf("expected the sources of 4 files, got %d", len(l.Sources))
+	}
+}
+
+func TestLoadFiles(t *testing.T) {
+	root := writeModule(t, map[string]string{
+		ModFile:         "",
+		"calc/a.pun":    "pkg calc\ni32 double(i32 x) {\n    return x * 2\n}\n",
+		"calc/b.pun":    "pkg calc\nimport \"util\"\n",
+		"calc/c.pun":    "pkg calc\n",
+		"util/util.pun": "pkg util\n",
+	})
+
+	program, err := New().LoadFiles(filepath.Join(root, "calc/a.pun"), filepath.Join(root, "calc/b.pun"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []string
+	for _, file := range program.Files {
+		rel, _ := filepath.Rel(root, file.Filename)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	want := []string{"util/util.pun", "calc/a.pun", "calc/b.pun"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("files:\ngot  %v\nwant %v", got, want)
+	}
+
+	_, err = New().LoadFiles(filepath.Join(root, "calc/a.pun"), filepath.Join(root, "util/util.pun"))
+	if err == nil || !strings.Contains(err.Error(), "not in the same directory") {
+		t.Errorf("expected an error for files in different directories, got %v", err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		errors []string
+	}{
+		{
+			name: "import cycle",
+			files: map[string]string{
+				"main.pun":  "pkg main\nimport \"a\"\n",
+				"a/a.pun":   "pkg a\nimport \"b\"\n",
+				"b/b.pun":   "pkg b\nimport \"a\"\n",
+				"punch.mod": "",
+			},
+			errors: []string{"import cycle not allowed: a -> b -> a"},
+		},
+		{
+			name: "missing package",
+			files: map[string]string{
+				"main.pun": "pkg main\nimport \"geo\"\n",
+			},
+			errors: []string{"package geo not found"},
+		},
+		{
+			name: "invalid path",
+			files: map[string]string{
+				"main.pun": "pkg main\nimport \"../geo\"\n",
+			},
+			errors: []string{`invalid import path "../geo"`},
+		},
+		{
+			name: "importing a program",
+			files: map[string]string{
+				"main.pun":      "pkg main\nimport \"tool\"\n",
+				"tool/main.pun": "pkg main\n",
+			},
+			errors: []string{`import "tool" is a program, not an importable package`},
+		},
+		{
+			name: "mixed package names",
+			files: map[string]string{
+				"main.pun":  "pkg main\nimport \"geo\"\n",
+				"geo/a.pun": "pkg geo\n",
+				"geo/b.pun": "pkg shapes\n",
+			},
+			errors: []string{"found packages geo"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeModule(t, tt.files)
+			_, err := New().Load(filepath.Join(root, "main.pun"))
+			list, ok := err.(diagnostic.List)
+			if !ok {
+				t.Fatalf("expected diagnostic.List, got %v", err)
+			}
+			if len(list) != len(tt.errors) {
+				t.Fatalf("expected %d errors, got %d:\n%v", len(tt.errors), len(list), err)
+			}
+			for i, want := range tt.errors {
+				if !strings.Contains(list[i].Message, want) {
+					t.Errorf("error %d: got %q, want it to contain %q", i, list[i].Message, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package parser
+
+import (
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/token"
+)
+
+// parseEnumDefinition parses an enum such as
+//
+//	enum Color { Red, Green = 4, Blue }
+func (p *Parser) parseEnumDefinition() (*ast.EnumDefinition, error) {
+	enumDef := &ast.EnumDefinition{
+		Token: p.curToken,
+	}
+
+	if !p.expectPeek(token.IDENTIFIER) {
+		return nil, p.error("expected identifier")
+	}
+	p.nextToken()
+	enumDef.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil, p.error("expected '{' after enum name")
+	}
+	p.nextToken() // consume the name
+	p.nextToken() // consume '{'
+
+	for !p.curTokenIs(token.RBRACE) {
+		if p.curTokenIs(token.EOF) {
+			return nil, p.error("expected '}' after enum variants")
+		}
+		variant, err := p.parseEnumVariant()
+		if err != nil {
+			return nil, err
+		}
+		enumDef.Variants = append(enumDef.Variants, variant)
+
+		if p.curTokenIs(token.COMMA) {
+			p.nextToken()
+			continue
+		}
+		if !p.curTokenIs(token.RBRACE) {
+			return nil, p.errorf("expected ',' or '}' after enum variant, got %q", p.curToken.Literal)
+		}
+	}
+	enumDef.Rbrace = p.curToken
+	p.nextToken()
+
+	p.definedTypes[enumDef.Name.Value] = true
+
+	return enumDef, nil
+}
+
+func (p *Parser) parseEnumVariant() (*ast.EnumVariant, error) {
+	if !p.curTokenIs(token.IDENTIFIER) {
+		return nil, p.errorf("expected enum variant name, got %q", p.curToken.Literal)
+	}
+	variant := &ast.EnumVariant{
+		Name: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal},
+	}
+	p.nextToken()
+
+	if !p.curTokenIs(token.ASSIGN) {
+		return variant, nil
+	}
+	p.nextToken() // consume '='
+
+	var minus *token.Token
+	if p.curTokenIs(token.MINUS) {
+		tok := p.curToken
+		minus = &tok
+		p.nextToken()
+	}
+	if !p.curTokenIs(token.NUMBER) {
+		return nil, p.errorf("expected integer value for enum variant %s", variant.Name.Value)
+	}
+	value, err := p.parseNumberType()
+	if err != nil {
+		return nil, err
+	}
+	p.nextToken()
+
+	variant.Value = value
+	if minus != nil {
+		variant.Value = &ast.PrefixExpression{Token: *minus, Operator: *minus, Right: value}
+	}
+	return variant, nil
+}
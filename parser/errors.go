@@ -1,9 +1,11 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
+	"github.com/dfirebaugh/punch/diagnostic"
 	"github.com/dfirebaugh/punch/token"
 	"github.com/sirupsen/logrus"
 )
@@ -14,24 +16,77 @@ func init() {
 	logrus.SetLevel(logrus.ErrorLevel)
 }
 
-func (p *Parser) noPrefixParseFnError(t token.Type) {
-	msg := fmt.Sprintf("%s:\tno prefix parse function for %s found", p.curToken.Position, t)
-	p.error(msg)
+func (p *Parser) noPrefixParseFnError() error {
+	if p.curTokenIs(token.EOF) {
+		return p.error("unexpected end of file")
+	}
+	return p.errorf("unexpected %q", p.curToken.Literal)
 }
 
+// errorf returns a diagnostic pointing at the current token.
 func (p *Parser) errorf(format string, args ...interface{}) error {
-	message := fmt.Sprintf(format, args...)
-	if !showFileName {
-		return fmt.Errorf("[%d:%d]: %s", p.curToken.Position.Line, p.curToken.Position.Column, message)
-	}
-	return fmt.Errorf("%s:[%d:%d]: %s", p.curToken.Position.Filename, p.curToken.Position.Line, p.curToken.Position.Column, message)
+	return p.diagnostic(fmt.Sprintf(format, args...))
+}
+
+// errorAt returns a diagnostic pointing at tok.
+func (p *Parser) errorAt(tok token.Token, format string, args ...interface{}) error {
+	return p.diagnosticAt(tok, fmt.Sprintf(format, args...))
 }
 
 func (p *Parser) error(msg ...string) error {
+	return p.diagnostic(strings.Join(msg, " "))
+}
+
+func (p *Parser) diagnostic(msg string) diagnostic.Diagnostic {
+	return p.diagnosticAt(p.curToken, msg)
+}
+
+func (p *Parser) diagnosticAt(tok token.Token, msg string) diagnostic.Diagnostic {
+	d := diagnostic.New(tok, "%s", msg)
 	if !showFileName {
-		return fmt.Errorf("[%d:%d]: %s", p.curToken.Position.Line, p.curToken.Position.Column, strings.Join(msg, " "))
+		d.Pos.Filename = ""
+		d.End.Filename = ""
+	}
+	return d
+}
+
+// addError records an error so that parsing can continue and report every
+// syntax error in the file at once.
+func (p *Parser) addError(err error) {
+	var d diagnostic.Diagnostic
+	if errors.As(err, &d) {
+		p.errors = append(p.errors, d)
+		return
+	}
+	p.errors = append(p.errors, p.diagnostic(err.Error()))
+}
+
+// recoverFrom records a parse error and skips ahead to the next statement
+// boundary (a '}', a keyword or the start of a new line).
+func (p *Parser) recoverFrom(err error, start token.Token) {
+	p.addError(err)
+	line := p.curToken.Position.Line
+
+	// always make progress so that a statement can't fail at the same token twice
+	if p.curToken.Position == start.Position && !p.curTokenIs(token.RBRACE) {
+		p.nextToken()
+	}
+
+	for !p.curTokenIs(token.EOF) {
+		if p.curTokenIs(token.RBRACE) || p.curToken.Position.Line > line || p.isStatementKeyword(p.curToken) {
+			return
+		}
+		p.nextToken()
+	}
+}
+
+func (p *Parser) isStatementKeyword(t token.Token) bool {
+	switch t.Type {
+	case token.FUNCTION, token.RETURN, token.IF, token.FOR, token.BREAK, token.CONTINUE, token.STRUCT,
+		token.ENUM, token.INTERFACE, token.TEST, token.PUB, token.DEFER, token.MAP, token.IMPORT, token.PACKAGE:
+		return true
 	}
-	return fmt.Errorf("%s:[%d:%d]: %s", p.curToken.Position.Filename, p.curToken.Position.Line, p.curToken.Position.Column, strings.Join(msg, " "))
+	return false
 }
 
 func (p *Parser) debug(msg ...string) {
@@ -50,6 +105,6 @@ func (p *Parser) trace(msg ...string) {
 	logrus.Tracef("%s:[%d:%d]: %s", p.curToken.Position.Filename, p.curToken.Position.Line, p.curToken.Position.Column, strings.Join(msg, " "))
 }
 
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() diagnostic.List {
 	return p.errors
 }
@@ -0,0 +1,99 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dfirebaugh/punch/diagnostic"
+	"github.com/dfirebaugh/punch/lexer"
+)
+
+func TestParseReportsEveryError(t *testing.T) {
+	source := `pkg main
+
+fn main() {
+  i32 a = )
+  println(a)
+}
+
+fn other() {
+  i32 b = ]
+}
+
+fn third() {
+  return (
+}
+`
+	p := New(lexer.New("main.pun", source))
+	program, err := p.ParseProgram("main.pun")
+	if program == nil {
+		t.Fatalf("expected a partial program")
+	}
+
+	var diags diagnostic.List
+	if !errors.As(err, &diags) {
+		t.Fatalf("expected a diagnostic list, got %v", err)
+	}
+
+	wantLines := []int{4, 9, 13}
+	if len(diags) != len(wantLines) {
+		t.Fatalf("expected %d errors, got %d:\n%s", len(wantLines), len(diags), diags)
+	}
+	for i, line := range wantLines {
+		if diags[i].Pos.Line != line {
+			t.Errorf("error %d: expected line %d, got %d (%s)", i, line, diags[i].Pos.Line, diags[i].Message)
+		}
+	}
+}
+
+func TestParseReportsMisplacedBranches(t *testing.T) {
+	source := `pkg main
+
+fn main() {
+  break
+  outer: for i in 0..3 {
+    fn() f = fn() {
+      continue
+    }
+    outer: for j in 0..3 {
+      continue inner
+      break outer
+    }
+  }
+}
+`
+	_, err := New(lexer.New("main.pun", source)).ParseProgram("main.pun")
+	var diags diagnostic.List
+	if !errors.As(err, &diags) {
+		t.Fatalf("expected a diagnostic list, got %v", err)
+	}
+
+	wantLines := []int{4, 7, 9, 10}
+	if len(diags) != len(wantLines) {
+		t.Fatalf("expected %d errors, got %d:\n%s", len(wantLines), len(diags), diags)
+	}
+	for i, line := range wantLines {
+		if diags[i].Pos.Line != line {
+			t.Errorf("error %d: expected line %d, got %d (%s)", i, line, diags[i].Pos.Line, diags[i].Message)
+		}
+	}
+}
+
+func TestParseErrorMessages(t *testing.T) {
+	source := `pkg main
+
+fn main() {
+  if a b {
+  }
+}
+`
+	_, err := New(lexer.New("main.pun", source)).ParseProgram("main.pun")
+	var diags diagnostic.List
+	if !errors.As(err, &diags) || len(diags) == 0 {
+		t.Fatalf("expected a diagnostic list, got %v", err)
+	}
+	want := "expected '{' after if condition, got b instead"
+	if diags[0].Message != want {
+		t.Errorf("got message %q, want %q", diags[0].Message, want)
+	}
+}
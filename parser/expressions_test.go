@@ -0,0 +1,317 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/lexer"
+)
+
+func parseStatements(t *testing.T, body string) []ast.Statement {
+	t.Helper()
+	source := "pkg main\nfn main() {\n" + body + "\n}\n"
+	program, err := New(lexer.New("main.pun", source)).ParseProgram("main.pun")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return program.Files[0].Statements[0].(*ast.FunctionStatement).Body.Statements
+}
+
+func TestOperatorPrecedence(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"a - b - c", "((a - b) - c)"},
+		{"a * b + c", "((a * b) + c)"},
+		{"a + b * c", "(a + (b * c))"},
+		{"a / b * c % d", "((a / b) * (c % d))"},
+		{"a + b < c * d", "((a + b) < (c * d))"},
+		{"a < b == c > d", "((a < b) == (c > d))"},
+		{"a > 0 && b > 0 || c", "(((a > 0) && (b > 0)) || c)"},
+		{"a || b && c", "(a || (b && c))"},
+		{"-a + b", "(( - a) + b)"},
+		{"!a && b", "(( ! a) && b)"},
+		{"f(a + b) * c", "(f((a + b)) * c)"},
+		{"s[i] + 1", "((s[i]) + 1)"},
+		{"s[a:b] + t", "((s[a:b]) + t)"},
+		{"s[:b]", "(s[:b])"},
+		{"s[a + 1:]", "(s[(a + 1):])"},
+		{`"b" > s`, "(b > s)"},
+	}
+	for _, tt := range tests {
+		stmts := parseStatements(t, "println("+tt.input+")")
+		call := stmts[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionCall)
+		if got := call.Arguments[0].String(); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestElseIf(t *testing.T) {
+	stmts := parseStatements(t, `if a {
+  x = 1
+} else if b {
+  x = 2
+} else {
+  x = 3
+}
+x = 4`)
+	if len(stmts) != 2 {
+		t.Fatalf("expected 2 statements, got %d", len(stmts))
+	}
+	outer := stmts[0].(*ast.IfStatement)
+	if len(outer.Alternative.Statements) != 1 {
+		t.Fatalf("expected the else block to hold the else if, got %d statements", len(outer.Alternative.Statements))
+	}
+	inner, ok := outer.Alternative.Statements[0].(*ast.IfStatement)
+	if !ok {
+		t.Fatalf("expected an if statement, got %T", outer.Alternative.Statements[0])
+	}
+	if inner.Condition.String() != "b" || inner.Alternative == nil {
+		t.Errorf("unexpected else if: %s", inner.String())
+	}
+}
+
+func TestFunctionLiteral(t *testing.T) {
+	source := "pkg main\nfn(i32) i32 adder(i32 n) {\n  return fn(i32 x) i32 { return x + n }\n}\nfn main() {\n  fn(fn(i32) i32, i32) bool f = check\n}\n"
+	program, err := New(lexer.New("main.pun", source)).ParseProgram("main.pun")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stmts := program.Files[0].Statements
+	fn := stmts[0].(*ast.FunctionStatement)
+	if len(fn.ReturnTypes) != 1 || fn.ReturnTypes[0].Value != "fn(i32) i32" {
+		t.Errorf("unexpected results: %s", fn.String())
+	}
+	lit, ok := fn.Body.Statements[0].(*ast.ReturnStatement).ReturnValues[0].(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("expected a function literal, got %s", fn.Body.Statements[0].String())
+	}
+	if len(lit.Parameters) != 1 || lit.Parameters[0].Type != "i32" || lit.ReturnTypes[0].Value != "i32" {
+		t.Errorf("unexpected literal: %s", lit.String())
+	}
+	decl, ok := stmts[1].(*ast.FunctionStatement).Body.Statements[0].(*ast.VariableDeclaration)
+	if !ok {
+		t.Fatalf("expected a variable declaration, got %T", stmts[1].(*ast.FunctionStatement).Body.Statements[0])
+	}
+	if decl.Type.Literal != "fn(fn(i32) i32, i32) bool" {
+		t.Errorf("got type %s", decl.Type.Literal)
+	}
+}
+
+func TestFunctionValues(t *testing.T) {
+	source := "pkg main\nstruct calc {\n\tfn(i32) i32 op\n}\nfn main() {\n\tadder(2)(3)\n\t[]fn() i32 fs = {one}\n\tfs[0]()\n}\n"
+	program, err := New(lexer.New("main.pun", source)).ParseProgram("main.pun")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stmts := program.Files[0].Statements
+	if field := stmts[0].(*ast.StructDefinition).Fields[0]; field.Name.Value != "op" || field.Type != "fn(i32) i32" {
+		t.Errorf("unexpected field: %s %s", field.Type, field.Name.Value)
+	}
+	body := stmts[1].(*ast.FunctionStatement).Body.Statements
+	call, ok := body[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionCall)
+	if !ok {
+		t.Fatalf("expected a function call, got %s", body[0].String())
+	}
+	if _, ok := call.Function.(*ast.FunctionCall); !ok {
+		t.Errorf("expected a call of a call, got %T", call.Function)
+	}
+	if decl, ok := body[1].(*ast.ListDeclaration); !ok || decl.Type != "fn() i32" {
+		t.Errorf("unexpected declaration: %s", body[1].String())
+	}
+	call, ok = body[2].(*ast.ExpressionStatement).Expression.(*ast.FunctionCall)
+	if !ok {
+		t.Fatalf("expected a function call, got %s", body[2].String())
+	}
+	if _, ok := call.Function.(*ast.IndexExpression); !ok {
+		t.Errorf("expected a call of an index, got %T", call.Function)
+	}
+}
+
+func TestMultipleResults(t *testing.T) {
+	source := "pkg main\n(i32, bool) pair(i32 a) {\n  return a + 1, a == 0\n}\nfn main() {\n  i32 n, bool z = pair(1)\n}\n"
+	program, err := New(lexer.New("main.pun", source)).ParseProgram("main.pun")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stmts := program.Files[0].Statements
+	fn := stmts[0].(*ast.FunctionStatement)
+	if len(fn.ReturnTypes) != 2 || fn.ReturnTypes[1].Value != "bool" {
+		t.Errorf("unexpected results: %s", fn.String())
+	}
+	ret := fn.Body.Statements[0].(*ast.ReturnStatement)
+	if len(ret.ReturnValues) != 2 {
+		t.Errorf("expected 2 return values, got %d", len(ret.ReturnValues))
+	}
+	decl, ok := stmts[1].(*ast.FunctionStatement).Body.Statements[0].(*ast.DestructuringDeclaration)
+	if !ok {
+		t.Fatalf("expected a destructuring declaration, got %T", stmts[1].(*ast.FunctionStatement).Body.Statements[0])
+	}
+	if got := decl.String(); got != "i32 n, bool z = pair(1);" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestHashLiteral(t *testing.T) {
+	source := "pkg main\nmap[str]i32 count(map[str]i32 m, str k) {\n  m[k] = m[k] + 1\n  return m\n}\nfn main() {\n  map[str]i32 ages = {\n    \"ann\": 31,\n    \"bob\": 40 + 2,\n  }\n  map[i32]str names = {}\n}\n"
+	program, err := New(lexer.New("main.pun", source)).ParseProgram("main.pun")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stmts := program.Files[0].Statements
+	fn := stmts[0].(*ast.FunctionStatement)
+	if fn.ReturnTypes[0].Value != "map[str]i32" || fn.Parameters[0].Type != "map[str]i32" {
+		t.Errorf("unexpected function: %s", fn.String())
+	}
+	assignment, ok := fn.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IndexAssignment)
+	if !ok {
+		t.Fatalf("expected an index assignment, got %s", fn.Body.Statements[0].String())
+	}
+	if got := assignment.String(); got != "(m[k]) = ((m[k]) + 1)" {
+		t.Errorf("got %s", got)
+	}
+	body := stmts[1].(*ast.FunctionStatement).Body.Statements
+	for i, want := range []string{"{ann: 31, bob: (40 + 2)}", "{}"} {
+		decl, ok := body[i].(*ast.VariableDeclaration)
+		if !ok {
+			t.Fatalf("expected a variable declaration, got %T", body[i])
+		}
+		if _, ok := decl.Value.(*ast.HashLiteral); !ok || decl.Value.String() != want {
+			t.Errorf("got %s, want %s", decl.Value.String(), want)
+		}
+	}
+}
+
+func TestForIn(t *testing.T) {
+	stmts := parseStatements(t, "for i, name in names {\n  println(i, name)\n}\nfor ch in s {\n}\nfor i in 0..len(s) - 1 {\n}\ni32 n = 1\n")
+	tests := []struct {
+		vars     int
+		iterable string
+	}{
+		{2, "names"},
+		{1, "s"},
+		{1, "0..(len(s) - 1)"},
+	}
+	for i, tt := range tests {
+		loop, ok := stmts[i].(*ast.ForInStatement)
+		if !ok {
+			t.Fatalf("expected a for in statement, got %T", stmts[i])
+		}
+		if len(loop.Vars) != tt.vars || loop.Iterable.String() != tt.iterable {
+			t.Errorf("got %d variables and %s, want %d and %s", len(loop.Vars), loop.Iterable.String(), tt.vars, tt.iterable)
+		}
+	}
+	if len(stmts[0].(*ast.ForInStatement).Body.Statements) != 1 {
+		t.Errorf("expected the body to have one statement")
+	}
+	if _, ok := stmts[3].(*ast.VariableDeclaration); !ok {
+		t.Errorf("expected a variable declaration after the loops, got %T", stmts[3])
+	}
+}
+
+func TestLabeledLoops(t *testing.T) {
+	stmts := parseStatements(t, "outer: for i in 0..3 {\n  for i32 j = 0; j < 3; j = j + 1 {\n    continue outer\n    break\n    n = 2\n  }\n}\n")
+	outer, ok := stmts[0].(*ast.ForInStatement)
+	if !ok || outer.Label == nil || outer.Label.Value != "outer" {
+		t.Fatalf("expected a loop labeled outer, got %s", stmts[0].String())
+	}
+	inner := outer.Body.Statements[0].(*ast.ForStatement)
+	if inner.Label != nil {
+		t.Errorf("expected the inner loop to have no label, got %s", inner.Label.Value)
+	}
+	// the identifier on the line after break starts a statement rather
+	// than naming a label
+	body := inner.Body.Statements
+	if len(body) != 3 {
+		t.Fatalf("expected 3 statements in the inner loop, got %d", len(body))
+	}
+	for i, want := range []string{"continue outer", "break"} {
+		if body[i].String() != want {
+			t.Errorf("got %s, want %s", body[i].String(), want)
+		}
+	}
+}
+
+func TestForForms(t *testing.T) {
+	stmts := parseStatements(t, "for {\n  break\n}\nfor n < 3 {\n  n = n + 1\n}\nfor true {\n}\nfor i := 0; i < 3; i = i + 1 {\n}\nlp: for {\n  break lp\n}\ni32 n = 1\n")
+	tests := []struct {
+		init      bool
+		condition string
+		post      bool
+	}{
+		{false, "", false},
+		{false, "(n < 3)", false},
+		{false, "true", false},
+		{true, "(i < 3)", true},
+		{false, "", false},
+	}
+	for i, tt := range tests {
+		loop, ok := stmts[i].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("expected a for statement, got %T", stmts[i])
+		}
+		condition := ""
+		if loop.Condition != nil {
+			condition = loop.Condition.String()
+		}
+		if loop.Init != nil != tt.init || condition != tt.condition || loop.Post != nil != tt.post {
+			t.Errorf("loop %d: got init %v, condition %q and post %v, want %v, %q and %v",
+				i, loop.Init != nil, condition, loop.Post != nil, tt.init, tt.condition, tt.post)
+		}
+		if len(loop.Body.Statements) > 1 {
+			t.Errorf("loop %d: expected at most one statement in the body, got %d", i, len(loop.Body.Statements))
+		}
+	}
+	if _, ok := stmts[5].(*ast.VariableDeclaration); !ok {
+		t.Errorf("expected a variable declaration after the loops, got %T", stmts[5])
+	}
+}
+
+func TestStructLiteralsInControlBodies(t *testing.T) {
+	source := `pkg main
+struct pt {
+	i32 x
+}
+fn main() {
+	if c {
+		pt a = pt {
+			x: 1,
+		}
+	} else {
+		pt b = pt {
+			x: 2,
+		}
+	}
+	if c {
+		for i in 0..2 {
+			pt d = pt {
+				x: 3,
+			}
+		}
+	}
+	if f(fn() {
+		pt e = pt {
+			x: 4,
+		}
+	}) {
+	}
+}
+`
+	program, err := New(lexer.New("main.pun", source)).ParseProgram("main.pun")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body := program.Files[0].Statements[1].(*ast.FunctionStatement).Body.Statements
+	first := body[0].(*ast.IfStatement)
+	for _, block := range []*ast.BlockStatement{first.Consequence, first.Alternative} {
+		decl, ok := block.Statements[0].(*ast.VariableDeclaration)
+		if !ok {
+			t.Fatalf("expected a variable declaration, got %T", block.Statements[0])
+		}
+		if _, ok := decl.Value.(*ast.StructLiteral); !ok {
+			t.Errorf("expected a struct literal, got %T", decl.Value)
+		}
+	}
+}
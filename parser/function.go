@@ -1,27 +1,87 @@
 package parser
 
 import (
+	"strings"
+
 	"github.com/dfirebaugh/punch/ast"
 	"github.com/dfirebaugh/punch/token"
 )
 
 func (p *Parser) parseFunctionStatement() (*ast.FunctionStatement, error) {
 	var isExported bool
-	var returnType *ast.Identifier
+	var returnTypes []*ast.Identifier
+	start := p.curToken
 
 	if p.curToken.Type == token.PUB {
 		isExported = true
 		p.nextToken()
 	}
 
-	if p.isTypeToken(p.curToken) || p.isStructType(p.curToken) {
-		returnType = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if p.isFunctionType() || p.isMapType() {
+		result, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		returnTypes = []*ast.Identifier{{Token: result, Value: result.Literal}}
+	} else if p.isResultList() {
+		var err error
+		returnTypes, err = p.parseResultList()
+		if err != nil {
+			return nil, err
+		}
+	} else if p.isTypeToken(p.curToken) || p.isStructType(p.curToken) {
+		returnTypes = []*ast.Identifier{{Token: p.curToken, Value: p.curToken.Literal}}
 		p.nextToken()
 	} else if p.curToken.Type == token.FUNCTION {
 		p.nextToken()
 	} else {
 		return nil, p.errorf("expected return type or 'fn', got %s instead", p.curToken.Type)
 	}
+	return p.parseFunction(start, isExported, returnTypes)
+}
+
+// parseTypedStatement parses a statement that starts with a function or a
+// map type. It either declares a variable of that type, e.g.
+// `fn(i32) i32 double = fn(i32 n) i32 { return n * 2 }` or
+// `map[str]i32 ages = {"ann": 31}`, or a function that returns one.
+func (p *Parser) parseTypedStatement() (ast.Statement, error) {
+	start := p.curToken
+	typ, err := p.parseType()
+	if err != nil {
+		return nil, err
+	}
+	if !p.curTokenIs(token.IDENTIFIER) || !p.peekTokenIs(token.ASSIGN) {
+		return p.parseFunction(start, false, []*ast.Identifier{{Token: typ, Value: typ.Literal}})
+	}
+
+	decl := &ast.VariableDeclaration{
+		Type: typ,
+		Name: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal},
+	}
+	p.nextToken() // consume the name
+	p.nextToken() // consume '='
+	if start.Type == token.MAP && p.curTokenIs(token.LBRACE) {
+		decl.Value, err = p.parseHashLiteral()
+	} else {
+		decl.Value, err = p.parseValue()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decl, nil
+}
+
+// parseFunction parses the rest of a function declaration once its result
+// types are known, starting at the receiver or the name.
+func (p *Parser) parseFunction(start token.Token, isExported bool, returnTypes []*ast.Identifier) (*ast.FunctionStatement, error) {
+	var receiver *ast.Parameter
+	if p.curTokenIs(token.LPAREN) {
+		var err error
+		receiver, err = p.parseReceiver()
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	ident, err := p.parseIdentifier()
 	if err != nil {
@@ -44,23 +104,153 @@ func (p *Parser) parseFunctionStatement() (*ast.FunctionStatement, error) {
 		return nil, p.error("expected '{' to start function body")
 	}
 
-	body, err := p.parseBlockStatement()
+	body, err := p.parseFunctionBody()
 	if err != nil {
 		return nil, err
 	}
 
 	stmt := &ast.FunctionStatement{
-		IsExported: isExported,
-		ReturnType: returnType,
-		Name:       ident.(*ast.Identifier),
-		Parameters: params,
-		Body:       body,
+		Token:       start,
+		IsExported:  isExported,
+		Receiver:    receiver,
+		Name:        ident.(*ast.Identifier),
+		Parameters:  params,
+		Body:        body,
+		ReturnTypes: returnTypes,
 	}
 
 	p.trace("end of parsing function statement")
 	return stmt, nil
 }
 
+// parseFunctionLiteral parses an anonymous function such as
+// `fn(i32 n) i32 { return n * 2 }`, leaving the parser after its body.
+func (p *Parser) parseFunctionLiteral() (ast.Expression, error) {
+	lit := &ast.FunctionLiteral{Token: p.curToken}
+	p.nextToken() // consume 'fn'
+
+	params, err := p.parseFunctionParameters()
+	if err != nil {
+		return nil, err
+	}
+	lit.Parameters = params
+
+	if !p.curTokenIs(token.LBRACE) {
+		result, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		lit.ReturnTypes = []*ast.Identifier{{Token: result, Value: result.Literal}}
+	}
+	if !p.expectCurrentTokenIs(token.LBRACE) {
+		return nil, p.error("expected '{' to start function body")
+	}
+	lit.Body, err = p.parseFunctionBody()
+	if err != nil {
+		return nil, err
+	}
+	p.nextToken() // consume '}'
+	return lit, nil
+}
+
+// parseFunctionType parses a function type such as `fn(i32, str) bool`. The
+// type is returned as a single token that spells all of it, which is how
+// the checker refers to it.
+func (p *Parser) parseFunctionType() (token.Token, error) {
+	start := p.curToken
+	p.nextToken() // consume 'fn'
+	p.nextToken() // consume '('
+
+	var params []string
+	for !p.curTokenIs(token.RPAREN) {
+		param, err := p.parseType()
+		if err != nil {
+			return token.Token{}, err
+		}
+		params = append(params, param.Literal)
+		if p.curTokenIs(token.COMMA) {
+			p.nextToken()
+		} else if !p.curTokenIs(token.RPAREN) {
+			return token.Token{}, p.errorf("expected ',' or ')' after parameter type, got %s instead", p.curToken.Literal)
+		}
+	}
+	p.nextToken() // consume ')'
+
+	name := "fn(" + strings.Join(params, ", ") + ")"
+	if p.isFunctionType() || p.isMapType() || p.isTypeToken(p.curToken) || p.curTokenIs(token.LBRACKET) && p.peekTokenIs(token.RBRACKET) {
+		result, err := p.parseType()
+		if err != nil {
+			return token.Token{}, err
+		}
+		name += " " + result.Literal
+	}
+	return token.Token{Type: token.IDENTIFIER, Literal: name, Position: start.Position}, nil
+}
+
+// parseType parses the type of a parameter or a result of a function type
+// or a function literal. List, map and function types are returned as a
+// token that spells the whole type.
+func (p *Parser) parseType() (token.Token, error) {
+	if p.isFunctionType() {
+		return p.parseFunctionType()
+	}
+	if p.isMapType() {
+		return p.parseMapType()
+	}
+	if p.curTokenIs(token.LBRACKET) && p.peekTokenIs(token.RBRACKET) {
+		start := p.curToken
+		p.nextToken() // consume '['
+		p.nextToken() // consume ']'
+		elem, err := p.parseType()
+		if err != nil {
+			return token.Token{}, err
+		}
+		return token.Token{Type: token.IDENTIFIER, Literal: "[]" + elem.Literal, Position: start.Position}, nil
+	}
+	if !p.isTypeToken(p.curToken) {
+		return token.Token{}, p.errorf("expected a type, got %s instead", p.curToken.Literal)
+	}
+	typ := p.curToken
+	p.nextToken()
+	return typ, nil
+}
+
+// parseResultList parses the types in parentheses in front of a function
+// that returns several values, e.g. `(i32, bool)`.
+func (p *Parser) parseResultList() ([]*ast.Identifier, error) {
+	var types []*ast.Identifier
+	p.nextToken() // consume '('
+	for !p.curTokenIs(token.RPAREN) {
+		if !p.isTypeToken(p.curToken) {
+			return nil, p.errorf("expected a result type, got %s instead", p.curToken.Literal)
+		}
+		types = append(types, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+		p.nextToken()
+		if p.curTokenIs(token.COMMA) {
+			p.nextToken()
+		} else if !p.curTokenIs(token.RPAREN) {
+			return nil, p.errorf("expected ',' or ')' after result type, got %s instead", p.curToken.Literal)
+		}
+	}
+	p.nextToken() // consume ')'
+	return types, nil
+}
+
+// parseReceiver parses the `(rect r)` that attaches a method to a struct.
+func (p *Parser) parseReceiver() (*ast.Parameter, error) {
+	p.nextToken() // consume '('
+	receiver, err := p.parseFunctionParameter()
+	if err != nil {
+		return nil, err
+	}
+	if !p.expectPeek(token.RPAREN) {
+		return nil, p.errorf("expected ')' after receiver %s", receiver.Identifier.Value)
+	}
+	p.nextToken() // consume the receiver name
+	p.nextToken() // consume ')'
+	return receiver, nil
+}
+
 func (p *Parser) parseFunctionParameters() ([]*ast.Parameter, error) {
 	parameters := []*ast.Parameter{}
 
@@ -93,12 +283,20 @@ func (p *Parser) parseFunctionParameters() ([]*ast.Parameter, error) {
 }
 
 func (p *Parser) parseFunctionParameter() (*ast.Parameter, error) {
-	if !p.isTypeToken(p.curToken) {
-		return nil, p.errorf("expected type token, got %s instead", p.curToken.Type)
+	var paramType token.Token
+	if p.isFunctionType() || p.isMapType() {
+		var err error
+		paramType, err = p.parseType()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if !p.isTypeToken(p.curToken) {
+			return nil, p.errorf("expected type token, got %s instead", p.curToken.Type)
+		}
+		paramType = p.curToken
+		p.nextToken()
 	}
-	paramType := p.curToken
-
-	p.nextToken()
 
 	if !p.curTokenIs(token.IDENTIFIER) {
 		return nil, p.errorf("expected identifier token, got %s instead", p.curToken.Type)
@@ -114,7 +312,7 @@ func (p *Parser) parseFunctionParameter() (*ast.Parameter, error) {
 			},
 			Value: paramName,
 		},
-		Type: paramType.Type,
+		Type: p.typeName(paramType),
 	}, nil
 }
 
@@ -133,16 +331,35 @@ func (p *Parser) parseFunctionCall(function ast.Expression) (ast.Expression, err
 		p.nextToken() // consume (
 	}
 	if p.curTokenIs(token.RPAREN) {
+		exp.Rparen = p.curToken
 		p.nextToken()
 		return exp, err
 	}
 	exp.Arguments, err = p.parseFunctionCallArguments()
+	if p.prevToken.Type == token.RPAREN {
+		exp.Rparen = p.prevToken
+	}
 
 	p.trace("parsed function call after args", p.curToken.Literal, p.peekToken.Literal)
 
 	return exp, err
 }
 
+// parseCalls parses the calls that follow an expression that yields a
+// function, such as adder(2)(3) or handlers[0](). A call starts on the line
+// the expression ends on so that a parenthesis on the next line starts a
+// statement of its own.
+func (p *Parser) parseCalls(fn ast.Expression) (ast.Expression, error) {
+	for p.curTokenIs(token.LPAREN) && p.curToken.Position.Line == p.prevToken.Position.Line {
+		call, err := p.parseFunctionCall(fn)
+		if err != nil {
+			return nil, err
+		}
+		fn = call
+	}
+	return fn, nil
+}
+
 func (p *Parser) parseFunctionCallArguments() ([]ast.Expression, error) {
 	args := []ast.Expression{}
 	p.trace("parsing func call args beginning", p.curToken.Literal, p.peekToken.Literal)
@@ -204,21 +421,30 @@ func (p *Parser) parseReturnStatement() (*ast.ReturnStatement, error) {
 
 	p.nextToken() // consume 'return' keyword
 
-	if p.curTokenIs(token.SEMICOLON) || p.curTokenIs(token.RBRACE) {
+	if p.curTokenIs(token.RBRACE) {
+		return stmt, nil // leave the '}' for the enclosing block
+	}
+	if p.curTokenIs(token.SEMICOLON) {
 		p.nextToken() // consume semicolon if present
 		return stmt, nil
 	}
 
-	expr, err := p.parseExpression(LOWEST)
-	if err != nil {
-		return nil, err
-	}
-
-	if expr != nil {
+	for {
+		expr, err := p.parseExpression(LOWEST)
+		if err != nil {
+			return nil, err
+		}
+		if expr == nil {
+			return nil, p.error("expected expression after 'return'")
+		}
 		p.trace("return expression parsed:", expr.String())
 		stmt.ReturnValues = append(stmt.ReturnValues, expr)
-	} else {
-		return nil, p.error("expected expression after 'return'")
+
+		// the values of a function with several results are comma separated
+		if !p.curTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
 	}
 
 	if p.curTokenIs(token.SEMICOLON) {
@@ -227,3 +453,11 @@ func (p *Parser) parseReturnStatement() (*ast.ReturnStatement, error) {
 
 	return stmt, nil
 }
+
+// parseFunctionBody parses the body of a function or a function literal,
+// which break and continue cannot leave.
+func (p *Parser) parseFunctionBody() (*ast.BlockStatement, error) {
+	p.controls = append(p.controls, control{kind: controlFunction})
+	defer p.exitControlStatement()
+	return p.parseBlockStatement()
+}
@@ -0,0 +1,80 @@
+package parser
+
+import (
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/token"
+)
+
+// parseInterfaceDefinition parses an interface such as
+//
+//	interface shape {
+//		i32 area()
+//		fn scale(i32 factor)
+//	}
+func (p *Parser) parseInterfaceDefinition() (*ast.InterfaceDefinition, error) {
+	interfaceDef := &ast.InterfaceDefinition{
+		Token: p.curToken,
+	}
+
+	if !p.expectPeek(token.IDENTIFIER) {
+		return nil, p.error("expected identifier")
+	}
+	p.nextToken()
+	interfaceDef.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil, p.error("expected '{' after interface name")
+	}
+	p.nextToken() // consume the name
+	p.nextToken() // consume '{'
+
+	// register the name first so that methods can refer to the interface
+	p.definedTypes[interfaceDef.Name.Value] = true
+
+	for !p.curTokenIs(token.RBRACE) {
+		if p.curTokenIs(token.EOF) {
+			return nil, p.error("expected '}' after interface methods")
+		}
+		method, err := p.parseInterfaceMethod()
+		if err != nil {
+			return nil, err
+		}
+		interfaceDef.Methods = append(interfaceDef.Methods, method)
+	}
+	interfaceDef.Rbrace = p.curToken
+	p.nextToken()
+
+	return interfaceDef, nil
+}
+
+func (p *Parser) parseInterfaceMethod() (*ast.InterfaceMethod, error) {
+	method := &ast.InterfaceMethod{Token: p.curToken}
+
+	if p.isTypeToken(p.curToken) {
+		method.ReturnType = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	} else if !p.curTokenIs(token.FUNCTION) {
+		return nil, p.errorf("expected return type or 'fn', got %q", p.curToken.Literal)
+	}
+
+	if !p.expectPeek(token.IDENTIFIER) {
+		return nil, p.error("expected method name")
+	}
+	p.nextToken()
+	method.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil, p.errorf("expected '(' after method name %s", method.Name.Value)
+	}
+	p.nextToken()
+
+	params, err := p.parseFunctionParameters()
+	if err != nil {
+		return nil, err
+	}
+	method.Parameters = params
+	if p.prevToken.Type == token.RPAREN {
+		method.Rparen = p.prevToken
+	}
+
+	return method, nil
+}
@@ -3,7 +3,6 @@ package parser
 import (
 	"github.com/dfirebaugh/punch/ast"
 	"github.com/dfirebaugh/punch/token"
-	"github.com/sirupsen/logrus"
 )
 
 func (p *Parser) parseListLiteral() (ast.Expression, error) {
@@ -14,6 +13,9 @@ func (p *Parser) parseListLiteral() (ast.Expression, error) {
 	}
 	list := &ast.ListLiteral{Token: p.curToken}
 	list.Elements = p.parseExpressionList()
+	if p.curTokenIs(token.RBRACE) {
+		list.Rbrace = p.curToken
+	}
 	return list, nil
 }
 
@@ -26,14 +28,14 @@ func (p *Parser) parseListOperation() (ast.Expression, error) {
 
 	op.List, err = p.parseExpression(LOWEST)
 	if err != nil {
-		logrus.Error(err)
+		p.addError(err)
 	}
 
 	if p.curTokenIs(token.COMMA) {
 		p.nextToken()
 		op.Element, err = p.parseExpression(LOWEST)
 		if err != nil {
-			logrus.Error(err)
+			p.addError(err)
 		}
 	}
 
@@ -47,10 +49,13 @@ func (p *Parser) parseExpressionList() []ast.Expression {
 	if p.curTokenIs(token.LBRACE) {
 		p.nextToken() // consume '{'
 	}
+	if p.curTokenIs(token.RBRACE) {
+		return list
+	}
 
 	expression, err := p.parseExpression(LOWEST)
 	if err != nil {
-		logrus.Error(err)
+		p.addError(err)
 	}
 	list = append(list, expression)
 
@@ -61,7 +66,7 @@ func (p *Parser) parseExpressionList() []ast.Expression {
 		}
 		expression, err = p.parseExpression(LOWEST)
 		if err != nil {
-			logrus.Error(err)
+			p.addError(err)
 		}
 		list = append(list, expression)
 	}
@@ -69,7 +74,7 @@ func (p *Parser) parseExpressionList() []ast.Expression {
 	return list
 }
 
-func (p *Parser) parseListDeclaration() (*ast.ListDeclaration, error) {
+func (p *Parser) parseListDeclaration() (ast.Statement, error) {
 	decl := &ast.ListDeclaration{Token: p.curToken}
 	if p.curTokenIs(token.LBRACKET) {
 		p.nextToken()
@@ -77,12 +82,11 @@ func (p *Parser) parseListDeclaration() (*ast.ListDeclaration, error) {
 	if p.curTokenIs(token.RBRACKET) {
 		p.nextToken()
 	}
-	// Expect the type token (e.g., "let" or "const")
-	if !p.expectPeek(token.IDENTIFIER) {
-		return nil, p.error("expected type token")
+	elem, err := p.parseType()
+	if err != nil {
+		return nil, err
 	}
-	decl.Type = p.curToken.Type
-	p.nextToken()
+	decl.Type = p.typeName(elem)
 
 	// Expect the identifier token (name of the list)
 	if !p.expectCurrentTokenIs(token.IDENTIFIER) {
@@ -99,6 +103,20 @@ func (p *Parser) parseListDeclaration() (*ast.ListDeclaration, error) {
 	p.nextToken()
 	p.nextToken() // consume assign operator
 
+	// a list that is not written out as a literal, such as the result of
+	// a call, is declared like any other variable
+	if !p.curTokenIs(token.LBRACE) {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return &ast.VariableDeclaration{
+			Type:  token.Token{Type: token.IDENTIFIER, Literal: "[]" + elem.Literal, Position: decl.Token.Position},
+			Name:  decl.Name,
+			Value: value,
+		}, nil
+	}
+
 	listLiteral, err := p.parseListLiteral()
 	if err != nil {
 		return nil, err
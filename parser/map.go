@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/token"
+)
+
+// parseMapType parses a map type such as `map[str]i32`. Like a function
+// type it is returned as a single token that spells all of it.
+func (p *Parser) parseMapType() (token.Token, error) {
+	start := p.curToken
+	p.nextToken() // consume 'map'
+	p.nextToken() // consume '['
+
+	key, err := p.parseType()
+	if err != nil {
+		return token.Token{}, err
+	}
+	if !p.expectCurrentTokenIs(token.RBRACKET) {
+		return token.Token{}, p.errorf("expected ']' after map key type, got %s instead", p.curToken.Literal)
+	}
+	p.nextToken() // consume ']'
+
+	elem, err := p.parseType()
+	if err != nil {
+		return token.Token{}, err
+	}
+	name := "map[" + key.Literal + "]" + elem.Literal
+	return token.Token{Type: token.IDENTIFIER, Literal: name, Position: start.Position}, nil
+}
+
+// parseHashLiteral parses a map literal such as `{"a": 1, "b": 2}`,
+// leaving the parser after its closing brace.
+func (p *Parser) parseHashLiteral() (ast.Expression, error) {
+	hash := &ast.HashLiteral{Token: p.curToken}
+	p.nextToken() // consume '{'
+
+	for !p.curTokenIs(token.RBRACE) {
+		if p.curTokenIs(token.EOF) {
+			return nil, p.error("expected '}' after map literal")
+		}
+		key, err := p.parseExpression(LOWEST)
+		if err != nil {
+			return nil, err
+		}
+		if key == nil || !p.expectCurrentTokenIs(token.COLON) {
+			return nil, p.errorf("expected ':' after map key, got %s instead", p.curToken.Literal)
+		}
+		p.nextToken() // consume ':'
+
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		hash.Pairs = append(hash.Pairs, &ast.HashPair{Key: key, Value: value})
+
+		if p.curTokenIs(token.COMMA) {
+			p.nextToken()
+		} else if !p.curTokenIs(token.RBRACE) {
+			return nil, p.errorf("expected ',' or '}' after map value, got %s instead", p.curToken.Literal)
+		}
+	}
+	hash.Rbrace = p.curToken
+	p.nextToken() // consume '}'
+	return hash, nil
+}
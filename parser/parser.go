@@ -2,25 +2,49 @@ package parser
 
 import (
 	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/diagnostic"
 	"github.com/dfirebaugh/punch/lexer"
 	"github.com/dfirebaugh/punch/token"
 )
 
 type Parser struct {
 	l         *lexer.Lexer
+	prevToken token.Token
 	curToken  token.Token
 	peekToken token.Token
-	errors    []string
+	errors    diagnostic.List
 
 	prefixParseFns map[token.Type]prefixParseFn
 	infixParseFns  map[token.Type]infixParseFn
 
-	deferStack []ast.Statement
-
 	definedTypes      map[string]bool
 	structDefinitions map[string]*ast.StructDefinition
 
-	controlDepth int
+	// controls holds the control statements around the statement being
+	// parsed, innermost last
+	controls []control
+}
+
+// controlKind is the kind of a control statement.
+type controlKind int
+
+const (
+	// controlCondition is the condition of an if or the header of a loop,
+	// where a brace starts a block rather than a struct literal
+	controlCondition controlKind = iota
+	// controlLoop is the body of a loop, which break and continue can
+	// leave
+	controlLoop
+	// controlFunction is the body of a function, which break and continue
+	// cannot leave
+	controlFunction
+)
+
+// control is a control statement around the statement being parsed. label
+// is the label of a loop, if it has one.
+type control struct {
+	kind  controlKind
+	label string
 }
 
 type parseRule struct {
@@ -40,7 +64,7 @@ type ParseFn interface {
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:            l,
-		errors:       []string{},
+		errors:       diagnostic.List{},
 		definedTypes: make(map[string]bool),
 	}
 	p.prefixParseFns = make(map[token.Type]prefixParseFn)
@@ -89,6 +113,7 @@ func (p *Parser) registerParseRules() {
 		token.LEN:        {prefixFn: p.parseListOperation},
 		token.LPAREN:     {infixFn: p.parseFunctionCall},
 		token.STRUCT:     {prefixFn: p.parseStructLiteral},
+		token.FUNCTION:   {prefixFn: p.parseFunctionLiteral},
 	}
 	numberTypes := []token.Type{
 		token.U8, token.U16, token.U32, token.U64,
@@ -128,9 +153,31 @@ func (p *Parser) parseExpression(precedence int) (ast.Expression, error) {
 		return b, nil
 	}
 
+	if p.isHashLiteral() {
+		return p.parseHashLiteral()
+	}
+	if p.curTokenIs(token.LBRACE) {
+		// a list literal such as {1, 2} assigned to a list field
+		lit, err := p.parseListLiteral()
+		if err != nil {
+			return nil, err
+		}
+		if p.curTokenIs(token.RBRACE) {
+			p.nextToken()
+		}
+		return lit, nil
+	}
+
 	if p.curTokenIs(token.STRING) {
 		p.trace("parseExpression - parsing string literal:", p.curToken.Literal)
-		return p.parseStringLiteral()
+		lit, err := p.parseStringLiteral()
+		if err != nil {
+			return nil, err
+		}
+		if p.isBinaryOperator(p.curToken) {
+			return p.parseInfixExpression(lit)
+		}
+		return lit, nil
 	}
 
 	if p.isNumber() {
@@ -157,12 +204,25 @@ func (p *Parser) parseExpression(precedence int) (ast.Expression, error) {
 			p.nextToken()
 			return p.parseInfixExpression(n)
 		}
-		if p.curTokenIs(token.NUMBER) {
-			p.nextToken()
-		}
+		p.nextToken()
 		return n, nil
 	}
 
+	if p.isConversion() {
+		p.trace("parsing conversion", p.curToken.Literal, p.peekToken.Literal)
+		// a conversion such as i64(n) is a call to the type
+		typ := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		p.nextToken()
+		call, err := p.parseFunctionCall(typ)
+		if err != nil {
+			return nil, err
+		}
+		if p.isBinaryOperator(p.curToken) {
+			return p.parseInfixExpression(call)
+		}
+		return call, nil
+	}
+
 	if p.isIndexExpression() {
 		ident, err := p.parseIdentifier()
 		if err != nil {
@@ -214,6 +274,10 @@ func (p *Parser) parseExpression(precedence int) (ast.Expression, error) {
 			if err != nil {
 				return nil, err
 			}
+			fnCall, err = p.parseCalls(fnCall)
+			if err != nil {
+				return nil, err
+			}
 			p.trace("parsed identifier functioncall expression", p.curToken.Literal, p.peekToken.Literal)
 
 			if p.isBinaryOperator(p.curToken) {
@@ -230,6 +294,12 @@ func (p *Parser) parseExpression(precedence int) (ast.Expression, error) {
 		if ident == nil {
 			return nil, p.error("identifier is nil")
 		}
+		switch ident.(type) {
+		case *ast.InfixExpression, *ast.FunctionCall, *ast.IndexExpression, *ast.SliceExpression:
+			// a field access followed by an operator, a method call or an
+			// index has already been parsed up to its last token
+			return ident, nil
+		}
 		if p.isStructAccess() {
 			return p.parseStructFieldAccess(ident.(*ast.Identifier))
 		}
@@ -244,12 +314,19 @@ func (p *Parser) parseExpression(precedence int) (ast.Expression, error) {
 	}
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
-		return nil, p.errorf("no prefix parse function for %s", p.curToken.Literal)
+		return nil, p.noPrefixParseFnError()
 	}
+	operator := p.curToken
 	leftExp, err := prefix()
 	if err != nil {
 		return nil, err
 	}
+	switch operator.Type {
+	case token.BANG, token.MINUS, token.PLUS, token.FUNCTION:
+		// the operand or the body has already been parsed up to the token
+		// after it
+		return leftExp, nil
+	}
 
 	for precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
@@ -267,6 +344,7 @@ func (p *Parser) parseExpression(precedence int) (ast.Expression, error) {
 }
 
 func (p *Parser) nextToken() {
+	p.prevToken = p.curToken
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
 }
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"slices"
 	"strconv"
 
 	"github.com/dfirebaugh/punch/ast"
@@ -13,53 +14,58 @@ func (p *Parser) ParseProgram(filename string) (*ast.Program, error) {
 	program.Files = []*ast.File{}
 
 	for !p.curTokenIs(token.EOF) {
-		file, err := p.parseFile(filename)
-		if err != nil {
-			return nil, err
-		}
+		file := p.parseFile(filename)
 		if file != nil {
 			program.Files = append(program.Files, file)
 		}
 	}
 
-	return program, nil
+	// the partially parsed program is returned with the errors so tools can
+	// still show as much of the AST as possible
+	return program, p.errors.Err()
 }
 
-func (p *Parser) parseFile(filename string) (*ast.File, error) {
+func (p *Parser) parseFile(filename string) *ast.File {
 	file := &ast.File{
 		Filename: filename,
 	}
 
-	if !p.expectCurrentTokenIs(token.PACKAGE) {
-		return nil, p.error("expected 'pkg' keyword")
-	}
-	p.nextToken()
-	if !p.expectCurrentTokenIs(token.IDENTIFIER) {
-		return nil, p.error("expected package name")
+	if p.expectCurrentTokenIs(token.PACKAGE) {
+		p.nextToken()
+		if p.expectCurrentTokenIs(token.IDENTIFIER) {
+			file.PackageName = p.curToken.Literal
+			p.nextToken()
+		} else {
+			p.addError(p.diagnostic("expected package name").WithHint("name the package after 'pkg', e.g. `pkg main`"))
+		}
+	} else {
+		p.addError(p.diagnostic("expected 'pkg' keyword").WithHint("every file starts with a package clause, e.g. `pkg main`"))
 	}
-	file.PackageName = p.curToken.Literal
-	p.nextToken()
 
-	if p.curTokenIs(token.IMPORT) {
+	for p.curTokenIs(token.IMPORT) {
+		start := p.curToken
 		if err := p.parseImports(file); err != nil {
-			return nil, p.errorf("expected import path: %s", err)
+			p.recoverFrom(err, start)
 		}
 	}
 
 	for !p.curTokenIs(token.EOF) {
 		if p.curTokenIs(token.SEMICOLON) || p.curTokenIs(token.RBRACE) {
 			p.nextToken()
+			continue
 		}
+		start := p.curToken
 		stmt, err := p.parseStatement()
 		if err != nil {
-			return nil, err
+			p.recoverFrom(err, start)
+			continue
 		}
 		if stmt != nil {
 			file.Statements = append(file.Statements, stmt)
 		}
 	}
 
-	return file, nil
+	return file
 }
 
 func (p *Parser) parseImports(file *ast.File) error {
@@ -70,7 +76,7 @@ func (p *Parser) parseImports(file *ast.File) error {
 			if !p.expectCurrentTokenIs(token.STRING) {
 				return p.error("expected import path")
 			}
-			file.Imports = append(file.Imports, p.curToken.Literal)
+			file.Imports = append(file.Imports, &ast.Import{Token: p.curToken, Path: p.curToken.Literal})
 			p.nextToken()
 		}
 		p.nextToken()
@@ -78,7 +84,7 @@ func (p *Parser) parseImports(file *ast.File) error {
 		if !p.expectCurrentTokenIs(token.STRING) {
 			return p.error("expected import path")
 		}
-		file.Imports = append(file.Imports, p.curToken.Literal)
+		file.Imports = append(file.Imports, &ast.Import{Token: p.curToken, Path: p.curToken.Literal})
 		p.nextToken()
 	}
 
@@ -88,11 +94,19 @@ func (p *Parser) parseImports(file *ast.File) error {
 func (p *Parser) parseStatement() (ast.Statement, error) {
 	p.trace("parsing statement", p.curToken.Literal, p.peekToken.Literal)
 
+	if p.isFunctionType() || p.isMapType() {
+		return p.parseTypedStatement()
+	}
+
 	if p.isFunctionDeclaration() {
 		p.trace("parsing function declaration", p.curToken.Literal, p.peekToken.Literal)
 		return p.parseFunctionStatement()
 	}
 
+	if p.isDestructuringDeclaration() {
+		return p.parseDestructuringDeclaration()
+	}
+
 	if p.isVariableDeclaration() {
 		p.trace("parsing variable declaration", p.curToken.Literal, p.peekToken.Literal)
 		s, err := p.parseTypeBasedVariableDeclaration()
@@ -110,6 +124,12 @@ func (p *Parser) parseStatement() (ast.Statement, error) {
 		return p.parseExpressionStatement()
 	case token.STRUCT:
 		return p.parseStructDefinition()
+	case token.ENUM:
+		return p.parseEnumDefinition()
+	case token.INTERFACE:
+		return p.parseInterfaceDefinition()
+	case token.TEST:
+		return p.parseTestBlock()
 	case token.SLASH_SLASH:
 		p.parseComment()
 		return nil, nil
@@ -127,10 +147,17 @@ func (p *Parser) parseStatement() (ast.Statement, error) {
 	case token.IF:
 		return p.parseIfStatement()
 	case token.FOR:
-		return p.parseForStatement()
+		return p.parseLoop(nil)
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
 	case token.LBRACE:
 		return p.parseBlockStatement()
 	case token.IDENTIFIER:
+		if p.isLabeledLoop() {
+			return p.parseLabeledLoop()
+		}
 		if p.peekTokenIs(token.ASSIGN) {
 			return p.parseVariableDeclarationOrAssignment()
 		}
@@ -173,7 +200,7 @@ func (p *Parser) parseVariableDeclarationOrAssignment() (ast.Statement, error) {
 		p.nextToken() // consume assign operator
 	}
 
-	value, err := p.parseExpression(LOWEST)
+	value, err := p.parseValue()
 	if err != nil {
 		return nil, err
 	}
@@ -195,7 +222,12 @@ func (p *Parser) parseExpressionStatement() (*ast.ExpressionStatement, error) {
 	if stmt.Expression != nil {
 		p.trace("after parsing expression statement", stmt.Expression.String())
 		if p.curTokenIs(token.ASSIGN) {
-			assignment, err := p.parseStructFieldAssignment(stmt.Expression)
+			var assignment ast.Expression
+			if index, ok := stmt.Expression.(*ast.IndexExpression); ok {
+				assignment, err = p.parseIndexAssignment(index)
+			} else {
+				assignment, err = p.parseStructFieldAssignment(stmt.Expression)
+			}
 			if err != nil {
 				p.error(err.Error())
 			}
@@ -213,8 +245,11 @@ func (p *Parser) parseExpressionStatement() (*ast.ExpressionStatement, error) {
 	return stmt, nil
 }
 
+// parseNumberType parses an integer. Integers above the range of an i64 are
+// kept as the bits of a u64, and the checker reads their value from the
+// literal.
 func (p *Parser) parseNumberType() (ast.Expression, error) {
-	d, err := strconv.Atoi(p.curToken.Literal)
+	d, err := strconv.ParseUint(p.curToken.Literal, 10, 64)
 	if err != nil {
 		return nil, p.error("could not parse number")
 	}
@@ -293,8 +328,24 @@ func (p *Parser) parsePrefixExpression() (ast.Expression, error) {
 	p.nextToken()
 
 	expression.Right, err = p.parseExpression(PREFIX)
+	if err != nil {
+		return nil, err
+	}
 
-	return expression, err
+	return prefixed(expression), nil
+}
+
+// prefixed applies a prefix operator to the leftmost operand of the
+// expression it precedes. The expression is parsed together with the
+// operators that follow the operand, which bind less tightly.
+func prefixed(prefix *ast.PrefixExpression) ast.Expression {
+	infix, ok := prefix.Right.(*ast.InfixExpression)
+	if !ok {
+		return prefix
+	}
+	prefix.Right = infix.Left
+	infix.Left = prefixed(prefix)
+	return infix
 }
 
 func (p *Parser) parseInfixExpression(left ast.Expression) (ast.Expression, error) {
@@ -313,19 +364,34 @@ func (p *Parser) parseInfixExpression(left ast.Expression) (ast.Expression, erro
 	if err != nil {
 		return nil, err
 	}
+	if expression.Right == nil {
+		return nil, p.errorf("expected expression after %q", expression.Operator.Literal)
+	}
 
-	return expression, nil
+	return bind(left, expression.Operator, expression.Right), nil
+}
+
+// bind returns the infix expression of left, op and right. The right
+// operand is parsed together with the rest of the expression, so it is
+// rotated until operators bind by precedence and associate to the left.
+func bind(left ast.Expression, op token.Token, right ast.Expression) ast.Expression {
+	if infix, ok := right.(*ast.InfixExpression); ok && precedences[infix.Operator.Type] <= precedences[op.Type] {
+		infix.Left = bind(left, op, infix.Left)
+		return infix
+	}
+	return &ast.InfixExpression{Left: left, Operator: op, Right: right}
 }
 
 func (p *Parser) parseIfStatement() (*ast.IfStatement, error) {
 	var err error
-	p.enterControlStatement()
-	defer p.exitControlStatement()
-
 	stmt := &ast.IfStatement{Token: p.curToken}
 
+	// a brace after the condition starts the body rather than a struct
+	// literal
 	p.nextToken() // consume if
+	p.enterControlStatement()
 	stmt.Condition, err = p.parseExpression(LOWEST)
+	p.exitControlStatement()
 	if err != nil {
 		return nil, err
 	}
@@ -334,7 +400,7 @@ func (p *Parser) parseIfStatement() (*ast.IfStatement, error) {
 	}
 
 	if !p.expectCurrentTokenIs(token.LBRACE) {
-		return nil, p.error("expecting current token is a '{'", p.curToken.Literal, p.peekToken.Literal)
+		return nil, p.errorf("expected '{' after if condition, got %s instead", p.curToken.Literal)
 	}
 	stmt.Consequence, err = p.parseBlockStatement()
 	if err != nil {
@@ -347,6 +413,20 @@ func (p *Parser) parseIfStatement() (*ast.IfStatement, error) {
 		p.nextToken() // consume }
 		p.nextToken() // consume else
 
+		if p.curTokenIs(token.IF) {
+			// an else if is kept as an else block that only holds the
+			// nested if statement, which has consumed its own braces
+			nested, err := p.parseIfStatement()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Alternative = &ast.BlockStatement{
+				Token:      nested.Token,
+				Statements: []ast.Statement{nested},
+			}
+			return stmt, nil
+		}
+
 		if !p.expectCurrentTokenIs(token.LBRACE) {
 			return nil, p.error("expected left brace")
 		}
@@ -365,11 +445,24 @@ func (p *Parser) parseIfStatement() (*ast.IfStatement, error) {
 }
 
 func (p *Parser) enterControlStatement() {
-	p.controlDepth++
+	p.controls = append(p.controls, control{kind: controlCondition})
 }
 
 func (p *Parser) exitControlStatement() {
-	p.controlDepth--
+	p.controls = p.controls[:len(p.controls)-1]
+}
+
+// enclosingLoops returns the labels of the loops around the statement
+// being parsed in its function, innermost first, with "" for a loop
+// without one.
+func (p *Parser) enclosingLoops() []string {
+	var labels []string
+	for i := len(p.controls) - 1; i >= 0 && p.controls[i].kind != controlFunction; i-- {
+		if p.controls[i].kind == controlLoop {
+			labels = append(labels, p.controls[i].label)
+		}
+	}
+	return labels
 }
 
 func (p *Parser) parseBlockStatement() (*ast.BlockStatement, error) {
@@ -380,9 +473,11 @@ func (p *Parser) parseBlockStatement() (*ast.BlockStatement, error) {
 		p.nextToken() // consume LBRACE
 	}
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		start := p.curToken
 		stmt, err := p.parseStatement()
 		if err != nil {
-			return nil, err
+			p.recoverFrom(err, start)
+			continue
 		}
 		if p.curTokenIs(token.RPAREN) {
 			p.nextToken()
@@ -391,6 +486,9 @@ func (p *Parser) parseBlockStatement() (*ast.BlockStatement, error) {
 			block.Statements = append(block.Statements, stmt)
 		}
 	}
+	if p.curTokenIs(token.RBRACE) {
+		block.Rbrace = p.curToken
+	}
 
 	return block, nil
 }
@@ -428,9 +526,6 @@ func (p *Parser) parseDeferStatement() (*ast.DeferStatement, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	p.deferStack = append(p.deferStack, deferStmt.Statement)
-
 	return deferStmt, nil
 }
 
@@ -438,7 +533,6 @@ func (p *Parser) parseAssignmentExpression(left ast.Expression) (ast.Expression,
 	var err error
 	p.trace("parse assignment", p.curToken.Literal, p.peekToken.Literal)
 
-	println(p.curToken.Literal, p.curTokenIs(token.INFER))
 	if _, ok := left.(*ast.Identifier); !ok {
 		return nil, p.error("left-hand side of assignment must be an identifier")
 	}
@@ -466,7 +560,7 @@ func (p *Parser) parseTypeBasedVariableDeclaration() (ast.Statement, error) {
 		}
 		p.nextToken() // consume identifier
 		p.nextToken() // consume INFER
-		decl.Value, err = p.parseExpression(LOWEST)
+		decl.Value, err = p.parseValue()
 		if err != nil {
 			return nil, err
 		}
@@ -496,9 +590,56 @@ func (p *Parser) parseTypeBasedVariableDeclaration() (ast.Statement, error) {
 
 	p.nextToken()
 	p.nextToken()
-	varDecl.Value, err = p.parseExpression(LOWEST)
+	varDecl.Value, err = p.parseValue()
+	if err != nil {
+		return nil, err
+	}
 
-	return varDecl, err
+	return varDecl, nil
+}
+
+func (p *Parser) parseDestructuringDeclaration() (ast.Statement, error) {
+	decl := &ast.DestructuringDeclaration{}
+	for {
+		if !p.isTypeToken(p.curToken) || !p.peekTokenIs(token.IDENTIFIER) {
+			return nil, p.error("expected a type and a name")
+		}
+		varType := p.curToken
+		p.nextToken()
+		decl.Vars = append(decl.Vars, &ast.VariableDeclaration{
+			Type: varType,
+			Name: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal},
+		})
+		p.nextToken()
+		if p.curTokenIs(token.ASSIGN) {
+			break
+		}
+		if !p.curTokenIs(token.COMMA) {
+			return nil, p.error("expected ',' or '=' after variable name")
+		}
+		p.nextToken()
+	}
+	p.nextToken() // consume '='
+
+	var err error
+	decl.Value, err = p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return decl, nil
+}
+
+// parseValue parses the expression on the right hand side of an assignment.
+func (p *Parser) parseValue() (ast.Expression, error) {
+	start := p.curToken
+	value, err := p.parseExpression(LOWEST)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, p.errorAt(start, "expected expression, found %q", start.Literal)
+	}
+	return value, nil
 }
 
 func (p *Parser) inferType(value ast.Expression) token.Type {
@@ -516,21 +657,100 @@ func (p *Parser) inferType(value ast.Expression) token.Type {
 	}
 }
 
-func (p *Parser) parseForStatement() (*ast.ForStatement, error) {
+// typeName returns the type a type token refers to. User defined types are
+// identified by their name rather than the IDENTIFIER token type.
+func (p *Parser) typeName(t token.Token) token.Type {
+	if t.Type == token.IDENTIFIER {
+		return token.Type(t.Literal)
+	}
+	return t.Type
+}
+
+// parseLabeledLoop parses a loop named by a label, such as
+// `outer: for i in 0..n { }`, that break and continue in it can name.
+func (p *Parser) parseLabeledLoop() (ast.Statement, error) {
+	label := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if slices.Contains(p.enclosingLoops(), label.Value) {
+		p.addError(p.errorf("loop label %s is already in use", label.Value))
+	}
+	p.nextToken() // consume the label
+	p.nextToken() // consume ':'
+	return p.parseLoop(label)
+}
+
+func (p *Parser) parseLoop(label *ast.Identifier) (ast.Statement, error) {
+	if p.isForIn() {
+		return p.parseForInStatement(label)
+	}
+	return p.parseForStatement(label)
+}
+
+// parseLoopBody parses the body of a loop, in which break and continue can
+// name the loop's label.
+func (p *Parser) parseLoopBody(label *ast.Identifier) (*ast.BlockStatement, error) {
+	loop := control{kind: controlLoop}
+	if label != nil {
+		loop.label = label.Value
+	}
+	p.controls = append(p.controls, loop)
+	defer p.exitControlStatement()
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseForStatement(label *ast.Identifier) (*ast.ForStatement, error) {
 	var err error
 	p.trace("parsing for statement", p.curToken.Literal, p.peekToken.Literal)
 
-	stmt := &ast.ForStatement{Token: p.curToken}
+	stmt := &ast.ForStatement{Token: p.curToken, Label: label}
 
 	p.nextToken() // consume for
 
+	// `for { }` loops until it is left and `for cond { }` only has a
+	// condition
+	if !p.curTokenIs(token.LBRACE) && !p.hasLoopClauses() {
+		p.trace("parsing for loop condition expression", p.curToken.Literal, p.peekToken.Literal)
+		p.enterControlStatement()
+		stmt.Condition, err = p.parseExpression(LOWEST)
+		p.exitControlStatement()
+		if err != nil {
+			return nil, err
+		}
+		if stmt.Condition == nil {
+			return nil, p.error("expected condition expression in for loop")
+		}
+	} else if !p.curTokenIs(token.LBRACE) {
+		if err := p.parseLoopClauses(stmt); err != nil {
+			return nil, err
+		}
+	}
+	if !p.curTokenIs(token.LBRACE) {
+		return nil, p.errorf("expected '{' after for statement, got %s instead", p.curToken.Literal)
+	}
+
+	stmt.Body, err = p.parseLoopBody(label)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.curTokenIs(token.RBRACE) {
+		p.trace("consuming right brace after for statement", p.curToken.Literal)
+		p.nextToken()
+	}
+
+	return stmt, nil
+}
+
+// parseLoopClauses parses the init statement, condition and post statement
+// of a for loop, leaving the parser at the body.
+func (p *Parser) parseLoopClauses(stmt *ast.ForStatement) error {
+	var err error
 	p.trace("parsing for loop init expression", p.curToken.Literal, p.peekToken.Literal)
 	stmt.Init, err = p.parseStatement()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	if stmt.Init == nil {
-		return nil, p.error("expected initialization statement in for loop")
+		return p.error("expected initialization statement in for loop")
 	}
 
 	if p.curTokenIs(token.SEMICOLON) {
@@ -542,10 +762,10 @@ func (p *Parser) parseForStatement() (*ast.ForStatement, error) {
 	p.trace("parsing for loop condition expression", p.curToken.Literal, p.peekToken.Literal)
 	stmt.Condition, err = p.parseExpression(LOWEST)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	if stmt.Condition == nil {
-		return nil, p.error("expected condition expression in for loop")
+		return p.error("expected condition expression in for loop")
 	}
 
 	if p.curTokenIs(token.RPAREN) { // might need to remove this
@@ -561,45 +781,162 @@ func (p *Parser) parseForStatement() (*ast.ForStatement, error) {
 	if !p.curTokenIs(token.LBRACE) {
 		stmt.Post, err = p.parseStatement()
 		if err != nil {
-			return nil, err
+			return err
+		}
+	}
+	return nil
+}
+
+// parseForInStatement parses a loop such as `for i, name in names { }` or
+// `for i in 0..n { }`, leaving the parser after its body.
+func (p *Parser) parseForInStatement(label *ast.Identifier) (*ast.ForInStatement, error) {
+	stmt := &ast.ForInStatement{Token: p.curToken, Label: label}
+	p.nextToken() // consume for
+
+	for {
+		stmt.Vars = append(stmt.Vars, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+		p.nextToken() // consume the variable
+		if !p.curTokenIs(token.COMMA) {
+			break
 		}
+		p.nextToken() // consume ','
 	}
+	p.nextToken() // consume in
 
-	stmt.Body, err = p.parseBlockStatement()
+	// a brace after the iterable starts the body rather than a struct
+	// literal
+	p.enterControlStatement()
+	iterable, err := p.parseExpression(LOWEST)
+	if err == nil && iterable != nil && p.curTokenIs(token.RANGE) {
+		rng := &ast.RangeExpression{Token: p.curToken, Low: iterable}
+		p.nextToken() // consume ..
+		rng.High, err = p.parseExpression(LOWEST)
+		iterable = rng
+		if err == nil && rng.High == nil {
+			err = p.error("expected the end of the range")
+		}
+	}
+	p.exitControlStatement()
 	if err != nil {
 		return nil, err
 	}
+	if iterable == nil {
+		return nil, p.error("expected a list, a string, a map or a range to iterate over")
+	}
+	stmt.Iterable = iterable
 
+	if !p.expectCurrentTokenIs(token.LBRACE) {
+		return nil, p.errorf("expected '{' after for statement, got %s instead", p.curToken.Literal)
+	}
+	stmt.Body, err = p.parseLoopBody(label)
+	if err != nil {
+		return nil, err
+	}
 	if p.curTokenIs(token.RBRACE) {
-		p.trace("consuming right brace after for statement", p.curToken.Literal)
 		p.nextToken()
 	}
-	// if !p.curTokenIs(token.LBRACE) {
-	// 	p.nextToken()
-	// }
+	return stmt, nil
+}
 
+func (p *Parser) parseBreakStatement() (*ast.BreakStatement, error) {
+	stmt := &ast.BreakStatement{Token: p.curToken}
+	stmt.Label = p.parseBranchLabel()
 	return stmt, nil
 }
 
-func (p *Parser) parseIndexExpression(left ast.Expression) (ast.Expression, error) {
-	indexExp := &ast.IndexExpression{
-		Token: p.curToken,
-		Left:  left,
+func (p *Parser) parseContinueStatement() (*ast.ContinueStatement, error) {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+	stmt.Label = p.parseBranchLabel()
+	return stmt, nil
+}
+
+// parseBranchLabel parses the label after break or continue, if there is
+// one, and reports a branch that is not in a loop or names no loop around
+// it. The statement is kept either way.
+func (p *Parser) parseBranchLabel() *ast.Identifier {
+	branch := p.curToken
+	p.nextToken() // consume break or continue
+
+	// the label is on the same line so that a statement after the branch
+	// is not taken for one
+	var label *ast.Identifier
+	if p.curTokenIs(token.IDENTIFIER) && p.curToken.Position.Line == branch.Position.Line {
+		label = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		p.nextToken() // consume the label
+	}
+	if p.curTokenIs(token.SEMICOLON) {
+		p.nextToken()
 	}
 
-	p.nextToken() // consume the identifier
-	p.nextToken() // consume '['
+	loops := p.enclosingLoops()
+	switch {
+	case len(loops) == 0:
+		p.addError(p.errorAt(branch, "%s is not in a loop", branch.Literal))
+	case label != nil && !slices.Contains(loops, label.Value):
+		p.addError(p.errorAt(label.Token, "no loop labeled %s around this %s", label.Value, branch.Literal))
+	}
+	return label
+}
+
+// parseIndexAssignment parses the value stored by left[index] = value.
+func (p *Parser) parseIndexAssignment(left *ast.IndexExpression) (ast.Expression, error) {
+	assignment := &ast.IndexAssignment{Token: p.curToken, Left: left}
+	p.nextToken() // consume '='
 
-	index, err := p.parseExpression(LOWEST)
+	right, err := p.parseValue()
 	if err != nil {
 		return nil, err
 	}
-	indexExp.Index = index
+	assignment.Right = right
+	return assignment, nil
+}
+
+// parseIndexExpression parses left[index] and the slice left[low:high],
+// where either bound may be left out.
+func (p *Parser) parseIndexExpression(left ast.Expression) (ast.Expression, error) {
+	p.nextToken() // consume the identifier
+	lbracket := p.curToken
+	p.nextToken() // consume '['
+
+	var index ast.Expression
+	if !p.curTokenIs(token.COLON) {
+		var err error
+		index, err = p.parseExpression(LOWEST)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	if !p.expectCurrentTokenIs(token.RBRACKET) {
-		return nil, p.error("expected ']' after index expression")
+	var expr ast.Expression
+	if p.curTokenIs(token.COLON) {
+		slice := &ast.SliceExpression{Token: lbracket, Left: left, Low: index}
+		p.nextToken() // consume ':'
+		if !p.curTokenIs(token.RBRACKET) {
+			high, err := p.parseExpression(LOWEST)
+			if err != nil {
+				return nil, err
+			}
+			slice.High = high
+		}
+		if !p.expectCurrentTokenIs(token.RBRACKET) {
+			return nil, p.error("expected ']' after slice expression")
+		}
+		slice.Rbracket = p.curToken
+		expr = slice
+	} else {
+		if !p.expectCurrentTokenIs(token.RBRACKET) {
+			return nil, p.error("expected ']' after index expression")
+		}
+		expr = &ast.IndexExpression{Token: lbracket, Left: left, Index: index, Rbracket: p.curToken}
 	}
 	p.nextToken()
 
-	return indexExp, nil
+	expr, err := p.parseCalls(expr)
+	if err != nil {
+		return nil, err
+	}
+	if p.isBinaryOperator(p.curToken) {
+		return p.parseInfixExpression(expr)
+	}
+	return expr, nil
 }
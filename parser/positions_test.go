@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/lexer"
+)
+
+func TestNodePositions(t *testing.T) {
+	source := `pkg main
+
+struct point {
+  i32 x
+}
+
+fn main() {
+  point p = point {
+    x: 1,
+  }
+  println(p.x + 2)
+  return
+}
+`
+	p := New(lexer.New("main.pun", source))
+	program, err := p.ParseProgram("main.pun")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	text := func(n ast.Node) string {
+		return source[n.Pos().Offset:n.End().Offset]
+	}
+
+	stmts := program.Files[0].Statements
+	structDef := stmts[0].(*ast.StructDefinition)
+	fn := stmts[1].(*ast.FunctionStatement)
+	decl := fn.Body.Statements[0].(*ast.VariableDeclaration)
+	call := fn.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionCall)
+	sum := call.Arguments[0].(*ast.InfixExpression)
+	ret := fn.Body.Statements[2].(*ast.ReturnStatement)
+
+	tests := []struct {
+		node ast.Node
+		want string
+	}{
+		{structDef, "struct point {\n  i32 x\n}"},
+		{decl, "point p = point {\n    x: 1,\n  }"},
+		{decl.Value, "point {\n    x: 1,\n  }"},
+		{call, "println(p.x + 2)"},
+		{sum, "p.x + 2"},
+		{sum.Left, "p.x"},
+		{ret, "return"},
+		{fn.Body, "{\n  point p = point {\n    x: 1,\n  }\n  println(p.x + 2)\n  return\n}"},
+	}
+	for _, tt := range tests {
+		if got := text(tt.node); got != tt.want {
+			t.Errorf("%T: got %q, want %q", tt.node, got, tt.want)
+		}
+	}
+
+	if fn.Pos().Line != 7 || fn.Pos().Column != 1 {
+		t.Errorf("function starts at %s, want 7:1", fn.Pos())
+	}
+
+	json, err := program.JSON()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(json, `"Pos":{"Filename":"main.pun","Offset":10,"Line":3,"Column":1}`) {
+		t.Errorf("expected the struct definition span in the JSON, got %s", json)
+	}
+}
+
+func TestImportPositions(t *testing.T) {
+	source := `pkg main
+import "math"
+import (
+  "geo/shapes"
+)
+`
+	p := New(lexer.New("main.pun", source))
+	program, err := p.ParseProgram("main.pun")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	imports := program.Files[0].Imports
+	if len(imports) != 2 {
+		t.Fatalf("expected 2 imports, got %d", len(imports))
+	}
+	for i, want := range []string{`"math"`, `"geo/shapes"`} {
+		imp := imports[i]
+		if got := source[imp.Pos().Offset:imp.End().Offset]; got != want {
+			t.Errorf("import %d: got %q, want %q", i, got, want)
+		}
+		if imp.String() != want {
+			t.Errorf("import %d: String() = %q, want %q", i, imp.String(), want)
+		}
+	}
+}
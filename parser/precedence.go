@@ -6,7 +6,8 @@ import "github.com/dfirebaugh/punch/token"
 const (
 	_ int = iota
 	LOWEST
-	COND         // OR or AND
+	OR           // ||
+	AND          // &&
 	ASSIGN       // =
 	TERNARY      // ? :
 	EQUALS       // == or !=
@@ -43,8 +44,8 @@ var precedences = map[token.Type]int{
 	token.ASTERISK:        PRODUCT,
 	token.ASTERISK_EQUALS: PRODUCT,
 	token.MOD:             MOD,
-	token.AND:             COND,
-	token.OR:              COND,
+	token.AND:             AND,
+	token.OR:              OR,
 	token.LPAREN:          CALL,
 	token.DOT:             CALL,
 	token.LBRACKET:        INDEX,
@@ -14,6 +14,7 @@ func (p *Parser) expectCurrentTokenIs(expectedType token.Type) bool {
 // peekTokenAfter checks if the token after the expectedType token is of a specific type.
 // It temporarily advances the parser to check the token and then restores the parser's state.
 func (p *Parser) peekTokenAfter(expectedType token.Type) bool {
+	prevToken := p.prevToken
 	curToken := p.curToken
 	peekToken := p.peekToken
 	p.l.SaveState()
@@ -21,6 +22,29 @@ func (p *Parser) peekTokenAfter(expectedType token.Type) bool {
 	p.nextToken()
 	result := p.peekToken.Type == expectedType
 
+	p.prevToken = prevToken
+	p.curToken = curToken
+	p.peekToken = peekToken
+
+	p.l.RestoreState()
+	return result
+}
+
+// tokenAhead returns the token n tokens after the current one, so
+// tokenAhead(1) is the peek token. Like peekTokenAfter it restores the
+// parser's state afterwards.
+func (p *Parser) tokenAhead(n int) token.Token {
+	prevToken := p.prevToken
+	curToken := p.curToken
+	peekToken := p.peekToken
+	p.l.SaveState()
+
+	for i := 1; i < n; i++ {
+		p.nextToken()
+	}
+	result := p.peekToken
+
+	p.prevToken = prevToken
 	p.curToken = curToken
 	p.peekToken = peekToken
 
@@ -39,15 +63,117 @@ func (p *Parser) peekTokenIs(t token.Type) bool {
 }
 
 func (p *Parser) isFunctionDeclaration() bool {
-	return p.curTokenIs(token.FN) || p.curTokenIs(token.PUB) && p.isTypeToken(p.peekToken) && p.peekTokenAfter(token.IDENTIFIER) || p.isTypeToken(p.curToken) && p.peekTokenIs(token.IDENTIFIER) && p.peekTokenAfter(token.LPAREN)
+	return p.curTokenIs(token.FN) || p.isResultList() || p.curTokenIs(token.PUB) && p.isTypeToken(p.peekToken) && p.peekTokenAfter(token.IDENTIFIER) || p.isTypeToken(p.curToken) && p.peekTokenIs(token.IDENTIFIER) && p.peekTokenAfter(token.LPAREN) || p.isMethodDeclaration()
+}
+
+// isMethodDeclaration reports whether the current tokens start a method such
+// as `i32 (rect r) area()`, where the receiver follows the return type.
+func (p *Parser) isMethodDeclaration() bool {
+	return p.isTypeToken(p.curToken) && p.peekTokenIs(token.LPAREN) && p.peekTokenAfter(token.IDENTIFIER)
+}
+
+// isFunctionType reports whether the current tokens start a function type
+// such as `fn(i32) i32`. A method such as `fn (rect r) area()` also starts
+// with `fn (` but names its receiver after the receiver's type.
+func (p *Parser) isFunctionType() bool {
+	if !p.curTokenIs(token.FUNCTION) || !p.peekTokenIs(token.LPAREN) {
+		return false
+	}
+	return p.tokenAhead(2).Type == token.RPAREN || p.tokenAhead(3).Type != token.IDENTIFIER
+}
+
+// isMapType reports whether the current tokens start a map type such as
+// `map[str]i32`.
+func (p *Parser) isMapType() bool {
+	return p.curTokenIs(token.MAP) && p.peekTokenIs(token.LBRACKET)
+}
+
+// isHashLiteral reports whether the current tokens start a map literal such
+// as `{"a": 1}`, whose first key is followed by a colon.
+func (p *Parser) isHashLiteral() bool {
+	return p.curTokenIs(token.LBRACE) && p.tokenAhead(2).Type == token.COLON
+}
+
+// isForIn reports whether the current tokens start a loop over a list, a
+// string, a map or a range, such as `for i, name in names`.
+func (p *Parser) isForIn() bool {
+	if !p.curTokenIs(token.FOR) || !p.peekTokenIs(token.IDENTIFIER) {
+		return false
+	}
+	if isIn(p.tokenAhead(2)) {
+		return true
+	}
+	return p.tokenAhead(2).Type == token.COMMA && p.tokenAhead(3).Type == token.IDENTIFIER && isIn(p.tokenAhead(4))
+}
+
+// hasLoopClauses reports whether the header of the for loop that starts at
+// the current token has init and post statements, as in
+// `for i := 0; i < n; i = i + 1 { }`, rather than only a condition. Like
+// tokenAhead it restores the parser's state afterwards.
+func (p *Parser) hasLoopClauses() bool {
+	prevToken := p.prevToken
+	curToken := p.curToken
+	peekToken := p.peekToken
+	p.l.SaveState()
+
+	result := false
+	depth := 0
+	for !p.curTokenIs(token.EOF) {
+		switch p.curToken.Type {
+		case token.LPAREN, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACKET:
+			depth--
+		case token.SEMICOLON:
+			result = depth == 0
+		}
+		if result || depth == 0 && p.curTokenIs(token.LBRACE) {
+			break
+		}
+		p.nextToken()
+	}
+
+	p.prevToken = prevToken
+	p.curToken = curToken
+	p.peekToken = peekToken
+
+	p.l.RestoreState()
+	return result
+}
+
+// isIn reports whether a token is the `in` of a for in loop. It is not a
+// keyword, so that it can still name variables and fields.
+func isIn(t token.Token) bool {
+	return t.Type == token.IDENTIFIER && t.Literal == "in"
+}
+
+// isLabeledLoop reports whether the current tokens start a loop named by a
+// label, such as `outer: for`.
+func (p *Parser) isLabeledLoop() bool {
+	return p.curTokenIs(token.IDENTIFIER) && p.peekTokenIs(token.COLON) && p.tokenAhead(2).Type == token.FOR
+}
+
+// isResultList reports whether the current tokens start the result types of
+// a function that returns several values, such as `(i32, bool)`.
+func (p *Parser) isResultList() bool {
+	return p.curTokenIs(token.LPAREN) && p.isTypeToken(p.peekToken) && p.peekTokenAfter(token.COMMA)
+}
+
+// isDestructuringDeclaration reports whether the current tokens start a
+// declaration of several variables such as `i32 s, bool eq = add_eq(a, b)`.
+func (p *Parser) isDestructuringDeclaration() bool {
+	return p.isTypeToken(p.curToken) && p.peekTokenIs(token.IDENTIFIER) && p.peekTokenAfter(token.COMMA)
 }
 
 func (p *Parser) isVariableDeclaration() bool {
 	return p.isTypeToken(p.curToken) && p.peekTokenIs(token.IDENTIFIER) && p.peekTokenAfter(token.ASSIGN)
 }
 
+// isInControlStatement reports whether the expression being parsed is the
+// condition of an if or the header of a loop, where a brace starts the
+// body. The body of a function literal in the condition starts afresh.
 func (p *Parser) isInControlStatement() bool {
-	return p.controlDepth > 0
+	return len(p.controls) > 0 && p.controls[len(p.controls)-1].kind == controlCondition
 }
 
 func (p *Parser) isTypeToken(t token.Token) bool {
@@ -111,6 +237,18 @@ func (p *Parser) isNumber() bool {
 	return p.curTokenIs(token.NUMBER) || p.curTokenIs(token.FLOAT)
 }
 
+// isConversion reports whether the current token starts a conversion to a
+// numeric type, e.g. f64(n).
+func (p *Parser) isConversion() bool {
+	switch p.curToken.Type {
+	case token.U8, token.U16, token.U32, token.U64,
+		token.I8, token.I16, token.I32, token.I64,
+		token.F32, token.F64:
+		return p.peekTokenIs(token.LPAREN)
+	}
+	return false
+}
+
 func (p *Parser) isIndexExpression() bool {
 	return p.curTokenIs(token.IDENTIFIER) && p.peekTokenIs(token.LBRACKET)
 }
@@ -30,6 +30,7 @@ func (p *Parser) parseStructDefinition() (*ast.StructDefinition, error) {
 		return nil, p.error("expected '}' after struct fields")
 	}
 	p.nextToken()
+	structDef.Rbrace = p.curToken
 
 	p.definedTypes[structDef.Name.Value] = true
 	p.structDefinitions[structDef.Name.Value] = structDef
@@ -41,16 +42,19 @@ func (p *Parser) parseStructField() (*ast.StructField, error) {
 	if p.curTokenIs(token.LBRACE) {
 		p.nextToken()
 	}
-	if !p.expectPeek(token.IDENTIFIER) {
-		return nil, p.error("expected identifier")
+	typ, err := p.parseType()
+	if err != nil {
+		return nil, err
 	}
-	field := &ast.StructField{
-		Token: p.peekToken,
-		Name:  &ast.Identifier{Token: p.peekToken, Value: p.peekToken.Literal},
-		Type:  p.curToken.Type,
+	if !p.expectCurrentTokenIs(token.IDENTIFIER) {
+		return nil, p.errorf("expected a field name after %s, got %s instead", typ.Literal, p.curToken.Literal)
 	}
-	p.nextToken()
-	return field, nil
+	// the name is the last token of the field
+	return &ast.StructField{
+		Token: p.curToken,
+		Name:  &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal},
+		Type:  p.typeName(typ),
+	}, nil
 }
 
 func (p *Parser) parseStructFields() ([]*ast.StructField, error) {
@@ -132,13 +136,16 @@ func (p *Parser) parseStructLiteral() (ast.Expression, error) {
 
 		p.nextToken()
 	}
+	if p.curTokenIs(token.RBRACE) {
+		structLit.Rbrace = p.curToken
+	}
 	p.nextToken()
 	return structLit, nil
 }
 
 func (p *Parser) parseStructFieldAccess(left ast.Expression) (ast.Expression, error) {
-	if !p.expectCurrentTokenIs(token.DOT) {
-		p.error("expected a dot, but got: ", p.curToken.Literal)
+	if !p.expectPeek(token.DOT) {
+		return nil, p.errorf("expected '.' before field name, got %s instead", p.peekToken.Literal)
 	}
 	p.nextToken() // consume the dot
 
@@ -154,9 +161,15 @@ func (p *Parser) parseStructFieldAccess(left ast.Expression) (ast.Expression, er
 
 	p.nextToken() // consume the field identifier
 
+	if p.peekTokenIs(token.LPAREN) {
+		return p.parseMethodCall(fieldAccess)
+	}
 	if p.peekTokenIs(token.DOT) {
 		return p.parseStructFieldAccess(fieldAccess)
 	}
+	if p.peekTokenIs(token.LBRACKET) {
+		return p.parseIndexExpression(fieldAccess)
+	}
 	if p.isBinaryOperator(p.peekToken) {
 		p.nextToken()
 		return p.parseInfixExpression(fieldAccess)
@@ -165,10 +178,25 @@ func (p *Parser) parseStructFieldAccess(left ast.Expression) (ast.Expression, er
 	return fieldAccess, nil
 }
 
+// parseMethodCall parses the arguments of a call such as `r.area()`, where the
+// current token is the method name.
+func (p *Parser) parseMethodCall(method *ast.StructFieldAccess) (ast.Expression, error) {
+	call, err := p.parseFunctionCall(method)
+	if err != nil {
+		return nil, err
+	}
+	call.(*ast.FunctionCall).FunctionName = method.Field.Value
+
+	if p.isBinaryOperator(p.curToken) {
+		return p.parseInfixExpression(call)
+	}
+	return call, nil
+}
+
 func (p *Parser) parseStructFieldAssignment(left ast.Expression) (ast.Expression, error) {
 	tok := p.curToken
 	if !p.curTokenIs(token.ASSIGN) {
-		p.error("we were expecting an assignment operator, but got: ", p.curToken.Literal)
+		return nil, p.errorf("expected '=' after struct field, got %s instead", p.curToken.Literal)
 	}
 	p.nextToken()
 
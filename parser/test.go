@@ -0,0 +1,34 @@
+package parser
+
+import (
+	"github.com/dfirebaugh/punch/ast"
+	"github.com/dfirebaugh/punch/token"
+)
+
+// parseTestBlock parses a test such as
+//
+//	test "adds numbers" {
+//		assert(add(1, 2) == 3)
+//	}
+func (p *Parser) parseTestBlock() (*ast.TestBlock, error) {
+	test := &ast.TestBlock{Token: p.curToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil, p.error("expected test name")
+	}
+	p.nextToken()
+	test.Name = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil, p.error("expected '{' after test name")
+	}
+	p.nextToken()
+
+	body, err := p.parseBlockStatement()
+	if err != nil {
+		return nil, err
+	}
+	test.Body = body
+
+	return test, nil
+}
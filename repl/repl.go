@@ -5,6 +5,7 @@ import (
 	"io"
 	"strings"
 
+	"github.com/dfirebaugh/punch/checker"
 	"github.com/dfirebaugh/punch/emitters/wat"
 	"github.com/dfirebaugh/punch/lexer"
 	"github.com/dfirebaugh/punch/parser"
@@ -80,9 +81,20 @@ func (repl *REPL) handleLine(line string) bool {
 		}
 		println(json)
 
+		checked, err := checker.Check(program)
+		if err != nil {
+			println(err.Error())
+			return true
+		}
+
 		println("")
 		println("wat:")
-		println(wat.GenerateWAT(program, true))
+		watCode, err := wat.NewGenerator(wat.Options{MemoryManagement: true}).Generate(checked)
+		if err != nil {
+			println(err.Error())
+			return true
+		}
+		println(watCode)
 	}
 	return true
 }
@@ -10,6 +10,8 @@ type Token struct {
 	Type     Type
 	Literal  string
 	Position scanner.Position
+	// End is the position immediately after the token.
+	End scanner.Position
 }
 
 type TokenCollector interface {
@@ -61,6 +63,7 @@ const (
 	COLON     = ":"
 	SEMICOLON = ";"
 	DOT       = "."
+	RANGE     = ".."
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -76,6 +79,8 @@ const (
 	LET       = "LET"
 	RETURN    = "RETURN"
 	FOR       = "FOR"
+	BREAK     = "BREAK"
+	CONTINUE  = "CONTINUE"
 	IF        = "IF"
 	ELSE      = "ELSE"
 	PUB       = "PUB"
@@ -86,6 +91,7 @@ const (
 	TEST      = "TEST"
 	ENUM      = "ENUM"
 	DEFER     = "DEFER"
+	MAP       = "MAP"
 	APPEND    = "APPEND"
 	LEN       = "LEN"
 
@@ -119,11 +125,15 @@ var Keywords = map[Type]string{
 	FN:        "fn",
 	ENUM:      "enum",
 	RETURN:    "return",
+	DEFER:     "defer",
+	MAP:       "map",
 	CONST:     "const",
 	LET:       "let",
 	IF:        "if",
 	ELSE:      "else",
 	FOR:       "for",
+	BREAK:     "break",
+	CONTINUE:  "continue",
 	TRUE:      "true",
 	FALSE:     "false",
 	PUB:       "pub",
@@ -30,8 +30,10 @@ func (t Token) IsFloat() bool {
 	return err == nil
 }
 
+// IsNumber reports whether the token is an integer that fits in 64 bits,
+// signed or not.
 func (t Token) IsNumber() bool {
-	_, err := strconv.Atoi(t.Literal)
+	_, err := strconv.ParseUint(t.Literal, 10, 64)
 	return err == nil
 }
 
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 
+	"github.com/dfirebaugh/punch/checker"
 	"github.com/dfirebaugh/punch/emitters/js"
 	"github.com/dfirebaugh/punch/emitters/wat"
 	"github.com/dfirebaugh/punch/lexer"
@@ -108,9 +109,23 @@ func watHandler(w http.ResponseWriter, r *http.Request) {
 	l := lexer.New("example", requestBody.Source)
 	p := parser.New(l)
 
-	program, _ := p.ParseProgram("ast_explorer")
+	program, err := p.ParseProgram("ast_explorer")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	watCode := wat.GenerateWAT(program, true)
+	checked, err := checker.Check(program)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	watCode, err := wat.NewGenerator(wat.Options{MemoryManagement: true}).Generate(checked)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	w.Header().Set("Content-Type", "text/plain")
 	w.Write([]byte(watCode))
@@ -140,12 +155,22 @@ func jsHandler(w http.ResponseWriter, r *http.Request) {
 	l := lexer.New("example", requestBody.Source)
 	p := parser.New(l)
 
-	program, _ := p.ParseProgram("ast_explorer")
+	program, err := p.ParseProgram("ast_explorer")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	checked, err := checker.Check(program)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	t := js.NewTranspiler()
-	jsCode, err := t.Transpile(program)
+	jsCode, err := t.Transpile(checked)
 	if err != nil {
-		http.Error(w, "Failed to transpile to JS", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -1,4 +1,13 @@
-export const renderJSON = (data, container) => {
+const hasSpan = (value) =>
+  typeof value === "object" &&
+  value !== null &&
+  value.Pos &&
+  value.End &&
+  value.Pos.Line > 0;
+
+// onSelect is called with a node when its key is clicked, so the caller can
+// highlight the source the node came from.
+export const renderJSON = (data, container, onSelect) => {
   Object.entries(data).forEach(([key, value]) => {
     const containerItem = document.createElement("div");
     containerItem.classList.add("json-item");
@@ -19,6 +28,9 @@ export const renderJSON = (data, container) => {
     keyElement.addEventListener("click", () => {
       const isCollapsed = containerItem.classList.toggle("collapsed");
       toggleButton.textContent = isCollapsed ? "+" : "-";
+      if (onSelect && hasSpan(value)) {
+        onSelect(value);
+      }
     });
 
     const valueElement = document.createElement("div");
@@ -46,7 +58,7 @@ export const renderJSON = (data, container) => {
       valueElement.appendChild(bracketOpen);
       const nestedContainer = document.createElement("div");
       nestedContainer.style.marginLeft = "20px";
-      renderJSON(value, nestedContainer);
+      renderJSON(value, nestedContainer, onSelect);
       valueElement.appendChild(nestedContainer);
       valueElement.appendChild(bracketClose);
 
@@ -34,6 +34,10 @@ const highlightCode = (startLine, startCol, endLine, endCol) => {
   editor.markText(from, to, { className: "highlighted" });
 };
 
+export const highlightNode = (node) => {
+  highlightCode(node.Pos.Line, node.Pos.Column, node.End.Line, node.End.Column);
+};
+
 export const fetchAndRenderAST = () => {
   const source = editor.getValue().trim();
 
@@ -54,7 +58,7 @@ export const fetchAndRenderAST = () => {
       const outputElement = document.getElementById("output");
       outputElement.innerHTML = "";
 
-      renderJSON(ast, outputElement);
+      renderJSON(ast, outputElement, highlightNode);
     })
     .catch((error) => {
       const outputElement = document.getElementById("output");
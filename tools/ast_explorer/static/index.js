@@ -1,4 +1,4 @@
-import { editor } from "./editor.js";
+import { editor, highlightNode } from "./editor.js";
 import { renderJSON } from "./ast.js";
 import { snippets } from "./examples.js";
 
@@ -84,7 +84,7 @@ document.addEventListener("DOMContentLoaded", () => {
           const ast = parse(source);
           const outputElement = document.getElementById("output");
           outputElement.innerHTML = "";
-          renderJSON(JSON.parse(ast), outputElement);
+          renderJSON(JSON.parse(ast), outputElement, highlightNode);
         } catch (error) {
           handleWasmError(error);
         }
@@ -208,7 +208,7 @@ document.addEventListener("DOMContentLoaded", () => {
               const ast = parse(source);
               const outputElement = document.getElementById("output");
               outputElement.innerHTML = "";
-              renderJSON(JSON.parse(ast), outputElement);
+              renderJSON(JSON.parse(ast), outputElement, highlightNode);
               break;
             case "lex":
               const tokens = lex(source);
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"syscall/js"
 
+	"github.com/dfirebaugh/punch/checker"
 	js_gen "github.com/dfirebaugh/punch/emitters/js"
 	"github.com/dfirebaugh/punch/emitters/wat"
 	"github.com/dfirebaugh/punch/lexer"
@@ -74,9 +75,18 @@ func generateWAT(this js.Value, p []js.Value) interface{} {
 	program, err := parser.ParseProgram("ast_explorer")
 	if err != nil {
 		logrus.Error(err)
+		return err.Error()
 	}
 
-	watCode := wat.GenerateWAT(program, true)
+	checked, err := checker.Check(program)
+	if err != nil {
+		return err.Error()
+	}
+
+	watCode, err := wat.NewGenerator(wat.Options{MemoryManagement: true}).Generate(checked)
+	if err != nil {
+		return err.Error()
+	}
 	return watCode
 }
 
@@ -92,10 +102,20 @@ func generateJS(this js.Value, p []js.Value) interface{} {
 	program, err := parser.ParseProgram("ast_explorer")
 	if err != nil {
 		logrus.Error(err)
+		return map[string]interface{}{
+			"error": fmt.Sprintf("Failed to parse program: %v", err),
+		}
+	}
+
+	checked, err := checker.Check(program)
+	if err != nil {
+		return map[string]interface{}{
+			"error": fmt.Sprintf("Failed to check program: %v", err),
+		}
 	}
 
 	t := js_gen.NewTranspiler()
-	jsCode, err := t.Transpile(program)
+	jsCode, err := t.Transpile(checked)
 	if err != nil {
 		return map[string]interface{}{
 			"error": fmt.Sprintf("Failed to transpile to JS: %v", err),